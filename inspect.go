@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/mesosphere/mesos-dns/resolver"
+)
+
+// inspectFlags adds the flags the records, resolve and export-zone
+// subcommands share to fs, the configuration file is only read without
+// -api
+func inspectFlags(fs *flag.FlagSet, o *resolver.InspectOptions) *string {
+	cjson := new(string)
+	fs.StringVar(&o.API, "api", "", "HTTP API of a running instance, e.g. http://localhost:8123, instead of generating the records once")
+	fs.StringVar(&o.Token, "token", os.Getenv("MESOS_DNS_ADMIN_TOKEN"), "admin token for -api, defaults to $MESOS_DNS_ADMIN_TOKEN")
+	fs.DurationVar(&o.Timeout, "timeout", 10*time.Second, "timeout of the requests to -api")
+	fs.StringVar(cjson, "config", "config.json", "location of configuration file (json)")
+	fs.StringVar(cjson, "j", "config.json", "shorthand for -config")
+	return cjson
+}
+
+// loadInspected reads the configuration when o generates the records
+// itself
+func loadInspected(o *resolver.InspectOptions, cjson string) {
+	if o.API != "" {
+		return
+	}
+
+	logging.SetupLogs()
+	config, err := records.LoadConfig(cjson)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	o.Config = config
+}
+
+// recordsCmd runs the records subcommand: it prints every record a
+// running instance serves, or the ones the configuration generates
+func recordsCmd(args []string) {
+	var o resolver.InspectOptions
+
+	fs := flag.NewFlagSet("records", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mesos-dns records [flags]")
+		fs.PrintDefaults()
+	}
+	cjson := inspectFlags(fs, &o)
+	fs.StringVar(&o.Format, "format", "table", "output format: table or json")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	loadInspected(&o, *cjson)
+
+	if err := resolver.PrintRecords(os.Stdout, o); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// resolve runs the resolve subcommand: it answers a query for a name in
+// the Mesos domain as a running instance, or the configuration, would
+func resolve(args []string) {
+	var o resolver.InspectOptions
+
+	fs := flag.NewFlagSet("resolve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mesos-dns resolve [flags] <name> [type]")
+		fs.PrintDefaults()
+	}
+	cjson := inspectFlags(fs, &o)
+	fs.StringVar(&o.Format, "format", "table", "output format: table or json")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	qtype := "A"
+	if fs.NArg() == 2 {
+		qtype = fs.Arg(1)
+	}
+	loadInspected(&o, *cjson)
+
+	if err := resolver.PrintResolve(os.Stdout, o, fs.Arg(0), qtype); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// exportZone runs the export-zone subcommand: it prints every record a
+// running instance serves, or the ones the configuration generates, as a
+// zone file
+func exportZone(args []string) {
+	var o resolver.InspectOptions
+
+	fs := flag.NewFlagSet("export-zone", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mesos-dns export-zone [flags]")
+		fs.PrintDefaults()
+	}
+	cjson := inspectFlags(fs, &o)
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	loadInspected(&o, *cjson)
+
+	if err := resolver.PrintZone(os.Stdout, o); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
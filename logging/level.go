@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRaise is how long a level set at runtime lasts if not told
+const DefaultRaise = 10 * time.Minute
+
+var (
+	levelLock sync.Mutex
+	base      int
+	raised    = -1
+	until     time.Time
+	restore   *time.Timer
+)
+
+// SetLevel sets up the logs at the configured verbosity, 0 logs errors
+// only, 1 like -v and 2 like -vv, unless Raise set another level for now
+func SetLevel(level int) {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+
+	base = level
+	apply()
+}
+
+// Raise sets up the logs at level, usually a higher one while looking
+// into a problem, for d, and then back at the configured verbosity
+func Raise(level int, d time.Duration) {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+
+	if restore != nil {
+		restore.Stop()
+	}
+	raised, until = level, time.Now().Add(d)
+	restore = time.AfterFunc(d, Restore)
+	apply()
+}
+
+// Restore ends a Raise, the logs go back to the configured verbosity
+func Restore() {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+
+	if restore != nil {
+		restore.Stop()
+		restore = nil
+	}
+	raised, until = -1, time.Time{}
+	apply()
+}
+
+// Level returns the verbosity in use, the configured one and, if Raise
+// set the one in use, until when it lasts
+func Level() (current int, configured int, raisedUntil time.Time) {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+
+	if raised >= 0 {
+		return raised, base, until
+	}
+	return base, base, time.Time{}
+}
+
+// apply points the logs at the verbosity in use, it must be called with
+// levelLock held
+func apply() {
+	level := base
+	if raised >= 0 {
+		level = raised
+	}
+
+	VeryVerboseFlag = level >= 2
+	VerboseFlag = level == 1
+	SetupLogs()
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRaise(t *testing.T) {
+	defer SetLevel(0)
+	SetLevel(0)
+	if Verbose.Writer() != ioutil.Discard {
+		t.Error("expected quiet logs at level 0")
+	}
+
+	Raise(2, 50*time.Millisecond)
+	if current, configured, until := Level(); current != 2 || configured != 0 || until.IsZero() {
+		t.Errorf("expected level 2 for now, got %d %d %v", current, configured, until)
+	}
+	if !VeryVerboseFlag || VeryVerbose.Writer() == ioutil.Discard {
+		t.Error("expected very verbose logs while raised")
+	}
+
+	// the configured level changing doesn't end the raise
+	SetLevel(1)
+	if current, _, _ := Level(); current != 2 {
+		t.Errorf("expected level 2 to last, got %d", current)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if current, configured, until := Level(); current != 1 || configured != 1 || !until.IsZero() {
+		t.Errorf("expected the configured level 1 after the raise, got %d %d %v", current, configured, until)
+	}
+	if !VerboseFlag || VeryVerboseFlag {
+		t.Error("expected verbose logs at level 1")
+	}
+
+	Raise(2, time.Hour)
+	Restore()
+	if current, _, _ := Level(); current != 1 {
+		t.Errorf("expected level 1 after a restore, got %d", current)
+	}
+}
+
+func TestSetLevelKeepsLoggers(t *testing.T) {
+	defer SetLevel(0)
+	verbose, veryVerbose, errs := Verbose, VeryVerbose, Error
+
+	// other goroutines may be logging
+	SetLevel(2)
+	Raise(1, time.Hour)
+	Restore()
+	if Verbose != verbose || VeryVerbose != veryVerbose || Error != errs {
+		t.Error("expected the loggers to be kept across level changes")
+	}
+	if Verbose.Writer() == ioutil.Discard || VeryVerbose.Writer() == ioutil.Discard {
+		t.Error("expected very verbose logs at level 2")
+	}
+}
@@ -3,27 +3,65 @@ package logging
 import (
 	"io/ioutil"
 	"log"
-	"os"
 )
 
+// the loggers are never replaced, SetupLogs only changes where they
+// write, so they can be used while the verbosity changes
 var (
 	VerboseFlag     bool
 	VeryVerboseFlag bool
-	Verbose         *log.Logger
-	VeryVerbose     *log.Logger
-	Error           *log.Logger
+	Verbose         = log.New(ioutil.Discard, "VERBOSE: ", log.Lshortfile)
+	VeryVerbose     = log.New(ioutil.Discard, "VERY VERBOSE: ", log.Lshortfile)
+	Error           = log.New(stderr, "ERROR: ", log.Lshortfile)
 )
 
 type LogOut struct {
-	MesosRequests    int
-	MesosSuccess     int
-	MesosNXDomain    int
-	MesosFailed      int
-	NonMesosRequests int
-	NonMesosSuccess  int
-	NonMesosNXDomain int
-	NonMesosFailed   int
-	NonMesosRecursed int
+	MesosRequests      int
+	MesosSuccess       int
+	MesosNXDomain      int
+	MesosNoData        int
+	MesosFailed        int
+	MesosCached        int
+	MesosPartial       int
+	MesosUnhealthy     int
+	MesosRefused       int
+	CanaryMismatched   int
+	CanaryRejected     int
+	NonMesosRequests   int
+	NonMesosSuccess    int
+	NonMesosNXDomain   int
+	NonMesosFailed     int
+	NonMesosRecursed   int
+	NonMesosMinimized  int
+	NonMesosLocal      int
+	NonMesosCached     int
+	NonMesosCoalesced  int
+	NonMesosBlocked    int
+	NonMesosRPZ        int
+	NonMesosBogus      int
+	NonMesosFailover   int
+	NonMesosRefused    int
+	NonMesosOverridden int
+	NonMesosHostsFile  int
+	NonMesosLoops      int
+	NonMesosHopLimit   int
+	NonMesosACLRefused int
+	Truncated          int
+	QueryACLRefused    int
+	RateLimited        int
+	RateLimitedClients int
+	RRLLimited         int
+	RRLSlipped         int
+	DnstapDropped      int
+	ComponentFailures  int
+	ComponentRestarts  int
+	Transfers          int
+	TransfersRefused   int
+	Notifies           int
+	NotifiesFailed     int
+	HeapBytes          int
+	Goroutines         int
+	OpenFDs            int
 }
 
 var CurLog LogOut
@@ -37,19 +75,30 @@ func PrintCurLog() {
 // Verbose = optional verbosity
 // VeryVerbose = optional verbosity
 // Error = stderr
+// written to the output set by SetOutput
 func SetupLogs() {
-	logopts := log.Ldate | log.Ltime | log.Lshortfile
+	outLock.Lock()
+	logopts := log.Lshortfile
+	if timed {
+		logopts |= log.Ldate | log.Ltime
+	}
+	outLock.Unlock()
 
 	if VerboseFlag {
-		Verbose = log.New(os.Stdout, "VERBOSE: ", logopts)
-		VeryVerbose = log.New(ioutil.Discard, "VERY VERBOSE: ", logopts)
+		Verbose.SetPrefix("VERBOSE: ")
+		Verbose.SetOutput(stdout)
+		VeryVerbose.SetOutput(ioutil.Discard)
 	} else if VeryVerboseFlag {
-		Verbose = log.New(os.Stdout, "VERY VERBOSE: ", logopts)
-		VeryVerbose = Verbose
+		Verbose.SetPrefix("VERY VERBOSE: ")
+		Verbose.SetOutput(stdout)
+		VeryVerbose.SetOutput(stdout)
 	} else {
-		Verbose = log.New(ioutil.Discard, "VERBOSE: ", logopts)
-		VeryVerbose = log.New(ioutil.Discard, "VERY VERBOSE: ", logopts)
+		Verbose.SetPrefix("VERBOSE: ")
+		Verbose.SetOutput(ioutil.Discard)
+		VeryVerbose.SetOutput(ioutil.Discard)
 	}
 
-	Error = log.New(os.Stderr, "ERROR: ", logopts)
+	for _, l := range []*log.Logger{Verbose, VeryVerbose, Error} {
+		l.SetFlags(logopts)
+	}
 }
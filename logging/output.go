@@ -0,0 +1,246 @@
+package logging
+
+import (
+	"errors"
+	"io"
+	"log/syslog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Output is where the logs are written
+type Output struct {
+	// Backend: stdout, which writes the errors to stderr, syslog or file
+	Backend string
+
+	// File is the log file of the file backend
+	File string
+
+	// MaxSize is the size in bytes the log file is rotated at, 0 is
+	// unlimited
+	MaxSize int64
+
+	// MaxAge is how long a log file is written before it is rotated, 0
+	// is unlimited
+	MaxAge time.Duration
+
+	// Backups is how many rotated log files are kept
+	Backups int
+
+	// SyslogAddress is the host:port of the syslog server, over UDP, the
+	// local syslog if empty
+	SyslogAddress string
+
+	// SyslogTag is the program name the syslog messages carry
+	SyslogTag string
+}
+
+// swapWriter writes to the writer set last, it lets the output change
+// under the loggers - once set returns nothing writes to the old one
+type swapWriter struct {
+	sync.RWMutex
+	w io.Writer
+}
+
+func (s *swapWriter) Write(p []byte) (int, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.w.Write(p)
+}
+
+// set makes the writes go to w, it waits for the writes to the old
+// writer to finish
+func (s *swapWriter) set(w io.Writer) {
+	s.Lock()
+	s.w = w
+	s.Unlock()
+}
+
+var (
+	outLock sync.Mutex
+	stdout  = &swapWriter{w: os.Stdout}
+	stderr  = &swapWriter{w: os.Stderr}
+	timed   = true
+	closers []io.Closer
+	reopen  func() error
+)
+
+// SetOutput sends the logs set up by SetupLogs to o, closing the
+// previous output
+func SetOutput(o Output) error {
+	var out, errs io.Writer
+	var cs []io.Closer
+	var re func() error
+	stamped := true
+
+	switch o.Backend {
+	case "", "stdout":
+		out, errs = os.Stdout, os.Stderr
+
+	case "syslog":
+		network := ""
+		if o.SyslogAddress != "" {
+			network = "udp"
+		}
+		info, err := syslog.Dial(network, o.SyslogAddress, syslog.LOG_DAEMON|syslog.LOG_INFO, o.SyslogTag)
+		if err != nil {
+			return err
+		}
+		e, err := syslog.Dial(network, o.SyslogAddress, syslog.LOG_DAEMON|syslog.LOG_ERR, o.SyslogTag)
+		if err != nil {
+			info.Close()
+			return err
+		}
+		// syslog has its own timestamps
+		out, errs, cs, stamped = info, e, []io.Closer{info, e}, false
+
+	case "file":
+		f, err := openRotating(o.File, o.MaxSize, o.MaxAge, o.Backups)
+		if err != nil {
+			return err
+		}
+		out, errs, cs, re = f, f, []io.Closer{f}, f.reopen
+
+	default:
+		return errors.New("unknown log backend " + o.Backend)
+	}
+
+	outLock.Lock()
+	old := closers
+	stdout.set(out)
+	stderr.set(errs)
+	timed, closers, reopen = stamped, cs, re
+	outLock.Unlock()
+
+	// no logger writes to the old output anymore
+	for _, c := range old {
+		c.Close()
+	}
+	return nil
+}
+
+// Reopen reopens the log file, after it was moved away by an external
+// log rotation
+func Reopen() error {
+	outLock.Lock()
+	re := reopen
+	outLock.Unlock()
+
+	if re == nil {
+		return nil
+	}
+	return re()
+}
+
+// rotatingFile is a log file that is moved to file.1, file.1 to file.2
+// and so on when it gets too big or too old
+type rotatingFile struct {
+	sync.Mutex
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	backups int
+
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotating(path string, maxSize int64, maxAge time.Duration, backups int) (*rotatingFile, error) {
+	if path == "" {
+		return nil, errors.New("the file log backend needs a file")
+	}
+
+	r := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the log file for appending, it must be called with r locked
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f, r.size, r.opened = f, fi.Size(), time.Now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.due(len(p)) {
+		// keep logging to the old file if it cannot be rotated
+		if err := r.rotate(); err != nil && r.f == nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// due reports whether writing n more bytes needs a new file first
+func (r *rotatingFile) due(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+	return (r.maxSize > 0 && r.size+int64(n) > r.maxSize) ||
+		(r.maxAge > 0 && time.Since(r.opened) >= r.maxAge)
+}
+
+// rotate moves the log file to the backups and opens a new one
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+
+	for i := r.backups; i > 0; i-- {
+		from := r.path + "." + strconv.Itoa(i-1)
+		if i == 1 {
+			from = r.path
+		}
+		if i == r.backups {
+			os.Remove(r.path + "." + strconv.Itoa(i))
+		}
+		if err := os.Rename(from, r.path+"."+strconv.Itoa(i)); err != nil && !os.IsNotExist(err) {
+			r.open()
+			return err
+		}
+	}
+	if r.backups == 0 {
+		os.Remove(r.path)
+	}
+
+	return r.open()
+}
+
+// reopen closes the log file and opens the one at its path
+func (r *rotatingFile) reopen() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.f != nil {
+		r.f.Close()
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.f.Close()
+}
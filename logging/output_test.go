@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mesos-dns.log")
+
+	f, err := openRotating(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{"": "fourth\n", ".1": "third\n", ".2": "second\n", ".3": ""} {
+		b, err := ioutil.ReadFile(path + name)
+		if want == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("expected no %s, got %q", path+name, b)
+			}
+			continue
+		}
+		if err != nil || string(b) != want {
+			t.Errorf("expected %q in %s, got %q %v", want, path+name, b, err)
+		}
+	}
+
+	// a file moved away is replaced on reopen
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("fifth\n"))
+	if b, _ := ioutil.ReadFile(path); string(b) != "fifth\n" {
+		t.Errorf("expected the reopened file to get the new lines, got %q", b)
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mesos-dns.log")
+
+	f, err := openRotating(path, 0, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("old\n"))
+	f.opened = time.Now().Add(-2 * time.Hour)
+	f.Write([]byte("new\n"))
+
+	if b, _ := ioutil.ReadFile(path + ".1"); string(b) != "old\n" {
+		t.Errorf("expected the old file rotated, got %q", b)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "new\n" {
+		t.Errorf("expected a new file, got %q", b)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mesos-dns.log")
+
+	if err := SetOutput(Output{Backend: "file", File: path}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetOutput(Output{Backend: "stdout"})
+
+	VerboseFlag = true
+	defer func() { VerboseFlag = false }()
+	SetupLogs()
+	Verbose.Println("hello")
+	Error.Println("oops")
+
+	b, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(b), "VERBOSE: ") || !strings.Contains(string(b), "ERROR: ") {
+		t.Errorf("expected both logs in the file, got %q", b)
+	}
+
+	if err := SetOutput(Output{Backend: "file"}); err == nil {
+		t.Error("expected an error without a file")
+	}
+	if err := SetOutput(Output{Backend: "carrier-pigeon"}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+func TestSetOutputWhileLogging(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetOutput(Output{Backend: "stdout"})
+
+	log := func(i int) Output {
+		return Output{Backend: "file", File: filepath.Join(dir, "mesos-dns.log."+strconv.Itoa(i%2))}
+	}
+	if err := SetOutput(log(0)); err != nil {
+		t.Fatal(err)
+	}
+	SetupLogs()
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			if err := Error.Output(1, "busy"); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	// the old log files are closed under the logger
+	for i := 1; i <= 20; i++ {
+		if err := SetOutput(log(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected every line written, got %v", err)
+	}
+}
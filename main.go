@@ -1,29 +1,53 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"sync"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/mesosphere/mesos-dns/logging"
 	"github.com/mesosphere/mesos-dns/records"
 	"github.com/mesosphere/mesos-dns/resolver"
+	"github.com/mesosphere/mesos-dns/supervisor"
+	"github.com/mesosphere/mesos-dns/systemd"
+	"github.com/mesosphere/mesos-dns/tracing"
 
 	"github.com/miekg/dns"
 )
 
 func main() {
-	var wg sync.WaitGroup
-	var resolver resolver.Resolver
+	if len(os.Args) > 1 && os.Args[1] == "probe" {
+		probe(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		validate(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "records" {
+		recordsCmd(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "resolve" {
+		resolve(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export-zone" {
+		exportZone(os.Args[2:])
+	}
 
 	versionFlag := false
+	encrypt := ""
+	preflightOnly := false
 
 	cjson := flag.String("config", "config.json", "location of configuration file (json)")
 	flag.BoolVar(&logging.VerboseFlag, "v", false, "verbose logging")
 	flag.BoolVar(&logging.VeryVerboseFlag, "vv", false, "very verbose logging")
 	flag.BoolVar(&versionFlag, "version", false, "output the version")
+	flag.StringVar(&encrypt, "encrypt", "", "encrypt a secret with the configured secretkeyfile and exit")
+	flag.BoolVar(&preflightOnly, "preflight-only", false, "run the preflight checks, print the report and exit")
 	flag.Parse()
 
 	if versionFlag {
@@ -33,27 +57,266 @@ func main() {
 
 	logging.SetupLogs()
 
-	resolver.Config = records.SetConfig(*cjson)
+	verbose, veryVerbose := logging.VerboseFlag, logging.VeryVerboseFlag
+	config := records.SetConfig(*cjson)
+	if err := setLogOutput(config); err != nil {
+		logging.Error.Println("cannot set up logging:", err)
+		os.Exit(1)
+	}
+	setVerbosity(verbose, veryVerbose, config.Verbosity)
+
+	if encrypt != "" {
+		enc, err := records.EncryptSecret(encrypt, config.SecretKeyFile)
+		if err != nil {
+			logging.Error.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(enc)
+		os.Exit(0)
+	}
+
+	tracing.Setup(config.TraceEndpoint, config.TraceSampleRate)
+
+	resolver := resolver.New(config)
+	resolver.Version = version
+	resolver.Inherit(systemd.Files())
+
+	if !preflight(resolver, preflightOnly) {
+		os.Exit(1)
+	}
+	if preflightOnly {
+		os.Exit(0)
+	}
+
+	// bind our ports while we may, then give up root
+	if config.User != "" || config.Group != "" {
+		if err := resolver.Bind(); err != nil {
+			logging.Error.Println(err)
+			os.Exit(1)
+		}
+		if err := dropPrivileges(config.User, config.Group); err != nil {
+			logging.Error.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	// reload the first time, in the background if a peer or a snapshot
+	// gave us records to serve meanwhile
+	resolver.CheckPeers()
+	if resolver.Warmup() || resolver.LoadSnapshot() {
+		go resolver.Reload()
+	} else {
+		resolver.Reload()
+	}
+
+	sup := supervisor.New()
+
+	// the servers give up after failing to bind a few times, the refresh
+	// loop only stops with mesos-dns
+	servers := supervisor.Policy{Restart: "on-failure", MinBackoff: time.Second, MaxBackoff: 30 * time.Second, MaxFailures: 5}
+	sup.Go(supervisor.Component{
+		Name:   "refresh",
+		Run:    resolver.Refresh,
+		Policy: supervisor.Policy{Restart: "always", MinBackoff: time.Second, MaxBackoff: time.Minute},
+	})
+
+	// SIGHUP re-reads the configuration, SIGUSR1 reopens the log file,
+	// SIGUSR2 toggles very verbose logs, SIGINT and SIGTERM shut down
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGINT, syscall.SIGTERM)
 
-	// reload the first time
-	resolver.Reload()
-	ticker := time.NewTicker(time.Second * time.Duration(resolver.Config.RefreshSeconds))
 	go func() {
-		for _ = range ticker.C {
-			resolver.Reload()
-			logging.PrintCurLog()
+		for sig := range sigs {
+			switch sig {
+			case syscall.SIGUSR1:
+				if err := logging.Reopen(); err != nil {
+					logging.Error.Println("cannot reopen the log file:", err)
+				}
+				continue
+			case syscall.SIGUSR2:
+				if _, _, until := logging.Level(); until.IsZero() {
+					logging.Raise(2, logging.DefaultRaise)
+					logging.Error.Println("very verbose logging for " + logging.DefaultRaise.String())
+				} else {
+					logging.Restore()
+					logging.Error.Println("back to the configured verbosity")
+				}
+				continue
+			case syscall.SIGINT, syscall.SIGTERM:
+				logging.Error.Println("shutting down on " + sig.String())
+				sup.Shutdown()
+				return
+			}
+
+			config, err := records.LoadConfig(*cjson)
+			if err != nil {
+				logging.Error.Println("not reloading configuration:", err)
+				continue
+			}
+
+			if err := setLogOutput(config); err != nil {
+				logging.Error.Println("not changing the log output:", err)
+			}
+			setVerbosity(verbose, veryVerbose, config.Verbosity)
+			resolver.Reconfigure(config)
+			go resolver.DetectLoops()
 		}
 	}()
 
+	go resolver.SelfReport()
+
+	if resolver.Config.HTTPOn {
+		sup.Go(supervisor.Component{Name: "http server", Run: resolver.LaunchHTTP, Policy: servers})
+	}
+
+	if len(resolver.Config.Blocklists) > 0 {
+		go resolver.RefreshBlocklists()
+	}
+
+	if len(resolver.Config.RPZ) > 0 {
+		go resolver.RefreshRPZ()
+	}
+
+	if len(resolver.Config.HostsFiles) > 0 {
+		sup.Go(supervisor.Component{
+			Name:   "hosts files",
+			Run:    resolver.WatchHostsFiles,
+			Policy: supervisor.Policy{Restart: "always", MinBackoff: time.Second, MaxBackoff: time.Minute},
+		})
+	}
+
+	if resolver.Config.Dnstap != "" {
+		sup.Go(supervisor.Component{
+			Name:   "dnstap",
+			Run:    resolver.RunDnstap,
+			Policy: supervisor.Policy{Restart: "always", MinBackoff: time.Second, MaxBackoff: time.Minute},
+		})
+	}
+
+	if resolver.Config.StatsdAddress != "" {
+		sup.Go(supervisor.Component{
+			Name:   "statsd",
+			Run:    resolver.RunStatsd,
+			Policy: supervisor.Policy{Restart: "always", MinBackoff: time.Second, MaxBackoff: time.Minute},
+		})
+	}
+
 	// handle for everything in this domain...
 	dns.HandleFunc(resolver.Config.Domain+".", panicRecover(resolver.HandleMesos))
+	for _, alias := range resolver.Config.DomainAliases {
+		dns.HandleFunc(alias+".", panicRecover(resolver.HandleAlias(alias)))
+	}
+	if resolver.Config.CatalogZone != "" {
+		dns.HandleFunc(resolver.Config.CatalogZone+".", panicRecover(resolver.HandleCatalog))
+	}
 	dns.HandleFunc(".", panicRecover(resolver.HandleNonMesos))
 
-	go resolver.Serve("tcp")
-	go resolver.Serve("udp")
+	for _, net := range []string{"tcp", "udp"} {
+		net := net
+		sup.Go(supervisor.Component{
+			Name:   net + " server",
+			Run:    func(ctx context.Context) error { return resolver.Serve(ctx, net) },
+			Policy: servers,
+		})
+	}
+
+	if systemd.Enabled() {
+		sup.Go(supervisor.Component{
+			Name:   "systemd",
+			Run:    resolver.RunSystemd,
+			Policy: supervisor.Policy{Restart: "on-failure", MinBackoff: time.Second, MaxBackoff: time.Minute},
+		})
+	}
+
+	if resolver.Config.DoQPort > 0 {
+		sup.Go(supervisor.Component{
+			Name:   "doq server",
+			Run:    resolver.ServeDoQ,
+			Policy: servers,
+		})
+	}
+
+	if resolver.Config.PushPort > 0 {
+		sup.Go(supervisor.Component{
+			Name:   "push server",
+			Run:    resolver.ServePush,
+			Policy: servers,
+		})
+	}
+	go resolver.DetectLoops()
+
+	if err := sup.Wait(); err != nil {
+		logging.Error.Println(err)
+		os.Exit(1)
+	}
+}
+
+// setVerbosity sets up the logs for the higher of the command line and
+// the configured verbosity
+func setVerbosity(verbose bool, veryVerbose bool, level int) {
+	if veryVerbose {
+		level = 2
+	} else if verbose && level < 1 {
+		level = 1
+	}
+	logging.SetLevel(level)
+}
+
+// setLogOutput sends the logs where config says, the next setVerbosity
+// sets them up there
+func setLogOutput(config records.Config) error {
+	return logging.SetOutput(logging.Output{
+		Backend:       config.LogBackend,
+		File:          config.LogFile,
+		MaxSize:       int64(config.LogMaxSizeMB) << 20,
+		MaxAge:        time.Duration(config.LogMaxAgeHours) * time.Hour,
+		Backups:       config.LogBackups,
+		SyslogAddress: config.SyslogAddress,
+		SyslogTag:     config.SyslogTag,
+	})
+}
+
+// preflight runs the preflight checks and reports the results, to
+// stdout if report is set, and whether mesos-dns can run
+func preflight(res *resolver.Resolver, report bool) bool {
+	checks := res.Preflight()
+	for _, c := range checks {
+		if report {
+			fmt.Println(c)
+		} else if c.Err != nil {
+			logging.Error.Println("preflight: " + c.String())
+		} else {
+			logging.Verbose.Println("preflight: " + c.String())
+		}
+	}
+
+	return !resolver.Failed(checks)
+}
+
+// dropPrivileges switches to userName and groupName, without any
+// supplementary groups
+func dropPrivileges(userName string, groupName string) error {
+	uid, gid, err := records.Account(userName, groupName)
+	if err != nil {
+		return err
+	}
+
+	if gid >= 0 {
+		if err := syscall.Setgroups([]int{gid}); err != nil {
+			return errors.New("cannot drop supplementary groups: " + err.Error())
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return errors.New("cannot switch to group " + strconv.Itoa(gid) + ": " + err.Error())
+		}
+	}
+	if uid >= 0 {
+		if err := syscall.Setuid(uid); err != nil {
+			return errors.New("cannot switch to user " + strconv.Itoa(uid) + ": " + err.Error())
+		}
+	}
 
-	wg.Add(1)
-	wg.Wait()
+	logging.Verbose.Println("running as uid " + strconv.Itoa(os.Getuid()) + ", gid " + strconv.Itoa(os.Getgid()))
+	return nil
 }
 
 // panicRecover catches any panics from the resolvers and sets an error
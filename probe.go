@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/resolver"
+)
+
+// probe runs the probe subcommand: it queries a resolver for a name, prints
+// the outcome in the chosen format and exits with the monitoring plugin
+// exit code
+func probe(args []string) {
+	var o resolver.ProbeOptions
+	tcp := false
+	format := ""
+
+	fs := flag.NewFlagSet("probe", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mesos-dns probe [flags] <name>")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&o.Server, "server", "127.0.0.1:53", "resolver to query, host or host:port")
+	fs.StringVar(&o.Type, "type", "A", "record type to query")
+	fs.BoolVar(&tcp, "tcp", false, "query over TCP")
+	fs.DurationVar(&o.Timeout, "timeout", 5*time.Second, "query timeout")
+	fs.DurationVar(&o.Warning, "warning", 0, "answer time over which the probe warns, 0 for none")
+	fs.DurationVar(&o.Critical, "critical", 0, "answer time over which the probe is critical, 0 for none")
+	fs.IntVar(&o.MinAnswers, "min-answers", 1, "answers needed for the probe to pass")
+	fs.StringVar(&format, "format", "json", "output format: json, nagios or prometheus")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(3)
+	}
+	o.Name = fs.Arg(0)
+	if tcp {
+		o.Net = "tcp"
+	}
+
+	p := resolver.RunProbe(o)
+	switch format {
+	case "nagios":
+		fmt.Println(p.Nagios())
+	case "prometheus":
+		fmt.Print(p.Prometheus())
+	case "json":
+		b, _ := json.Marshal(p)
+		fmt.Println(string(b))
+	default:
+		fmt.Fprintln(os.Stderr, "unknown format "+format)
+		os.Exit(3)
+	}
+	os.Exit(p.Code())
+}
@@ -0,0 +1,50 @@
+package records
+
+import (
+	"errors"
+	"os/user"
+	"strconv"
+)
+
+// Account returns the uid of userName and the gid of groupName, each a
+// name or a numeric id - the gid of the user's primary group without a
+// groupName, and -1 for what is not set
+// numeric ids need no passwd or group entry, but a uid without one has
+// no primary group, so it needs a groupName
+func Account(userName string, groupName string) (uid int, gid int, err error) {
+	uid, gid = -1, -1
+
+	if userName != "" {
+		if u, err := user.Lookup(userName); err == nil {
+			uid, _ = strconv.Atoi(u.Uid)
+			gid, _ = strconv.Atoi(u.Gid)
+		} else if uid = numericID(userName); uid < 0 {
+			return -1, -1, errors.New("unknown user " + userName)
+		} else if u, err := user.LookupId(userName); err == nil {
+			gid, _ = strconv.Atoi(u.Gid)
+		}
+	}
+
+	if groupName != "" {
+		if g, err := user.LookupGroup(groupName); err == nil {
+			gid, _ = strconv.Atoi(g.Gid)
+		} else if gid = numericID(groupName); gid < 0 {
+			return -1, -1, errors.New("unknown group " + groupName)
+		}
+	}
+
+	if uid >= 0 && gid < 0 {
+		return -1, -1, errors.New("user " + userName + " has no primary group, set the group too")
+	}
+
+	return uid, gid, nil
+}
+
+// numericID returns s as a uid or gid, -1 if it isn't one
+func numericID(s string) int {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 0 {
+		return -1
+	}
+	return id
+}
@@ -0,0 +1,31 @@
+package records
+
+import "testing"
+
+func TestAccount(t *testing.T) {
+	var tests = []struct {
+		user, group string
+		uid, gid    int
+		ok          bool
+	}{
+		{"", "", -1, -1, true},
+		{"root", "", 0, 0, true},
+		{"0", "", 0, 0, true},
+		{"", "0", -1, 0, true},
+		{"root", "root", 0, 0, true},
+		{"no-such-user-mesos-dns", "", -1, -1, false},
+		{"root", "no-such-group-mesos-dns", -1, -1, false},
+		// ids without passwd and group entries
+		{"54321", "54321", 54321, 54321, true},
+		{"root", "54321", 0, 54321, true},
+		{"54321", "", -1, -1, false},
+		{"-1", "0", -1, -1, false},
+	}
+
+	for _, tt := range tests {
+		uid, gid, err := Account(tt.user, tt.group)
+		if (err == nil) != tt.ok || uid != tt.uid || gid != tt.gid {
+			t.Errorf("%q/%q: expected %d, %d, %v, got %d, %d, %v", tt.user, tt.group, tt.uid, tt.gid, tt.ok, uid, gid, err)
+		}
+	}
+}
@@ -1,39 +1,151 @@
 package records
 
 import (
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net"
+	"net/url"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/mesosphere/mesos-dns/logging"
 	"github.com/miekg/dns"
 )
 
+// Cluster is a mesos cluster served under Name.domain
+type Cluster struct {
+	Name    string
+	Masters []string
+}
+
+// RPZ is a response policy zone, loaded from File or transferred from
+// Primary
+type RPZ struct {
+	Zone    string
+	File    string
+	Primary string
+	// TSIGKey: name of the key in TSIGKeys transfers are signed with
+	TSIGKey string
+}
+
 // Config holds mesos dns configuration
 type Config struct {
 
 	// Mesos master(s): a list of IP:port/zk pairs for one or more Mesos masters
 	Masters []string
 
+	// ClusterName: name of the mesos cluster, reported in the zone
+	// metadata
+	ClusterName string
+
+	// ZoneMetadata: serve TXT records at the zone apex with the cluster
+	// name, mesos-dns version and the serial and time of the records
+	// (default true)
+	ZoneMetadata bool
+
+	// Clusters: other mesos clusters, each served under its own
+	// subdomain, name.domain
+	Clusters []Cluster
+
+	// MasterUser: principal for HTTP basic authentication against the
+	// masters, none if empty
+	MasterUser string
+
+	// MasterPassword: secret for MasterUser
+	MasterPassword string
+
+	// SecretKeyFile: file with the base64 encoded AES-256 key used to
+	// decrypt "enc:" secrets in the configuration
+	SecretKeyFile string
+
+	// Preset: named set of refresh, TTL and SOA timings, fast-failover,
+	// stable or bulk-batch, settings in the file win over it (default none)
+	Preset string
+
 	// Refresh frequency: the frequency in seconds of regenerating records (default 60)
 	RefreshSeconds int
 
+	// RefreshJitter: fraction of the refresh interval each wait is
+	// randomly lengthened or shortened by (default 0.1)
+	RefreshJitter float64
+
+	// RefreshBackoffMax: the longest wait in seconds between reloads while
+	// the masters fail, the interval doubles with every failure up to it,
+	// 0 to not back off (default 600)
+	RefreshBackoffMax int
+
 	// TTL: the TTL value used for SRV and A records (default 60)
 	TTL int
 
+	// TTLDecay: serve the TTL less the age of the records, like a
+	// secondary, so stale records expire if refreshes stall (default
+	// false)
+	TTLDecay bool
+
+	// TTLOverrides: TTLs for names in the domain that differ from TTL,
+	// e.g. short ones for fast moving services
+	TTLOverrides map[string]int
+
+	// TTLLabel: task label with the TTL of the task's records, e.g.
+	// DNS_TTL=5, empty turns them off (default DNS_TTL)
+	TTLLabel string
+
+	// TLSALabel: prefix of the task labels with the TLSA records of the
+	// task's ports, e.g. DNS_TLSA_443="3 1 1 <hash>", empty turns them
+	// off (default DNS_TLSA)
+	TLSALabel string
+
+	// SRVWeight: task resource the weight of its SRV records follows,
+	// none, cpus (in hundredths) or mem (in MB) (default none)
+	SRVWeight string
+
+	// SRVWeightLabel: task label with the weight of the task's SRV
+	// records, it wins over SRVWeight, empty turns it off (default
+	// DNS_SRV_WEIGHT)
+	SRVWeightLabel string
+
+	// SRVPriorityLabel: task label with the priority of the task's SRV
+	// records, empty turns it off (default DNS_SRV_PRIORITY)
+	SRVPriorityLabel string
+
+	// LOCAttributes: the slave attributes with the latitude, longitude
+	// and optionally altitude (degrees and meters) of slaves, to serve LOC
+	// records of the names pointing at them (default none)
+	LOCAttributes []string
+
+	// SSHFPAttribute: prefix of the slave attributes with the SSH host
+	// key fingerprints of slaves, e.g. sshfp-ed25519:<sha-256>, served as
+	// SSHFP records of agent.slave.domain (default none)
+	SSHFPAttribute string
+
+	// SSHFPFile: file with the SSHFP records of the slaves by hostname,
+	// as written by ssh-keyscan -D (default none)
+	SSHFPFile string
+
 	// Resolver port: port used to listen for slave requests (default 53)
 	Port int
 
 	//  Domain: name of the domain used (default "mesos", ie .mesos domain)
 	Domain string
 
+	// DomainAliases: other domains the records of Domain are served under,
+	// e.g. while moving to a new domain
+	DomainAliases []string
+
 	// DNS server: IP address of the DNS server for forwarded accesses
 	Resolvers []string
 
+	// RecurseOn: forward queries outside of Domain to Resolvers, refuse
+	// them if false (default true)
+	RecurseOn bool
+
 	// Timeout is the default connect/read/write timeout for outbound
 	// queries
 	Timeout int
@@ -44,24 +156,527 @@ type Config struct {
 	// Email is the rname for a SOA
 	Email string
 
+	// SOARefresh: the SOA refresh interval in seconds for secondaries
+	// (default 60)
+	SOARefresh int
+
+	// SOARetry: the SOA retry interval in seconds for secondaries
+	// (default 600)
+	SOARetry int
+
+	// SOAExpire: the SOA expire time in seconds for secondaries
+	// (default 86400)
+	SOAExpire int
+
+	// SOAMinttl: the SOA minimum TTL, used by resolvers to cache
+	// negative answers (default 60)
+	SOAMinttl int
+
 	// Mname is the mname for a SOA
 	Mname string
 
+	// Nameservers: names of the nameservers for the domain, served as its
+	// NS records (default the mname)
+	Nameservers []string
+
 	// ListenAddr is the server listener address
 	Listener string
+
+	// ReplySource: address UDP answers are sent from when listening on
+	// 0.0.0.0, by default each answer comes from the address the query
+	// was sent to
+	ReplySource string
+
+	// User, Group: account mesos-dns switches to once its ports are
+	// bound, it keeps running as the user that started it if empty
+	User  string
+	Group string
+
+	// DoQPort: port DNS over QUIC (RFC 9250) is served on, usually 853,
+	// 0 turns it off (default 0)
+	DoQPort int
+
+	// DoQCert, DoQKey: PEM files with the certificate and key of DNS over
+	// QUIC
+	DoQCert string
+	DoQKey  string
+
+	// DNS64Prefix: NAT64 prefix (RFC 6052) AAAA records are synthesized
+	// with from the A records of the mesos domain, e.g. 64:ff9b::/96,
+	// empty turns DNS64 off (default "")
+	DNS64Prefix string
+
+	// PushPort: port DNS Push Notifications (RFC 8765) are served on over
+	// TLS, usually 5352, 0 turns them off (default 0)
+	PushPort int
+
+	// PushCert, PushKey: PEM files with the certificate and key of DNS
+	// Push Notifications
+	PushCert string
+	PushKey  string
+
+	// LocalZones: answer queries for the root hints, localhost and the
+	// RFC 6303 special-use reverse zones locally instead of forwarding them
+	LocalZones bool
+
+	// CacheSize: maximum number of forwarded responses to cache, 0
+	// disables the cache (default 0)
+	CacheSize int
+
+	// CacheMaxTTL: upper bound in seconds on how long a forwarded response
+	// is cached regardless of its TTL (default 3600)
+	CacheMaxTTL int
+
+	// AnswerCacheSize: how many assembled answers for the domain are kept
+	// until the next reload (default 0, disabled)
+	AnswerCacheSize int
+
+	// Blocklists: files or http(s) urls listing external names that are
+	// never forwarded
+	Blocklists []string
+
+	// BlocklistRefresh: the frequency in seconds of reloading the
+	// block lists (default 3600)
+	BlocklistRefresh int
+
+	// Sinkhole: address returned for blocked names, NXDOMAIN if empty
+	Sinkhole string
+
+	// RPZ: response policy zones applied to forwarded queries, the first
+	// zone with a policy for a name wins
+	RPZ []RPZ
+
+	// RPZRefresh: the frequency in seconds of reloading the response
+	// policy zones (default 3600)
+	RPZRefresh int
+
+	// MaxForwardHops: how many mesos-dns forwarders, peers and stub
+	// zone resolvers, a query may pass through (default 3)
+	MaxForwardHops int
+
+	// MaxReferrals: how many referrals we follow for a forwarded query
+	// (default 3)
+	MaxReferrals int
+
+	// QNameMinimize: ask nameservers that answered with referrals only for
+	// the next label of the name, not the full name (default false)
+	QNameMinimize bool
+
+	// RaceResolvers: send forwarded queries to all resolvers at once and
+	// use the first good answer instead of trying them in order
+	RaceResolvers bool
+
+	// RateLimitQPS: queries a second each client may send, over it they
+	// are refused or dropped, 0 turns limiting off (default 0)
+	RateLimitQPS float64
+
+	// RateLimitBurst: queries a client may send at once before
+	// RateLimitQPS applies (default RateLimitQPS)
+	RateLimitBurst int
+
+	// RateLimitAction: what happens to queries over the limit, refuse or
+	// drop (default refuse)
+	RateLimitAction string
+
+	// RRLRate: identical answers a second each client network (/24 or
+	// /56) gets over UDP before response rate limiting drops them, 0 turns
+	// it off (default 0)
+	RRLRate int
+
+	// RRLSlip: every RRLSlip-th limited answer is sent truncated instead
+	// of dropped, 0 drops them all (default 2)
+	RRLSlip int
+
+	// QueryLog: file the queries are logged to as JSON lines, "-" for
+	// stdout, empty turns it off (default empty)
+	QueryLog string
+
+	// QueryLogSample: fraction of the queries logged (default 1)
+	QueryLogSample float64
+
+	// Dnstap: file, or unix socket as unix:path, the queries and
+	// responses are written to in dnstap format, empty turns it off
+	// (default empty)
+	Dnstap string
+
+	// CoalesceQueries: forward identical queries that arrive while one is
+	// being forwarded just once, and send all of them its answer (default
+	// true)
+	CoalesceQueries bool
+
+	// Overrides: external names pinned to fixed addresses instead of
+	// being forwarded
+	Overrides map[string][]string
+
+	// CAA: CAA records of names in the domain, the domain itself for the
+	// zone apex, in presentation format, e.g. 0 issue "letsencrypt.org"
+	CAA map[string][]string
+
+	// HostsFiles: files in /etc/hosts format whose names are served, in
+	// the domain along with the generated records and outside of it
+	// instead of being forwarded, changes are picked up while running
+	HostsFiles []string
+
+	// StubZones: domains whose queries are forwarded to their own
+	// resolvers (IP or IP:port) instead of Resolvers, the longest match
+	// wins
+	StubZones map[string][]string
+
+	// UnderscoreNames: how non-SRV queries for underscore names without
+	// records (e.g. _dmarc.domain) are answered - "nxdomain" or "forward"
+	// to the resolvers (default nxdomain)
+	UnderscoreNames string
+
+	// CNAMEs: names in the domain that are aliases for other names, in
+	// the domain or not, e.g. "db.mesos": "db.example.com"
+	CNAMEs map[string]string
+
+	// DNAMEs: names in the domain whose subtrees are redirected to other
+	// names, e.g. "marathon-0.6.0.mesos": "marathon.mesos"
+	DNAMEs map[string]string
+
+	// UnderscoreTXT: TXT records for underscore names, e.g. for ACME
+	// DNS-01 validation under the domain
+	UnderscoreTXT map[string][]string
+
+	// TXTLabels: task labels published as TXT records on the task's name,
+	// "*" publishes all of them (default none)
+	TXTLabels []string
+
+	// TXTRedact: task labels never published as TXT records, even if they
+	// match TXTLabels
+	TXTRedact []string
+
+	// AliasLabel: task label with extra names for the task, e.g.
+	// DNS_ALIAS=shop.mesos, empty turns them off (default DNS_ALIAS)
+	AliasLabel string
+
+	// AllowQuery: networks (CIDR) allowed to query, others are refused,
+	// everyone may if empty (default empty)
+	AllowQuery []string
+
+	// AllowRecursion: networks (CIDR) allowed to have queries for other
+	// domains forwarded to the Resolvers, everyone may if empty (default
+	// empty)
+	AllowRecursion []string
+
+	// AXFRAllow: networks (CIDR) allowed to transfer the zone with AXFR
+	// or IXFR, transfers are refused if neither this nor TSIGKeys is set
+	AXFRAllow []string
+
+	// TSIGKeys: TSIG key name to base64 secret, if set zone transfers
+	// must be signed with one of these keys
+	TSIGKeys map[string]string
+
+	// Peers: the other mesos-dns instances (IP or IP:port) serving the
+	// domain, published at resolvers.domain while they answer
+	Peers []string
+
+	// WarmupFromPeers: at startup, serve the records transferred from the
+	// first of the Peers that allows it until the masters answer (default
+	// false)
+	WarmupFromPeers bool
+
+	// SnapshotFile: file the records are saved to after each reload that
+	// reaches the masters, and served from at startup until they answer
+	// (default "", no snapshot)
+	SnapshotFile string
+
+	// Notify: secondary servers (IP or IP:port) sent a DNS NOTIFY when
+	// the zone changes so they transfer it right away
+	Notify []string
+
+	// IXFRJournal: how many zone changes are kept to answer IXFR, 0
+	// answers every IXFR with the full zone (default 16)
+	IXFRJournal int
+
+	// CatalogZone: name of an RFC 9432 catalog zone listing Domain and
+	// CatalogMembers, for secondaries to provision them, off if empty
+	CatalogZone string
+
+	// CatalogMembers: other zones the catalog zone lists, e.g. the
+	// domains of other clusters
+	CatalogMembers []string
+
+	// DNSSEC: sign answers for the domain for clients that ask for it
+	DNSSEC bool
+
+	// DNSSECKSK, DNSSECZSK: BIND style key files (without .key/.private)
+	// to sign with, generated at startup if unset
+	DNSSECKSK string
+	DNSSECZSK string
+
+	// DNSSECValidate: validate the DNSSEC signatures of forwarded answers,
+	// setting the AD bit on the ones that validate and failing the bogus
+	// ones (default false)
+	DNSSECValidate bool
+
+	// TrustAnchors: DS or DNSKEY records, in zone file format, validation
+	// starts from (default the DS records of the root zone KSKs)
+	TrustAnchors []string
+
+	// SelfReportSeconds: how often heap size, goroutines and open files
+	// are reported (default 60)
+	SelfReportSeconds int
+
+	// HeapWarnMB, GoroutineWarn, FDWarn: warn when the heap, goroutines
+	// or open files go above these (default 0, off)
+	HeapWarnMB    int
+	GoroutineWarn int
+	FDWarn        int
+
+	// Verbosity: 1 logs like -v, 2 like -vv, the higher of this and the
+	// command line wins (default 0)
+	Verbosity int
+
+	// LogBackend: where the logs go - stdout (errors to stderr), syslog or
+	// file (default stdout)
+	LogBackend string
+
+	// LogFile: the log file of the file LogBackend
+	LogFile string
+
+	// LogMaxSizeMB, LogMaxAgeHours: the log file is rotated when it gets
+	// bigger or older than these, 0 is unlimited (default 100 and 0)
+	LogMaxSizeMB   int
+	LogMaxAgeHours int
+
+	// LogBackups: how many rotated log files are kept (default 5)
+	LogBackups int
+
+	// SyslogAddress: host:port of the syslog server, over UDP, the local
+	// syslog if empty
+	SyslogAddress string
+
+	// SyslogTag: program name of the syslog messages (default mesos-dns)
+	SyslogTag string
+
+	// Filters: names of the compiled in answer filters to run, in order
+	Filters []string
+
+	// AnswerBudget: milliseconds we may spend assembling an answer before
+	// sending the records found so far, 0 is unlimited (default 1000)
+	AnswerBudget int
+
+	// InactiveAgents: what happens to tasks on slaves the master reports
+	// as deactivated or unreachable - "drop" their records, or
+	// "quarantine" them, serving them only for names with no other
+	// records (default drop)
+	InactiveAgents string
+
+	// MaintenanceAgents: what happens to tasks on slaves in or close to a
+	// window of the master's maintenance schedule - "ignore" the schedule,
+	// "deprioritize" their records, answering with them last, or "drop"
+	// them (default ignore)
+	MaintenanceAgents string
+
+	// DrainSeconds: how long before a maintenance window its slaves are
+	// deprioritized or dropped (default 300)
+	DrainSeconds int
+
+	// NameTemplate: name of the A records of tasks, of {task},
+	// {framework}, {instance} and {domain} (default
+	// {task}.{framework}.{domain})
+	NameTemplate string
+
+	// SRVTemplate: name of the SRV records of tasks, NameTemplate fields
+	// plus {protocol} (default _{task}._{protocol}.{framework}.{domain})
+	SRVTemplate string
+
+	// NameSanitize: what happens to characters that are not valid in
+	// names - "strip" drops them, "dash" replaces them with dashes
+	// (default strip)
+	NameSanitize string
+
+	// IncludeFrameworks: frameworks whose tasks get records, by name or
+	// shell pattern, e.g. marathon*; empty includes every framework
+	IncludeFrameworks []string
+
+	// ExcludeFrameworks: frameworks whose tasks never get records, by
+	// name or shell pattern, even if included
+	ExcludeFrameworks []string
+
+	// RoleZones: serve the tasks of frameworks with a role under the
+	// subzone of the role, e.g. web.marathon.dev.mesos (default false)
+	RoleZones bool
+
+	// RoleACLs: networks (CIDR) allowed to query the subzone of a role,
+	// by role; other clients are refused, roles missing here are open
+	RoleACLs map[string][]string
+
+	// CollapseVersions: drop version suffixes from framework names, e.g.
+	// marathon-0.6.0 is served as marathon (default false)
+	CollapseVersions bool
+
+	// EnumerateTasks: also serve task-N.task.framework.domain for each
+	// instance of a task, numbered by task id (default false)
+	EnumerateTasks bool
+
+	// TaskIDRecords: also serve taskid.domain for each task, by its full
+	// mesos task id (default false)
+	TaskIDRecords bool
+
+	// AttributeKeys: slave attributes whose values group tasks into
+	// framework.key-value.domain subdomains, e.g. rack or zone
+	AttributeKeys []string
+
+	// AnswerOrder: how answers are ordered for load balancing, random,
+	// roundrobin, weighted by the cpus of the slaves, hash of the client
+	// subnet or sorted (default random)
+	AnswerOrder string
+
+	// HealthFirst: answer with tasks failing their health checks after
+	// the healthy ones (default false)
+	HealthFirst bool
+
+	// HealthOmitShare: leave out tasks failing their health checks while
+	// they are at most this share, 0 to 1, of the answers, 0 never leaves
+	// them out (default 0)
+	HealthOmitShare float64
+
+	// CanarySeconds: how long new records are compared with the served
+	// ones on live queries before they are served, 0 serves them right
+	// away (default 0)
+	CanarySeconds int
+
+	// CanaryMaxMismatch: share of compared queries, 0 to 1, whose answer
+	// may change for new records to be served (default 1)
+	CanaryMaxMismatch float64
+
+	// FlapSeconds: how long we keep serving the records of a framework
+	// that disappeared from the state, in case it re-registers, 0 drops
+	// them right away (default 0)
+	FlapSeconds int
+
+	// TraceEndpoint: zipkin v2 url traces are exported to, tracing is off
+	// if empty
+	TraceEndpoint string
+
+	// TraceSampleRate: share of forwarded queries traced, 0 to 1 (default
+	// 0.01)
+	TraceSampleRate float64
+
+	// StatsdAddress: host:port metrics are shipped to, shipping is off if
+	// empty
+	StatsdAddress string
+
+	// StatsdFormat: statsd (udp) or graphite (tcp plaintext) (default
+	// statsd)
+	StatsdFormat string
+
+	// StatsdPrefix: prefix of the metric names (default mesos-dns)
+	StatsdPrefix string
+
+	// StatsdFlushSeconds: how often metrics are shipped (default 10)
+	StatsdFlushSeconds int
+
+	// HTTPOn: serve the HTTP API (default false)
+	HTTPOn bool
+
+	// HTTPListener: address the HTTP API listens on, apart from the dns
+	// listener so it can stay on a management interface (default
+	// 127.0.0.1)
+	HTTPListener string
+
+	// HTTPPort: port of the HTTP API (default 8123)
+	HTTPPort int
+
+	// AdminToken: bearer token for the admin endpoints of the HTTP API,
+	// they are off if empty
+	AdminToken string
+
+	// ReadyRefreshPeriods: how many refreshes /ready waits for records
+	// from the masters before reporting not ready (default 3)
+	ReadyRefreshPeriods int
+
+	// ACMETTL: seconds ACME challenges published through the API are
+	// served for (default 600)
+	ACMETTL int
+
+	// TrimAnswers: drop answers that don't fit in a UDP response instead
+	// of truncating the whole response and setting TC
+	TrimAnswers bool
 }
 
 // SetConfig instantiates a Config struct read in from config.json
-func SetConfig(cjson string) (c Config) {
+// it exits if mesos-dns cannot run with the configuration
+func SetConfig(cjson string) Config {
+	c, err := LoadConfig(cjson)
+	if err != nil {
+		logging.Error.Println(err)
+		os.Exit(1)
+	}
+
+	return c
+}
+
+// rootTrustAnchors are the DS records of the root zone KSKs, KSK-2017
+// and KSK-2024
+var rootTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBB683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// LoadConfig reads config.json and checks it, every problem is logged and
+// an error returned if mesos-dns cannot run with it
+func LoadConfig(cjson string) (c Config, err error) {
 	c = Config{
-		RefreshSeconds: 60,
-		TTL:            60,
-		Domain:         "mesos",
-		Port:           53,
-		Timeout:        5,
-		Email:          "root.mesos-dns.mesos",
-		Resolvers:      []string{"8.8.8.8"},
-		Listener:       "0.0.0.0",
+		RefreshSeconds:      60,
+		RefreshJitter:       0.1,
+		RefreshBackoffMax:   600,
+		TTL:                 60,
+		Domain:              "mesos",
+		Port:                53,
+		Timeout:             5,
+		Email:               "root.mesos-dns.mesos",
+		Resolvers:           []string{"8.8.8.8"},
+		Listener:            "0.0.0.0",
+		RecurseOn:           true,
+		MaxForwardHops:      3,
+		MaxReferrals:        3,
+		SOARefresh:          60,
+		SOARetry:            600,
+		SOAExpire:           86400,
+		SOAMinttl:           60,
+		CacheMaxTTL:         3600,
+		BlocklistRefresh:    3600,
+		RPZRefresh:          3600,
+		TrustAnchors:        append([]string(nil), rootTrustAnchors...),
+		SelfReportSeconds:   60,
+		LogBackend:          "stdout",
+		LogMaxSizeMB:        100,
+		LogBackups:          5,
+		SyslogTag:           "mesos-dns",
+		UnderscoreNames:     "nxdomain",
+		HTTPListener:        "127.0.0.1",
+		AliasLabel:          "DNS_ALIAS",
+		TTLLabel:            "DNS_TTL",
+		TLSALabel:           "DNS_TLSA",
+		SRVWeight:           "none",
+		SRVWeightLabel:      "DNS_SRV_WEIGHT",
+		SRVPriorityLabel:    "DNS_SRV_PRIORITY",
+		ZoneMetadata:        true,
+		CoalesceQueries:     true,
+		RateLimitAction:     "refuse",
+		RRLSlip:             2,
+		QueryLogSample:      1,
+		TraceSampleRate:     0.01,
+		IXFRJournal:         16,
+		StatsdFormat:        "statsd",
+		StatsdPrefix:        "mesos-dns",
+		StatsdFlushSeconds:  10,
+		CanaryMaxMismatch:   1,
+		HTTPPort:            8123,
+		ReadyRefreshPeriods: 3,
+		ACMETTL:             600,
+		AnswerBudget:        1000,
+		InactiveAgents:      "drop",
+		MaintenanceAgents:   "ignore",
+		AnswerOrder:         "random",
+		DrainSeconds:        300,
+		NameTemplate:        defaultNameTemplate,
+		SRVTemplate:         defaultSRVTemplate,
+		NameSanitize:        "strip",
 	}
 
 	usr, _ := user.Current()
@@ -70,28 +685,41 @@ func SetConfig(cjson string) (c Config) {
 
 	path, err := filepath.Abs(cjson)
 	if err != nil {
-		logging.Error.Println("cannot find configuration file")
-		os.Exit(1)
+		return c, errors.New("cannot find configuration file")
 	}
 
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		logging.Error.Println("missing configuration file")
-		os.Exit(1)
+		return c, errors.New("missing configuration file")
 	}
 
 	err = json.Unmarshal(b, &c)
 	if err != nil {
-		logging.Error.Println(err)
+		return c, err
+	}
+
+	err = c.applyPreset(b)
+	if err != nil {
+		return c, err
+	}
+
+	err = c.resolveSecrets()
+	if err != nil {
+		return c, errors.New("cannot resolve secrets: " + err.Error())
 	}
 
 	if len(c.Resolvers) == 0 {
 		c.Resolvers = GetLocalDNS()
 	}
 
-	if len(c.Masters) == 0 {
-		logging.Error.Println("please specify mesos masters in config.json")
-		os.Exit(1)
+	// report every problem before giving up
+	fatal := false
+	for _, p := range c.Check() {
+		logging.Error.Println(p)
+		fatal = fatal || p.Fatal
+	}
+	if fatal {
+		return c, errors.New("invalid configuration")
 	}
 
 	c.Email = strings.Replace(c.Email, "@", ".", -1)
@@ -100,21 +728,859 @@ func SetConfig(cjson string) (c Config) {
 	}
 
 	c.Domain = strings.ToLower(c.Domain)
+	for i := range c.Clusters {
+		c.Clusters[i].Name = strings.ToLower(c.Clusters[i].Name)
+	}
+	for i, alias := range c.DomainAliases {
+		c.DomainAliases[i] = strings.TrimSuffix(strings.ToLower(alias), ".")
+	}
+	c.CatalogZone = strings.TrimSuffix(strings.ToLower(c.CatalogZone), ".")
+	for i, member := range c.CatalogMembers {
+		c.CatalogMembers[i] = strings.TrimSuffix(strings.ToLower(member), ".")
+	}
+
+	for i, z := range c.RPZ {
+		c.RPZ[i].Zone = dns.Fqdn(strings.ToLower(z.Zone))
+		if z.TSIGKey != "" {
+			c.RPZ[i].TSIGKey = dns.Fqdn(strings.ToLower(z.TSIGKey))
+		}
+	}
+
+	keys := make(map[string]string, len(c.TSIGKeys))
+	for name, secret := range c.TSIGKeys {
+		keys[dns.Fqdn(strings.ToLower(name))] = secret
+	}
+	c.TSIGKeys = keys
+
+	overrides := make(map[string][]string, len(c.Overrides))
+	for name, addrs := range c.Overrides {
+		overrides[dns.Fqdn(strings.ToLower(name))] = addrs
+	}
+	c.Overrides = overrides
+
+	caa := make(map[string][]string, len(c.CAA))
+	for name, values := range c.CAA {
+		caa[dns.Fqdn(strings.ToLower(name))] = values
+	}
+	c.CAA = caa
+
+	stubs := make(map[string][]string, len(c.StubZones))
+	for zone, addrs := range c.StubZones {
+		stubs[dns.Fqdn(strings.ToLower(zone))] = addrs
+	}
+	c.StubZones = stubs
+
+	cnames := make(map[string]string, len(c.CNAMEs))
+	for name, target := range c.CNAMEs {
+		cnames[dns.Fqdn(strings.ToLower(name))] = dns.Fqdn(strings.ToLower(target))
+	}
+	c.CNAMEs = cnames
+
+	dnames := make(map[string]string, len(c.DNAMEs))
+	for name, target := range c.DNAMEs {
+		dnames[dns.Fqdn(strings.ToLower(name))] = dns.Fqdn(strings.ToLower(target))
+	}
+	c.DNAMEs = dnames
+
+	acls := make(map[string][]string, len(c.RoleACLs))
+	for role, cidrs := range c.RoleACLs {
+		acls[strings.ToLower(role)] = cidrs
+	}
+	c.RoleACLs = acls
+
+	ttls := make(map[string]int, len(c.TTLOverrides))
+	for name, ttl := range c.TTLOverrides {
+		ttls[dns.Fqdn(strings.ToLower(name))] = ttl
+	}
+	c.TTLOverrides = ttls
+
+	underscore := make(map[string][]string, len(c.UnderscoreTXT))
+	for name, txts := range c.UnderscoreTXT {
+		underscore[dns.Fqdn(strings.ToLower(name))] = txts
+	}
+	c.UnderscoreTXT = underscore
 	c.Mname = "mesos-dns." + c.Domain + "."
+	for i, ns := range c.Nameservers {
+		c.Nameservers[i] = dns.Fqdn(strings.ToLower(ns))
+	}
 
 	logging.Verbose.Println("Mesos-DNS configuration:")
 	logging.Verbose.Println("   - Masters: " + strings.Join(c.Masters, ", "))
+	logging.Verbose.Println("   - ClusterName: " + c.ClusterName)
+	logging.Verbose.Println("   - ZoneMetadata: ", c.ZoneMetadata)
+	logging.Verbose.Println("   - MasterUser: " + c.MasterUser)
+	logging.Verbose.Println("   - Preset: " + c.Preset)
 	logging.Verbose.Println("   - RefreshSeconds: ", c.RefreshSeconds)
+	logging.Verbose.Println("   - RefreshJitter: ", c.RefreshJitter)
+	logging.Verbose.Println("   - RefreshBackoffMax: ", c.RefreshBackoffMax)
+	logging.Verbose.Println("   - Verbosity: ", c.Verbosity)
+	logging.Verbose.Println("   - LogBackend: " + c.LogBackend)
+	logging.Verbose.Println("   - LogFile: " + c.LogFile)
+	logging.Verbose.Println("   - LogMaxSizeMB: ", c.LogMaxSizeMB)
+	logging.Verbose.Println("   - LogMaxAgeHours: ", c.LogMaxAgeHours)
+	logging.Verbose.Println("   - LogBackups: ", c.LogBackups)
+	logging.Verbose.Println("   - SyslogAddress: " + c.SyslogAddress)
+	logging.Verbose.Println("   - SyslogTag: " + c.SyslogTag)
 	logging.Verbose.Println("   - TTL: ", c.TTL)
+	logging.Verbose.Println("   - TTLDecay: ", c.TTLDecay)
+	for name, ttl := range c.TTLOverrides {
+		logging.Verbose.Println("   - TTLOverride: "+name+" -> ", ttl)
+	}
+	logging.Verbose.Println("   - TTLLabel: " + c.TTLLabel)
+	logging.Verbose.Println("   - TLSALabel: " + c.TLSALabel)
+	logging.Verbose.Println("   - SRVWeight: " + c.SRVWeight)
+	logging.Verbose.Println("   - SRVWeightLabel: " + c.SRVWeightLabel)
+	logging.Verbose.Println("   - LOCAttributes: " + strings.Join(c.LOCAttributes, ", "))
+	logging.Verbose.Println("   - SSHFPAttribute: " + c.SSHFPAttribute)
+	logging.Verbose.Println("   - SSHFPFile: " + c.SSHFPFile)
+	logging.Verbose.Println("   - SRVPriorityLabel: " + c.SRVPriorityLabel)
 	logging.Verbose.Println("   - Domain: " + c.Domain)
+	logging.Verbose.Println("   - DomainAliases: ", c.DomainAliases)
+	for _, cl := range c.Clusters {
+		logging.Verbose.Println("   - Cluster "+cl.Name+": ", cl.Masters)
+	}
 	logging.Verbose.Println("   - Port: ", c.Port)
 	logging.Verbose.Println("   - Timeout: ", c.Timeout)
 	logging.Verbose.Println("   - Listener: " + c.Listener)
+	logging.Verbose.Println("   - ReplySource: " + c.ReplySource)
+	logging.Verbose.Println("   - User: " + c.User)
+	logging.Verbose.Println("   - Group: " + c.Group)
+	logging.Verbose.Println("   - DoQPort: ", c.DoQPort)
+	logging.Verbose.Println("   - DoQCert: " + c.DoQCert)
+	logging.Verbose.Println("   - DoQKey: " + c.DoQKey)
+	logging.Verbose.Println("   - DNS64Prefix: " + c.DNS64Prefix)
+	logging.Verbose.Println("   - PushPort: ", c.PushPort)
+	logging.Verbose.Println("   - PushCert: " + c.PushCert)
+	logging.Verbose.Println("   - PushKey: " + c.PushKey)
 	logging.Verbose.Println("   - Resolvers: " + strings.Join(c.Resolvers, ", "))
+	logging.Verbose.Println("   - RecurseOn: ", c.RecurseOn)
+	logging.Verbose.Println("   - LocalZones: ", c.LocalZones)
+	logging.Verbose.Println("   - CacheSize: ", c.CacheSize)
+	logging.Verbose.Println("   - CacheMaxTTL: ", c.CacheMaxTTL)
+	logging.Verbose.Println("   - AnswerCacheSize: ", c.AnswerCacheSize)
+	logging.Verbose.Println("   - Blocklists: " + strings.Join(c.Blocklists, ", "))
+	logging.Verbose.Println("   - BlocklistRefresh: ", c.BlocklistRefresh)
+	logging.Verbose.Println("   - Sinkhole: " + c.Sinkhole)
+	for _, z := range c.RPZ {
+		logging.Verbose.Println("   - RPZ " + z.Zone + ": " + z.File + z.Primary)
+	}
+	logging.Verbose.Println("   - RPZRefresh: ", c.RPZRefresh)
+	logging.Verbose.Println("   - RaceResolvers: ", c.RaceResolvers)
+	logging.Verbose.Println("   - CoalesceQueries: ", c.CoalesceQueries)
+	logging.Verbose.Println("   - RateLimitQPS: ", c.RateLimitQPS)
+	logging.Verbose.Println("   - RateLimitBurst: ", c.RateLimitBurst)
+	logging.Verbose.Println("   - RateLimitAction: " + c.RateLimitAction)
+	logging.Verbose.Println("   - RRLRate: ", c.RRLRate)
+	logging.Verbose.Println("   - RRLSlip: ", c.RRLSlip)
+	logging.Verbose.Println("   - QueryLog: " + c.QueryLog)
+	logging.Verbose.Println("   - QueryLogSample: ", c.QueryLogSample)
+	logging.Verbose.Println("   - Dnstap: " + c.Dnstap)
+	logging.Verbose.Println("   - MaxForwardHops: ", c.MaxForwardHops)
+	logging.Verbose.Println("   - MaxReferrals: ", c.MaxReferrals)
+	logging.Verbose.Println("   - QNameMinimize: ", c.QNameMinimize)
+	logging.Verbose.Println("   - TrimAnswers: ", c.TrimAnswers)
+	logging.Verbose.Println("   - AllowQuery: " + strings.Join(c.AllowQuery, ", "))
+	logging.Verbose.Println("   - AllowRecursion: " + strings.Join(c.AllowRecursion, ", "))
+	logging.Verbose.Println("   - AXFRAllow: " + strings.Join(c.AXFRAllow, ", "))
+	for name := range c.TSIGKeys {
+		logging.Verbose.Println("   - TSIGKey: " + name)
+	}
+	logging.Verbose.Println("   - Notify: " + strings.Join(c.Notify, ", "))
+	logging.Verbose.Println("   - IXFRJournal: ", c.IXFRJournal)
+	logging.Verbose.Println("   - CatalogZone: " + c.CatalogZone)
+	logging.Verbose.Println("   - CatalogMembers: " + strings.Join(c.CatalogMembers, ", "))
+	logging.Verbose.Println("   - Peers: " + strings.Join(c.Peers, ", "))
+	logging.Verbose.Println("   - WarmupFromPeers: ", c.WarmupFromPeers)
+	logging.Verbose.Println("   - SnapshotFile: " + c.SnapshotFile)
+	logging.Verbose.Println("   - AnswerBudget: ", c.AnswerBudget)
+	logging.Verbose.Println("   - Filters: ", c.Filters)
+	logging.Verbose.Println("   - InactiveAgents: " + c.InactiveAgents)
+	logging.Verbose.Println("   - MaintenanceAgents: " + c.MaintenanceAgents)
+	logging.Verbose.Println("   - DrainSeconds: ", c.DrainSeconds)
+	logging.Verbose.Println("   - FlapSeconds: ", c.FlapSeconds)
+	logging.Verbose.Println("   - AnswerOrder: " + c.AnswerOrder)
+	logging.Verbose.Println("   - HealthFirst: ", c.HealthFirst)
+	logging.Verbose.Println("   - HealthOmitShare: ", c.HealthOmitShare)
+	logging.Verbose.Println("   - CanarySeconds: ", c.CanarySeconds)
+	logging.Verbose.Println("   - CanaryMaxMismatch: ", c.CanaryMaxMismatch)
+	logging.Verbose.Println("   - NameTemplate: " + c.NameTemplate)
+	logging.Verbose.Println("   - SRVTemplate: " + c.SRVTemplate)
+	logging.Verbose.Println("   - NameSanitize: " + c.NameSanitize)
+	logging.Verbose.Println("   - IncludeFrameworks: ", c.IncludeFrameworks)
+	logging.Verbose.Println("   - ExcludeFrameworks: ", c.ExcludeFrameworks)
+	logging.Verbose.Println("   - RoleZones: ", c.RoleZones)
+	logging.Verbose.Println("   - RoleACLs: ", c.RoleACLs)
+	logging.Verbose.Println("   - CollapseVersions: ", c.CollapseVersions)
+	logging.Verbose.Println("   - EnumerateTasks: ", c.EnumerateTasks)
+	logging.Verbose.Println("   - TaskIDRecords: ", c.TaskIDRecords)
+	logging.Verbose.Println("   - AttributeKeys: ", c.AttributeKeys)
+	logging.Verbose.Println("   - TraceEndpoint: " + c.TraceEndpoint)
+	logging.Verbose.Println("   - TraceSampleRate: ", c.TraceSampleRate)
+	logging.Verbose.Println("   - StatsdAddress: " + c.StatsdAddress)
+	logging.Verbose.Println("   - StatsdFormat: " + c.StatsdFormat)
+	logging.Verbose.Println("   - StatsdPrefix: " + c.StatsdPrefix)
+	logging.Verbose.Println("   - StatsdFlushSeconds: ", c.StatsdFlushSeconds)
+	logging.Verbose.Println("   - HTTPOn: ", c.HTTPOn)
+	logging.Verbose.Println("   - HTTPListener: " + c.HTTPListener)
+	logging.Verbose.Println("   - HTTPPort: ", c.HTTPPort)
+	logging.Verbose.Println("   - ReadyRefreshPeriods: ", c.ReadyRefreshPeriods)
+	logging.Verbose.Println("   - ACMETTL: ", c.ACMETTL)
+	logging.Verbose.Println("   - SelfReportSeconds: ", c.SelfReportSeconds)
+	logging.Verbose.Println("   - HeapWarnMB: ", c.HeapWarnMB)
+	logging.Verbose.Println("   - GoroutineWarn: ", c.GoroutineWarn)
+	logging.Verbose.Println("   - FDWarn: ", c.FDWarn)
+	logging.Verbose.Println("   - DNSSEC: ", c.DNSSEC)
+	logging.Verbose.Println("   - DNSSECKSK: " + c.DNSSECKSK)
+	logging.Verbose.Println("   - DNSSECZSK: " + c.DNSSECZSK)
+	logging.Verbose.Println("   - DNSSECValidate: ", c.DNSSECValidate)
+	for _, a := range c.TrustAnchors {
+		logging.Verbose.Println("   - TrustAnchors: " + a)
+	}
+	logging.Verbose.Println("   - UnderscoreNames: " + c.UnderscoreNames)
+	for name, txts := range c.UnderscoreTXT {
+		logging.Verbose.Println("   - UnderscoreTXT: " + name + " -> " + strings.Join(txts, ", "))
+	}
+	logging.Verbose.Println("   - TXTLabels: " + strings.Join(c.TXTLabels, ", "))
+	logging.Verbose.Println("   - TXTRedact: " + strings.Join(c.TXTRedact, ", "))
+	logging.Verbose.Println("   - AliasLabel: " + c.AliasLabel)
+	for name, addrs := range c.Overrides {
+		logging.Verbose.Println("   - Override: " + name + " -> " + strings.Join(addrs, ", "))
+	}
+	for name, target := range c.CNAMEs {
+		logging.Verbose.Println("   - CNAME: " + name + " -> " + target)
+	}
+	for name, target := range c.DNAMEs {
+		logging.Verbose.Println("   - DNAME: " + name + " -> " + target)
+	}
+	for name, values := range c.CAA {
+		logging.Verbose.Println("   - CAA: " + name + " -> " + strings.Join(values, ", "))
+	}
+	logging.Verbose.Println("   - HostsFiles: " + strings.Join(c.HostsFiles, ", "))
+	for zone, addrs := range c.StubZones {
+		logging.Verbose.Println("   - StubZone: " + zone + " -> " + strings.Join(addrs, ", "))
+	}
 	logging.Verbose.Println("   - Email: " + c.Email)
 	logging.Verbose.Println("   - Mname: " + c.Mname)
+	logging.Verbose.Println("   - Nameservers: " + strings.Join(c.Nameservers, ", "))
+	logging.Verbose.Println("   - SOARefresh: ", c.SOARefresh)
+	logging.Verbose.Println("   - SOARetry: ", c.SOARetry)
+	logging.Verbose.Println("   - SOAExpire: ", c.SOAExpire)
+	logging.Verbose.Println("   - SOAMinttl: ", c.SOAMinttl)
 
-	return c
+	return c, nil
+}
+
+// Problem is an issue with a configuration found by Check
+type Problem struct {
+	// Fatal problems prevent mesos-dns from starting, the rest are
+	// warnings
+	Fatal bool
+	Msg   string
+}
+
+func (p Problem) String() string {
+	if p.Fatal {
+		return "config error: " + p.Msg
+	}
+	return "config warning: " + p.Msg
+}
+
+// Check validates the configuration and returns every problem found,
+// fatal errors and warnings alike
+func (c Config) Check() []Problem {
+	var problems []Problem
+	fatal := func(msg string) {
+		problems = append(problems, Problem{Fatal: true, Msg: msg})
+	}
+	warn := func(msg string) {
+		problems = append(problems, Problem{Fatal: false, Msg: msg})
+	}
+
+	if len(c.Masters) == 0 && len(c.Clusters) == 0 {
+		fatal("please specify mesos masters in config.json")
+	}
+	for _, m := range c.Masters {
+		if _, _, err := net.SplitHostPort(m); err != nil {
+			fatal("master " + m + " is not host:port")
+		}
+	}
+
+	clusters := make(map[string]bool, len(c.Clusters))
+	for _, cl := range c.Clusters {
+		switch {
+		case cl.Name == "" || strings.Contains(cl.Name, ".") || !validDomain(cl.Name):
+			fatal("invalid cluster name \"" + cl.Name + "\"")
+		case clusters[cl.Name]:
+			fatal("cluster " + cl.Name + " is listed twice")
+		case len(cl.Masters) == 0:
+			fatal("cluster " + cl.Name + " has no masters")
+		}
+		clusters[cl.Name] = true
+
+		for _, m := range cl.Masters {
+			if _, _, err := net.SplitHostPort(m); err != nil {
+				fatal("master " + m + " of cluster " + cl.Name + " is not host:port")
+			}
+		}
+	}
+
+	if c.Domain == "" || !validDomain(c.Domain) {
+		fatal("invalid domain \"" + c.Domain + "\"")
+	}
+
+	for _, alias := range c.DomainAliases {
+		switch {
+		case !validDomain(alias):
+			fatal("invalid domain alias \"" + alias + "\"")
+		case alias == c.Domain || strings.HasSuffix(alias, "."+c.Domain) || strings.HasSuffix(c.Domain, "."+alias):
+			fatal("domain alias " + alias + " overlaps domain " + c.Domain)
+		}
+	}
+
+	if c.Port <= 0 || c.Port > 65535 {
+		fatal("port " + strconv.Itoa(c.Port) + " out of range")
+	}
+
+	if net.ParseIP(c.Listener) == nil {
+		fatal("listener " + c.Listener + " is not an IP address")
+	}
+
+	if c.ReplySource != "" {
+		if net.ParseIP(c.ReplySource) == nil {
+			fatal("replysource " + c.ReplySource + " is not an IP address")
+		} else if c.Listener != "0.0.0.0" {
+			warn("replysource only applies when listening on 0.0.0.0")
+		}
+	}
+
+	if _, _, err := Account(c.User, c.Group); err != nil {
+		fatal(err.Error())
+	}
+
+	if c.DoQPort < 0 || c.DoQPort > 65535 {
+		fatal("doqport " + strconv.Itoa(c.DoQPort) + " out of range")
+	} else if c.DoQPort > 0 {
+		if _, err := tls.LoadX509KeyPair(c.DoQCert, c.DoQKey); err != nil {
+			fatal("cannot load doqcert and doqkey: " + err.Error())
+		}
+	}
+
+	if c.DNS64Prefix != "" {
+		ip, network, err := net.ParseCIDR(c.DNS64Prefix)
+		if err != nil || ip.To4() != nil {
+			fatal("dns64prefix " + c.DNS64Prefix + " is not an IPv6 prefix")
+		} else if ones, _ := network.Mask.Size(); ones != 32 && ones != 40 && ones != 48 && ones != 56 && ones != 64 && ones != 96 {
+			fatal("dns64prefix " + c.DNS64Prefix + " must be a /32, /40, /48, /56, /64 or /96")
+		} else if ones == 96 && network.IP[8] != 0 {
+			// RFC 6052, section 2.2
+			fatal("dns64prefix " + c.DNS64Prefix + " must have bits 64 to 71 set to zero")
+		}
+	}
+
+	if c.PushPort < 0 || c.PushPort > 65535 {
+		fatal("pushport " + strconv.Itoa(c.PushPort) + " out of range")
+	} else if c.PushPort > 0 {
+		if _, err := tls.LoadX509KeyPair(c.PushCert, c.PushKey); err != nil {
+			fatal("cannot load pushcert and pushkey: " + err.Error())
+		}
+	}
+
+	if c.Email == "" {
+		fatal("email must not be empty")
+	}
+
+	if _, ok := presets[c.Preset]; c.Preset != "" && !ok {
+		fatal("preset must be fast-failover, stable or bulk-batch")
+	}
+
+	if c.RefreshSeconds <= 0 {
+		fatal("refreshSeconds must be positive")
+	}
+
+	if c.RefreshJitter < 0 || c.RefreshJitter >= 1 {
+		fatal("refreshjitter must be at least 0 and less than 1")
+	}
+
+	if c.RefreshBackoffMax < 0 {
+		fatal("refreshbackoffmax must not be negative")
+	} else if c.RefreshBackoffMax > 0 && c.RefreshBackoffMax < c.RefreshSeconds {
+		fatal("refreshbackoffmax must not be shorter than refreshSeconds")
+	}
+
+	if c.TTL < 0 {
+		fatal("ttl must not be negative")
+	} else if c.TTL == 0 {
+		warn("ttl of 0 disables caching of all answers")
+	} else if c.TTL < c.RefreshSeconds {
+		warn("ttl is shorter than refreshSeconds, clients will re-query unchanged records")
+	}
+
+	for name, ttl := range c.TTLOverrides {
+		if ttl < 0 {
+			fatal("ttl override for " + name + " must not be negative")
+		}
+	}
+
+	if c.Timeout > 0 && c.RefreshSeconds > 0 && c.RefreshSeconds <= c.Timeout {
+		warn("refreshSeconds is not longer than timeout, refreshes may overlap")
+	}
+
+	if c.SOARefresh < 0 || c.SOARetry < 0 || c.SOAExpire < 0 || c.SOAMinttl < 0 {
+		fatal("soarefresh, soaretry, soaexpire and soaminttl must not be negative")
+	}
+
+	if c.SOAExpire < c.SOARefresh+c.SOARetry {
+		warn("soaexpire should be larger than soarefresh + soaretry")
+	}
+
+	if c.CacheSize < 0 || c.CacheMaxTTL < 0 || c.AnswerCacheSize < 0 {
+		fatal("cachesize, cachemaxttl and answercachesize must not be negative")
+	}
+
+	zones := make(map[string]bool, len(c.RPZ))
+	for _, z := range c.RPZ {
+		_, _, perr := net.SplitHostPort(z.Primary)
+		key := z.TSIGKey == ""
+		for name := range c.TSIGKeys {
+			key = key || dns.Fqdn(strings.ToLower(name)) == dns.Fqdn(strings.ToLower(z.TSIGKey))
+		}
+
+		switch {
+		case z.Zone == "" || !validDomain(strings.TrimSuffix(z.Zone, ".")):
+			fatal("invalid rpz zone \"" + z.Zone + "\"")
+		case zones[dns.Fqdn(strings.ToLower(z.Zone))]:
+			fatal("rpz zone " + z.Zone + " is listed twice")
+		case (z.File == "") == (z.Primary == ""):
+			fatal("rpz zone " + z.Zone + " needs either a file or a primary")
+		case z.Primary != "" && perr != nil:
+			fatal("rpz primary " + z.Primary + " is not host:port")
+		case !key:
+			fatal("rpz zone " + z.Zone + " uses unknown tsig key " + z.TSIGKey)
+		}
+		zones[dns.Fqdn(strings.ToLower(z.Zone))] = true
+	}
+	if len(c.RPZ) > 0 && c.RPZRefresh <= 0 {
+		fatal("rpzrefresh must be positive")
+	}
+
+	if len(c.Blocklists) > 0 && c.BlocklistRefresh <= 0 {
+		fatal("blocklistrefresh must be positive")
+	}
+
+	if c.HTTPOn && (c.HTTPPort <= 0 || c.HTTPPort > 65535) {
+		fatal("httpport " + strconv.Itoa(c.HTTPPort) + " out of range")
+	}
+
+	if c.HTTPOn && net.ParseIP(c.HTTPListener) == nil {
+		fatal("httplistener " + c.HTTPListener + " is not an IP address")
+	}
+
+	// the dns server listens on tcp too
+	if c.HTTPOn && c.HTTPPort == c.Port &&
+		(c.HTTPListener == c.Listener || c.HTTPListener == "0.0.0.0" || c.Listener == "0.0.0.0") {
+		fatal("httpport and port must differ on the same listener")
+	}
+
+	if c.HTTPOn && c.ReadyRefreshPeriods <= 0 {
+		fatal("readyrefreshperiods must be positive")
+	}
+
+	if c.TraceSampleRate < 0 || c.TraceSampleRate > 1 {
+		fatal("tracesamplerate must be between 0 and 1")
+	}
+
+	if c.TraceEndpoint != "" {
+		if u, err := url.Parse(c.TraceEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			fatal("traceendpoint " + c.TraceEndpoint + " is not an http url")
+		}
+	}
+
+	if c.StatsdFormat != "statsd" && c.StatsdFormat != "graphite" {
+		fatal("statsdformat must be statsd or graphite")
+	}
+
+	if c.StatsdAddress != "" {
+		if _, _, err := net.SplitHostPort(c.StatsdAddress); err != nil {
+			fatal("statsdaddress " + c.StatsdAddress + " is not a host:port")
+		}
+		if c.StatsdFlushSeconds <= 0 {
+			fatal("statsdflushseconds must be positive")
+		}
+	}
+
+	if c.InactiveAgents != "drop" && c.InactiveAgents != "quarantine" {
+		fatal("inactiveagents must be drop or quarantine")
+	}
+
+	if c.MaintenanceAgents != "ignore" && c.MaintenanceAgents != "deprioritize" && c.MaintenanceAgents != "drop" {
+		fatal("maintenanceagents must be ignore, deprioritize or drop")
+	}
+
+	if c.RateLimitQPS < 0 || c.RateLimitBurst < 0 {
+		fatal("ratelimitqps and ratelimitburst must not be negative")
+	}
+	if c.RateLimitAction != "refuse" && c.RateLimitAction != "drop" {
+		fatal("ratelimitaction must be refuse or drop")
+	}
+	if c.RRLRate < 0 || c.RRLSlip < 0 {
+		fatal("rrlrate and rrlslip must not be negative")
+	}
+	if c.QueryLogSample <= 0 || c.QueryLogSample > 1 {
+		fatal("querylogsample must be more than 0 and at most 1")
+	}
+	if c.Dnstap == "unix:" {
+		fatal("dnstap must name the unix socket, unix:path")
+	}
+
+	if n := len(c.LOCAttributes); n == 1 || n > 3 {
+		fatal("locattributes must name the latitude, longitude and optionally altitude attributes")
+	}
+
+	if c.SRVWeight != "none" && c.SRVWeight != "cpus" && c.SRVWeight != "mem" {
+		fatal("srvweight must be none, cpus or mem")
+	}
+
+	switch c.AnswerOrder {
+	case "random", "roundrobin", "weighted", "hash", "sorted":
+	default:
+		fatal("answerorder must be random, roundrobin, weighted, hash or sorted")
+	}
+
+	if c.DrainSeconds < 0 {
+		fatal("drainseconds must not be negative")
+	}
+
+	if problem := checkTemplate(c.NameTemplate, "task"); problem != "" {
+		fatal("nametemplate " + problem)
+	}
+
+	if problem := checkTemplate(c.SRVTemplate, "task", "protocol"); problem != "" {
+		fatal("srvtemplate " + problem)
+	}
+
+	if c.NameSanitize != "strip" && c.NameSanitize != "dash" {
+		fatal("namesanitize must be strip or dash")
+	}
+
+	for _, pattern := range append(c.IncludeFrameworks, c.ExcludeFrameworks...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fatal("invalid framework pattern " + pattern)
+		}
+	}
+
+	for role, cidrs := range c.RoleACLs {
+		for _, cidr := range cidrs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				fatal("roleacls " + cidr + " of " + role + " is not a CIDR")
+			}
+		}
+	}
+	if len(c.RoleACLs) > 0 && !c.RoleZones {
+		warn("roleacls have no effect without rolezones")
+	}
+
+	if c.CanarySeconds < 0 || (c.CanarySeconds > 0 && c.CanarySeconds >= c.RefreshSeconds) {
+		fatal("canaryseconds must be between 0 and refreshSeconds")
+	}
+
+	if c.HealthOmitShare < 0 || c.HealthOmitShare > 1 {
+		fatal("healthomitshare must be between 0 and 1")
+	}
+
+	if c.CanaryMaxMismatch < 0 || c.CanaryMaxMismatch > 1 {
+		fatal("canarymaxmismatch must be between 0 and 1")
+	}
+
+	if c.FlapSeconds < 0 {
+		fatal("flapseconds must not be negative")
+	}
+
+	if c.AnswerBudget < 0 {
+		fatal("answerbudget must not be negative")
+	}
+
+	if c.ACMETTL <= 0 {
+		fatal("acmettl must be positive")
+	}
+
+	if c.Verbosity < 0 || c.Verbosity > 2 {
+		fatal("verbosity must be 0, 1 or 2")
+	}
+
+	switch c.LogBackend {
+	case "stdout", "syslog":
+	case "file":
+		if c.LogFile == "" {
+			fatal("logfile must be set for the file logbackend")
+		}
+	default:
+		fatal("logbackend must be stdout, syslog or file")
+	}
+	if c.LogMaxSizeMB < 0 || c.LogMaxAgeHours < 0 || c.LogBackups < 0 {
+		fatal("logmaxsizemb, logmaxagehours and logbackups must not be negative")
+	}
+	if c.SyslogAddress != "" {
+		if _, _, err := net.SplitHostPort(c.SyslogAddress); err != nil {
+			fatal("syslogaddress must be host:port")
+		}
+	}
+
+	if c.SelfReportSeconds <= 0 {
+		fatal("selfreportseconds must be positive")
+	}
+
+	if c.HeapWarnMB < 0 || c.GoroutineWarn < 0 || c.FDWarn < 0 {
+		fatal("heapwarnmb, goroutinewarn and fdwarn must not be negative")
+	}
+
+	if c.Sinkhole != "" && net.ParseIP(c.Sinkhole) == nil {
+		fatal("sinkhole " + c.Sinkhole + " is not an IP address")
+	}
+
+	for name, addrs := range c.Overrides {
+		for _, addr := range addrs {
+			if net.ParseIP(addr) == nil {
+				fatal("invalid override address " + addr + " for " + name)
+			}
+		}
+	}
+
+	for name, values := range c.CAA {
+		if !dns.IsSubDomain(c.Domain+".", name) {
+			fatal("caa name " + name + " is not in the mesos domain")
+		}
+		for _, value := range values {
+			if rr, err := dns.NewRR(name + " IN CAA " + value); err != nil || rr == nil {
+				fatal("invalid caa " + value + " for " + name)
+			}
+		}
+	}
+
+	for _, path := range c.HostsFiles {
+		if _, err := os.Stat(path); err != nil {
+			warn("can't read hosts file " + path + ": " + err.Error())
+		}
+	}
+	if c.SSHFPFile != "" {
+		if _, err := os.Stat(c.SSHFPFile); err != nil {
+			warn("can't read sshfp file " + c.SSHFPFile + ": " + err.Error())
+		}
+	}
+
+	for zone, addrs := range c.StubZones {
+		if _, ok := dns.IsDomainName(zone); !ok || zone == "." {
+			fatal("stub zone " + zone + " is not a domain")
+		}
+		if dns.IsSubDomain(c.Domain+".", zone) {
+			fatal("stub zone " + zone + " is in the mesos domain")
+		}
+		if len(addrs) == 0 {
+			fatal("stub zone " + zone + " has no resolvers")
+		}
+		for _, addr := range addrs {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			if net.ParseIP(host) == nil {
+				fatal("stub zone " + zone + " resolver " + addr + " is not an IP address or IP:port")
+			}
+		}
+	}
+
+	if c.UnderscoreNames != "nxdomain" && c.UnderscoreNames != "forward" {
+		fatal("underscorenames must be nxdomain or forward")
+	}
+
+	if c.UnderscoreNames == "forward" && !c.RecurseOn {
+		warn("underscorenames is forward but recurseon is off, they will be refused")
+	}
+
+	for name := range c.UnderscoreTXT {
+		fqdn := dns.Fqdn(strings.ToLower(name))
+		if !strings.HasPrefix(fqdn, "_") || !strings.HasSuffix(fqdn, "."+strings.ToLower(c.Domain)+".") {
+			fatal("underscoretxt name " + name + " must start with _ and be in the domain")
+		}
+	}
+
+	for _, ns := range c.Nameservers {
+		if _, ok := dns.IsDomainName(ns); !ok {
+			fatal("invalid nameserver " + ns)
+		}
+	}
+
+	for name, target := range c.CNAMEs {
+		fqdn := dns.Fqdn(strings.ToLower(name))
+		if !strings.HasSuffix(fqdn, "."+strings.ToLower(c.Domain)+".") {
+			fatal("cname " + name + " must be in the domain")
+		}
+		if _, ok := dns.IsDomainName(target); !ok || dns.Fqdn(strings.ToLower(target)) == fqdn {
+			fatal("invalid cname target " + target + " for " + name)
+		}
+	}
+
+	for name, target := range c.DNAMEs {
+		fqdn := dns.Fqdn(strings.ToLower(name))
+		if !strings.HasSuffix(fqdn, "."+strings.ToLower(c.Domain)+".") {
+			fatal("dname " + name + " must be in the domain")
+		}
+		if _, ok := dns.IsDomainName(target); !ok || dns.IsSubDomain(fqdn, dns.Fqdn(strings.ToLower(target))) {
+			fatal("invalid dname target " + target + " for " + name)
+		}
+	}
+
+	for _, cidr := range c.AllowQuery {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			fatal("allowquery " + cidr + " is not a CIDR")
+		}
+	}
+	for _, cidr := range c.AllowRecursion {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			fatal("allowrecursion " + cidr + " is not a CIDR")
+		}
+	}
+	if len(c.AllowRecursion) > 0 && !c.RecurseOn {
+		warn("allowrecursion is set but recurseon is false")
+	}
+
+	for _, cidr := range c.AXFRAllow {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			fatal("axfrallow " + cidr + " is not a CIDR")
+		}
+	}
+
+	for name, secret := range c.TSIGKeys {
+		if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+			fatal("tsig key " + name + " is not base64")
+		}
+	}
+
+	for _, ns := range c.Notify {
+		host, _, err := net.SplitHostPort(ns)
+		if err != nil {
+			host = ns
+		}
+		if net.ParseIP(host) == nil {
+			fatal("notify " + ns + " is not an IP address or IP:port")
+		}
+	}
+
+	for _, peer := range c.Peers {
+		host, _, err := net.SplitHostPort(peer)
+		if err != nil {
+			host = peer
+		}
+		if net.ParseIP(host) == nil {
+			fatal("peer " + peer + " is not an IP address or IP:port")
+		}
+	}
+
+	if c.WarmupFromPeers && len(c.Peers) == 0 {
+		warn("warmupfrompeers is set but there are no peers")
+	}
+	if c.SnapshotFile != "" {
+		if fi, err := os.Stat(filepath.Dir(c.SnapshotFile)); err != nil || !fi.IsDir() {
+			fatal("snapshotfile " + c.SnapshotFile + " is not in an existing directory")
+		}
+	}
+
+	if c.IXFRJournal < 0 {
+		fatal("ixfrjournal must not be negative")
+	}
+
+	if c.CatalogZone != "" {
+		switch {
+		case !validDomain(c.CatalogZone):
+			fatal("invalid catalog zone \"" + c.CatalogZone + "\"")
+		case c.CatalogZone == c.Domain || strings.HasSuffix(c.CatalogZone, "."+c.Domain) || strings.HasSuffix(c.Domain, "."+c.CatalogZone):
+			fatal("catalog zone " + c.CatalogZone + " overlaps domain " + c.Domain)
+		}
+		if len(c.AXFRAllow) == 0 && len(c.TSIGKeys) == 0 {
+			warn("catalogzone is set but zone transfers are not allowed")
+		}
+	}
+
+	for _, member := range c.CatalogMembers {
+		if !validDomain(member) {
+			fatal("invalid catalog member \"" + member + "\"")
+		}
+	}
+
+	if len(c.Notify) > 0 && len(c.AXFRAllow) == 0 && len(c.TSIGKeys) == 0 {
+		warn("notify is set but zone transfers are not allowed")
+	}
+
+	if (c.DNSSECKSK == "") != (c.DNSSECZSK == "") {
+		fatal("dnssecksk and dnsseczsk must be set together")
+	}
+
+	if c.DNSSEC && c.DNSSECKSK == "" {
+		warn("dnssec keys are generated at startup, the DS record changes on every restart")
+	}
+
+	if c.DNSSECValidate {
+		if !c.RecurseOn {
+			warn("dnssecvalidate is set but recursion is off")
+		}
+		if len(c.TrustAnchors) == 0 {
+			fatal("dnssecvalidate needs trustanchors")
+		}
+		for _, a := range c.TrustAnchors {
+			rr, err := dns.NewRR(a)
+			if err != nil {
+				fatal("invalid trust anchor " + a + ": " + err.Error())
+				continue
+			}
+			switch rr.(type) {
+			case *dns.DS, *dns.DNSKEY:
+			default:
+				fatal("trust anchor " + a + " is not a DS or DNSKEY record")
+			}
+		}
+	}
+
+	if c.RecurseOn && c.MaxForwardHops <= 0 {
+		fatal("maxforwardhops must be positive")
+	}
+
+	if c.MaxReferrals < 0 {
+		fatal("maxreferrals can't be negative")
+	}
+
+	if c.RecurseOn && len(c.Resolvers) == 0 {
+		warn("recursion is on but no resolvers are configured")
+	}
+
+	if c.Port == 53 {
+		local := localAddies()
+		for _, r := range c.Resolvers {
+			if r == c.Listener || (c.Listener == "0.0.0.0" && contains(local, r)) {
+				warn("resolver " + r + " is this mesos-dns instance, forwarded queries will loop")
+			}
+		}
+	}
+
+	if c.MasterPassword != "" && c.MasterUser == "" {
+		warn("masterpassword is set without masteruser and is ignored")
+	}
+
+	return problems
+}
+
+// validDomain reports whether domain is a syntactically valid domain name
+func validDomain(domain string) bool {
+	_, ok := dns.IsDomainName(domain)
+	return ok && !strings.ContainsAny(domain, " *")
+}
+
+// contains reports whether s is one of list
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
 }
 
 // localAddies returns an array of local ipv4 addresses
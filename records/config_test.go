@@ -14,3 +14,152 @@ func TestNonLocalAddies(t *testing.T) {
 		}
 	}
 }
+
+func TestCheck(t *testing.T) {
+	valid := Config{
+		Masters:             []string{"127.0.0.1:5050"},
+		RefreshSeconds:      60,
+		TTL:                 60,
+		Domain:              "mesos",
+		Port:                8053,
+		Timeout:             5,
+		Email:               "root.mesos-dns.mesos",
+		Resolvers:           []string{"8.8.8.8"},
+		Listener:            "0.0.0.0",
+		RecurseOn:           true,
+		MaxForwardHops:      3,
+		MaxReferrals:        3,
+		SOARefresh:          60,
+		SOARetry:            600,
+		SOAExpire:           86400,
+		SOAMinttl:           60,
+		SelfReportSeconds:   60,
+		UnderscoreNames:     "nxdomain",
+		ACMETTL:             600,
+		ReadyRefreshPeriods: 3,
+		InactiveAgents:      "drop",
+		MaintenanceAgents:   "ignore",
+		AnswerOrder:         "random",
+		SRVWeight:           "none",
+		RateLimitAction:     "refuse",
+		QueryLogSample:      1,
+		LogBackend:          "stdout",
+		StatsdFormat:        "statsd",
+		NameTemplate:        "{task}.{framework}.{domain}",
+		SRVTemplate:         "_{task}._{protocol}.{framework}.{domain}",
+		NameSanitize:        "strip",
+	}
+
+	if problems := valid.Check(); len(problems) != 0 {
+		t.Error("valid config has problems:", problems)
+	}
+
+	c := valid
+	c.Masters = nil
+	c.Port = 0
+	c.TTL = 0
+	problems := c.Check()
+
+	fatals, warnings := 0, 0
+	for _, p := range problems {
+		if p.Fatal {
+			fatals++
+		} else {
+			warnings++
+		}
+	}
+
+	// all problems are reported at once
+	if fatals != 2 || warnings != 1 {
+		t.Error("expected 2 fatal problems and 1 warning, got", problems)
+	}
+
+	c = valid
+	c.Port = 53
+	c.Listener = "10.0.0.1"
+	c.Resolvers = []string{"10.0.0.1"}
+	problems = c.Check()
+	if len(problems) != 1 || problems[0].Fatal {
+		t.Error("should warn about forwarding to ourselves, got", problems)
+	}
+
+	// the http api may share the dns port on another address
+	c = valid
+	c.Listener = "10.0.0.1"
+	c.HTTPOn = true
+	c.HTTPListener = "127.0.0.1"
+	c.HTTPPort = c.Port
+	if problems = c.Check(); len(problems) != 0 {
+		t.Error("http api on its own listener has problems:", problems)
+	}
+
+	c.HTTPListener = "10.0.0.1"
+	if problems = c.Check(); len(problems) != 1 || !problems[0].Fatal {
+		t.Error("should not let the http api take the dns port, got", problems)
+	}
+
+	var rpzs = []struct {
+		zone RPZ
+		ok   bool
+	}{
+		{RPZ{Zone: "rpz.local", File: "rpz.db"}, true},
+		{RPZ{Zone: "rpz.local", Primary: "10.0.0.1:53"}, true},
+		{RPZ{Zone: "rpz.local", Primary: "10.0.0.1"}, false},
+		{RPZ{Zone: "rpz.local"}, false},
+		{RPZ{Zone: "rpz.local", File: "rpz.db", Primary: "10.0.0.1:53"}, false},
+		{RPZ{Zone: "rpz.local", Primary: "10.0.0.1:53", TSIGKey: "missing"}, false},
+	}
+	for _, tt := range rpzs {
+		c = valid
+		c.RPZ = []RPZ{tt.zone}
+		c.RPZRefresh = 3600
+		if problems = c.Check(); (len(problems) == 0) != tt.ok {
+			t.Errorf("rpz %+v: unexpected problems %v", tt.zone, problems)
+		}
+	}
+
+	for prefix, ok := range map[string]bool{
+		"64:ff9b::/96":          true,
+		"2001:db8::/32":         true,
+		"2001:db8::/33":         false,
+		"2001:db8:0:0:100::/96": false,
+		"10.0.0.0/8":            false,
+	} {
+		c = valid
+		c.DNS64Prefix = prefix
+		if problems = c.Check(); (len(problems) == 0) != ok {
+			t.Errorf("dns64prefix %s: unexpected problems %v", prefix, problems)
+		}
+	}
+
+	c = valid
+	c.SnapshotFile = "/nonexistent/records.zone"
+	if problems = c.Check(); len(problems) != 1 || !problems[0].Fatal {
+		t.Error("should not save snapshots to a missing directory, got", problems)
+	}
+
+	for anchor, ok := range map[string]bool{
+		". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBB683457104237C7F8EC8D": true,
+		"example.com. IN A 192.0.2.1": false,
+		"not a record":                false,
+	} {
+		c = valid
+		c.DNSSECValidate = true
+		c.TrustAnchors = []string{anchor}
+		if problems = c.Check(); (len(problems) == 0) != ok {
+			t.Errorf("trust anchor %s: unexpected problems %v", anchor, problems)
+		}
+	}
+
+	c = valid
+	c.RefreshJitter = 1
+	if problems = c.Check(); len(problems) != 1 || !problems[0].Fatal {
+		t.Error("should not let the jitter reach the refresh interval, got", problems)
+	}
+
+	c = valid
+	c.RefreshBackoffMax = c.RefreshSeconds - 1
+	if problems = c.Check(); len(problems) != 1 || !problems[0].Fatal {
+		t.Error("should not back off to less than the refresh interval, got", problems)
+	}
+}
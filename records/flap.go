@@ -0,0 +1,55 @@
+package records
+
+import (
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// frameworkRR is a record generated for one of a framework's tasks
+type frameworkRR struct {
+	name  string
+	host  string
+	rtype string
+}
+
+// frameworkRR inserts a record for a task of framework fname and
+// remembers it belongs to fname
+func (rg *RecordGenerator) frameworkRR(fname string, name string, host string, rtype string) {
+	rg.frameworks[fname] = append(rg.frameworks[fname], frameworkRR{name, host, rtype})
+	rg.insertRR(name, host, rtype)
+}
+
+// HoldFrameworks keeps serving the records of the frameworks in prev
+// that are missing from rg until they have been gone for window, so a
+// framework that re-registers after a master failover does not flap
+// through NXDOMAIN
+func (rg *RecordGenerator) HoldFrameworks(prev *RecordGenerator, now time.Time, window time.Duration) {
+	// no state was loaded
+	if window <= 0 || rg.As == nil {
+		return
+	}
+
+	rg.missing = make(map[string]time.Time)
+	for fname, rrs := range prev.frameworks {
+		if _, ok := rg.frameworks[fname]; ok {
+			continue
+		}
+
+		since, ok := prev.missing[fname]
+		if !ok {
+			since = now
+		}
+		if now.Sub(since) >= window {
+			logging.Verbose.Println("framework " + fname + " is gone")
+			continue
+		}
+
+		logging.VeryVerbose.Println("holding on to the records of missing framework " + fname)
+		rg.frameworks[fname] = rrs
+		rg.missing[fname] = since
+		for _, rr := range rrs {
+			rg.insertRR(rr.name, rr.host, rr.rtype)
+		}
+	}
+}
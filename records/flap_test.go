@@ -0,0 +1,77 @@
+package records
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHoldFrameworks(t *testing.T) {
+	state := func(frameworks string) StateJSON {
+		var sj StateJSON
+		err := json.Unmarshal([]byte(`{
+			"slaves": [{"id": "s1", "hostname": "10.0.0.1"}],
+			"leader": "master@10.0.0.9:5050",
+			"frameworks": [`+frameworks+`]
+		}`), &sj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sj
+	}
+
+	both := state(`
+		{"name": "marathon", "tasks": [{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING"}]},
+		{"name": "chronos", "tasks": [{"name": "job", "slave_id": "s1", "state": "TASK_RUNNING",
+			"resources": {"ports": "[31000-31000]"}}]}`)
+	marathon := state(`
+		{"name": "marathon", "tasks": [{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING"}]}`)
+
+	config := Config{Domain: "mesos", InactiveAgents: "drop"}
+	window := 30 * time.Second
+	start := time.Unix(1433160600, 0)
+
+	var prev RecordGenerator
+	prev.InsertState(both, config)
+
+	var tests = []struct {
+		sj   StateJSON
+		at   time.Duration
+		held bool
+	}{
+		{marathon, 10 * time.Second, true},
+		// the window starts when chronos went missing, not at each reload
+		{marathon, 35 * time.Second, true},
+		{marathon, 45 * time.Second, false},
+		{marathon, 50 * time.Second, false},
+		// chronos re-registers, and then flaps again
+		{both, 60 * time.Second, true},
+		{marathon, 70 * time.Second, true},
+	}
+
+	for i, tt := range tests {
+		var rg RecordGenerator
+		rg.InsertState(tt.sj, config)
+		rg.HoldFrameworks(&prev, start.Add(tt.at), window)
+
+		_, a := rg.As["job.chronos.mesos."]
+		_, srv := rg.SRVs["_job._tcp.chronos.mesos."]
+		if a != tt.held || srv != tt.held {
+			t.Errorf("%d: expected chronos records held %v, got A %v SRV %v", i, tt.held, a, srv)
+		}
+		if _, ok := rg.As["web.marathon.mesos."]; !ok {
+			t.Errorf("%d: lost the marathon records", i)
+		}
+
+		prev = rg
+	}
+
+	// a window of 0 drops the records right away
+	prev.InsertState(both, config)
+	var rg RecordGenerator
+	rg.InsertState(marathon, config)
+	rg.HoldFrameworks(&prev, start, 0)
+	if _, ok := rg.As["job.chronos.mesos."]; ok {
+		t.Error("should not hold records without a window")
+	}
+}
@@ -8,19 +8,35 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
 )
 
 // rrs is a type of question names to resource records answers
 type rrs map[string][]string
 
 type slave struct {
-	Id       string `json:"id"`
-	Hostname string `json:"hostname"`
+	Id         string                 `json:"id"`
+	Hostname   string                 `json:"hostname"`
+	Pid        string                 `json:"pid"`
+	Active     *bool                  `json:"active"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Resources  struct {
+		Cpus float64 `json:"cpus"`
+	} `json:"resources"`
+}
+
+// active reports whether the master considers the slave active, older
+// masters don't say and all their slaves are
+func (s slave) active() bool {
+	return s.Active == nil || *s.Active
 }
 
 // Slaves is a mapping of id to hostname read in from state.json
@@ -28,30 +44,65 @@ type Slaves []slave
 
 // Resources holds our SRV ports
 type Resources struct {
-	Ports string `json:"ports"`
+	Ports string  `json:"ports"`
+	Cpus  float64 `json:"cpus"`
+	Mem   float64 `json:"mem"`
+}
+
+// Label is a key/value pair attached to a task
+type Label struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
 }
 
-// Tasks holds mesos task information read in from state.json
-type Tasks []struct {
-	FrameworkId string `json:"framework_id"`
-	Id          string `json:"id"`
-	Name        string `json:"name"`
-	SlaveId     string `json:"slave_id"`
-	State       string `json:"state"`
+// Status is a status update of a task, Healthy is set for tasks with
+// health checks
+type Status struct {
+	State     string  `json:"state"`
+	Healthy   *bool   `json:"healthy"`
+	Timestamp float64 `json:"timestamp"`
+}
+
+// Task holds mesos task information read in from state.json
+type Task struct {
+	FrameworkId string     `json:"framework_id"`
+	Id          string     `json:"id"`
+	Name        string     `json:"name"`
+	SlaveId     string     `json:"slave_id"`
+	State       string     `json:"state"`
+	Labels      []Label    `json:"labels"`
+	Statuses    []Status   `json:"statuses"`
+	Discovery   *Discovery `json:"discovery"`
 	Resources   `json:"resources"`
+
+	// instance numbers running tasks of the same name by task id
+	instance int
+
+	// draining is set for tasks on slaves entering maintenance
+	draining bool
 }
 
+// Tasks holds the tasks of a framework
+type Tasks []Task
+
 // Frameworks holds mesos frameworks information read in from state.json
 type Frameworks []struct {
 	Tasks `json:"tasks"`
 	Name  string `json:"name"`
+	Role  string `json:"role"`
 }
 
 // StateJSON is a representation of mesos master state.json
 type StateJSON struct {
-	Frameworks `json:"frameworks"`
-	Slaves     `json:"slaves"`
-	Leader     string `json:"leader"`
+	Frameworks        `json:"frameworks"`
+	Slaves            `json:"slaves"`
+	UnreachableSlaves []struct {
+		Id string `json:"id"`
+	} `json:"unreachable_slaves"`
+	Leader string `json:"leader"`
+
+	// Maintenance is the maintenance schedule of the master, if we read it
+	Maintenance []MaintenanceWindow `json:"-"`
 }
 
 // RecordGenerator is a tmp mapping of resource records and slaves
@@ -59,15 +110,210 @@ type StateJSON struct {
 // prob. want to break apart
 // refactor me - prob. not needed
 type RecordGenerator struct {
-	As   rrs
-	SRVs rrs
+	As     rrs
+	SRVs   rrs
+	TXTs   rrs
+	CNAMEs rrs
+	TLSAs  rrs
+	SSHFPs rrs
+	URIs   rrs
 	Slaves
+
+	// frameworks holds the task records of each framework in the state,
+	// missing when the ones we hold on to disappeared
+	frameworks map[string][]frameworkRR
+	missing    map[string]time.Time
+
+	// health tells for the records of tasks with health checks whether
+	// any of their tasks is healthy
+	health map[string]map[string]bool
+
+	// ttls holds the TTLs tasks ask for with their TTLLabel label
+	ttls map[string]int
+
+	// weights holds the cpus of each slave by address
+	weights map[string]float64
+
+	// ips holds the addresses of hosts by name while records are
+	// generated
+	ips map[string]string
+
+	// srvWeights holds the SRV priority and weight of tasks by name and
+	// host:port
+	srvWeights map[string]map[string]srvWeight
+
+	// locations holds the location of each slave by address
+	locations map[string]Location
+}
+
+// equal reports whether r and o hold the same records, in any order
+func (r rrs) equal(o rrs) bool {
+	if len(r) != len(o) {
+		return false
+	}
+
+	for name, hosts := range r {
+		others, ok := o[name]
+		if !ok || len(hosts) != len(others) {
+			return false
+		}
+
+		count := make(map[string]int, len(hosts))
+		for _, h := range hosts {
+			count[h]++
+		}
+		for _, h := range others {
+			count[h]--
+			if count[h] < 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Equal reports whether rg and o would serve the same zone
+func (rg *RecordGenerator) Equal(o *RecordGenerator) bool {
+	return rg.As.equal(o.As) && rg.SRVs.equal(o.SRVs) && rg.TXTs.equal(o.TXTs) && rg.CNAMEs.equal(o.CNAMEs) &&
+		rg.TLSAs.equal(o.TLSAs) && rg.SSHFPs.equal(o.SSHFPs) && rg.URIs.equal(o.URIs) &&
+		sameMap(rg.srvWeights, o.srvWeights) && sameMap(rg.locations, o.locations) && sameMap(rg.ttls, o.ttls)
+}
+
+// sameMap reports whether the maps a and b hold the same entries, a nil
+// map is the same as an empty one
+func sameMap(a, b interface{}) bool {
+	if reflect.ValueOf(a).Len() == 0 && reflect.ValueOf(b).Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// copy returns a deep copy of r, nil stays nil
+func (r rrs) copy() rrs {
+	if r == nil {
+		return nil
+	}
+
+	c := make(rrs, len(r))
+	for name, hosts := range r {
+		c[name] = append([]string(nil), hosts...)
+	}
+	return c
+}
+
+// Copy returns a copy of rg that can be changed without touching rg
+func (rg *RecordGenerator) Copy() RecordGenerator {
+	return RecordGenerator{
+		As:     rg.As.copy(),
+		SRVs:   rg.SRVs.copy(),
+		TXTs:   rg.TXTs.copy(),
+		CNAMEs: rg.CNAMEs.copy(),
+		TLSAs:  rg.TLSAs.copy(),
+		SSHFPs: rg.SSHFPs.copy(),
+		URIs:   rg.URIs.copy(),
+		Slaves: rg.Slaves,
+
+		frameworks: rg.frameworks,
+		missing:    rg.missing,
+		health:     rg.health,
+		ttls:       rg.ttls,
+		weights:    rg.weights,
+		srvWeights: rg.srvWeights,
+		locations:  rg.locations,
+	}
+}
+
+// Merge adds the records of o, generated for another cluster, to rg
+func (rg *RecordGenerator) Merge(o *RecordGenerator, cluster string) {
+	// no state was loaded
+	if o.As == nil {
+		return
+	}
+
+	if rg.As == nil {
+		rg.As = make(rrs)
+		rg.SRVs = make(rrs)
+		rg.TXTs = make(rrs)
+	}
+	if rg.CNAMEs == nil {
+		rg.CNAMEs = make(rrs)
+	}
+	if rg.TLSAs == nil {
+		rg.TLSAs = make(rrs)
+	}
+	if rg.SSHFPs == nil {
+		rg.SSHFPs = make(rrs)
+	}
+	if rg.URIs == nil {
+		rg.URIs = make(rrs)
+	}
+	if rg.frameworks == nil {
+		rg.frameworks = make(map[string][]frameworkRR)
+	}
+
+	for rtype, set := range map[string]rrs{"A": o.As, "SRV": o.SRVs, "TXT": o.TXTs, "CNAME": o.CNAMEs, "TLSA": o.TLSAs,
+		"SSHFP": o.SSHFPs, "URI": o.URIs} {
+		for name, hosts := range set {
+			for _, host := range hosts {
+				rg.insertRR(name, host, rtype)
+			}
+		}
+	}
+
+	// frameworks of the same name in different clusters are different
+	for fname, rrs := range o.frameworks {
+		rg.frameworks[fname+"."+cluster] = rrs
+	}
+	for name, ttl := range o.ttls {
+		rg.setTTL(name, ttl)
+	}
+	for name, hosts := range o.health {
+		for host, healthy := range hosts {
+			rg.markHealth(name, host, healthy)
+		}
+	}
+	for name, hosts := range o.srvWeights {
+		for host, w := range hosts {
+			rg.setSRVWeight(name, host, w)
+		}
+	}
+	if rg.weights == nil {
+		rg.weights = make(map[string]float64)
+	}
+	for host, weight := range o.weights {
+		rg.weights[host] = weight
+	}
+	if rg.locations == nil {
+		rg.locations = make(map[string]Location)
+	}
+	for host, loc := range o.locations {
+		rg.locations[host] = loc
+	}
+	rg.Slaves = append(rg.Slaves, o.Slaves...)
+}
+
+// Insert adds a record of type rtype ("A", "SRV", "TXT", "CNAME", "TLSA",
+// "SSHFP" or "URI") for name, host is the address, host:port target,
+// text, canonical name, "usage selector type data", "algorithm type
+// fingerprint" or URI respectively
+func (rg *RecordGenerator) Insert(name string, host string, rtype string) {
+	// no state was loaded
+	if rg.As == nil {
+		return
+	}
+
+	rg.insertRR(name, host, rtype)
 }
 
-// hostBySlaveId looks up a hostname by slave_id
+// hostBySlaveId looks up the address of a slave by slave_id, its
+// hostname if it has none
 func (rg *RecordGenerator) hostBySlaveId(slaveId string) (string, error) {
 	for i := 0; i < len(rg.Slaves); i++ {
 		if rg.Slaves[i].Id == slaveId {
+			if ip, ok := rg.hostIP(rg.Slaves[i].Hostname); ok {
+				return ip, nil
+			}
 			return rg.Slaves[i].Hostname, nil
 		}
 	}
@@ -75,13 +321,25 @@ func (rg *RecordGenerator) hostBySlaveId(slaveId string) (string, error) {
 	return "", errors.New("not found")
 }
 
+// Weight is the share of the answers host should get when they are
+// weighted by resources, the cpus of its slave or 1 if we don't know them
+func (rg *RecordGenerator) Weight(host string) float64 {
+	if w, ok := rg.weights[host]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
 // loadFromMaster loads state.json from mesos master
-func (rg *RecordGenerator) loadFromMaster(ip string, port string) (sj StateJSON) {
+func (rg *RecordGenerator) loadFromMaster(ip string, port string, config Config) (sj StateJSON) {
 	// tls ?
 	url := "http://" + ip + ":" + port + "/master/state.json"
 
 	req, err := http.NewRequest("GET", url, nil)
 	req.Header.Set("Content-Type", "application/json")
+	if config.MasterUser != "" {
+		req.SetBasicAuth(config.MasterUser, config.MasterPassword)
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -109,11 +367,26 @@ func leaderIP(leader string) string {
 	return strings.Split(pair, ":")[0]
 }
 
+// leaderAddr returns the ip and port of the mesos master with pid
+// leader, empty strings if it is not a pid
+func leaderAddr(leader string) (string, string) {
+	at := strings.LastIndex(leader, "@")
+	if at < 0 {
+		return "", ""
+	}
+
+	ip, port, err := net.SplitHostPort(leader[at+1:])
+	if err != nil {
+		return "", ""
+	}
+	return ip, port
+}
+
 // loadWrap catches an attempt to load state.json from a mesos master
 // attempts can fail from down server or mesos master secondary
 // it also reloads from a different master if the master it attempted to
 // load from was not the leader
-func (rg *RecordGenerator) loadWrap(ip string, port string) (StateJSON, error) {
+func (rg *RecordGenerator) loadWrap(ip string, port string, config Config) (StateJSON, error) {
 	var err error
 	var sj StateJSON
 
@@ -125,11 +398,11 @@ func (rg *RecordGenerator) loadWrap(ip string, port string) (StateJSON, error) {
 	}()
 
 	logging.VeryVerbose.Println("reloading from master " + ip)
-	sj = rg.loadFromMaster(ip, port)
+	sj = rg.loadFromMaster(ip, port, config)
 
 	if rip := leaderIP(sj.Leader); rip != ip {
 		logging.VeryVerbose.Println("master changed to " + ip)
-		sj = rg.loadFromMaster(rip, port)
+		sj = rg.loadFromMaster(rip, port, config)
 	}
 
 	return sj, err
@@ -159,8 +432,9 @@ func yankPorts(ports string) []string {
 
 // findMaster tries each master and looks for the leader
 // if no leader responds it errors
-func (rg *RecordGenerator) findMaster(masters []string) (StateJSON, error) {
+func (rg *RecordGenerator) findMaster(config Config) (StateJSON, error) {
 	var sj StateJSON
+	masters := config.Masters
 
 	// try each listed mesos master before dying
 	for i := 0; i < len(masters); i++ {
@@ -169,7 +443,7 @@ func (rg *RecordGenerator) findMaster(masters []string) (StateJSON, error) {
 			logging.Error.Println(err)
 		}
 
-		sj, _ = rg.loadWrap(ip, port)
+		sj, _ = rg.loadWrap(ip, port, config)
 
 		if sj.Leader == "" {
 			logging.VeryVerbose.Println("not a leader - trying next one")
@@ -206,13 +480,20 @@ func getProto(pair string) (string, string, error) {
 // this will shudown if it can't connect to a mesos master
 func (rg *RecordGenerator) ParseState(config Config) {
 	// try each listed mesos master before dying
-	sj, err := rg.findMaster(config.Masters)
+	sj, err := rg.findMaster(config)
 	if err != nil {
 		logging.Error.Println("no master")
 		return
 	}
 
-	rg.InsertState(sj, config.Domain, config.Mname, config.Listener, config.Masters)
+	if config.MaintenanceAgents == "deprioritize" || config.MaintenanceAgents == "drop" {
+		ip, port := leaderAddr(sj.Leader)
+		if sj.Maintenance, err = rg.loadMaintenance(ip, port, config); err != nil {
+			logging.Error.Println("can't read the maintenance schedule: " + err.Error())
+		}
+	}
+
+	rg.InsertState(sj, config)
 }
 
 // cleanName sanitizes invalid characters
@@ -233,56 +514,383 @@ func stripInvalid(tname string) string {
 }
 
 // InsertState transforms a StateJSON into RecordGenerator RRs
-func (rg *RecordGenerator) InsertState(sj StateJSON, domain string, mname string,
-	listener string, masters []string) error {
+func (rg *RecordGenerator) InsertState(sj StateJSON, config Config) error {
+	domain := config.Domain
 	rg.Slaves = sj.Slaves
 
 	rg.SRVs = make(rrs)
 	rg.As = make(rrs)
+	rg.TXTs = make(rrs)
+	rg.CNAMEs = make(rrs)
+	rg.TLSAs = make(rrs)
+	rg.SSHFPs = make(rrs)
+	rg.URIs = make(rrs)
+	rg.frameworks = make(map[string][]frameworkRR)
+	rg.health = make(map[string]map[string]bool)
+	rg.ttls = make(map[string]int)
+	rg.srvWeights = make(map[string]map[string]srvWeight)
+	rg.slaveIPs()
+	rg.weights = make(map[string]float64)
+	for _, s := range sj.Slaves {
+		if ip, ok := rg.hostIP(s.Hostname); ok {
+			rg.weights[ip] = s.Resources.Cpus
+		}
+	}
+	rg.setLocations(config)
+
+	inactive := inactiveSlaves(sj)
+	draining := maintenanceSlaves(sj, time.Now(), time.Duration(config.DrainSeconds)*time.Second)
+
+	// tasks on inactive slaves, in case their names have nothing else
+	var quarantined []Task
+	var quarantinedFrameworks []string
+
+	// tasks with records, by framework and task name
+	instances := make(map[string]map[string][]Task)
+	addInstance := func(fname string, task Task) {
+		if instances[fname] == nil {
+			instances[fname] = make(map[string][]Task)
+		}
+		tname := sanitize(task.Name, config)
+		instances[fname][tname] = append(instances[fname][tname], task)
+	}
 
 	f := sj.Frameworks
+	numberInstances(f, config)
 
 	// complete crap - refactor me
 	for i := 0; i < len(f); i++ {
-		fname := f[i].Name
-		fname = cleanName(fname)
+		if !frameworkIncluded(f[i].Name, config) {
+			continue
+		}
+
+		fname := frameworkName(f[i].Name, config)
+		if role := roleName(f[i].Role, config); role != "" {
+			fname += "." + role
+		}
+		if _, ok := rg.frameworks[fname]; !ok {
+			rg.frameworks[fname] = []frameworkRR{}
+		}
 
 		for x := 0; x < len(f[i].Tasks); x++ {
 			task := f[i].Tasks[x]
 
 			host, err := rg.hostBySlaveId(task.SlaveId)
 			if err == nil && (task.State == "TASK_RUNNING") {
+				if inactive[task.SlaveId] {
+					if config.InactiveAgents == "quarantine" {
+						quarantined = append(quarantined, task)
+						quarantinedFrameworks = append(quarantinedFrameworks, fname)
+					}
+					continue
+				}
 
-				tname := cleanName(task.Name)
-				tail := fname + "." + domain + "."
+				if draining[task.SlaveId] {
+					if config.MaintenanceAgents == "drop" {
+						continue
+					}
+					task.draining = config.MaintenanceAgents == "deprioritize"
+				}
 
-				// hack - what to do?
-				if task.Resources.Ports != "" {
-					sports := yankPorts(task.Resources.Ports)
+				rg.taskRecords(fname, task, host, config)
+				addInstance(fname, task)
+			}
+		}
+	}
 
-					// FIXME - 3 nested loops
-					for s := 0; s < len(sports); s++ {
-						var srvhost string = tname + "." + fname + "." + domain + ":" + sports[s]
+	for i, task := range quarantined {
+		fname := quarantinedFrameworks[i]
+		arec := taskName(sanitize(task.Name, config), fname, task, config)
+		if _, ok := rg.As[arec]; ok {
+			continue
+		}
 
-						tcp := "_" + tname + "._tcp." + tail
-						udp := "_" + tname + "._udp." + tail
+		host, _ := rg.hostBySlaveId(task.SlaveId)
+		rg.taskRecords(fname, task, host, config)
+		addInstance(fname, task)
+	}
 
-						rg.insertRR(tcp, srvhost, "SRV")
-						rg.insertRR(udp, srvhost, "SRV")
-					}
+	if config.EnumerateTasks {
+		for fname, tasks := range instances {
+			for _, t := range tasks {
+				rg.instanceRecords(fname, t, config)
+			}
+		}
+	}
 
-				}
+	rg.listenerRecord(config.Listener, config.Mname)
+	rg.masterRecord(config.Listener, domain, config.Masters, sj.Leader)
+	rg.slaveRecords(domain, inactive)
+	rg.sshfpRecords(config, inactive)
 
-				arec := tname + "." + tail
-				rg.insertRR(arec, host, "A")
+	// last, so aliases can't take over any other name
+	if config.AliasLabel != "" {
+		rg.aliasRecords(instances, config)
+	}
+	return nil
+}
+
+// inactiveSlaves returns the ids of the slaves the master reports as
+// deactivated or unreachable
+func inactiveSlaves(sj StateJSON) map[string]bool {
+	inactive := make(map[string]bool)
+	for _, s := range sj.Slaves {
+		if !s.active() {
+			inactive[s.Id] = true
+		}
+	}
+	for _, s := range sj.UnreachableSlaves {
+		inactive[s.Id] = true
+	}
+	return inactive
+}
+
+// taskRecords sets the A, SRV and TXT records for a task of framework
+// fname running on host
+func (rg *RecordGenerator) taskRecords(fname string, task Task, host string, config Config) {
+	tname := sanitize(task.Name, config)
+	arec := taskName(tname, fname, task, config)
+
+	// hack - what to do?
+	if task.Resources.Ports != "" {
+		sports := yankPorts(task.Resources.Ports)
+
+		// FIXME - 3 nested loops
+		for s := 0; s < len(sports); s++ {
+			var srvhost string = strings.TrimSuffix(arec, ".") + ":" + sports[s]
+
+			tcp := srvName(tname, fname, task, "tcp", config)
+			udp := srvName(tname, fname, task, "udp", config)
+
+			rg.frameworkRR(fname, tcp, srvhost, "SRV")
+			rg.frameworkRR(fname, udp, srvhost, "SRV")
+		}
+
+	}
 
+	rg.frameworkRR(fname, arec, host, "A")
+	rg.labelRecords(fname, arec, task.Labels, config)
+	rg.tlsaRecords(fname, arec, task, config)
+	rg.uriRecords(fname, arec, task)
+
+	if healthy, ok := task.healthy(); ok {
+		rg.markTaskHealth(tname, fname, arec, task, host, healthy, config)
+	}
+
+	if ttl, ok := taskTTL(task, config.TTLLabel); ok {
+		rg.setTaskTTL(tname, fname, arec, task, ttl, config)
+	}
+
+	if w, ok := taskSRVWeight(task, config); ok && task.Resources.Ports != "" {
+		rg.setTaskSRVWeight(tname, fname, arec, task, w, config)
+	}
+
+	if config.TaskIDRecords {
+		rg.taskIdRecords(fname, task, host, config)
+	}
+
+	if len(config.AttributeKeys) > 0 {
+		rg.attributeRecords(fname, task, host, config)
+	}
+}
+
+// attributeRecords sets the A and SRV records of a task under
+// framework.key-value.domain for the configured attributes of the slave
+// it runs on, e.g. app.marathon.rack-a3.mesos
+func (rg *RecordGenerator) attributeRecords(fname string, task Task, host string, config Config) {
+	tname := sanitize(task.Name, config)
+
+	for _, label := range rg.attributeLabels(task.SlaveId, config.AttributeKeys) {
+		zone := fname + "." + label + "." + config.Domain
+		tail := zone + "."
+
+		if task.Resources.Ports != "" {
+			for _, port := range yankPorts(task.Resources.Ports) {
+				srvhost := tname + "." + zone + ":" + port
+				rg.frameworkRR(fname, "_"+tname+"._tcp."+tail, srvhost, "SRV")
+				rg.frameworkRR(fname, "_"+tname+"._udp."+tail, srvhost, "SRV")
 			}
 		}
+
+		rg.frameworkRR(fname, tname+"."+tail, host, "A")
 	}
+}
 
-	rg.listenerRecord(listener, mname)
-	rg.masterRecord(listener, domain, masters, leaderIP(sj.Leader))
-	return nil
+// attributeLabels returns key-value labels for the text and scalar
+// attributes of a slave with one of keys
+func (rg *RecordGenerator) attributeLabels(slaveId string, keys []string) []string {
+	var labels []string
+
+	for _, s := range rg.Slaves {
+		if s.Id != slaveId {
+			continue
+		}
+
+		for _, key := range keys {
+			var value string
+			switch v := s.Attributes[key].(type) {
+			case string:
+				value = v
+			case float64:
+				value = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				// missing, or a range or set
+				continue
+			}
+
+			if label := cleanName(key + "-" + value); validLabels(label) && !strings.Contains(label, ".") {
+				labels = append(labels, label)
+			}
+		}
+	}
+
+	return labels
+}
+
+// taskIdRecords sets the A record, and SRV records if it has ports, of
+// taskid.domain for a task
+func (rg *RecordGenerator) taskIdRecords(fname string, task Task, host string, config Config) {
+	id := sanitize(task.Id, config)
+	if !validLabels(id) {
+		logging.VeryVerbose.Println("no records for task id " + task.Id)
+		return
+	}
+
+	name := id + "." + config.Domain + "."
+	rg.frameworkRR(fname, name, host, "A")
+
+	if task.Resources.Ports != "" {
+		for _, port := range yankPorts(task.Resources.Ports) {
+			rg.frameworkRR(fname, name, id+"."+config.Domain+":"+port, "SRV")
+		}
+	}
+}
+
+// validLabels reports whether name is a sequence of dns labels
+func validLabels(name string) bool {
+	for _, l := range strings.Split(name, ".") {
+		if l == "" || len(l) > 63 {
+			return false
+		}
+	}
+	return true
+}
+
+// instanceRecords sets A and SRV records of task-N.task.framework.domain
+// for the instances of a task, numbered in the order of their task ids
+// so an instance keeps its number as long as the others do
+func (rg *RecordGenerator) instanceRecords(fname string, tasks []Task, config Config) {
+	sort.Sort(byTaskId(tasks))
+
+	tail := sanitize(tasks[0].Name, config) + "." + fname + "." + config.Domain + "."
+	for i, task := range tasks {
+		host, err := rg.hostBySlaveId(task.SlaveId)
+		if err != nil {
+			continue
+		}
+
+		instance := "task-" + strconv.Itoa(i)
+		arec := instance + "." + tail
+		rg.frameworkRR(fname, arec, host, "A")
+
+		if task.Resources.Ports != "" {
+			for _, port := range yankPorts(task.Resources.Ports) {
+				srvhost := strings.TrimSuffix(arec, ".") + ":" + port
+				rg.frameworkRR(fname, "_"+instance+"._tcp."+tail, srvhost, "SRV")
+				rg.frameworkRR(fname, "_"+instance+"._udp."+tail, srvhost, "SRV")
+			}
+		}
+	}
+}
+
+// byTaskId sorts tasks by their mesos task id
+type byTaskId []Task
+
+func (t byTaskId) Len() int           { return len(t) }
+func (t byTaskId) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byTaskId) Less(i, j int) bool { return t[i].Id < t[j].Id }
+
+// publishLabel reports whether a task label may be exposed as TXT
+// metadata - it has to be on the allow list ("*" allows every label)
+// and must not be on the redact list
+func publishLabel(key string, allow []string, redact []string) bool {
+	for _, r := range redact {
+		if r == key {
+			return false
+		}
+	}
+
+	for _, a := range allow {
+		if a == key || a == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// labelRecords sets TXT records of key=value pairs for the task labels
+// we are allowed to publish
+func (rg *RecordGenerator) labelRecords(fname string, name string, labels []Label, config Config) {
+	for _, l := range labels {
+		if publishLabel(l.Key, config.TXTLabels, config.TXTRedact) {
+			rg.frameworkRR(fname, name, l.Key+"="+l.Value, "TXT")
+		}
+	}
+}
+
+// aliasRecords sets A records for the names tasks ask for in their
+// AliasLabel label, a comma separated list of names in the domain, e.g.
+// DNS_ALIAS=shop.mesos
+// names that already have records are left alone, tasks can share an
+// alias with each other but can't take over other names
+func (rg *RecordGenerator) aliasRecords(instances map[string]map[string][]Task, config Config) {
+	taken := make(map[string]bool)
+	for name := range rg.As {
+		taken[name] = true
+	}
+	for name := range rg.SRVs {
+		taken[name] = true
+	}
+
+	suffix := "." + config.Domain + "."
+	for fname, tasks := range instances {
+		for _, ts := range tasks {
+			for _, task := range ts {
+				host, err := rg.hostBySlaveId(task.SlaveId)
+				if err != nil {
+					continue
+				}
+
+				for _, alias := range taskAliases(task, config.AliasLabel) {
+					if !strings.HasSuffix(alias, suffix) || taken[alias] {
+						logging.VeryVerbose.Println("ignoring alias " + alias + " of task " + task.Id)
+						continue
+					}
+					rg.frameworkRR(fname, alias, host, "A")
+				}
+			}
+		}
+	}
+}
+
+// taskAliases returns the valid names in the key label of a task, fully
+// qualified and in lower case
+func taskAliases(task Task, key string) []string {
+	var aliases []string
+	for _, l := range task.Labels {
+		if l.Key != key {
+			continue
+		}
+
+		for _, alias := range strings.Split(l.Value, ",") {
+			alias = dns.Fqdn(strings.ToLower(strings.TrimSpace(alias)))
+			if _, ok := dns.IsDomainName(alias); ok && alias != "." {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+	return aliases
 }
 
 // listenerRecord sets the A record for the mesos-dns server in case
@@ -297,9 +905,64 @@ func (rg *RecordGenerator) listenerRecord(listener string, mname string) {
 	}
 }
 
+// InsertUnderscoreTXT sets the TXT records configured for underscore
+// names, e.g. _dmarc.domain or _acme-challenge.app.framework.domain
+func (rg *RecordGenerator) InsertUnderscoreTXT(config Config) {
+	// no state was loaded
+	if rg.TXTs == nil {
+		return
+	}
+
+	for name, txts := range config.UnderscoreTXT {
+		for _, txt := range txts {
+			rg.insertRR(name, txt, "TXT")
+		}
+	}
+}
+
+// InsertCNAMEs sets the configured CNAME records, unless their names
+// already have other records
+func (rg *RecordGenerator) InsertCNAMEs(config Config) {
+	// no state was loaded
+	if rg.As == nil {
+		return
+	}
+
+	for name, target := range config.CNAMEs {
+		_, a := rg.As[name]
+		_, srv := rg.SRVs[name]
+		_, txt := rg.TXTs[name]
+		if a || srv || txt {
+			logging.Error.Println("not adding CNAME for " + name + ", it has other records")
+			continue
+		}
+		rg.insertRR(name, target, "CNAME")
+	}
+}
+
+// InsertPeers sets A records at resolvers.domain for this mesos-dns
+// instance and its healthy peers, so clients can find alternate
+// resolvers if theirs goes away
+func (rg *RecordGenerator) InsertPeers(peers []string, config Config) {
+	// no state was loaded
+	if rg.As == nil {
+		return
+	}
+
+	arec := "resolvers." + config.Domain + "."
+	for _, ip := range rg.As[config.Mname] {
+		rg.insertRR(arec, ip, "A")
+	}
+	for _, ip := range peers {
+		rg.insertRR(arec, ip, "A")
+	}
+}
+
 // masterRecord sets A records for the mesos masters and an A record
-// for the leading master
+// for the leading master, leader is its pid as found in state.json
 func (rg *RecordGenerator) masterRecord(listener string, domain string, masters []string, leader string) {
+	lip, lport := leaderAddr(leader)
+	found := false
 
 	for i := 0; i < len(masters); i++ {
 		ip, port, err := getProto(masters[i])
@@ -321,16 +984,38 @@ func (rg *RecordGenerator) masterRecord(listener string, domain string, masters
 		rg.insertRR(udp, host, "SRV")
 
 		// if this is this is the leading master
-		if ip == leader {
-			// A record
-			arec = "leader." + domain + "."
-			rg.insertRR(arec, ip, "A")
-			// SRV records
-			tcp := "_leader._tcp." + domain + "."
-			udp := "_leader._udp." + domain + "."
-			host := "leader." + domain + ":" + port
-			rg.insertRR(tcp, host, "SRV")
-			rg.insertRR(udp, host, "SRV")
+		if ip == lip {
+			found = true
+			rg.leaderRecord(domain, ip, port)
+		}
+	}
+
+	// the leader is configured by hostname or not at all, e.g. masters
+	// were added since - state.json still knows where it is
+	if !found && lip != "" {
+		rg.insertRR("master."+domain+".", lip, "A")
+		rg.leaderRecord(domain, lip, lport)
+	}
+}
+
+// leaderRecord sets the A and SRV records of the leading master
+func (rg *RecordGenerator) leaderRecord(domain string, ip string, port string) {
+	// A record
+	arec := "leader." + domain + "."
+	rg.insertRR(arec, ip, "A")
+	// SRV records
+	tcp := "_leader._tcp." + domain + "."
+	udp := "_leader._udp." + domain + "."
+	host := "leader." + domain + ":" + port
+	rg.insertRR(tcp, host, "SRV")
+	rg.insertRR(udp, host, "SRV")
+}
+
+// slaveRecords sets an A record of slave.domain for every active slave
+func (rg *RecordGenerator) slaveRecords(domain string, inactive map[string]bool) {
+	for _, s := range rg.Slaves {
+		if !inactive[s.Id] && s.Hostname != "" {
+			rg.insertRR("slave."+domain+".", s.Hostname, "A")
 		}
 	}
 }
@@ -381,12 +1066,45 @@ func stripHost(hostip string) string {
 	return strings.Split(hostip, ":")[0]
 }
 
+// insertSorted adds host to hosts in order, so the same state always
+// generates the same records no matter in which order it is read
+func insertSorted(hosts []string, host string) []string {
+	i := sort.SearchStrings(hosts, host)
+	hosts = append(hosts, "")
+	copy(hosts[i+1:], hosts[i:])
+	hosts[i] = host
+	return hosts
+}
+
+// insertUnique adds value to the values of name in r unless it is there
+// already, r is made if nil
+func (r rrs) insertUnique(name string, value string) rrs {
+	if r == nil {
+		r = make(rrs)
+	}
+	for _, v := range r[name] {
+		if v == value {
+			return r
+		}
+	}
+
+	r[name] = insertSorted(r[name], value)
+	return r
+}
+
 // insertRR inserts host to name's map
 // refactor me
 func (rg *RecordGenerator) insertRR(name string, host string, rtype string) {
 	logging.VeryVerbose.Println("[" + rtype + "]\t" + name + ": " + host)
 
 	if rtype == "A" {
+		ip, ok := rg.hostIP(host)
+		if !ok {
+			logging.Error.Println("no IPv4 address for " + host + ", dropping it from " + name)
+			return
+		}
+		host = ip
+
 		if val, ok := rg.As[name]; ok {
 
 			h := stripHost(host)
@@ -396,13 +1114,33 @@ func (rg *RecordGenerator) insertRR(name string, host string, rtype string) {
 				}
 			}
 
-			rg.As[name] = append(val, host)
+			rg.As[name] = insertSorted(val, host)
 		} else {
 			rg.As[name] = []string{host}
 		}
+	} else if rtype == "CNAME" {
+		// a name has one canonical name
+		if rg.CNAMEs == nil {
+			rg.CNAMEs = make(rrs)
+		}
+		rg.CNAMEs[name] = []string{host}
+	} else if rtype == "TXT" {
+		for _, b := range rg.TXTs[name] {
+			if b == host {
+				return
+			}
+		}
+
+		rg.TXTs[name] = insertSorted(rg.TXTs[name], host)
+	} else if rtype == "TLSA" {
+		rg.TLSAs = rg.TLSAs.insertUnique(name, host)
+	} else if rtype == "SSHFP" {
+		rg.SSHFPs = rg.SSHFPs.insertUnique(name, host)
+	} else if rtype == "URI" {
+		rg.URIs = rg.URIs.insertUnique(name, host)
 	} else {
 		if val, ok := rg.SRVs[name]; ok {
-			rg.SRVs[name] = append(val, host)
+			rg.SRVs[name] = insertSorted(val, host)
 		} else {
 			rg.SRVs[name] = []string{host}
 		}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"github.com/mesosphere/mesos-dns/logging"
 	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
 	"testing"
 )
 
@@ -140,9 +143,14 @@ func TestInsertState(t *testing.T) {
 	}
 	sj.Leader = "master@144.76.157.37:5050"
 
-	masters := []string{"144.76.157.37:5050"}
+	config := Config{
+		Domain:   "mesos",
+		Mname:    "mesos-dns.mesos.",
+		Listener: "127.0.0.1",
+		Masters:  []string{"144.76.157.37:5050"},
+	}
 	rg := RecordGenerator{}
-	rg.InsertState(sj, "mesos", "mesos-dns.mesos.", "127.0.0.1", masters)
+	rg.InsertState(sj, config)
 
 	// ensure we are only collecting running tasks
 	_, ok := rg.SRVs["_poseidon._tcp.marathon-0.6.0.mesos."]
@@ -186,13 +194,18 @@ func TestInsertState(t *testing.T) {
 		t.Error("should find a leading master - SRV record")
 	}
 
+	_, ok = rg.As["slave.mesos."]
+	if !ok {
+		t.Error("should find the slaves - A record")
+	}
+
 	// test for 12 SRV names
 	if len(rg.SRVs) != 12 {
 		t.Error("not enough SRVs")
 	}
 
-	// test for 5 A names
-	if len(rg.As) != 8 {
+	// test for 9 A names
+	if len(rg.As) != 9 {
 		t.Error("not enough As")
 	}
 
@@ -233,3 +246,501 @@ func TestNTasks(t *testing.T) {
 		t.Error("should only have 2 A records")
 	}
 }
+
+func TestPublishLabel(t *testing.T) {
+	var tests = []struct {
+		key     string
+		allow   []string
+		redact  []string
+		publish bool
+	}{
+		{"owner", nil, nil, false},
+		{"owner", []string{"owner"}, nil, true},
+		{"owner", []string{"*"}, nil, true},
+		{"token", []string{"*"}, []string{"token"}, false},
+		{"token", []string{"token"}, []string{"token"}, false},
+	}
+
+	for _, tt := range tests {
+		if publishLabel(tt.key, tt.allow, tt.redact) != tt.publish {
+			t.Errorf("%s: expected publish %v", tt.key, tt.publish)
+		}
+	}
+}
+
+// ensure only allowed labels become TXT records
+func TestLabelRecords(t *testing.T) {
+	var sj StateJSON
+
+	b, err := ioutil.ReadFile("../factories/fake.json")
+	if err != nil {
+		t.Error("missing test data")
+	}
+
+	err = json.Unmarshal(b, &sj)
+	if err != nil {
+		t.Error(err)
+	}
+	sj.Leader = "master@144.76.157.37:5050"
+
+	config := Config{
+		Domain:    "mesos",
+		Mname:     "mesos-dns.mesos.",
+		Listener:  "127.0.0.1",
+		Masters:   []string{"144.76.157.37:5050"},
+		TXTLabels: []string{"*"},
+		TXTRedact: []string{"secret_token"},
+	}
+	rg := RecordGenerator{}
+	rg.InsertState(sj, config)
+
+	txts := rg.TXTs["reviewbot.marathon-0.6.0.mesos."]
+	if len(txts) != 1 || txts[0] != "owner=infra" {
+		t.Error("should only publish the owner label, got", txts)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a := RecordGenerator{As: make(rrs), SRVs: make(rrs), TXTs: make(rrs)}
+	b := RecordGenerator{As: make(rrs), SRVs: make(rrs), TXTs: make(rrs)}
+
+	a.insertRR("blah.mesos.", "10.0.0.1", "A")
+	a.insertRR("blah.mesos.", "10.0.0.2", "A")
+	b.insertRR("blah.mesos.", "10.0.0.2", "A")
+	b.insertRR("blah.mesos.", "10.0.0.1", "A")
+
+	if !a.Equal(&b) {
+		t.Error("order of records should not matter")
+	}
+
+	b.insertRR("_blah._tcp.mesos.", "blah.mesos:1234", "SRV")
+	if a.Equal(&b) {
+		t.Error("should notice an added record")
+	}
+
+	a.insertRR("_blah._tcp.mesos.", "blah.mesos:1234", "SRV")
+	a.setSRVWeight("_blah._tcp.mesos.", "blah.mesos:1234", srvWeight{priority: 1, weight: 10})
+	if a.Equal(&b) {
+		t.Error("should notice a changed SRV weight")
+	}
+
+	b.setSRVWeight("_blah._tcp.mesos.", "blah.mesos:1234", srvWeight{priority: 1, weight: 10})
+	a.locations = map[string]Location{"10.0.0.1": {Latitude: 52.5, Longitude: 13.4}}
+	if a.Equal(&b) {
+		t.Error("should notice a moved slave")
+	}
+
+	b.locations = a.locations
+	a.setTTL("blah.mesos.", 5)
+	if a.Equal(&b) {
+		t.Error("should notice a changed TTL")
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	b, err := ioutil.ReadFile("../factories/fake.json")
+	if err != nil {
+		t.Fatal("missing test data")
+	}
+
+	config := Config{
+		Domain:         "mesos",
+		Mname:          "mesos-dns.mesos.",
+		Listener:       "127.0.0.1",
+		Masters:        []string{"144.76.157.37:5050"},
+		EnumerateTasks: true,
+		TaskIDRecords:  true,
+	}
+
+	var gen [2]RecordGenerator
+	for i := range gen {
+		var sj StateJSON
+		if err := json.Unmarshal(b, &sj); err != nil {
+			t.Fatal(err)
+		}
+		sj.Leader = "master@144.76.157.37:5050"
+
+		// the second one reads the state backwards
+		if i == 1 {
+			for f := range sj.Frameworks {
+				tasks := sj.Frameworks[f].Tasks
+				for l, r := 0, len(tasks)-1; l < r; l, r = l+1, r-1 {
+					tasks[l], tasks[r] = tasks[r], tasks[l]
+				}
+			}
+			for l, r := 0, len(sj.Slaves)-1; l < r; l, r = l+1, r-1 {
+				sj.Slaves[l], sj.Slaves[r] = sj.Slaves[r], sj.Slaves[l]
+			}
+		}
+		gen[i].InsertState(sj, config)
+	}
+
+	for _, set := range []struct {
+		name string
+		a, b rrs
+	}{
+		{"A", gen[0].As, gen[1].As},
+		{"SRV", gen[0].SRVs, gen[1].SRVs},
+		{"TXT", gen[0].TXTs, gen[1].TXTs},
+	} {
+		if !reflect.DeepEqual(set.a, set.b) {
+			t.Errorf("%s records depend on the order of the state", set.name)
+		}
+	}
+}
+
+func TestInsertPeers(t *testing.T) {
+	config := Config{Domain: "mesos", Mname: "mesos-dns.mesos."}
+
+	var rg RecordGenerator
+	rg.InsertPeers([]string{"10.0.0.2"}, config)
+	if rg.As != nil {
+		t.Error("should not publish peers without state")
+	}
+
+	rg.As = make(rrs)
+	rg.insertRR("mesos-dns.mesos.", "10.0.0.1", "A")
+	rg.InsertPeers([]string{"10.0.0.2", "10.0.0.1"}, config)
+
+	if !reflect.DeepEqual(rg.As["resolvers.mesos."], []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("unexpected resolvers records %v", rg.As["resolvers.mesos."])
+	}
+}
+
+func TestInsertUnderscoreTXT(t *testing.T) {
+	config := Config{UnderscoreTXT: map[string][]string{"_dmarc.mesos.": {"v=DMARC1; p=none", "v=DMARC1; p=none"}}}
+
+	var rg RecordGenerator
+	rg.InsertUnderscoreTXT(config)
+	if rg.TXTs != nil {
+		t.Error("should not insert records without state")
+	}
+
+	rg.TXTs = make(rrs)
+	rg.InsertUnderscoreTXT(config)
+	if !reflect.DeepEqual(rg.TXTs["_dmarc.mesos."], []string{"v=DMARC1; p=none"}) {
+		t.Errorf("unexpected TXT records %v", rg.TXTs["_dmarc.mesos."])
+	}
+}
+
+func TestCopy(t *testing.T) {
+	rg := RecordGenerator{As: rrs{"a.mesos.": {"10.0.0.1"}}, SRVs: rrs{}, TXTs: rrs{}}
+
+	c := rg.Copy()
+	c.Insert("a.mesos.", "10.0.0.2", "A")
+	if len(rg.As["a.mesos."]) != 1 || len(c.As["a.mesos."]) != 2 {
+		t.Error("changing the copy should not change the original")
+	}
+
+	var empty RecordGenerator
+	c = empty.Copy()
+	c.Insert("a.mesos.", "10.0.0.1", "A")
+	if c.As != nil {
+		t.Error("should not insert records without state")
+	}
+}
+
+func TestInactiveSlaves(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1", "active": true},
+			{"id": "s2", "hostname": "10.0.0.2", "active": false},
+			{"id": "s3", "hostname": "10.0.0.3"}
+		],
+		"unreachable_slaves": [{"id": "s3"}],
+		"leader": "master@10.0.0.9:5050",
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING"},
+			{"name": "web", "slave_id": "s2", "state": "TASK_RUNNING"},
+			{"name": "db", "slave_id": "s3", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		mode string
+		web  []string
+		db   []string
+	}{
+		{"drop", []string{"10.0.0.1"}, nil},
+		{"quarantine", []string{"10.0.0.1"}, []string{"10.0.0.3"}},
+	}
+
+	for _, tt := range tests {
+		var rg RecordGenerator
+		rg.InsertState(sj, Config{Domain: "mesos", InactiveAgents: tt.mode})
+
+		if !reflect.DeepEqual(rg.As["web.marathon.mesos."], tt.web) {
+			t.Errorf("%s: expected web at %v, got %v", tt.mode, tt.web, rg.As["web.marathon.mesos."])
+		}
+		if !reflect.DeepEqual(rg.As["db.marathon.mesos."], tt.db) {
+			t.Errorf("%s: expected db at %v, got %v", tt.mode, tt.db, rg.As["db.marathon.mesos."])
+		}
+	}
+}
+
+func TestLeaderFromState(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1"},
+			{"id": "s2", "hostname": "10.0.0.2", "active": false},
+			{"id": "s3", "hostname": "10.0.0.3"}
+		],
+		"leader": "master@10.0.0.9:5050"
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the leader is not among the configured masters
+	config := Config{Domain: "mesos", Masters: []string{"10.0.0.8:5050"}}
+	var rg RecordGenerator
+	rg.InsertState(sj, config)
+
+	if !reflect.DeepEqual(rg.As["leader.mesos."], []string{"10.0.0.9"}) {
+		t.Errorf("expected the leader from state.json, got %v", rg.As["leader.mesos."])
+	}
+	if !reflect.DeepEqual(rg.SRVs["_leader._tcp.mesos."], []string{"leader.mesos:5050"}) {
+		t.Errorf("unexpected leader SRV %v", rg.SRVs["_leader._tcp.mesos."])
+	}
+	if !reflect.DeepEqual(rg.As["master.mesos."], []string{"10.0.0.8", "10.0.0.9"}) {
+		t.Errorf("expected every master, got %v", rg.As["master.mesos."])
+	}
+	if _, ok := rg.As["master1.mesos."]; ok {
+		t.Error("masterN is only for configured masters")
+	}
+	if !reflect.DeepEqual(rg.As["slave.mesos."], []string{"10.0.0.1", "10.0.0.3"}) {
+		t.Errorf("expected the active slaves, got %v", rg.As["slave.mesos."])
+	}
+}
+
+func TestInstanceRecords(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1"},
+			{"id": "s2", "hostname": "10.0.0.2"},
+			{"id": "s3", "hostname": "10.0.0.3"}
+		],
+		"leader": "master@10.0.0.9:5050",
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"id": "kafka.c", "name": "kafka", "slave_id": "s3", "state": "TASK_RUNNING"},
+			{"id": "kafka.a", "name": "kafka", "slave_id": "s1", "state": "TASK_RUNNING",
+				"resources": {"ports": "[31000-31000]"}},
+			{"id": "kafka.b", "name": "kafka", "slave_id": "s2", "state": "TASK_RUNNING"},
+			{"id": "kafka.0", "name": "kafka", "slave_id": "s2", "state": "TASK_FAILED"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, Config{Domain: "mesos", InactiveAgents: "drop"})
+	if _, ok := rg.As["task-0.kafka.marathon.mesos."]; ok {
+		t.Error("instances should only be enumerated when enabled")
+	}
+
+	rg.InsertState(sj, Config{Domain: "mesos", InactiveAgents: "drop", EnumerateTasks: true})
+
+	for i, host := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		name := "task-" + strconv.Itoa(i) + ".kafka.marathon.mesos."
+		if !reflect.DeepEqual(rg.As[name], []string{host}) {
+			t.Errorf("expected %s at %s, got %v", name, host, rg.As[name])
+		}
+	}
+	if _, ok := rg.As["task-3.kafka.marathon.mesos."]; ok {
+		t.Error("should not enumerate tasks that are not running")
+	}
+
+	srv := rg.SRVs["_task-0._tcp.kafka.marathon.mesos."]
+	if !reflect.DeepEqual(srv, []string{"task-0.kafka.marathon.mesos:31000"}) {
+		t.Errorf("unexpected instance SRV %v", srv)
+	}
+}
+
+func TestTaskIdRecords(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "s1", "hostname": "10.0.0.1"}],
+		"leader": "master@10.0.0.9:5050",
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"id": "myapp.c9f4e2a1-562f-11e4-a088-c20493233aa5", "name": "myapp", "slave_id": "s1",
+				"state": "TASK_RUNNING", "resources": {"ports": "[31000-31001]"}},
+			{"id": "ct:1413913764000:0:Weekly Report", "name": "report", "slave_id": "s1", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, Config{Domain: "mesos", InactiveAgents: "drop", TaskIDRecords: true})
+
+	name := "myapp.c9f4e2a1-562f-11e4-a088-c20493233aa5.mesos."
+	if !reflect.DeepEqual(rg.As[name], []string{"10.0.0.1"}) {
+		t.Errorf("expected %s at 10.0.0.1, got %v", name, rg.As[name])
+	}
+	srv := []string{
+		"myapp.c9f4e2a1-562f-11e4-a088-c20493233aa5.mesos:31000",
+		"myapp.c9f4e2a1-562f-11e4-a088-c20493233aa5.mesos:31001",
+	}
+	if !reflect.DeepEqual(rg.SRVs[name], srv) {
+		t.Errorf("expected SRV %v, got %v", srv, rg.SRVs[name])
+	}
+
+	// ids are cleaned like task names
+	if _, ok := rg.As["ct14139137640000weeklyreport.mesos."]; !ok {
+		t.Error("should clean task ids")
+	}
+}
+
+func TestAttributeRecords(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1", "attributes": {"rack": "a3", "zone": "us-east", "level": 2}},
+			{"id": "s2", "hostname": "10.0.0.2", "attributes": {"rack": "b1", "zone": "us-east"}},
+			{"id": "s3", "hostname": "10.0.0.3"}
+		],
+		"leader": "master@10.0.0.9:5050",
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "app", "slave_id": "s1", "state": "TASK_RUNNING", "resources": {"ports": "[31000-31000]"}},
+			{"name": "app", "slave_id": "s2", "state": "TASK_RUNNING"},
+			{"name": "app", "slave_id": "s3", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, Config{Domain: "mesos", InactiveAgents: "drop", AttributeKeys: []string{"rack", "zone", "level", "missing"}})
+
+	var tests = []struct {
+		name  string
+		hosts []string
+	}{
+		{"app.marathon.rack-a3.mesos.", []string{"10.0.0.1"}},
+		{"app.marathon.rack-b1.mesos.", []string{"10.0.0.2"}},
+		{"app.marathon.zone-us-east.mesos.", []string{"10.0.0.1", "10.0.0.2"}},
+		{"app.marathon.level-2.mesos.", []string{"10.0.0.1"}},
+		{"app.marathon.mesos.", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+	}
+
+	for _, tt := range tests {
+		if !reflect.DeepEqual(rg.As[tt.name], tt.hosts) {
+			t.Errorf("expected %s at %v, got %v", tt.name, tt.hosts, rg.As[tt.name])
+		}
+	}
+
+	srv := rg.SRVs["_app._tcp.marathon.rack-a3.mesos."]
+	if !reflect.DeepEqual(srv, []string{"app.marathon.rack-a3.mesos:31000"}) {
+		t.Errorf("unexpected attribute SRV %v", srv)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	config := Config{Domain: "mesos", InactiveAgents: "drop"}
+
+	var rg RecordGenerator
+	rg.Merge(&RecordGenerator{}, "east")
+	if rg.As != nil {
+		t.Error("should not merge a cluster without state")
+	}
+
+	var east RecordGenerator
+	east.As, east.SRVs, east.TXTs = make(rrs), make(rrs), make(rrs)
+	east.frameworks = map[string][]frameworkRR{"marathon": nil}
+	east.insertRR("web.marathon.east.mesos.", "10.0.0.1", "A")
+	east.insertRR("_web._tcp.marathon.east.mesos.", "web.marathon.east.mesos:31000", "SRV")
+
+	rg.InsertState(StateJSON{}, config)
+	rg.frameworks["marathon"] = nil
+	rg.Merge(&east, "east")
+
+	if !reflect.DeepEqual(rg.As["web.marathon.east.mesos."], []string{"10.0.0.1"}) || len(rg.SRVs) != 1 {
+		t.Errorf("records not merged: %v %v", rg.As, rg.SRVs)
+	}
+	if _, ok := rg.frameworks["marathon.east"]; !ok {
+		t.Error("frameworks of other clusters should be kept apart")
+	}
+}
+
+func TestAliasRecords(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1"},
+			{"id": "s2", "hostname": "10.0.0.2"}
+		],
+		"leader": "master@10.0.0.9:5050",
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "shop", "slave_id": "s1", "state": "TASK_RUNNING",
+			 "labels": [{"key": "DNS_ALIAS", "value": "Shop.mesos, store.mesos"}]},
+			{"name": "shop", "slave_id": "s2", "state": "TASK_RUNNING",
+			 "labels": [{"key": "DNS_ALIAS", "value": "shop.mesos"}]},
+			{"name": "evil", "slave_id": "s2", "state": "TASK_RUNNING",
+			 "labels": [{"key": "DNS_ALIAS", "value": "leader.mesos,shop.marathon.mesos,example.com,bad..name"}]}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, Config{Domain: "mesos", AliasLabel: "DNS_ALIAS"})
+
+	var tests = []struct {
+		name  string
+		hosts []string
+	}{
+		{"shop.mesos.", []string{"10.0.0.1", "10.0.0.2"}},
+		{"store.mesos.", []string{"10.0.0.1"}},
+		{"leader.mesos.", []string{"10.0.0.9"}},
+		{"shop.marathon.mesos.", []string{"10.0.0.1", "10.0.0.2"}},
+		{"example.com.", nil},
+	}
+
+	for _, tt := range tests {
+		hosts := append([]string(nil), rg.As[tt.name]...)
+		sort.Strings(hosts)
+		if !reflect.DeepEqual(hosts, tt.hosts) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.hosts, hosts)
+		}
+	}
+
+	rg = RecordGenerator{}
+	rg.InsertState(sj, Config{Domain: "mesos"})
+	if _, ok := rg.As["shop.mesos."]; ok {
+		t.Error("aliases should be off without an alias label")
+	}
+}
+
+func TestInsertCNAMEs(t *testing.T) {
+	var rg RecordGenerator
+	rg.InsertState(StateJSON{}, Config{Domain: "mesos"})
+	rg.Insert("web.mesos.", "10.0.0.1", "A")
+
+	rg.InsertCNAMEs(Config{CNAMEs: map[string]string{
+		"db.mesos.":  "db.example.com.",
+		"web.mesos.": "www.example.com.",
+	}})
+
+	if !reflect.DeepEqual(rg.CNAMEs["db.mesos."], []string{"db.example.com."}) {
+		t.Errorf("expected the configured CNAME, got %v", rg.CNAMEs["db.mesos."])
+	}
+	if _, ok := rg.CNAMEs["web.mesos."]; ok {
+		t.Error("a name with other records should not get a CNAME")
+	}
+
+	// a name has one canonical name
+	rg.Insert("db.mesos.", "db2.example.com.", "CNAME")
+	if !reflect.DeepEqual(rg.CNAMEs["db.mesos."], []string{"db2.example.com."}) {
+		t.Errorf("expected the CNAME to be replaced, got %v", rg.CNAMEs["db.mesos."])
+	}
+}
@@ -0,0 +1,56 @@
+package records
+
+import (
+	"strings"
+)
+
+// healthy reports whether the last health check of the task passed, ok
+// is false for tasks without health checks
+// tasks on slaves entering maintenance are never healthy
+func (t Task) healthy() (healthy bool, ok bool) {
+	if t.draining {
+		return false, true
+	}
+
+	var last float64
+	for _, s := range t.Statuses {
+		if s.Healthy != nil && (!ok || s.Timestamp >= last) {
+			healthy, ok, last = *s.Healthy, true, s.Timestamp
+		}
+	}
+	return healthy, ok
+}
+
+// markTaskHealth remembers the health of a task for its A and SRV
+// records
+func (rg *RecordGenerator) markTaskHealth(tname string, fname string, arec string, task Task, host string, healthy bool, config Config) {
+	rg.markHealth(arec, host, healthy)
+	if task.Resources.Ports == "" {
+		return
+	}
+
+	for _, port := range yankPorts(task.Resources.Ports) {
+		srvhost := strings.TrimSuffix(arec, ".") + ":" + port
+		rg.markHealth(srvName(tname, fname, task, "tcp", config), srvhost, healthy)
+		rg.markHealth(srvName(tname, fname, task, "udp", config), srvhost, healthy)
+	}
+}
+
+// markHealth records the health of a task behind host for name, a host
+// is healthy if any of its tasks is
+func (rg *RecordGenerator) markHealth(name string, host string, healthy bool) {
+	if rg.health == nil {
+		rg.health = make(map[string]map[string]bool)
+	}
+	if rg.health[name] == nil {
+		rg.health[name] = make(map[string]bool)
+	}
+	rg.health[name][host] = rg.health[name][host] || healthy
+}
+
+// Unhealthy reports whether every task behind host for name fails its
+// health checks
+func (rg *RecordGenerator) Unhealthy(name string, host string) bool {
+	healthy, ok := rg.health[name][host]
+	return ok && !healthy
+}
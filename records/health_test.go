@@ -0,0 +1,48 @@
+package records
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTaskHealth(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1"},
+			{"id": "s2", "hostname": "10.0.0.2"},
+			{"id": "s3", "hostname": "10.0.0.3"}
+		],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING", "resources": {"ports": "[8080-8080]"},
+			 "statuses": [{"state": "TASK_RUNNING", "healthy": false, "timestamp": 1}, {"state": "TASK_RUNNING", "healthy": true, "timestamp": 2}]},
+			{"name": "web", "slave_id": "s2", "state": "TASK_RUNNING", "resources": {"ports": "[8080-8080]"},
+			 "statuses": [{"state": "TASK_RUNNING", "healthy": true, "timestamp": 1}, {"state": "TASK_RUNNING", "healthy": false, "timestamp": 2}]},
+			{"name": "web", "slave_id": "s3", "state": "TASK_RUNNING",
+			 "statuses": [{"state": "TASK_RUNNING", "timestamp": 1}]}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, Config{Domain: "mesos"})
+
+	var tests = []struct {
+		name, host string
+		unhealthy  bool
+	}{
+		{"web.marathon.mesos.", "10.0.0.1", false},
+		{"web.marathon.mesos.", "10.0.0.2", true},
+		{"web.marathon.mesos.", "10.0.0.3", false},
+		{"_web._tcp.marathon.mesos.", "web.marathon.mesos:8080", false},
+		{"web.marathon.mesos.", "10.0.0.4", false},
+	}
+
+	for _, tt := range tests {
+		if rg.Unhealthy(tt.name, tt.host) != tt.unhealthy {
+			t.Errorf("%s %s: expected unhealthy %v", tt.name, tt.host, tt.unhealthy)
+		}
+	}
+}
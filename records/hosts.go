@@ -0,0 +1,62 @@
+package records
+
+import (
+	"net"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// slaveIPs remembers the address of every slave by hostname, from its
+// pid in state.json, so answers never wait for the OS resolver
+func (rg *RecordGenerator) slaveIPs() {
+	rg.ips = make(map[string]string)
+	for _, s := range rg.Slaves {
+		if ip, _ := leaderAddr(s.Pid); ipv4(ip) != "" {
+			rg.ips[s.Hostname] = ipv4(ip)
+		}
+	}
+}
+
+// hostIP returns the IPv4 address of host, an address, address:port or
+// hostname - hostnames of slaves are known from state.json, others are
+// looked up once per generation
+// ok is false if host has no IPv4 address
+func (rg *RecordGenerator) hostIP(host string) (ip string, ok bool) {
+	h := stripHost(host)
+	if h == "" {
+		return "", false
+	}
+	if net.ParseIP(h) != nil {
+		ip = ipv4(h)
+		return ip, ip != ""
+	}
+
+	if ip, ok := rg.ips[h]; ok {
+		return ip, ip != ""
+	}
+
+	addrs, err := net.LookupIP(h)
+	if err != nil {
+		logging.Error.Println(err)
+	}
+	for _, addr := range addrs {
+		if ip = ipv4(addr.String()); ip != "" {
+			break
+		}
+	}
+
+	// failures are remembered too, until the next generation
+	if rg.ips == nil {
+		rg.ips = make(map[string]string)
+	}
+	rg.ips[h] = ip
+	return ip, ip != ""
+}
+
+// ipv4 returns s as an IPv4 address, empty if it is not one
+func ipv4(s string) string {
+	if ip := net.ParseIP(s).To4(); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package records
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestHostIP(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "agent1.example", "pid": "slave(1)@10.0.0.1:5051"},
+			{"id": "s2", "hostname": "agent2.invalid"}
+		],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING"},
+			{"name": "db", "slave_id": "s2", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, Config{Domain: "mesos"})
+
+	var tests = []struct {
+		host string
+		ip   string
+		ok   bool
+	}{
+		{"10.0.0.2", "10.0.0.2", true},
+		{"10.0.0.2:5050", "10.0.0.2", true},
+		{"agent1.example", "10.0.0.1", true},
+		{"agent2.invalid", "", false},
+		{"::1", "", false},
+	}
+
+	for _, tt := range tests {
+		if ip, ok := rg.hostIP(tt.host); ip != tt.ip || ok != tt.ok {
+			t.Errorf("%s: expected %q %v, got %q %v", tt.host, tt.ip, tt.ok, ip, ok)
+		}
+	}
+
+	// records hold addresses only
+	if !reflect.DeepEqual(rg.As["web.marathon.mesos."], []string{"10.0.0.1"}) {
+		t.Errorf("expected web at the address of its slave, got %v", rg.As["web.marathon.mesos."])
+	}
+	if _, ok := rg.As["db.marathon.mesos."]; ok {
+		t.Error("db has no address")
+	}
+}
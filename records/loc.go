@@ -0,0 +1,84 @@
+package records
+
+import (
+	"strconv"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// Location is where a slave is, in degrees north and east and meters
+// above sea level
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+}
+
+// attributeFloat returns the number in the key attribute of a slave,
+// ok is false if it has none
+func attributeFloat(s slave, key string) (f float64, ok bool) {
+	switch v := s.Attributes[key].(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// slaveLocation returns the location of a slave from its LOCAttributes,
+// ok is false if it has no valid latitude and longitude
+func slaveLocation(s slave, config Config) (loc Location, ok bool) {
+	if len(config.LOCAttributes) < 2 {
+		return loc, false
+	}
+
+	lat, latOK := attributeFloat(s, config.LOCAttributes[0])
+	lon, lonOK := attributeFloat(s, config.LOCAttributes[1])
+	if !latOK || !lonOK {
+		return loc, false
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		logging.VeryVerbose.Println("ignoring the location of slave " + s.Id + ", out of range")
+		return loc, false
+	}
+	loc = Location{Latitude: lat, Longitude: lon}
+
+	if len(config.LOCAttributes) > 2 {
+		if alt, ok := attributeFloat(s, config.LOCAttributes[2]); ok && alt >= -100000 && alt <= 42849672 {
+			loc.Altitude = alt
+		}
+	}
+	return loc, true
+}
+
+// setLocations remembers the location of every slave by address
+func (rg *RecordGenerator) setLocations(config Config) {
+	rg.locations = make(map[string]Location)
+	for _, s := range rg.Slaves {
+		loc, ok := slaveLocation(s, config)
+		if !ok {
+			continue
+		}
+		if ip, ok := rg.hostIP(s.Hostname); ok {
+			rg.locations[ip] = loc
+		}
+	}
+}
+
+// SetLocation sets the location of the slave at host, e.g. restored from
+// a zone transfer
+func (rg *RecordGenerator) SetLocation(host string, loc Location) {
+	if rg.locations == nil {
+		rg.locations = make(map[string]Location)
+	}
+	rg.locations[host] = loc
+}
+
+// Location returns the location of the slave at host, ok is false if it
+// has none
+func (rg *RecordGenerator) Location(host string) (loc Location, ok bool) {
+	loc, ok = rg.locations[host]
+	return loc, ok
+}
@@ -0,0 +1,86 @@
+package records
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// MaintenanceWindow is a window of the master's maintenance schedule,
+// when its machines are going to be unavailable
+type MaintenanceWindow struct {
+	MachineIds []struct {
+		Hostname string `json:"hostname"`
+		IP       string `json:"ip"`
+	} `json:"machine_ids"`
+	Unavailability struct {
+		Start struct {
+			Nanoseconds int64 `json:"nanoseconds"`
+		} `json:"start"`
+		Duration struct {
+			Nanoseconds int64 `json:"nanoseconds"`
+		} `json:"duration"`
+	} `json:"unavailability"`
+}
+
+// loadMaintenance reads the maintenance schedule from the master at
+// ip:port
+func (rg *RecordGenerator) loadMaintenance(ip string, port string, config Config) ([]MaintenanceWindow, error) {
+	url := "http://" + ip + ":" + port + "/master/maintenance/schedule"
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if config.MasterUser != "" {
+		req.SetBasicAuth(config.MasterUser, config.MasterPassword)
+	}
+
+	client := &http.Client{Timeout: time.Duration(config.Timeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("maintenance schedule: " + resp.Status)
+	}
+
+	var schedule struct {
+		Windows []MaintenanceWindow `json:"windows"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&schedule); err != nil {
+		return nil, err
+	}
+	return schedule.Windows, nil
+}
+
+// maintenanceSlaves returns the ids of the slaves in a maintenance
+// window that is on at now or starts within lead
+func maintenanceSlaves(sj StateJSON, now time.Time, lead time.Duration) map[string]bool {
+	draining := make(map[string]bool)
+
+	for _, w := range sj.Maintenance {
+		start := time.Unix(0, w.Unavailability.Start.Nanoseconds)
+		// no duration means the machines don't come back
+		end := start.Add(time.Duration(w.Unavailability.Duration.Nanoseconds))
+		if now.Add(lead).Before(start) || (w.Unavailability.Duration.Nanoseconds > 0 && !now.Before(end)) {
+			continue
+		}
+
+		for _, m := range w.MachineIds {
+			for _, s := range sj.Slaves {
+				if s.Hostname != "" && (s.Hostname == m.Hostname || s.Hostname == m.IP) {
+					logging.VeryVerbose.Println("slave " + s.Hostname + " is entering maintenance")
+					draining[s.Id] = true
+				}
+			}
+		}
+	}
+
+	return draining
+}
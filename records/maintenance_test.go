@@ -0,0 +1,119 @@
+package records
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// schedule returns a maintenance schedule with one window for machine
+func schedule(t *testing.T, machine string, start time.Time, duration time.Duration) []MaintenanceWindow {
+	var windows []MaintenanceWindow
+	err := json.Unmarshal([]byte(`[{
+		"machine_ids": [{"hostname": "`+machine+`"}],
+		"unavailability": {
+			"start": {"nanoseconds": `+strconv.FormatInt(start.UnixNano(), 10)+`},
+			"duration": {"nanoseconds": `+strconv.FormatInt(int64(duration), 10)+`}
+		}
+	}]`), &windows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return windows
+}
+
+func TestMaintenanceSlaves(t *testing.T) {
+	now := time.Now()
+	lead := 5 * time.Minute
+
+	var tests = []struct {
+		start    time.Time
+		duration time.Duration
+		draining bool
+	}{
+		{now.Add(time.Hour), time.Hour, false},
+		{now.Add(time.Minute), time.Hour, true},
+		{now.Add(-time.Minute), time.Hour, true},
+		{now.Add(-time.Hour), time.Minute, false},
+		{now.Add(-time.Hour), 0, true},
+	}
+
+	for _, tt := range tests {
+		sj := StateJSON{
+			Slaves:      Slaves{{Id: "s1", Hostname: "10.0.0.1"}, {Id: "s2", Hostname: "10.0.0.2"}},
+			Maintenance: schedule(t, "10.0.0.1", tt.start, tt.duration),
+		}
+
+		draining := maintenanceSlaves(sj, now, lead)
+		if draining["s1"] != tt.draining || draining["s2"] {
+			t.Errorf("window at %v for %v: expected draining %v, got %v", tt.start.Sub(now), tt.duration, tt.draining, draining)
+		}
+	}
+}
+
+func TestMaintenanceAgents(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1"},
+			{"id": "s2", "hostname": "10.0.0.2"}
+		],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING"},
+			{"name": "web", "slave_id": "s2", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sj.Maintenance = schedule(t, "10.0.0.2", time.Now(), time.Hour)
+
+	var tests = []struct {
+		mode      string
+		hosts     []string
+		unhealthy bool
+	}{
+		{"ignore", []string{"10.0.0.1", "10.0.0.2"}, false},
+		{"deprioritize", []string{"10.0.0.1", "10.0.0.2"}, true},
+		{"drop", []string{"10.0.0.1"}, false},
+	}
+
+	for _, tt := range tests {
+		var rg RecordGenerator
+		rg.InsertState(sj, Config{Domain: "mesos", MaintenanceAgents: tt.mode})
+
+		if !reflect.DeepEqual(rg.As["web.marathon.mesos."], tt.hosts) {
+			t.Errorf("%s: expected %v, got %v", tt.mode, tt.hosts, rg.As["web.marathon.mesos."])
+		}
+		if rg.Unhealthy("web.marathon.mesos.", "10.0.0.2") != tt.unhealthy {
+			t.Errorf("%s: expected unhealthy %v", tt.mode, tt.unhealthy)
+		}
+	}
+}
+
+func TestLoadMaintenance(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/master/maintenance/schedule" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"windows": [{"machine_ids": [{"hostname": "agent1", "ip": "10.0.0.1"}],
+			"unavailability": {"start": {"nanoseconds": 1}}}]}`))
+	}))
+	defer ts.Close()
+
+	ip, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	var rg RecordGenerator
+	windows, err := rg.loadMaintenance(ip, port, Config{Timeout: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 1 || windows[0].MachineIds[0].IP != "10.0.0.1" || windows[0].Unavailability.Start.Nanoseconds != 1 {
+		t.Errorf("unexpected schedule %+v", windows)
+	}
+}
@@ -0,0 +1,164 @@
+package records
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultNameTemplate names the A records of tasks
+	defaultNameTemplate = "{task}.{framework}.{domain}"
+
+	// defaultSRVTemplate names the SRV records of tasks
+	defaultSRVTemplate = "_{task}._{protocol}.{framework}.{domain}"
+)
+
+var (
+	invalidChars = regexp.MustCompile("[^a-z0-9.-]+")
+	dashes       = regexp.MustCompile("-*\\.-*")
+	versionTail  = regexp.MustCompile("-v?[0-9]+(\\.[0-9]+)+$")
+)
+
+// sanitize turns a task or framework name into dns labels, per
+// NameSanitize
+func sanitize(name string, config Config) string {
+	if config.NameSanitize != "dash" {
+		return cleanName(name)
+	}
+
+	// replace what is invalid with dashes, and drop them at label edges
+	s := invalidChars.ReplaceAllString(strings.ToLower(name), "-")
+	s = dashes.ReplaceAllString(s, ".")
+	return strings.Trim(s, "-.")
+}
+
+// frameworkName is the label of framework name, without its version if
+// CollapseVersions is set
+func frameworkName(name string, config Config) string {
+	fname := sanitize(name, config)
+	if config.CollapseVersions {
+		if short := versionTail.ReplaceAllString(fname, ""); short != "" {
+			fname = short
+		}
+	}
+	return fname
+}
+
+// roleName is the label of the subzone the tasks of frameworks with role
+// are served under with RoleZones, empty if they are served right under
+// the domain
+func roleName(role string, config Config) string {
+	if !config.RoleZones || role == "*" {
+		return ""
+	}
+	return sanitize(role, config)
+}
+
+// frameworkIncluded tells whether tasks of the framework get records, by
+// IncludeFrameworks and ExcludeFrameworks, matching the framework name as
+// in state.json or as served
+func frameworkIncluded(name string, config Config) bool {
+	names := []string{strings.ToLower(name), frameworkName(name, config)}
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			for _, n := range names {
+				if ok, _ := path.Match(strings.ToLower(pattern), n); ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if len(config.IncludeFrameworks) > 0 && !matches(config.IncludeFrameworks) {
+		return false
+	}
+	return !matches(config.ExcludeFrameworks)
+}
+
+// render fills in a naming template, returning a fully qualified name
+func render(template string, fallback string, fields map[string]string) string {
+	if template == "" {
+		template = fallback
+	}
+
+	name := template
+	for k, v := range fields {
+		name = strings.Replace(name, "{"+k+"}", v, -1)
+	}
+	return name + "."
+}
+
+// taskName is the name of the A records of task, tname and fname are
+// already sanitized
+func taskName(tname string, fname string, task Task, config Config) string {
+	return render(config.NameTemplate, defaultNameTemplate, map[string]string{
+		"task":      tname,
+		"framework": fname,
+		"instance":  strconv.Itoa(task.instance),
+		"domain":    config.Domain,
+	})
+}
+
+// srvName is the name of the SRV records of task for protocol
+func srvName(tname string, fname string, task Task, protocol string, config Config) string {
+	return render(config.SRVTemplate, defaultSRVTemplate, map[string]string{
+		"task":      tname,
+		"framework": fname,
+		"instance":  strconv.Itoa(task.instance),
+		"protocol":  protocol,
+		"domain":    config.Domain,
+	})
+}
+
+// checkTemplate returns what is wrong with a naming template
+func checkTemplate(template string, required ...string) string {
+	for _, field := range required {
+		if !strings.Contains(template, "{"+field+"}") {
+			return "must contain {" + field + "}"
+		}
+	}
+	if !strings.HasSuffix(template, ".{domain}") {
+		return "must end with .{domain}"
+	}
+
+	rest := template
+	for _, field := range []string{"task", "framework", "instance", "protocol", "domain"} {
+		rest = strings.Replace(rest, "{"+field+"}", "", -1)
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return "has an unknown field"
+	}
+	return ""
+}
+
+// numberInstances numbers the running tasks of the same name within each
+// framework in the order of their task ids, for {instance}
+func numberInstances(f Frameworks, config Config) {
+	for i := range f {
+		byName := make(map[string][]*Task)
+		for x := range f[i].Tasks {
+			task := &f[i].Tasks[x]
+			if task.State == "TASK_RUNNING" {
+				tname := sanitize(task.Name, config)
+				byName[tname] = append(byName[tname], task)
+			}
+		}
+
+		for _, tasks := range byName {
+			sort.Sort(byTaskIdPtr(tasks))
+			for n, task := range tasks {
+				task.instance = n
+			}
+		}
+	}
+}
+
+type byTaskIdPtr []*Task
+
+func (t byTaskIdPtr) Len() int           { return len(t) }
+func (t byTaskIdPtr) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byTaskIdPtr) Less(i, j int) bool { return t[i].Id < t[j].Id }
@@ -0,0 +1,175 @@
+package records
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	var tests = []struct {
+		name     string
+		sanitize string
+		expected string
+	}{
+		{"My App", "strip", "myapp"},
+		{"my_app", "strip", "myapp"},
+		{"My App", "dash", "my-app"},
+		{"my_app", "dash", "my-app"},
+		{"--web  server!--", "dash", "web-server"},
+		{"api.v2_beta", "dash", "api.v2-beta"},
+		{"a_.b", "dash", "a.b"},
+	}
+
+	for _, tt := range tests {
+		if got := sanitize(tt.name, Config{NameSanitize: tt.sanitize}); got != tt.expected {
+			t.Errorf("%s %q: expected %q, got %q", tt.sanitize, tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestFrameworkName(t *testing.T) {
+	var tests = []struct {
+		name     string
+		collapse bool
+		expected string
+	}{
+		{"marathon-0.6.0", false, "marathon-0.6.0"},
+		{"marathon-0.6.0", true, "marathon"},
+		{"chronos-v2.3", true, "chronos"},
+		{"kafka-2", true, "kafka-2"},
+		{"marathon", true, "marathon"},
+	}
+
+	for _, tt := range tests {
+		if got := frameworkName(tt.name, Config{CollapseVersions: tt.collapse}); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestFrameworkIncluded(t *testing.T) {
+	var tests = []struct {
+		include  []string
+		exclude  []string
+		name     string
+		included bool
+	}{
+		{nil, nil, "chronos-2.3.0", true},
+		{[]string{"marathon*"}, nil, "marathon-0.6.0", true},
+		{[]string{"marathon*"}, nil, "chronos-2.3.0", false},
+		{[]string{"Marathon"}, nil, "marathon", true},
+		{nil, []string{"chronos-test"}, "chronos-test", false},
+		{nil, []string{"chronos-test"}, "chronos", true},
+		{[]string{"*"}, []string{"*test*"}, "chronos-test", false},
+	}
+
+	for _, tt := range tests {
+		config := Config{IncludeFrameworks: tt.include, ExcludeFrameworks: tt.exclude}
+		if got := frameworkIncluded(tt.name, config); got != tt.included {
+			t.Errorf("%q with %v and %v: expected %v, got %v", tt.name, tt.include, tt.exclude, tt.included, got)
+		}
+	}
+
+	// served names match too
+	config := Config{IncludeFrameworks: []string{"marathon"}, CollapseVersions: true}
+	if !frameworkIncluded("marathon-0.6.0", config) {
+		t.Error("should match the collapsed framework name")
+	}
+}
+
+func TestRoleZones(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "s1", "hostname": "10.0.0.1"}],
+		"frameworks": [
+			{"name": "marathon", "role": "dev", "tasks": [
+				{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING", "resources": {"ports": "[80-80]"}}]},
+			{"name": "chronos", "role": "*", "tasks": [
+				{"name": "job", "slave_id": "s1", "state": "TASK_RUNNING"}]}
+		]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		zones bool
+		name  string
+		found bool
+	}{
+		{false, "web.marathon.mesos.", true},
+		{false, "web.marathon.dev.mesos.", false},
+		{true, "web.marathon.dev.mesos.", true},
+		{true, "web.marathon.mesos.", false},
+		{true, "_web._tcp.marathon.dev.mesos.", true},
+		{true, "job.chronos.mesos.", true},
+	}
+
+	for _, tt := range tests {
+		var rg RecordGenerator
+		rg.InsertState(sj, Config{Domain: "mesos", RoleZones: tt.zones})
+
+		_, a := rg.As[tt.name]
+		_, srv := rg.SRVs[tt.name]
+		if (a || srv) != tt.found {
+			t.Errorf("rolezones %v: expected %s found %v", tt.zones, tt.name, tt.found)
+		}
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	var tests = []struct {
+		template string
+		ok       bool
+	}{
+		{"{task}.{framework}.{domain}", true},
+		{"{task}-{instance}.{domain}", true},
+		{"{framework}.{domain}", false},
+		{"{task}.{framework}", false},
+		{"{task}.{frmework}.{domain}", false},
+	}
+
+	for _, tt := range tests {
+		if problem := checkTemplate(tt.template, "task"); (problem == "") != tt.ok {
+			t.Errorf("%s: expected ok %v, got %q", tt.template, tt.ok, problem)
+		}
+	}
+}
+
+func TestNameTemplates(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "s1", "hostname": "10.0.0.1"}, {"id": "s2", "hostname": "10.0.0.2"}],
+		"leader": "master@10.0.0.9:5050",
+		"frameworks": [{"name": "marathon-0.6.0", "tasks": [
+			{"id": "b", "name": "web_app", "slave_id": "s2", "state": "TASK_RUNNING", "resources": {"ports": "[31000-31000]"}},
+			{"id": "a", "name": "web_app", "slave_id": "s1", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{
+		Domain:           "mesos",
+		InactiveAgents:   "drop",
+		NameTemplate:     "{task}-{instance}.{domain}",
+		SRVTemplate:      "_{task}._{protocol}.{domain}",
+		NameSanitize:     "dash",
+		CollapseVersions: true,
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, config)
+
+	if !reflect.DeepEqual(rg.As["web-app-0.mesos."], []string{"10.0.0.1"}) {
+		t.Errorf("unexpected web-app-0 %v", rg.As["web-app-0.mesos."])
+	}
+	if !reflect.DeepEqual(rg.As["web-app-1.mesos."], []string{"10.0.0.2"}) {
+		t.Errorf("unexpected web-app-1 %v", rg.As["web-app-1.mesos."])
+	}
+	if !reflect.DeepEqual(rg.SRVs["_web-app._tcp.mesos."], []string{"web-app-1.mesos:31000"}) {
+		t.Errorf("unexpected SRV %v", rg.SRVs["_web-app._tcp.mesos."])
+	}
+}
@@ -0,0 +1,46 @@
+package records
+
+import (
+	"encoding/json"
+)
+
+// preset holds timing settings that work well together
+type preset struct {
+	RefreshSeconds int
+	TTL            int
+	SOARefresh     int
+	SOARetry       int
+	SOAExpire      int
+	SOAMinttl      int
+}
+
+// presets are the timing presets operators can pick with Preset
+var presets = map[string]preset{
+	// clients notice failed tasks within seconds, at the cost of many
+	// more queries and state fetches
+	"fast-failover": {RefreshSeconds: 5, TTL: 5, SOARefresh: 10, SOARetry: 5, SOAExpire: 3600, SOAMinttl: 5},
+	// services whose tasks rarely move
+	"stable": {RefreshSeconds: 60, TTL: 300, SOARefresh: 300, SOARetry: 600, SOAExpire: 86400, SOAMinttl: 60},
+	// large batch clusters where many clients look up the same names and
+	// a few minutes of stale records are fine
+	"bulk-batch": {RefreshSeconds: 300, TTL: 600, SOARefresh: 900, SOARetry: 1800, SOAExpire: 604800, SOAMinttl: 300},
+}
+
+// applyPreset sets the timing settings of the Preset of c, then the ones
+// in the configuration file b again so they win over the preset
+// an unknown Preset is left for Check to report
+func (c *Config) applyPreset(b []byte) error {
+	p, ok := presets[c.Preset]
+	if !ok {
+		return nil
+	}
+
+	c.RefreshSeconds = p.RefreshSeconds
+	c.TTL = p.TTL
+	c.SOARefresh = p.SOARefresh
+	c.SOARetry = p.SOARetry
+	c.SOAExpire = p.SOAExpire
+	c.SOAMinttl = p.SOAMinttl
+
+	return json.Unmarshal(b, c)
+}
@@ -0,0 +1,42 @@
+package records
+
+import (
+	"testing"
+)
+
+func TestApplyPreset(t *testing.T) {
+	var tests = []struct {
+		preset  string
+		file    string
+		refresh int
+		ttl     int
+		minttl  int
+	}{
+		{"", `{}`, 60, 60, 60},
+		{"fast-failover", `{}`, 5, 5, 5},
+		{"stable", `{}`, 60, 300, 60},
+		{"bulk-batch", `{"ttl": 900}`, 300, 900, 300},
+		{"unknown", `{}`, 60, 60, 60},
+	}
+
+	for _, tt := range tests {
+		c := Config{Preset: tt.preset, RefreshSeconds: 60, TTL: 60, SOAMinttl: 60}
+		if err := c.applyPreset([]byte(tt.file)); err != nil {
+			t.Errorf("%s: %v", tt.preset, err)
+			continue
+		}
+		if c.RefreshSeconds != tt.refresh || c.TTL != tt.ttl || c.SOAMinttl != tt.minttl {
+			t.Errorf("%s %s: expected refresh %d ttl %d minttl %d, got %d %d %d", tt.preset, tt.file,
+				tt.refresh, tt.ttl, tt.minttl, c.RefreshSeconds, c.TTL, c.SOAMinttl)
+		}
+	}
+
+	// presets leave no warnings
+	for name := range presets {
+		c := Config{Preset: name}
+		c.applyPreset([]byte(`{}`))
+		if c.TTL < c.RefreshSeconds || c.SOARetry <= 0 || c.SOAExpire < c.SOARefresh {
+			t.Errorf("%s: timings do not fit together: %+v", name, presets[name])
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package records
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// secret values in config.json can reference the environment or carry a
+// blob encrypted with the key in SecretKeyFile instead of the plaintext
+const (
+	envPrefix = "env:"
+	encPrefix = "enc:"
+)
+
+// loadSecretKey reads a base64 encoded 32 byte AES-256 key from path
+func loadSecretKey(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != 32 {
+		return nil, errors.New("secret key must be 32 bytes")
+	}
+
+	return key, nil
+}
+
+// EncryptSecret returns the config.json value for plaintext encrypted
+// with the key in keyFile
+func EncryptSecret(plaintext string, keyFile string) (string, error) {
+	key, err := loadSecretKey(keyFile)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret opens a blob produced by EncryptSecret
+func decryptSecret(blob string, key []byte) (string, error) {
+	if key == nil {
+		return "", errors.New("encrypted secret but no secretkeyfile")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(blob)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret too short")
+	}
+
+	nonce := sealed[:gcm.NonceSize()]
+	plain, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+// resolveSecret returns the plaintext for a secret config value -
+// "env:NAME" reads the environment, "enc:blob" decrypts blob with key and
+// anything else is taken literally
+func resolveSecret(s string, key []byte) (string, error) {
+	switch {
+	case strings.HasPrefix(s, envPrefix):
+		name := strings.TrimPrefix(s, envPrefix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.New("environment variable " + name + " not set")
+		}
+		return v, nil
+	case strings.HasPrefix(s, encPrefix):
+		return decryptSecret(strings.TrimPrefix(s, encPrefix), key)
+	}
+
+	return s, nil
+}
+
+// resolveSecrets replaces every secret field of c with its plaintext
+func (c *Config) resolveSecrets() error {
+	var key []byte
+	if c.SecretKeyFile != "" {
+		var err error
+		key, err = loadSecretKey(c.SecretKeyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range []*string{&c.MasterPassword, &c.AdminToken} {
+		v, err := resolveSecret(*s, key)
+		if err != nil {
+			return err
+		}
+		*s = v
+	}
+
+	for name, secret := range c.TSIGKeys {
+		v, err := resolveSecret(secret, key)
+		if err != nil {
+			return errors.New("tsig key " + name + ": " + err.Error())
+		}
+		c.TSIGKeys[name] = v
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package records
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	f, err := ioutil.TempFile("", "mesos-dns-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(base64.StdEncoding.EncodeToString(make([]byte, 32)) + "\n")
+	f.Close()
+
+	key, err := loadSecretKey(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := EncryptSecret("s3cret", f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := resolveSecret(enc, key); err != nil || s != "s3cret" {
+		t.Error("not decrypting secrets", s, err)
+	}
+
+	if _, err := resolveSecret(enc, nil); err == nil {
+		t.Error("should fail to decrypt without a key")
+	}
+
+	os.Setenv("MESOS_DNS_TEST_SECRET", "fromenv")
+	defer os.Unsetenv("MESOS_DNS_TEST_SECRET")
+	if s, _ := resolveSecret("env:MESOS_DNS_TEST_SECRET", nil); s != "fromenv" {
+		t.Error("not reading secrets from the environment")
+	}
+
+	if _, err := resolveSecret("env:MESOS_DNS_TEST_MISSING", nil); err == nil {
+		t.Error("should fail on a missing environment variable")
+	}
+
+	if s, _ := resolveSecret("plain", nil); s != "plain" {
+		t.Error("should pass plain values through")
+	}
+}
+
+func TestResolveSecretsTSIGKeys(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString([]byte("tsig secret"))
+	os.Setenv("MESOS_DNS_TEST_TSIG", secret)
+	defer os.Unsetenv("MESOS_DNS_TEST_TSIG")
+
+	c := Config{TSIGKeys: map[string]string{
+		"env.key.": "env:MESOS_DNS_TEST_TSIG",
+		"raw.key.": secret,
+	}}
+	if err := c.resolveSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	for name, v := range c.TSIGKeys {
+		if v != secret {
+			t.Errorf("%s: expected the plaintext secret, got %q", name, v)
+		}
+	}
+
+	c.TSIGKeys["missing.key."] = "env:MESOS_DNS_TEST_MISSING"
+	if err := c.resolveSecrets(); err == nil {
+		t.Error("should fail on a tsig key from a missing environment variable")
+	}
+}
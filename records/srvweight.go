@@ -0,0 +1,114 @@
+package records
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// srvWeight is the priority and weight of a SRV record
+type srvWeight struct {
+	priority uint16
+	weight   uint16
+}
+
+// taskSRVWeight returns the SRV priority and weight of a task, from its
+// SRVPriorityLabel and SRVWeightLabel labels or else its resources, ok
+// is false if neither is set
+func taskSRVWeight(task Task, config Config) (w srvWeight, ok bool) {
+	switch config.SRVWeight {
+	case "cpus":
+		w.weight, ok = clampWeight(task.Resources.Cpus*100), true
+	case "mem":
+		w.weight, ok = clampWeight(task.Resources.Mem), true
+	}
+
+	if v, found := labelUint16(task, config.SRVWeightLabel); found {
+		w.weight, ok = v, true
+	}
+	if v, found := labelUint16(task, config.SRVPriorityLabel); found {
+		w.priority, ok = v, true
+	}
+	return w, ok
+}
+
+// clampWeight rounds f to a SRV weight
+func clampWeight(f float64) uint16 {
+	if f <= 0 {
+		return 0
+	}
+	return uint16(math.Min(math.Ceil(f), math.MaxUint16))
+}
+
+// labelUint16 returns the number in the key label of a task, found is
+// false if it has none or it is not a number from 0 to 65535
+func labelUint16(task Task, key string) (v uint16, found bool) {
+	if key == "" {
+		return 0, false
+	}
+
+	for _, l := range task.Labels {
+		if l.Key != key {
+			continue
+		}
+
+		n, err := strconv.ParseUint(l.Value, 10, 16)
+		if err != nil {
+			logging.VeryVerbose.Println("ignoring " + key + " " + l.Value + " of task " + task.Id)
+			return 0, false
+		}
+		return uint16(n), true
+	}
+	return 0, false
+}
+
+// setTaskSRVWeight sets the priority and weight of the SRV records of a
+// task
+func (rg *RecordGenerator) setTaskSRVWeight(tname string, fname string, arec string, task Task, w srvWeight, config Config) {
+	for _, port := range yankPorts(task.Resources.Ports) {
+		srvhost := strings.TrimSuffix(arec, ".") + ":" + port
+		rg.setSRVWeight(srvName(tname, fname, task, "tcp", config), srvhost, w)
+		rg.setSRVWeight(srvName(tname, fname, task, "udp", config), srvhost, w)
+	}
+}
+
+// setSRVWeight sets the priority and weight of the SRV record of name
+// for host, tasks behind the same host add up their weights and the
+// most preferred priority wins
+func (rg *RecordGenerator) setSRVWeight(name string, host string, w srvWeight) {
+	if rg.srvWeights == nil {
+		rg.srvWeights = make(map[string]map[string]srvWeight)
+	}
+	if rg.srvWeights[name] == nil {
+		rg.srvWeights[name] = make(map[string]srvWeight)
+	}
+
+	if cur, ok := rg.srvWeights[name][host]; ok {
+		w.weight = clampWeight(float64(cur.weight) + float64(w.weight))
+		if cur.priority < w.priority {
+			w.priority = cur.priority
+		}
+	}
+	rg.srvWeights[name][host] = w
+}
+
+// SetSRVWeight sets the priority and weight of the SRV record of name for
+// host, e.g. restored from a zone transfer
+func (rg *RecordGenerator) SetSRVWeight(name string, host string, priority uint16, weight uint16) {
+	if rg.srvWeights == nil {
+		rg.srvWeights = make(map[string]map[string]srvWeight)
+	}
+	if rg.srvWeights[name] == nil {
+		rg.srvWeights[name] = make(map[string]srvWeight)
+	}
+	rg.srvWeights[name][host] = srvWeight{priority: priority, weight: weight}
+}
+
+// SRVWeight returns the priority and weight of the SRV record of name
+// for host, 0 unless its tasks set them
+func (rg *RecordGenerator) SRVWeight(name string, host string) (priority uint16, weight uint16) {
+	w := rg.srvWeights[name][host]
+	return w.priority, w.weight
+}
@@ -0,0 +1,59 @@
+package records
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSRVWeight(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "s1", "hostname": "10.0.0.1"}],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING",
+			 "resources": {"ports": "[80-80]", "cpus": 0.5, "mem": 128}},
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING",
+			 "resources": {"ports": "[80-80]", "cpus": 1.5, "mem": 256}},
+			{"name": "db", "slave_id": "s1", "state": "TASK_RUNNING",
+			 "resources": {"ports": "[5432-5432]", "cpus": 2, "mem": 1024},
+			 "labels": [{"key": "DNS_SRV_WEIGHT", "value": "7"}, {"key": "DNS_SRV_PRIORITY", "value": "1"}]},
+			{"name": "bad", "slave_id": "s1", "state": "TASK_RUNNING",
+			 "resources": {"ports": "[81-81]"}, "labels": [{"key": "DNS_SRV_WEIGHT", "value": "70000"}]}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		resource string
+		labels   bool
+		name     string
+		host     string
+		priority uint16
+		weight   uint16
+	}{
+		{"none", true, "_web._tcp.marathon.mesos.", "web.marathon.mesos:80", 0, 0},
+		{"cpus", true, "_web._tcp.marathon.mesos.", "web.marathon.mesos:80", 0, 200},
+		{"mem", true, "_web._udp.marathon.mesos.", "web.marathon.mesos:80", 0, 384},
+		{"none", true, "_db._tcp.marathon.mesos.", "db.marathon.mesos:5432", 1, 7},
+		{"cpus", true, "_db._tcp.marathon.mesos.", "db.marathon.mesos:5432", 1, 7},
+		{"cpus", false, "_db._tcp.marathon.mesos.", "db.marathon.mesos:5432", 0, 200},
+		{"none", true, "_bad._tcp.marathon.mesos.", "bad.marathon.mesos:81", 0, 0},
+	}
+
+	for _, tt := range tests {
+		config := Config{Domain: "mesos", SRVWeight: tt.resource}
+		if tt.labels {
+			config.SRVWeightLabel = "DNS_SRV_WEIGHT"
+			config.SRVPriorityLabel = "DNS_SRV_PRIORITY"
+		}
+
+		var rg RecordGenerator
+		rg.InsertState(sj, config)
+
+		if priority, weight := rg.SRVWeight(tt.name, tt.host); priority != tt.priority || weight != tt.weight {
+			t.Errorf("%s %s: expected %d %d, got %d %d", tt.resource, tt.name, tt.priority, tt.weight, priority, weight)
+		}
+	}
+}
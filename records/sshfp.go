@@ -0,0 +1,131 @@
+package records
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// sshfpAlgorithms are the SSHFP numbers of the host key algorithms
+// named by the SSHFPAttribute attributes
+var sshfpAlgorithms = map[string]string{"rsa": "1", "dsa": "2", "ecdsa": "3", "ed25519": "4"}
+
+// attributeSSHFP returns the SSHFP records in the prefix-algorithm
+// attributes of a slave, e.g. sshfp-ed25519:<sha-256 of the host key>
+func attributeSSHFP(s slave, prefix string) []string {
+	var fps []string
+	for key, v := range s.Attributes {
+		alg, ok := sshfpAlgorithms[strings.TrimPrefix(key, prefix+"-")]
+		fp, text := v.(string)
+		if !strings.HasPrefix(key, prefix+"-") || !ok || !text {
+			continue
+		}
+
+		// the type follows from the length, SHA-1 or SHA-256
+		fp = strings.ToLower(fp)
+		b, err := hex.DecodeString(fp)
+		switch {
+		case err == nil && len(b) == 20:
+			fps = append(fps, alg+" 1 "+fp)
+		case err == nil && len(b) == 32:
+			fps = append(fps, alg+" 2 "+fp)
+		default:
+			logging.VeryVerbose.Println("ignoring the " + key + " fingerprint of slave " + s.Id)
+		}
+	}
+	return fps
+}
+
+// fileSSHFP reads the SSHFP records in a file written by ssh-keyscan -D,
+// by host name
+func fileSSHFP(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fps := make(map[string][]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		rr, err := dns.NewRR(line)
+		fp, ok := rr.(*dns.SSHFP)
+		if err != nil || !ok {
+			logging.VeryVerbose.Println("ignoring " + line + " in " + path)
+			continue
+		}
+		host := strings.ToLower(fp.Hdr.Name)
+		fps[host] = append(fps[host], strconv.Itoa(int(fp.Algorithm))+" "+strconv.Itoa(int(fp.Type))+" "+
+			strings.ToLower(fp.FingerPrint))
+	}
+	return fps, scanner.Err()
+}
+
+// agentName returns the name of a slave under slave.domain, the first
+// label of its hostname or its address with dashes, e.g.
+// agent1.slave.mesos or 10-0-0-1.slave.mesos
+func agentName(s slave, domain string) (string, bool) {
+	label := s.Hostname
+	if net.ParseIP(label) != nil {
+		label = strings.Replace(strings.Replace(label, ".", "-", -1), ":", "-", -1)
+	} else {
+		label = cleanName(strings.SplitN(label, ".", 2)[0])
+	}
+
+	if !validLabels(label) || strings.Contains(label, ".") {
+		return "", false
+	}
+	return label + ".slave." + domain + ".", true
+}
+
+// sshfpRecords sets the A and SSHFP records of agent.slave.domain for
+// every active slave with host key fingerprints in its SSHFPAttribute
+// attributes or the SSHFPFile
+func (rg *RecordGenerator) sshfpRecords(config Config, inactive map[string]bool) {
+	if config.SSHFPAttribute == "" && config.SSHFPFile == "" {
+		return
+	}
+
+	var file map[string][]string
+	if config.SSHFPFile != "" {
+		var err error
+		if file, err = fileSSHFP(config.SSHFPFile); err != nil {
+			logging.Error.Println("cannot read the sshfp file:", err)
+		}
+	}
+
+	for _, s := range rg.Slaves {
+		if inactive[s.Id] || s.Hostname == "" {
+			continue
+		}
+
+		fps := file[dns.Fqdn(strings.ToLower(s.Hostname))]
+		if config.SSHFPAttribute != "" {
+			fps = append(fps, attributeSSHFP(s, config.SSHFPAttribute)...)
+		}
+		if len(fps) == 0 {
+			continue
+		}
+
+		name, ok := agentName(s, config.Domain)
+		if !ok {
+			logging.VeryVerbose.Println("no name for slave " + s.Id + " to publish its fingerprints at")
+			continue
+		}
+		rg.insertRR(name, s.Hostname, "A")
+		for _, fp := range fps {
+			rg.insertRR(name, fp, "SSHFP")
+		}
+	}
+}
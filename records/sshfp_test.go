@@ -0,0 +1,58 @@
+package records
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSSHFPRecords(t *testing.T) {
+	f, err := ioutil.TempFile("", "sshfp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("; agent2.example.com:22 SSH-2.0-OpenSSH_7.4\n" +
+		"agent2.example.com IN SSHFP 1 1 0123456789ABCDEF0123456789ABCDEF01234567\n" +
+		"other.example.com IN SSHFP 4 2 00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff\n" +
+		"not a record\n")
+	f.Close()
+
+	var sj StateJSON
+	err = json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1", "attributes": {
+				"sshfp-ed25519": "00112233445566778899AABBCCDDEEFF00112233445566778899AABBCCDDEEFF",
+				"sshfp-rsa": "not hex",
+				"sshfp-unknown": "0123456789abcdef0123456789abcdef01234567",
+				"rack": "a3"}},
+			{"id": "s2", "hostname": "agent2.example.com", "pid": "slave(1)@10.0.0.2:5051"},
+			{"id": "s3", "hostname": "10.0.0.3", "attributes": {"rack": "a3"}}
+		]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, Config{Domain: "mesos", SSHFPAttribute: "sshfp", SSHFPFile: f.Name()})
+
+	want := rrs{
+		"10-0-0-1.slave.mesos.": {"4 2 00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"},
+		"agent2.slave.mesos.":   {"1 1 0123456789abcdef0123456789abcdef01234567"},
+	}
+	if !reflect.DeepEqual(rg.SSHFPs, want) {
+		t.Errorf("expected %v, got %v", want, rg.SSHFPs)
+	}
+	if hosts := rg.As["10-0-0-1.slave.mesos."]; len(hosts) != 1 || hosts[0] != "10.0.0.1" {
+		t.Errorf("expected an A record for the agent name, got %v", hosts)
+	}
+	if hosts := rg.As["agent2.slave.mesos."]; len(hosts) != 1 || hosts[0] != "10.0.0.2" {
+		t.Errorf("expected an A record for the agent name, got %v", hosts)
+	}
+	if _, ok := rg.As["10-0-0-3.slave.mesos."]; ok {
+		t.Error("slaves without fingerprints should get no name")
+	}
+}
@@ -0,0 +1,76 @@
+package records
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// taskTLSA returns the TLSA records a task asks for with its key_port
+// labels, by port, e.g. DNS_TLSA_443="3 1 1 <sha-256 of the key>", where
+// a label may hold several records separated by commas
+func taskTLSA(task Task, key string) map[string][]string {
+	if key == "" {
+		return nil
+	}
+
+	var tlsa map[string][]string
+	for _, l := range task.Labels {
+		if !strings.HasPrefix(l.Key, key+"_") {
+			continue
+		}
+
+		port := strings.TrimPrefix(l.Key, key+"_")
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 || port != strconv.Itoa(p) {
+			logging.VeryVerbose.Println("ignoring tlsa label " + l.Key + " of task " + task.Id)
+			continue
+		}
+
+		for _, value := range strings.Split(l.Value, ",") {
+			rr, ok := tlsaValue(value)
+			if !ok {
+				logging.VeryVerbose.Println("ignoring tlsa " + value + " of task " + task.Id)
+				continue
+			}
+			if tlsa == nil {
+				tlsa = make(map[string][]string)
+			}
+			tlsa[port] = append(tlsa[port], rr)
+		}
+	}
+	return tlsa
+}
+
+// tlsaValue returns the TLSA record value "usage selector type data" in
+// canonical form, ok is false if it is not valid
+func tlsaValue(value string) (string, bool) {
+	fields := strings.Fields(value)
+	if len(fields) != 4 {
+		return "", false
+	}
+
+	// certificate usage, selector and matching type
+	for i, max := range []int{3, 1, 2} {
+		if n, err := strconv.Atoi(fields[i]); err != nil || n < 0 || n > max {
+			return "", false
+		}
+	}
+
+	data := strings.ToLower(fields[3])
+	if b, err := hex.DecodeString(data); err != nil || len(b) == 0 {
+		return "", false
+	}
+
+	return strings.Join(append(fields[:3], data), " "), true
+}
+
+// tlsaRecords sets the TLSA records a task asks for at _port._tcp.name
+func (rg *RecordGenerator) tlsaRecords(fname string, name string, task Task, config Config) {
+	for port, values := range taskTLSA(task, config.TLSALabel) {
+		for _, value := range values {
+			rg.frameworkRR(fname, "_"+port+"._tcp."+name, value, "TLSA")
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package records
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTLSARecords(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "s1", "hostname": "10.0.0.1"}],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING", "labels": [
+				{"key": "DNS_TLSA_443", "value": "3 1 1 0A1B2C, 2 0 1 ffee"},
+				{"key": "DNS_TLSA_8443", "value": "3 1 1 0a1b2c"}
+			]},
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING", "labels": [
+				{"key": "DNS_TLSA_443", "value": "3 1 1 0a1b2c"}
+			]},
+			{"name": "bad", "slave_id": "s1", "state": "TASK_RUNNING", "labels": [
+				{"key": "DNS_TLSA_https", "value": "3 1 1 0a1b2c"},
+				{"key": "DNS_TLSA_443", "value": "4 1 1 0a1b2c,3 1 1 xyz,3 1 1"}
+			]}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, Config{Domain: "mesos", TLSALabel: "DNS_TLSA"})
+
+	want := rrs{
+		"_443._tcp.web.marathon.mesos.":  {"2 0 1 ffee", "3 1 1 0a1b2c"},
+		"_8443._tcp.web.marathon.mesos.": {"3 1 1 0a1b2c"},
+	}
+	if !reflect.DeepEqual(rg.TLSAs, want) {
+		t.Errorf("expected %v, got %v", want, rg.TLSAs)
+	}
+
+	rg = RecordGenerator{}
+	rg.InsertState(sj, Config{Domain: "mesos"})
+	if len(rg.TLSAs) != 0 {
+		t.Errorf("expected no TLSA records without a label, got %v", rg.TLSAs)
+	}
+}
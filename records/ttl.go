@@ -0,0 +1,62 @@
+package records
+
+import (
+	"strconv"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// taskTTL returns the TTL in the key label of a task, ok is false if it
+// has none or it is not a number of seconds
+func taskTTL(task Task, key string) (ttl int, ok bool) {
+	if key == "" {
+		return 0, false
+	}
+
+	for _, l := range task.Labels {
+		if l.Key != key {
+			continue
+		}
+
+		ttl, err := strconv.Atoi(l.Value)
+		if err != nil || ttl < 0 {
+			logging.VeryVerbose.Println("ignoring ttl " + l.Value + " of task " + task.Id)
+			return 0, false
+		}
+		return ttl, true
+	}
+	return 0, false
+}
+
+// setTaskTTL sets the TTL of the A and SRV records of a task
+func (rg *RecordGenerator) setTaskTTL(tname string, fname string, arec string, task Task, ttl int, config Config) {
+	rg.setTTL(arec, ttl)
+	if task.Resources.Ports == "" {
+		return
+	}
+
+	rg.setTTL(srvName(tname, fname, task, "tcp", config), ttl)
+	rg.setTTL(srvName(tname, fname, task, "udp", config), ttl)
+}
+
+// setTTL sets the TTL of name, the shortest one asked for wins
+func (rg *RecordGenerator) setTTL(name string, ttl int) {
+	if rg.ttls == nil {
+		rg.ttls = make(map[string]int)
+	}
+	if cur, ok := rg.ttls[name]; !ok || ttl < cur {
+		rg.ttls[name] = ttl
+	}
+}
+
+// SetTTL sets the TTL tasks asked for name, e.g. restored from a zone
+// transfer
+func (rg *RecordGenerator) SetTTL(name string, ttl int) {
+	rg.setTTL(name, ttl)
+}
+
+// TTL returns the TTL tasks asked for name, ok is false if they didn't
+func (rg *RecordGenerator) TTL(name string) (ttl int, ok bool) {
+	ttl, ok = rg.ttls[name]
+	return ttl, ok
+}
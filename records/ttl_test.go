@@ -0,0 +1,45 @@
+package records
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTaskTTL(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "s1", "hostname": "10.0.0.1"}],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING", "resources": {"ports": "[80-80]"},
+			 "labels": [{"key": "DNS_TTL", "value": "10"}]},
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING", "labels": [{"key": "DNS_TTL", "value": "5"}]},
+			{"name": "bad", "slave_id": "s1", "state": "TASK_RUNNING", "labels": [{"key": "DNS_TTL", "value": "soon"}]},
+			{"name": "db", "slave_id": "s1", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		label string
+		name  string
+		ttl   int
+		ok    bool
+	}{
+		{"DNS_TTL", "web.marathon.mesos.", 5, true},
+		{"DNS_TTL", "_web._tcp.marathon.mesos.", 10, true},
+		{"DNS_TTL", "bad.marathon.mesos.", 0, false},
+		{"DNS_TTL", "db.marathon.mesos.", 0, false},
+		{"", "web.marathon.mesos.", 0, false},
+	}
+
+	for _, tt := range tests {
+		var rg RecordGenerator
+		rg.InsertState(sj, Config{Domain: "mesos", TTLLabel: tt.label})
+
+		if ttl, ok := rg.TTL(tt.name); ttl != tt.ttl || ok != tt.ok {
+			t.Errorf("%q %s: expected %d %v, got %d %v", tt.label, tt.name, tt.ttl, tt.ok, ttl, ok)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package records
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// Discovery is the DiscoveryInfo of a task, with the ports it serves
+type Discovery struct {
+	Ports struct {
+		Ports []DiscoveryPort `json:"ports"`
+	} `json:"ports"`
+}
+
+// DiscoveryPort is a named port of a task, its labels may give the
+// scheme and path of the URL it is served at
+type DiscoveryPort struct {
+	Number   int    `json:"number"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Labels   struct {
+		Labels []Label `json:"labels"`
+	} `json:"labels"`
+}
+
+// label returns the value of the key label of p, "" if it has none
+func (p DiscoveryPort) label(key string) string {
+	for _, l := range p.Labels.Labels {
+		if l.Key == key {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// uriRecords sets a URI record (RFC 7553) at _name._protocol.name for
+// every named port of a task labeled with a scheme, e.g.
+// https://app.marathon.mesos:31000/api for a port labeled scheme=https
+// and path=/api
+func (rg *RecordGenerator) uriRecords(fname string, name string, task Task) {
+	if task.Discovery == nil {
+		return
+	}
+
+	for _, p := range task.Discovery.Ports.Ports {
+		scheme := strings.ToLower(p.label("scheme"))
+		if scheme == "" {
+			continue
+		}
+
+		pname := cleanName(p.Name)
+		proto := strings.ToLower(p.Protocol)
+		if proto == "" {
+			proto = "tcp"
+		}
+		if !validLabels(pname) || strings.Contains(pname, ".") || p.Number < 1 || p.Number > 65535 ||
+			(proto != "tcp" && proto != "udp") || !validScheme(scheme) {
+			logging.VeryVerbose.Println("ignoring the uri of port " + p.Name + " of task " + task.Id)
+			continue
+		}
+
+		path := p.label("path")
+		if path != "" && !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		uri := scheme + "://" + strings.TrimSuffix(name, ".") + ":" + strconv.Itoa(p.Number) + path
+		rg.frameworkRR(fname, "_"+pname+"._"+proto+"."+name, uri, "URI")
+	}
+}
+
+// validScheme reports whether s is a URI scheme (RFC 3986)
+func validScheme(s string) bool {
+	for i, c := range s {
+		letter := c >= 'a' && c <= 'z'
+		if !letter && (i == 0 || !(c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return s != ""
+}
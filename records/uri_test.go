@@ -0,0 +1,39 @@
+package records
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestURIRecords(t *testing.T) {
+	var sj StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "s1", "hostname": "10.0.0.1"}],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING", "discovery": {"ports": {"ports": [
+				{"number": 31000, "name": "api", "protocol": "tcp", "labels": {"labels": [
+					{"key": "scheme", "value": "https"}, {"key": "path", "value": "v2"}]}},
+				{"number": 31001, "name": "Metrics", "labels": {"labels": [{"key": "scheme", "value": "http"}]}},
+				{"number": 31002, "name": "raw", "protocol": "tcp"},
+				{"number": 31003, "name": "bad", "labels": {"labels": [{"key": "scheme", "value": "ht tp"}]}},
+				{"number": 0, "name": "zero", "labels": {"labels": [{"key": "scheme", "value": "http"}]}}
+			]}}},
+			{"name": "db", "slave_id": "s1", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rg RecordGenerator
+	rg.InsertState(sj, Config{Domain: "mesos"})
+
+	want := rrs{
+		"_api._tcp.web.marathon.mesos.":     {"https://web.marathon.mesos:31000/v2"},
+		"_metrics._tcp.web.marathon.mesos.": {"http://web.marathon.mesos:31001"},
+	}
+	if !reflect.DeepEqual(rg.URIs, want) {
+		t.Errorf("expected %v, got %v", want, rg.URIs)
+	}
+}
@@ -0,0 +1,67 @@
+package resolver
+
+import (
+	"net"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// remoteIP returns the address of the client behind w, nil if it has
+// none
+func remoteIP(w dns.ResponseWriter) net.IP {
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	}
+	return nil
+}
+
+// inNetworks reports whether ip is in any of the networks (CIDR)
+func inNetworks(ip net.IP, cidrs []string) bool {
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryAllowed reports whether the client behind w may query us at all,
+// everyone may unless AllowQuery is set
+func (res *Resolver) queryAllowed(w dns.ResponseWriter) bool {
+	config := res.config()
+	return len(config.AllowQuery) == 0 || inNetworks(remoteIP(w), config.AllowQuery)
+}
+
+// recursionAllowed reports whether the client behind w may have queries
+// for other domains forwarded, everyone may unless AllowRecursion is set
+func (res *Resolver) recursionAllowed(w dns.ResponseWriter) bool {
+	config := res.config()
+	return len(config.AllowRecursion) == 0 || inNetworks(remoteIP(w), config.AllowRecursion)
+}
+
+// aclChecked refuses the queries of clients outside AllowQuery and passes
+// the rest to h
+func (res *Resolver) aclChecked(h dns.Handler) dns.Handler {
+	if len(res.config().AllowQuery) == 0 {
+		return h
+	}
+
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if res.queryAllowed(w) {
+			h.ServeDNS(w, r)
+			return
+		}
+
+		logging.CurLog.QueryACLRefused += 1
+		logging.Verbose.Println("refused query from " + remoteIP(w).String() + ", not in allowquery")
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		res.reply(w, r, m)
+	})
+}
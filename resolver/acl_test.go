@@ -0,0 +1,65 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestACLs(t *testing.T) {
+	config := records.Config{
+		Domain:         "mesos",
+		RecurseOn:      true,
+		MaxForwardHops: 3,
+		AllowQuery:     []string{"10.0.0.0/8", "fd00::/8"},
+		AllowRecursion: []string{"10.1.0.0/16"},
+	}
+	res := New(config)
+
+	served := 0
+	h := res.aclChecked(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) { served++ }))
+	client := func(ip string) *fakeWriter {
+		return &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP(ip), Port: 53}}
+	}
+
+	var tests = []struct {
+		ip             string
+		query, recurse bool
+	}{
+		{"10.1.2.3", true, true},
+		{"10.2.0.1", true, false},
+		{"fd00::1", true, false},
+		{"192.0.2.1", false, false},
+	}
+
+	for _, tt := range tests {
+		served = 0
+		w := client(tt.ip)
+		h.ServeDNS(w, new(dns.Msg).SetQuestion("web.marathon.mesos.", dns.TypeA))
+		if query := served == 1; query != tt.query {
+			t.Errorf("%s: expected query allowed %v, got %v", tt.ip, tt.query, query)
+		}
+		if !tt.query && (w.msg == nil || w.msg.Rcode != dns.RcodeRefused) {
+			t.Errorf("%s: expected REFUSED, got %v", tt.ip, w.msg)
+		}
+
+		if recurse := res.recursionAllowed(w); recurse != tt.recurse {
+			t.Errorf("%s: expected recursion allowed %v, got %v", tt.ip, tt.recurse, recurse)
+		}
+	}
+
+	// queries for other domains are refused before they are forwarded
+	w := client("10.2.0.1")
+	res.HandleNonMesos(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+	if w.msg == nil || w.msg.Rcode != dns.RcodeRefused {
+		t.Errorf("expected REFUSED for recursion outside allowrecursion, got %v", w.msg)
+	}
+
+	// without ACLs everyone may
+	res = New(records.Config{Domain: "mesos"})
+	if !res.queryAllowed(client("192.0.2.1")) || !res.recursionAllowed(client("192.0.2.1")) {
+		t.Error("expected everyone to be allowed without acls")
+	}
+}
@@ -0,0 +1,137 @@
+package resolver
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// acmePrefix is the label ACME DNS-01 validation looks up (RFC 8555)
+const acmePrefix = "_acme-challenge."
+
+// challenges holds the TXT values published for ACME DNS-01 validation
+// and when they expire, keyed by name - it is guarded by rsLock
+// a nil *challenges holds none
+type challenges struct {
+	items map[string]map[string]time.Time
+}
+
+func newChallenges() *challenges {
+	return &challenges{items: make(map[string]map[string]time.Time)}
+}
+
+// insert adds the challenges that have not expired to rg
+func (c *challenges) insert(rg *records.RecordGenerator) {
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+	for name, values := range c.items {
+		for value, expires := range values {
+			if now.Before(expires) {
+				rg.Insert(name, value, "TXT")
+			}
+		}
+	}
+}
+
+func (c *challenges) add(name string, value string, expires time.Time) {
+	if c.items[name] == nil {
+		c.items[name] = make(map[string]time.Time)
+	}
+	c.items[name][value] = expires
+}
+
+// remove drops a challenge and reports whether it was there
+func (c *challenges) remove(name string, value string) bool {
+	if _, ok := c.items[name][value]; !ok {
+		return false
+	}
+
+	delete(c.items[name], value)
+	if len(c.items[name]) == 0 {
+		delete(c.items, name)
+	}
+	return true
+}
+
+// expire drops the challenges that expired by now and reports whether
+// there were any
+func (c *challenges) expire(now time.Time) bool {
+	expired := false
+	for name, values := range c.items {
+		for value, expires := range values {
+			if !now.Before(expires) {
+				c.remove(name, value)
+				expired = true
+			}
+		}
+	}
+	return expired
+}
+
+// challengeName returns the name a challenge for domain is published at,
+// domain has to be in the mesos domain
+func (res *Resolver) challengeName(domain string) (string, error) {
+	domain = dns.Fqdn(strings.ToLower(domain))
+	if _, ok := dns.IsDomainName(domain); !ok {
+		return "", errors.New("invalid domain " + domain)
+	}
+
+	if domain != res.zone() && !strings.HasSuffix(domain, "."+res.zone()) {
+		return "", errors.New(domain + " is not in " + res.zone())
+	}
+
+	return acmePrefix + domain, nil
+}
+
+// addChallenge publishes value as a TXT record at _acme-challenge.domain
+// for ACMETTL seconds
+func (res *Resolver) addChallenge(domain string, value string) (string, time.Time, error) {
+	name, err := res.challengeName(domain)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	ttl := time.Duration(res.config().ACMETTL) * time.Second
+	expires := time.Now().Add(ttl)
+
+	res.rsLock.Lock()
+	res.acme.add(name, value, expires)
+	res.publish()
+	res.rsLock.Unlock()
+
+	time.AfterFunc(ttl, func() {
+		res.rsLock.Lock()
+		defer res.rsLock.Unlock()
+
+		if res.acme.expire(time.Now()) {
+			res.publish()
+		}
+	})
+
+	return name, expires, nil
+}
+
+// removeChallenge withdraws a challenge once validation is done and
+// reports whether it was published
+func (res *Resolver) removeChallenge(domain string, value string) (bool, error) {
+	name, err := res.challengeName(domain)
+	if err != nil {
+		return false, err
+	}
+
+	res.rsLock.Lock()
+	defer res.rsLock.Unlock()
+
+	if !res.acme.remove(name, value) {
+		return false, nil
+	}
+
+	res.publish()
+	return true, nil
+}
@@ -0,0 +1,98 @@
+package resolver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func acmeDNS(t *testing.T) *Resolver {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Config.ACMETTL = 60
+	res.base = res.rs.Copy()
+	res.acme = newChallenges()
+	return res
+}
+
+func TestChallengeName(t *testing.T) {
+	res := acmeDNS(t)
+
+	var tests = []struct {
+		domain, name string
+		ok           bool
+	}{
+		{"myapp.marathon.mesos", "_acme-challenge.myapp.marathon.mesos.", true},
+		{"MyApp.Marathon.Mesos.", "_acme-challenge.myapp.marathon.mesos.", true},
+		{"mesos", "_acme-challenge.mesos.", true},
+		{"example.com", "", false},
+		{"notmesos", "", false},
+	}
+
+	for _, tt := range tests {
+		name, err := res.challengeName(tt.domain)
+		if (err == nil) != tt.ok || name != tt.name {
+			t.Errorf("%s: expected %q ok %v, got %q %v", tt.domain, tt.name, tt.ok, name, err)
+		}
+	}
+}
+
+func TestChallenges(t *testing.T) {
+	res := acmeDNS(t)
+	serial := res.serial
+
+	name, _, err := res.addChallenge("myapp.marathon.mesos", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion(name, dns.TypeTXT)
+	w := &fakeWriter{}
+	res.HandleMesos(w, r)
+	if len(w.msg.Answer) != 1 || w.msg.Answer[0].(*dns.TXT).Txt[0] != "token" {
+		t.Fatalf("expected the challenge, got %v", w.msg.Answer)
+	}
+	if res.serial == serial {
+		t.Error("publishing a challenge should change the serial")
+	}
+
+	// challenges survive reloads
+	res.base = res.base.Copy()
+	res.publish()
+	if len(res.rs.TXTs[name]) != 1 {
+		t.Error("challenge should survive a reload")
+	}
+
+	if ok, _ := res.removeChallenge("myapp.marathon.mesos", "other"); ok {
+		t.Error("should not remove a challenge that was never added")
+	}
+	if ok, _ := res.removeChallenge("myapp.marathon.mesos", "token"); !ok {
+		t.Error("should remove the challenge")
+	}
+	res.HandleMesos(w, r)
+	if w.msg.Rcode != dns.RcodeNameError {
+		t.Error("removed challenge should be gone")
+	}
+}
+
+func TestChallengeExpiry(t *testing.T) {
+	c := newChallenges()
+	now := time.Now()
+	c.add("_acme-challenge.a.mesos.", "old", now.Add(-time.Second))
+	c.add("_acme-challenge.a.mesos.", "new", now.Add(time.Minute))
+
+	if !c.expire(now) {
+		t.Error("should expire the old challenge")
+	}
+	if _, ok := c.items["_acme-challenge.a.mesos."]["new"]; !ok || len(c.items["_acme-challenge.a.mesos."]) != 1 {
+		t.Error("should keep the new challenge")
+	}
+	if c.expire(now) {
+		t.Error("nothing left to expire")
+	}
+}
@@ -0,0 +1,98 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// HandleAlias answers queries for alias, another name for the mesos
+// domain, from the records of the mesos domain
+func (res *Resolver) HandleAlias(alias string) dns.HandlerFunc {
+	alias = dns.Fqdn(strings.ToLower(alias))
+
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		q := r.Question[0]
+
+		// transfers and signatures are for the mesos domain only
+		if q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeRefused)
+			res.reply(w, r, m)
+			return
+		}
+
+		req := r.Copy()
+		req.Question[0].Name = rename(q.Name, alias, res.zone())
+
+		res.HandleMesos(&aliasWriter{ResponseWriter: w, res: res, r: r, alias: alias}, req)
+	}
+}
+
+// rename moves name from the zone from to the zone to, names outside
+// from are left alone
+func rename(name string, from string, to string) string {
+	lower := strings.ToLower(name)
+	if lower == from {
+		return to
+	}
+	if strings.HasSuffix(lower, "."+from) {
+		return name[:len(name)-len(from)] + to
+	}
+	return name
+}
+
+// aliasWriter rewrites responses for the mesos domain into responses
+// for alias
+type aliasWriter struct {
+	dns.ResponseWriter
+	res   *Resolver
+	r     *dns.Msg
+	alias string
+}
+
+func (a *aliasWriter) WriteMsg(m *dns.Msg) error {
+	zone := a.res.zone()
+
+	m.Question = a.r.Question
+	for _, section := range []*[]dns.RR{&m.Answer, &m.Ns, &m.Extra} {
+		var kept []dns.RR
+		for _, rr := range *section {
+			switch rr := rr.(type) {
+			case *dns.RRSIG, *dns.NSEC, *dns.DNSKEY:
+				// they would not validate under another name
+				continue
+			case *dns.SRV:
+				rr.Target = rename(rr.Target, zone, a.alias)
+			case *dns.SOA:
+				rr.Ns = rename(rr.Ns, zone, a.alias)
+				rr.Mbox = rename(rr.Mbox, zone, a.alias)
+			case *dns.NS:
+				rr.Ns = rename(rr.Ns, zone, a.alias)
+			}
+
+			rr.Header().Name = rename(rr.Header().Name, zone, a.alias)
+			kept = append(kept, rr)
+		}
+		*section = kept
+	}
+
+	// the alias may be longer than the mesos domain
+	if size := maxSize(a, a.r); m.Len() > size {
+		logging.CurLog.Truncated += 1
+		a.res.fit(m, size)
+	}
+
+	return a.ResponseWriter.WriteMsg(m)
+}
+
+// Write takes the packed answers of the answer cache
+func (a *aliasWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	m.Compress = true
+	return len(b), a.WriteMsg(m)
+}
@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRename(t *testing.T) {
+	var tests = []struct {
+		name, expected string
+	}{
+		{"mesos.", "cluster.internal."},
+		{"app.marathon.mesos.", "app.marathon.cluster.internal."},
+		{"App.Marathon.MESOS.", "App.Marathon.cluster.internal."},
+		{"notmesos.", "notmesos."},
+		{"example.com.", "example.com."},
+	}
+
+	for _, tt := range tests {
+		if got := rename(tt.name, "mesos.", "cluster.internal."); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestHandleAlias(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.answers = newAnswers(10)
+	h := res.HandleAlias("Cluster.Internal")
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		r := new(dns.Msg)
+		r.SetQuestion(name, qtype)
+		w := &fakeWriter{}
+		h(w, r)
+		return w.msg
+	}
+
+	// the second answer comes from the answer cache
+	for i := 0; i < 2; i++ {
+		m := query("chronos.marathon-0.6.0.cluster.internal.", dns.TypeA)
+		if len(m.Answer) != 1 || m.Answer[0].Header().Name != "chronos.marathon-0.6.0.cluster.internal." {
+			t.Errorf("%d: expected an A record for the alias, got %v", i, m.Answer)
+		}
+		if m.Question[0].Name != "chronos.marathon-0.6.0.cluster.internal." {
+			t.Errorf("%d: question should be kept, got %v", i, m.Question)
+		}
+	}
+
+	m := query("_liquor-store._tcp.marathon-0.6.0.cluster.internal.", dns.TypeSRV)
+	if len(m.Answer) == 0 {
+		t.Fatal("expected SRV records for the alias")
+	}
+	for _, rr := range m.Answer {
+		if srv := rr.(*dns.SRV); srv.Target != "liquor-store.marathon-0.6.0.cluster.internal." {
+			t.Errorf("SRV target should be in the alias, got %s", srv.Target)
+		}
+	}
+
+	m = query("missing.cluster.internal.", dns.TypeA)
+	if m.Rcode != dns.RcodeNameError || len(m.Ns) != 1 || m.Ns[0].Header().Name != "cluster.internal." {
+		t.Errorf("expected NXDOMAIN with the SOA of the alias, got %v", m)
+	}
+
+	if m = query("cluster.internal.", dns.TypeAXFR); m.Rcode != dns.RcodeRefused {
+		t.Error("should refuse transfers of aliases")
+	}
+}
@@ -0,0 +1,143 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// answerKey identifies an assembled answer for the mesos domain - on top
+// of the question it holds everything in the request that changes the
+// bytes we send back
+type answerKey struct {
+	name  string
+	qtype uint16
+	class uint16
+	rd    bool
+	cd    bool
+	edns  uint16
+	do    bool
+	tcp   bool
+}
+
+// answer is a wire format response and how it was counted
+type answer struct {
+	wire     []byte
+	rcode    int
+	answered bool
+}
+
+// answers holds assembled responses for the mesos domain until the next
+// reload, so hot names skip assembly, shuffling and packing
+// a nil *answers caches nothing
+type answers struct {
+	sync.Mutex
+	size  int
+	items map[answerKey]answer
+}
+
+func newAnswers(size int) *answers {
+	return &answers{size: size, items: make(map[answerKey]answer)}
+}
+
+// answerKeyFor returns the key for the response to r over w and whether
+// the response may be cached at all
+func answerKeyFor(w dns.ResponseWriter, r *dns.Msg) (answerKey, bool) {
+	// signed responses are unique
+	if r.IsTsig() != nil || len(r.Question) != 1 {
+		return answerKey{}, false
+	}
+
+	q := r.Question[0]
+	k := answerKey{
+		name:  q.Name,
+		qtype: q.Qtype,
+		class: q.Qclass,
+		rd:    r.RecursionDesired,
+		cd:    r.CheckingDisabled,
+	}
+	if opt := r.IsEdns0(); opt != nil {
+		k.edns = opt.UDPSize()
+		k.do = opt.Do()
+	}
+	_, k.tcp = w.RemoteAddr().(*net.TCPAddr)
+
+	return k, true
+}
+
+func (a *answers) get(k answerKey) (answer, bool) {
+	if a == nil {
+		return answer{}, false
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	ans, ok := a.items[k]
+	return ans, ok
+}
+
+// set stores ans unless the cache is full, it empties on every reload
+func (a *answers) set(k answerKey, ans answer) {
+	if a == nil {
+		return
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	if len(a.items) < a.size {
+		a.items[k] = ans
+	}
+}
+
+// reset drops every answer, the records they were made from are gone
+func (a *answers) reset() {
+	if a == nil {
+		return
+	}
+
+	a.Lock()
+	a.items = make(map[answerKey]answer)
+	a.Unlock()
+}
+
+// writeAnswer sends a cached answer as the reply to r
+func writeAnswer(w dns.ResponseWriter, r *dns.Msg, ans answer) {
+	wire := make([]byte, len(ans.wire))
+	copy(wire, ans.wire)
+	binary.BigEndian.PutUint16(wire, r.Id)
+
+	if _, err := w.Write(wire); err != nil {
+		logging.Error.Println(err)
+	}
+}
+
+// captureWriter packs the response itself so the wire format can be kept,
+// and holds it until send
+type captureWriter struct {
+	dns.ResponseWriter
+	wire []byte
+}
+
+func (c *captureWriter) WriteMsg(m *dns.Msg) error {
+	wire, err := m.Pack()
+	if err != nil {
+		return err
+	}
+
+	c.wire = wire
+	return nil
+}
+
+// send writes the packed response, if there is one
+func (c *captureWriter) send() {
+	if c.wire == nil {
+		return
+	}
+
+	if _, err := c.ResponseWriter.Write(c.wire); err != nil {
+		logging.Error.Println(err)
+	}
+}
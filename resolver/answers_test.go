@@ -0,0 +1,111 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+func TestAnswerCache(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.answers = newAnswers(10)
+
+	query := func(name string, id uint16, w *fakeWriter) *dns.Msg {
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		r.Id = id
+		res.HandleMesos(w, r)
+		return w.msg
+	}
+
+	first := query("chronos.marathon-0.6.0.mesos.", 1, &fakeWriter{})
+	before := logging.CurLog.MesosCached
+
+	second := query("chronos.marathon-0.6.0.mesos.", 2, &fakeWriter{})
+	if logging.CurLog.MesosCached != before+1 {
+		t.Fatal("second query should be answered from the cache")
+	}
+	if second.Id != 2 || len(second.Answer) != len(first.Answer) {
+		t.Error("cached answer should carry the new id and the same records")
+	}
+
+	// different transport, different answer
+	query("chronos.marathon-0.6.0.mesos.", 3, &fakeWriter{remote: &net.TCPAddr{}})
+	if logging.CurLog.MesosCached != before+1 {
+		t.Error("tcp queries should not get udp answers")
+	}
+
+	if m := query("missing.mesos.", 4, &fakeWriter{}); m.Rcode != dns.RcodeNameError {
+		t.Error("expected NXDOMAIN")
+	}
+	if m := query("missing.mesos.", 5, &fakeWriter{}); m.Rcode != dns.RcodeNameError || len(m.Ns) != 1 {
+		t.Error("expected a cached NXDOMAIN with the SOA")
+	}
+
+	res.answers.reset()
+	query("chronos.marathon-0.6.0.mesos.", 6, &fakeWriter{})
+	if logging.CurLog.MesosCached != before+2 {
+		t.Error("reset should drop the cached answers")
+	}
+
+	var none *answers
+	none.set(answerKey{}, answer{})
+	if _, ok := none.get(answerKey{}); ok {
+		t.Error("nil answers should cache nothing")
+	}
+}
+
+// lockCheckWriter records whether the records were locked while the
+// response was written
+type lockCheckWriter struct {
+	fakeWriter
+	res    *Resolver
+	locked bool
+}
+
+func (w *lockCheckWriter) check() {
+	if w.res.rsLock.TryLock() {
+		w.res.rsLock.Unlock()
+	} else {
+		w.locked = true
+	}
+}
+
+func (w *lockCheckWriter) WriteMsg(m *dns.Msg) error {
+	w.check()
+	return w.fakeWriter.WriteMsg(m)
+}
+
+func (w *lockCheckWriter) Write(b []byte) (int, error) {
+	w.check()
+	return w.fakeWriter.Write(b)
+}
+
+func TestAnswerWrittenUnlocked(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cache := range []*answers{nil, newAnswers(10)} {
+		res.answers = cache
+		// assembled, then from the cache
+		for i := 0; i < 2; i++ {
+			r := new(dns.Msg)
+			r.SetQuestion("chronos.marathon-0.6.0.mesos.", dns.TypeA)
+			w := &lockCheckWriter{res: res}
+			res.HandleMesos(w, r)
+			if w.msg == nil || len(w.msg.Answer) == 0 {
+				t.Fatal("expected an answer")
+			}
+			if w.locked {
+				t.Errorf("the records should be unlocked while writing (cache %v, query %d)", cache != nil, i)
+			}
+		}
+	}
+}
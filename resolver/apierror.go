@@ -0,0 +1,82 @@
+package resolver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// requestIDHeader carries the id of an API request, taken from the
+// client when it sends one so it can match our logs to its own
+const requestIDHeader = "X-Request-Id"
+
+// error codes of the HTTP API, they don't change when the messages do
+const (
+	errNotFound         = "not_found"
+	errMethodNotAllowed = "method_not_allowed"
+	errInvalidRequest   = "invalid_request"
+	errUnauthorized     = "unauthorized"
+	errForbidden        = "forbidden"
+)
+
+// apiError is the body of every failed HTTP API request
+type apiError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+// apiErrorResponse wraps an apiError, so clients can tell error bodies
+// from the rest
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+// requestID gives each request an id, echoed in the response header
+func requestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// writeError fails a request with status code, code is one of the
+// err constants and details is optional
+func writeError(w http.ResponseWriter, status int, code string, message string, details string) {
+	id := w.Header().Get(requestIDHeader)
+	logging.Verbose.Println("api request " + id + " failed: " + code + ": " + message)
+
+	writeJSON(w, status, apiErrorResponse{apiError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: id,
+	}})
+}
+
+// methodNotAllowed fails a request made with none of the allowed methods
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "method not allowed", "allowed: "+allow)
+}
+
+// handleNotFound fails requests for paths we don't serve
+func handleNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, errNotFound, "no such endpoint", r.URL.Path)
+}
@@ -0,0 +1,29 @@
+package resolver
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+// refreshDelay returns how long to wait for the next reload after
+// failures reloads in a row that didn't reach the masters: the refresh
+// interval, doubled for every failure up to RefreshBackoffMax, then moved
+// by up to RefreshJitter of itself either way so instances started
+// together don't poll the masters together
+func refreshDelay(c records.Config, failures int) time.Duration {
+	d := time.Duration(c.RefreshSeconds) * time.Second
+	max := time.Duration(c.RefreshBackoffMax) * time.Second
+	for i := 0; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if max > 0 && failures > 0 && d > max {
+		d = max
+	}
+
+	if c.RefreshJitter > 0 {
+		d += time.Duration((2*rand.Float64() - 1) * c.RefreshJitter * float64(d))
+	}
+	return d
+}
@@ -0,0 +1,46 @@
+package resolver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+func TestRefreshDelay(t *testing.T) {
+	c := records.Config{RefreshSeconds: 60, RefreshBackoffMax: 600}
+
+	var tests = []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{3, 8 * time.Minute},
+		{4, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if d := refreshDelay(c, tt.failures); d != tt.delay {
+			t.Errorf("%d failures: expected %s, got %s", tt.failures, tt.delay, d)
+		}
+	}
+
+	c.RefreshBackoffMax = 0
+	if d := refreshDelay(c, 5); d != time.Minute {
+		t.Errorf("expected no backoff, got %s", d)
+	}
+
+	c.RefreshJitter = 0.1
+	spread := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		d := refreshDelay(c, 0)
+		if d < 54*time.Second || d > 66*time.Second {
+			t.Fatalf("expected %s within 10%% of a minute", d)
+		}
+		spread[d] = true
+	}
+	if len(spread) < 2 {
+		t.Error("expected the delays to be jittered")
+	}
+}
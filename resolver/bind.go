@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"net"
+	"os"
+	"strconv"
+)
+
+// fileConn is a listener or packet conn we can take the socket of
+type fileConn interface {
+	File() (*os.File, error)
+	Close() error
+}
+
+// bindFile binds addr on network and returns the socket
+func bindFile(network string, addr string) (*os.File, error) {
+	var c fileConn
+	if network == "tcp" {
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c = l.(*net.TCPListener)
+	} else {
+		pc, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c = pc.(*net.UDPConn)
+	}
+	defer c.Close()
+	return c.File()
+}
+
+// Bind opens the sockets of the DNS, DoQ, push and HTTP servers up front, so
+// they can be served after we give up the privileges needed to bind
+// them - servers that restart serve the same sockets again
+func (res *Resolver) Bind() error {
+	config := res.config()
+	dnsAddr := net.JoinHostPort(config.Listener, strconv.Itoa(config.Port))
+	addrs := []struct{ name, network, addr string }{
+		{"tcp", "tcp", dnsAddr},
+		{"udp", "udp", dnsAddr},
+	}
+	if config.DoQPort > 0 {
+		addrs = append(addrs, struct{ name, network, addr string }{
+			"doq", "udp", net.JoinHostPort(config.Listener, strconv.Itoa(config.DoQPort))})
+	}
+	if config.PushPort > 0 {
+		addrs = append(addrs, struct{ name, network, addr string }{
+			"push", "tcp", net.JoinHostPort(config.Listener, strconv.Itoa(config.PushPort))})
+	}
+	if config.HTTPOn {
+		addrs = append(addrs, struct{ name, network, addr string }{
+			"http", "tcp", net.JoinHostPort(config.HTTPListener, strconv.Itoa(config.HTTPPort))})
+	}
+
+	for _, a := range addrs {
+		if res.sockets[a.name] != nil {
+			continue
+		}
+		f, err := bindFile(a.network, a.addr)
+		if err != nil {
+			return err
+		}
+		if res.sockets == nil {
+			res.sockets = make(map[string]*os.File)
+		}
+		res.sockets[a.name] = f
+	}
+	return nil
+}
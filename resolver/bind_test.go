@@ -0,0 +1,42 @@
+package resolver
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+func TestBind(t *testing.T) {
+	port, files := systemdSockets(t)
+	for _, f := range files {
+		f.Close()
+	}
+
+	res := New(records.Config{Domain: "mesos", Listener: "127.0.0.1", Port: port,
+		HTTPOn: true, HTTPListener: "127.0.0.1", HTTPPort: 0})
+	if err := res.Bind(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"tcp", "udp", "http"} {
+		if res.sockets[name] == nil {
+			t.Errorf("expected a %s socket", name)
+		}
+	}
+	if res.sockets["doq"] != nil {
+		t.Error("doq is off, expected no socket for it")
+	}
+
+	// the port is taken until the servers serve it
+	if _, err := net.ListenPacket("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port))); err == nil {
+		t.Error("expected the udp port to stay bound")
+	}
+
+	// bound sockets are kept
+	udp := res.sockets["udp"]
+	if err := res.Bind(); err != nil || res.sockets["udp"] != udp {
+		t.Error("should keep the sockets already bound", err)
+	}
+}
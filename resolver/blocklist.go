@@ -0,0 +1,180 @@
+package resolver
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// blocklist is the set of external names we refuse to forward
+type blocklist struct {
+	sync.RWMutex
+	names map[string]bool
+
+	// sources holds the names of each source as last loaded, only load
+	// uses it
+	sources map[string]map[string]bool
+}
+
+// parseBlocklist reads domains from a block list - either one domain per
+// line or hosts file format ("0.0.0.0 domain"), '#' starts a comment
+func parseBlocklist(rd io.Reader, names map[string]bool) error {
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// hosts format - skip the address
+		if net.ParseIP(fields[0]) != nil {
+			fields = fields[1:]
+		}
+
+		for _, f := range fields {
+			names[dns.Fqdn(strings.ToLower(f))] = true
+		}
+	}
+
+	return scanner.Err()
+}
+
+// openBlocklist opens a block list from a file path or an http(s) url
+func openBlocklist(src string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.Open(src)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New(src + ": " + resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// load replaces the block list with the contents of srcs
+// a source that fails to load keeps its last names and the error is
+// logged
+func (bl *blocklist) load(srcs []string) {
+	sources := make(map[string]map[string]bool, len(srcs))
+	names := make(map[string]bool)
+
+	for _, src := range srcs {
+		loaded, err := loadBlocklist(src)
+		if err != nil {
+			logging.Error.Println(err)
+			loaded = bl.sources[src]
+		}
+		sources[src] = loaded
+		for name := range loaded {
+			names[name] = true
+		}
+	}
+
+	bl.Lock()
+	bl.names, bl.sources = names, sources
+	bl.Unlock()
+
+	logging.Verbose.Printf("loaded %d blocked names\n", len(names))
+}
+
+// loadBlocklist returns the names of the block list src
+func loadBlocklist(src string) (map[string]bool, error) {
+	rd, err := openBlocklist(src)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+
+	names := make(map[string]bool)
+	if err := parseBlocklist(rd, names); err != nil {
+		return nil, errors.New(src + ": " + err.Error())
+	}
+	return names, nil
+}
+
+// blocked reports whether name or any of its parent domains is listed
+func (bl *blocklist) blocked(name string) bool {
+	if bl == nil {
+		return false
+	}
+
+	bl.RLock()
+	defer bl.RUnlock()
+
+	if len(bl.names) == 0 {
+		return false
+	}
+
+	name = strings.ToLower(name)
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if bl.names[name[off:]] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// blockedMsg returns the response for a blocked question - the sinkhole
+// address if one matches the qtype, NXDOMAIN otherwise
+func (res *Resolver) blockedMsg(r *dns.Msg) *dns.Msg {
+	config := res.config()
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.RecursionAvailable = true
+
+	sink := net.ParseIP(config.Sinkhole)
+	if sink == nil {
+		m.SetRcode(r, dns.RcodeNameError)
+		return m
+	}
+
+	q := r.Question[0]
+	hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: uint32(config.TTL)}
+
+	switch {
+	case q.Qtype == dns.TypeA && sink.To4() != nil:
+		hdr.Rrtype = dns.TypeA
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: sink.To4()})
+	case q.Qtype == dns.TypeAAAA && sink.To4() == nil:
+		hdr.Rrtype = dns.TypeAAAA
+		m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: sink})
+	}
+
+	// any other qtype gets NODATA
+	return m
+}
+
+// RefreshBlocklists loads the configured block lists and reloads them
+// every BlocklistRefresh seconds
+func (res *Resolver) RefreshBlocklists() {
+	config := res.config()
+	res.blocklist.load(config.Blocklists)
+
+	ticker := time.NewTicker(time.Second * time.Duration(config.BlocklistRefresh))
+	for _ = range ticker.C {
+		res.blocklist.load(config.Blocklists)
+	}
+}
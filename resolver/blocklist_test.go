@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestBlocklist(t *testing.T) {
+	list := `# comment
+ads.example.com
+0.0.0.0 tracker.example.net # hosts format
+
+BAD.org`
+
+	bl := &blocklist{names: make(map[string]bool)}
+	if err := parseBlocklist(strings.NewReader(list), bl.names); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name    string
+		blocked bool
+	}{
+		{"ads.example.com.", true},
+		{"x.ads.example.com.", true},
+		{"example.com.", false},
+		{"tracker.example.net.", true},
+		{"bad.org.", true},
+		{"www.Bad.Org.", true},
+		{"notbad.org.", false},
+		{"0.0.0.0.", false},
+	}
+
+	for _, tt := range tests {
+		if bl.blocked(tt.name) != tt.blocked {
+			t.Errorf("%s: expected blocked %v", tt.name, tt.blocked)
+		}
+	}
+}
+
+func TestBlocklistLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ads, trackers := filepath.Join(dir, "ads"), filepath.Join(dir, "trackers")
+	ioutil.WriteFile(ads, []byte("ads.example.com\n"), 0644)
+	ioutil.WriteFile(trackers, []byte("tracker.example.net\n"), 0644)
+
+	bl := &blocklist{}
+	bl.load([]string{ads, trackers})
+	if !bl.blocked("ads.example.com.") || !bl.blocked("tracker.example.net.") {
+		t.Fatal("expected the names of both lists blocked")
+	}
+
+	// a list that fails to load keeps its names, the others are updated
+	os.Remove(trackers)
+	ioutil.WriteFile(ads, []byte("more-ads.example.com\n"), 0644)
+	bl.load([]string{ads, trackers})
+	if !bl.blocked("tracker.example.net.") {
+		t.Error("expected the names of a missing list kept")
+	}
+	if bl.blocked("ads.example.com.") || !bl.blocked("more-ads.example.com.") {
+		t.Error("expected the names of a changed list replaced")
+	}
+
+	// lists that are no longer configured go
+	bl.load([]string{ads})
+	if bl.blocked("tracker.example.net.") {
+		t.Error("expected the names of a removed list dropped")
+	}
+}
+
+func TestBlockedMsg(t *testing.T) {
+	r := new(dns.Msg)
+	r.SetQuestion("ads.example.com.", dns.TypeA)
+
+	res := Resolver{Config: records.Config{TTL: 60}}
+	if m := res.blockedMsg(r); m.Rcode != dns.RcodeNameError {
+		t.Error("should return NXDOMAIN without a sinkhole")
+	}
+
+	res.Config.Sinkhole = "10.0.0.1"
+	m := res.blockedMsg(r)
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 1 {
+		t.Fatal("should answer with the sinkhole")
+	}
+
+	if a := m.Answer[0].(*dns.A); a.A.String() != "10.0.0.1" {
+		t.Error("wrong sinkhole address")
+	}
+
+	r.SetQuestion("ads.example.com.", dns.TypeAAAA)
+	if m := res.blockedMsg(r); m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 {
+		t.Error("should return NODATA for AAAA with an IPv4 sinkhole")
+	}
+}
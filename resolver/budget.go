@@ -0,0 +1,53 @@
+package resolver
+
+import (
+	"errors"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// errBudget is the error for answers that ran out of time before we
+// found any records
+var errBudget = errors.New("answer budget exceeded")
+
+// partialTTL caps the TTL of answers that ran out of time, so resolvers
+// come back for the complete answer soon
+const partialTTL = 5
+
+// shorten caps the TTLs of the records of a partial answer at partialTTL
+func shorten(rrs []dns.RR) {
+	for _, rr := range rrs {
+		if rr.Header().Ttl > partialTTL {
+			rr.Header().Ttl = partialTTL
+		}
+	}
+}
+
+// budget bounds the time spent assembling an answer, so the client gets
+// the records found so far instead of timing out with nothing
+type budget struct {
+	deadline time.Time
+	exceeded bool
+}
+
+// newBudget returns a budget of ms milliseconds from now, 0 is unlimited
+func newBudget(ms int) *budget {
+	b := &budget{}
+	if ms > 0 {
+		b.deadline = time.Now().Add(time.Duration(ms) * time.Millisecond)
+	}
+	return b
+}
+
+// left reports whether there is time left to add another record
+func (b *budget) left() bool {
+	if b.exceeded {
+		return false
+	}
+
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		b.exceeded = true
+	}
+	return !b.exceeded
+}
@@ -0,0 +1,85 @@
+package resolver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+func TestBudget(t *testing.T) {
+	if b := newBudget(0); !b.left() || b.exceeded {
+		t.Error("a zero budget should be unlimited")
+	}
+
+	b := newBudget(1)
+	if !b.left() {
+		t.Error("a fresh budget should have time left")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if b.left() || !b.exceeded {
+		t.Error("budget should be exceeded")
+	}
+}
+
+func TestBudgetExceeded(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a budget that is gone before the first record
+	res.Config.AnswerBudget = 1
+	res.rsLock.Lock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		res.rsLock.Unlock()
+	}()
+
+	before := logging.CurLog.MesosPartial
+
+	r := new(dns.Msg)
+	r.SetQuestion("_liquor-store._udp.marathon-0.6.0.mesos.", dns.TypeSRV)
+	w := &fakeWriter{}
+	res.HandleMesos(w, r)
+
+	if logging.CurLog.MesosPartial != before+1 {
+		t.Error("should count the partial answer")
+	}
+	if w.msg.Rcode != dns.RcodeServerFailure {
+		t.Error("an answer without records should be SERVFAIL, not negative")
+	}
+}
+
+func TestBudgetPartialTTL(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the CNAME comes before the budget runs out, its target's A
+	// records don't
+	res.rs.Insert("db.mesos.", "chronos.marathon-0.6.0.mesos.", "CNAME")
+	res.Config.AnswerBudget = 1
+	res.rsLock.Lock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		res.rsLock.Unlock()
+	}()
+
+	r := new(dns.Msg)
+	r.SetQuestion("db.mesos.", dns.TypeA)
+	w := &fakeWriter{}
+	res.HandleMesos(w, r)
+
+	if len(w.msg.Answer) == 0 {
+		t.Fatal("expected the records found before the budget ran out")
+	}
+	for _, rr := range w.msg.Answer {
+		if rr.Header().Ttl > partialTTL {
+			t.Errorf("expected a TTL of at most %d on a partial answer, got %s", partialTTL, rr)
+		}
+	}
+}
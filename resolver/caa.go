@@ -0,0 +1,23 @@
+package resolver
+
+import (
+	"strconv"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// caaRecords returns the CAA records configured for dom, named name
+func (res *Resolver) caaRecords(name string, dom string) []dns.RR {
+	config := res.config()
+	var rrs []dns.RR
+	for _, value := range config.CAA[dom] {
+		rr, err := dns.NewRR(name + " " + strconv.Itoa(config.TTL) + " IN CAA " + value)
+		if err != nil || rr == nil {
+			logging.Error.Println("invalid caa " + value + " for " + dom)
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
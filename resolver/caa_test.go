@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestCAA(t *testing.T) {
+	config := records.Config{
+		Domain: "mesos",
+		TTL:    60,
+		CAA: map[string][]string{
+			"mesos.":               {`0 issue "ca.example.com"`, `0 iodef "mailto:security@example.com"`},
+			"shop.marathon.mesos.": {`128 issue "letsencrypt.org"`},
+		},
+	}
+	res := New(config)
+	res.base.InsertState(records.StateJSON{}, config)
+	res.publish()
+
+	var tests = []struct {
+		name  string
+		rcode int
+		n     int
+	}{
+		{"mesos.", dns.RcodeSuccess, 2},
+		{"shop.marathon.mesos.", dns.RcodeSuccess, 1},
+		{"missing.mesos.", dns.RcodeNameError, 0},
+	}
+
+	for _, tt := range tests {
+		w := &fakeWriter{}
+		res.HandleMesos(w, new(dns.Msg).SetQuestion(tt.name, dns.TypeCAA))
+		if w.msg == nil || w.msg.Rcode != tt.rcode || len(w.msg.Answer) != tt.n {
+			t.Errorf("%s: expected %s with %d answers, got %v", tt.name, dns.RcodeToString[tt.rcode], tt.n, w.msg)
+			continue
+		}
+		for _, rr := range w.msg.Answer {
+			if caa, ok := rr.(*dns.CAA); !ok || caa.Hdr.Ttl != 60 {
+				t.Errorf("%s: expected CAA records, got %v", tt.name, rr)
+			}
+		}
+	}
+
+	caa := res.caaRecords("shop.marathon.mesos.", "shop.marathon.mesos.")[0].(*dns.CAA)
+	if caa.Flag != 128 || caa.Tag != "issue" || caa.Value != "letsencrypt.org" {
+		t.Errorf("unexpected caa record %v", caa)
+	}
+}
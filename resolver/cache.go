@@ -0,0 +1,173 @@
+package resolver
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// cacheKey identifies a cached answer by question
+type cacheKey struct {
+	name  string
+	qtype uint16
+}
+
+// cacheEntry is a cached upstream response and when it goes stale
+type cacheEntry struct {
+	key     cacheKey
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// cache is a size bounded LRU of upstream responses that honors the
+// TTLs handed out by the upstream resolvers
+// a nil *cache is valid and caches nothing
+type cache struct {
+	sync.Mutex
+	size   int
+	maxTTL time.Duration
+	lru    *list.List
+	items  map[cacheKey]*list.Element
+}
+
+// newCache returns a cache holding up to size responses, none of them
+// for longer than maxTTL seconds
+func newCache(size int, maxTTL int) *cache {
+	return &cache{
+		size:   size,
+		maxTTL: time.Duration(maxTTL) * time.Second,
+		lru:    list.New(),
+		items:  make(map[cacheKey]*list.Element),
+	}
+}
+
+// keyFor returns the cache key for the question in r
+func keyFor(r *dns.Msg) cacheKey {
+	q := r.Question[0]
+	return cacheKey{name: strings.ToLower(q.Name), qtype: q.Qtype}
+}
+
+// minTTL returns the TTL a response may be cached for - the lowest TTL
+// in the answer, or the negative caching TTL from the SOA for
+// NXDOMAIN/NODATA responses (RFC 2308)
+func minTTL(m *dns.Msg) (uint32, bool) {
+	var ttl uint32
+	found := false
+
+	rrs := m.Answer
+	if len(rrs) == 0 {
+		for _, rr := range m.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl = soa.Hdr.Ttl
+				if soa.Minttl < ttl {
+					ttl = soa.Minttl
+				}
+				return ttl, true
+			}
+		}
+		return 0, false
+	}
+
+	for _, rr := range rrs {
+		if !found || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+			found = true
+		}
+	}
+
+	return ttl, found
+}
+
+// get returns a copy of the cached response for r with its id and TTLs
+// adjusted, or nil on a miss
+func (c *cache) get(r *dns.Msg) *dns.Msg {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.items[keyFor(r)]
+	if !ok {
+		return nil
+	}
+
+	e := el.Value.(*cacheEntry)
+	now := time.Now()
+	if !now.Before(e.expires) {
+		c.lru.Remove(el)
+		delete(c.items, e.key)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+
+	m := e.msg.Copy()
+	m.Id = r.Id
+
+	age := uint32(now.Sub(e.stored) / time.Second)
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if rr.Header().Ttl > age {
+				rr.Header().Ttl -= age
+			} else {
+				rr.Header().Ttl = 0
+			}
+		}
+	}
+
+	return m
+}
+
+// set stores the upstream response m for r if it is cacheable
+func (c *cache) set(r *dns.Msg, m *dns.Msg) {
+	if c == nil || m == nil || m.Truncated {
+		return
+	}
+
+	if m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError {
+		return
+	}
+
+	ttl, ok := minTTL(m)
+	if !ok || ttl == 0 {
+		return
+	}
+
+	d := time.Duration(ttl) * time.Second
+	if c.maxTTL > 0 && d > c.maxTTL {
+		d = c.maxTTL
+	}
+
+	now := time.Now()
+	e := &cacheEntry{
+		key:     keyFor(r),
+		msg:     m.Copy(),
+		stored:  now,
+		expires: now.Add(d),
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if el, ok := c.items[e.key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.items[e.key] = c.lru.PushFront(e)
+
+	for c.lru.Len() > c.size {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.items, el.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,104 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func fakeAnswer(r *dns.Msg, ttl uint32) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = append(m.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+		A:   net.ParseIP("10.0.0.1").To4(),
+	})
+	return m
+}
+
+func TestCache(t *testing.T) {
+	c := newCache(2, 3600)
+
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+
+	if c.get(r) != nil {
+		t.Error("should miss on an empty cache")
+	}
+
+	c.set(r, fakeAnswer(r, 60))
+
+	// a different query id and case should still hit
+	q := new(dns.Msg)
+	q.SetQuestion("EXAMPLE.com.", dns.TypeA)
+	m := c.get(q)
+	if m == nil {
+		t.Fatal("should hit a cached response")
+	}
+
+	if m.Id != q.Id {
+		t.Error("not rewriting the message id")
+	}
+
+	// other qtypes are separate entries
+	q.SetQuestion("example.com.", dns.TypeAAAA)
+	if c.get(q) != nil {
+		t.Error("should miss for a different qtype")
+	}
+
+	// evict the least recently used entry
+	for _, name := range []string{"a.com.", "b.com."} {
+		n := new(dns.Msg)
+		n.SetQuestion(name, dns.TypeA)
+		c.set(n, fakeAnswer(n, 60))
+	}
+
+	if c.get(r) != nil {
+		t.Error("should have evicted the oldest entry")
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := newCache(10, 3600)
+
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+
+	// zero TTLs are not cacheable
+	c.set(r, fakeAnswer(r, 0))
+	if c.get(r) != nil {
+		t.Error("should not cache a zero TTL")
+	}
+
+	c.set(r, fakeAnswer(r, 60))
+	c.items[keyFor(r)].Value.(*cacheEntry).stored = time.Now().Add(-30 * time.Second)
+
+	m := c.get(r)
+	if m == nil {
+		t.Fatal("should hit a cached response")
+	}
+
+	if ttl := m.Answer[0].Header().Ttl; ttl > 30 {
+		t.Errorf("not decaying TTLs, got %d", ttl)
+	}
+
+	c.items[keyFor(r)].Value.(*cacheEntry).expires = time.Now()
+	if c.get(r) != nil {
+		t.Error("should not serve expired entries")
+	}
+}
+
+func TestCacheMaxTTL(t *testing.T) {
+	c := newCache(10, 5)
+
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+	c.set(r, fakeAnswer(r, 86400))
+
+	e := c.items[keyFor(r)].Value.(*cacheEntry)
+	if e.expires.Sub(e.stored) != 5*time.Second {
+		t.Error("not capping the TTL")
+	}
+}
@@ -0,0 +1,127 @@
+package resolver
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// canary holds freshly generated records while we keep answering from
+// the live ones, comparing what each query would have got from them
+// a nil *canary compares nothing
+type canary struct {
+	base records.RecordGenerator
+
+	compared   int64
+	mismatched int64
+}
+
+// values returns the record values of name for qtype in rg
+func values(rg *records.RecordGenerator, name string, qtype uint16) []string {
+	switch qtype {
+	case dns.TypeA:
+		return rg.As[name]
+	case dns.TypeSRV:
+		return rg.SRVs[name]
+	case dns.TypeTXT:
+		return rg.TXTs[name]
+	case dns.TypeTLSA:
+		return rg.TLSAs[name]
+	case dns.TypeSSHFP:
+		return rg.SSHFPs[name]
+	case dns.TypeURI:
+		return rg.URIs[name]
+	case dns.TypeANY:
+		var all []string
+		all = append(all, rg.As[name]...)
+		all = append(all, rg.SRVs[name]...)
+		return append(all, rg.TXTs[name]...)
+	}
+	return nil
+}
+
+// sameValues reports whether a and b hold the same values, in any order
+func sameValues(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	count := make(map[string]int, len(a))
+	for _, v := range a {
+		count[v]++
+	}
+	for _, v := range b {
+		count[v]--
+		if count[v] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compare notes whether the canary would answer a query for name the
+// way live does
+func (c *canary) compare(name string, qtype uint16, live *records.RecordGenerator) {
+	if c == nil {
+		return
+	}
+
+	atomic.AddInt64(&c.compared, 1)
+	old, cand := values(live, name, qtype), values(&c.base, name, qtype)
+	if sameValues(old, cand) {
+		return
+	}
+
+	atomic.AddInt64(&c.mismatched, 1)
+	logging.CurLog.CanaryMismatched += 1
+	logging.Verbose.Printf("canary: %s %s would change from %v to %v", name, dns.TypeToString[qtype], old, cand)
+}
+
+// passed reports whether few enough queries would have changed
+func (c *canary) passed(max float64) bool {
+	compared := atomic.LoadInt64(&c.compared)
+	if compared == 0 {
+		return true
+	}
+	return float64(atomic.LoadInt64(&c.mismatched))/float64(compared) <= max
+}
+
+// startCanary shadows the live records with rg for window and promotes
+// it afterwards if it passed - the caller holds rsLock
+func (res *Resolver) startCanary(rg records.RecordGenerator, window time.Duration) {
+	c := &canary{base: rg}
+	res.canary = c
+	logging.Verbose.Println("canary: shadowing new records for " + window.String())
+
+	time.AfterFunc(window, func() { res.promote(c) })
+}
+
+// promote serves the records of canary c if it passed, unless a newer
+// canary replaced it
+func (res *Resolver) promote(c *canary) {
+	max := res.config().CanaryMaxMismatch
+
+	res.rsLock.Lock()
+	defer res.rsLock.Unlock()
+
+	if res.canary != c {
+		return
+	}
+	res.canary = nil
+
+	summary := strconv.FormatInt(atomic.LoadInt64(&c.mismatched), 10) + " of " +
+		strconv.FormatInt(atomic.LoadInt64(&c.compared), 10) + " queries would have changed"
+	if !c.passed(max) {
+		logging.CurLog.CanaryRejected += 1
+		logging.Error.Println("canary: keeping the old records, " + summary)
+		return
+	}
+
+	logging.Verbose.Println("canary: promoting the new records, " + summary)
+	res.base = c.base
+	res.publish()
+}
@@ -0,0 +1,71 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSameValues(t *testing.T) {
+	var tests = []struct {
+		a, b []string
+		same bool
+	}{
+		{nil, nil, true},
+		{[]string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.2", "10.0.0.1"}, true},
+		{[]string{"10.0.0.1"}, []string{"10.0.0.1", "10.0.0.1"}, false},
+		{[]string{"10.0.0.1", "10.0.0.1"}, []string{"10.0.0.1", "10.0.0.2"}, false},
+		{[]string{"10.0.0.1"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		if sameValues(tt.a, tt.b) != tt.same {
+			t.Errorf("%v %v: expected same %v", tt.a, tt.b, tt.same)
+		}
+	}
+}
+
+func TestCanary(t *testing.T) {
+	name := "chronos.marathon-0.6.0.mesos."
+
+	for _, max := range []float64{1, 0.4} {
+		res := acmeDNS(t)
+		res.Config.CanaryMaxMismatch = max
+		live := res.rs.As[name]
+
+		cand := res.base.Copy()
+		cand.As[name] = []string{"10.0.0.99"}
+		res.startCanary(cand, time.Hour)
+
+		for _, q := range []string{name, name, "liquor-store.marathon-0.6.0.mesos."} {
+			r := new(dns.Msg)
+			r.SetQuestion(q, dns.TypeA)
+			w := &fakeWriter{}
+			res.HandleMesos(w, r)
+
+			if q == name && w.msg.Answer[0].(*dns.A).A.String() == "10.0.0.99" {
+				t.Fatal("should answer from the live records during the canary")
+			}
+		}
+
+		c := res.canary
+		if c.compared != 3 || c.mismatched != 2 {
+			t.Errorf("expected 2 of 3 queries to differ, got %d of %d", c.mismatched, c.compared)
+		}
+
+		res.promote(c)
+		if res.canary != nil {
+			t.Error("canary should be done")
+		}
+
+		promoted := reflect.DeepEqual(res.rs.As[name], []string{"10.0.0.99"})
+		if max == 1 && !promoted {
+			t.Error("canary should have been promoted")
+		}
+		if max < 1 && (promoted || !reflect.DeepEqual(res.rs.As[name], live)) {
+			t.Error("canary should have been rejected")
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package resolver
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// catalogVersion is the catalog zone schema version we generate
+const catalogVersion = "2"
+
+// catalog is an RFC 9432 catalog zone, listing the zones secondaries
+// should serve
+// its members only change with the configuration, on restart
+type catalog struct {
+	zone    string
+	serial  uint32
+	members []string
+}
+
+// newCatalog returns the catalog zone of config, nil if there is none
+func newCatalog(config records.Config) *catalog {
+	if config.CatalogZone == "" {
+		return nil
+	}
+
+	members := []string{dns.Fqdn(config.Domain)}
+	for _, member := range config.CatalogMembers {
+		members = append(members, dns.Fqdn(member))
+	}
+
+	return &catalog{
+		zone:    dns.Fqdn(config.CatalogZone),
+		serial:  uint32(time.Now().Unix()),
+		members: members,
+	}
+}
+
+// memberID returns the label of member under zones, the same every time
+// so secondaries keep the zone across restarts
+func memberID(member string) string {
+	sum := sha1.Sum([]byte(member))
+	return hex.EncodeToString(sum[:8])
+}
+
+// catalogSOA returns the SOA of the catalog zone
+func (res *Resolver) catalogSOA() *dns.SOA {
+	soa, _ := res.formatSOA(res.catalog.zone)
+	soa.Serial = res.catalog.serial
+	return soa
+}
+
+// catalogRecords returns the records of the catalog zone, without the
+// SOA - the NS every catalog has, its version and a PTR to each member
+func (res *Resolver) catalogRecords() []dns.RR {
+	c := res.catalog
+	hdr := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 0}
+	}
+
+	rrs := []dns.RR{
+		&dns.NS{Hdr: hdr(c.zone, dns.TypeNS), Ns: "invalid."},
+		&dns.TXT{Hdr: hdr("version."+c.zone, dns.TypeTXT), Txt: []string{catalogVersion}},
+	}
+	for _, member := range c.members {
+		rrs = append(rrs, &dns.PTR{Hdr: hdr(memberID(member)+".zones."+c.zone, dns.TypePTR), Ptr: member})
+	}
+	return rrs
+}
+
+// HandleCatalog answers queries for the catalog zone, from the clients
+// allowed to transfer zones - it is meant for secondaries, not resolvers
+func (res *Resolver) HandleCatalog(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+
+	if !res.transferAllowed(w, r) {
+		logging.CurLog.TransfersRefused += 1
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		res.reply(w, r, m)
+		return
+	}
+
+	soa := res.catalogSOA()
+	if q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR {
+		// the catalog is small, IXFR gets all of it unless up to date
+		rrs := []dns.RR{soa}
+		if s, ok := ixfrSOA(r); !ok || s.Serial != soa.Serial {
+			rrs = append(rrs, res.catalogRecords()...)
+			rrs = append(rrs, soa)
+		}
+		res.sendTransfer(w, r, rrs, soa)
+		return
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	// names with records exist, and so do the names above them
+	name := dns.CanonicalName(q.Name)
+	var exists bool
+	for _, rr := range append([]dns.RR{soa}, res.catalogRecords()...) {
+		if !dns.IsSubDomain(name, rr.Header().Name) {
+			continue
+		}
+		exists = true
+		if rr.Header().Name == name && (q.Qtype == rr.Header().Rrtype || q.Qtype == dns.TypeANY) {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+
+	if len(m.Answer) == 0 {
+		if !exists {
+			m.Rcode = dns.RcodeNameError
+		}
+		m.Ns = []dns.RR{soa}
+	}
+	res.reply(w, r, m)
+}
+
+// ixfrSOA returns the SOA an IXFR request r carries, the serial the
+// client has
+func ixfrSOA(r *dns.Msg) (*dns.SOA, bool) {
+	if r.Question[0].Qtype != dns.TypeIXFR || len(r.Ns) == 0 {
+		return nil, false
+	}
+	soa, ok := r.Ns[0].(*dns.SOA)
+	return soa, ok
+}
@@ -0,0 +1,112 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func catalogDNS() *Resolver {
+	return New(records.Config{
+		Domain:         "mesos",
+		TTL:            60,
+		Mname:          "ns1.mesos.",
+		Email:          "root.ns1.mesos.",
+		AXFRAllow:      []string{"127.0.0.0/8"},
+		CatalogZone:    "catalog.invalid",
+		CatalogMembers: []string{"east.example.com"},
+	})
+}
+
+func TestCatalogTransfer(t *testing.T) {
+	res := catalogDNS()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{Listener: l, Handler: dns.HandlerFunc(res.HandleCatalog)}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	m := new(dns.Msg)
+	m.SetAxfr("catalog.invalid.")
+	rrs, err := transferIn(t, m, l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := rrs[0].(*dns.SOA); !ok {
+		t.Fatal("transfer should start with the SOA", rrs)
+	}
+	if _, ok := rrs[len(rrs)-1].(*dns.SOA); !ok {
+		t.Fatal("transfer should end with the SOA", rrs)
+	}
+
+	members := make(map[string]string)
+	var version string
+	for _, rr := range rrs {
+		switch rr := rr.(type) {
+		case *dns.PTR:
+			members[rr.Ptr] = rr.Hdr.Name
+		case *dns.TXT:
+			if rr.Hdr.Name == "version.catalog.invalid." {
+				version = rr.Txt[0]
+			}
+		}
+	}
+	if version != "2" {
+		t.Errorf("expected catalog version 2, got %q", version)
+	}
+	for _, zone := range []string{"mesos.", "east.example.com."} {
+		if members[zone] != memberID(zone)+".zones.catalog.invalid." {
+			t.Errorf("expected %s in the catalog, got %v", zone, members)
+		}
+	}
+
+	// up to date, just the SOA
+	m.SetIxfr("catalog.invalid.", res.catalog.serial, "ns1.mesos.", "root.ns1.mesos.")
+	rrs, err = transferIn(t, m, l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 1 {
+		t.Error("expected just the SOA", rrs)
+	}
+}
+
+func TestHandleCatalog(t *testing.T) {
+	res := catalogDNS()
+
+	var tests = []struct {
+		name    string
+		qtype   uint16
+		rcode   int
+		answers int
+	}{
+		{"catalog.invalid.", dns.TypeSOA, dns.RcodeSuccess, 1},
+		{"Catalog.Invalid.", dns.TypeNS, dns.RcodeSuccess, 1},
+		{"version.catalog.invalid.", dns.TypeTXT, dns.RcodeSuccess, 1},
+		{memberID("mesos.") + ".zones.catalog.invalid.", dns.TypePTR, dns.RcodeSuccess, 1},
+		{"zones.catalog.invalid.", dns.TypePTR, dns.RcodeSuccess, 0},
+		{"missing.catalog.invalid.", dns.TypeA, dns.RcodeNameError, 0},
+	}
+
+	for _, tt := range tests {
+		w := &fakeWriter{}
+		res.HandleCatalog(w, new(dns.Msg).SetQuestion(tt.name, tt.qtype))
+		if w.msg.Rcode != tt.rcode || len(w.msg.Answer) != tt.answers {
+			t.Errorf("%s %s: expected %s with %d answers, got %s with %d", tt.name, dns.TypeToString[tt.qtype],
+				dns.RcodeToString[tt.rcode], tt.answers, dns.RcodeToString[w.msg.Rcode], len(w.msg.Answer))
+		}
+	}
+
+	// only secondaries may read the catalog
+	w := &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}}
+	res.HandleCatalog(w, new(dns.Msg).SetQuestion("catalog.invalid.", dns.TypeSOA))
+	if w.msg.Rcode != dns.RcodeRefused {
+		t.Errorf("expected REFUSED for other clients, got %s", dns.RcodeToString[w.msg.Rcode])
+	}
+}
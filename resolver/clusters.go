@@ -0,0 +1,55 @@
+package resolver
+
+import (
+	"sync"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+// clusters keeps the last records of each of the other clusters, so a
+// cluster whose masters can't be reached keeps serving them
+type clusters struct {
+	sync.Mutex
+	last map[string]records.RecordGenerator
+}
+
+// clusterConfig is config for generating the records of cluster cl
+func clusterConfig(config records.Config, cl records.Cluster) records.Config {
+	config.Masters = cl.Masters
+	config.Domain = cl.Name + "." + config.Domain
+	config.Clusters = nil
+	return config
+}
+
+// loadClusters generates the records of every configured cluster, all
+// at once, falling back to the last records of clusters that fail
+func (res *Resolver) loadClusters(config records.Config) map[string]records.RecordGenerator {
+	fresh := make([]records.RecordGenerator, len(config.Clusters))
+
+	var wg sync.WaitGroup
+	for i, cl := range config.Clusters {
+		wg.Add(1)
+		go func(i int, cl records.Cluster) {
+			defer wg.Done()
+			fresh[i].ParseState(clusterConfig(config, cl))
+		}(i, cl)
+	}
+	wg.Wait()
+
+	res.clusters.Lock()
+	defer res.clusters.Unlock()
+
+	last := make(map[string]records.RecordGenerator, len(config.Clusters))
+	for i, cl := range config.Clusters {
+		if fresh[i].As != nil {
+			last[cl.Name] = fresh[i]
+		} else if prev, ok := res.clusters.last[cl.Name]; ok {
+			logging.Error.Println("cluster " + cl.Name + " unavailable, serving its last records")
+			last[cl.Name] = prev
+		}
+	}
+
+	res.clusters.last = last
+	return last
+}
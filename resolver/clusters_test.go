@@ -0,0 +1,70 @@
+package resolver
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+// fakeMaster serves a state.json with one task of framework marathon
+func fakeMaster(t *testing.T, task string) *httptest.Server {
+	var port string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"leader": "master@127.0.0.1:` + port + `",
+			"slaves": [{"id": "s1", "hostname": "10.0.0.1"}],
+			"frameworks": [{"name": "marathon", "tasks": [
+				{"id": "` + task + `.1", "name": "` + task + `", "slave_id": "s1", "state": "TASK_RUNNING"}
+			]}]
+		}`))
+	}))
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func TestClusters(t *testing.T) {
+	east := fakeMaster(t, "web")
+	west := fakeMaster(t, "db")
+	defer west.Close()
+
+	res := &Resolver{}
+	res.Config = records.Config{
+		Domain:         "mesos",
+		Listener:       "127.0.0.1",
+		Mname:          "mesos-dns.mesos.",
+		InactiveAgents: "drop",
+		Clusters: []records.Cluster{
+			{Name: "east", Masters: []string{east.Listener.Addr().String()}},
+			{Name: "west", Masters: []string{west.Listener.Addr().String()}},
+		},
+	}
+
+	res.Reload()
+	for name, host := range map[string]string{
+		"web.marathon.east.mesos.": "10.0.0.1",
+		"db.marathon.west.mesos.":  "10.0.0.1",
+		"leader.east.mesos.":       "127.0.0.1",
+	} {
+		if !reflect.DeepEqual(res.rs.As[name], []string{host}) {
+			t.Errorf("expected %s at %s, got %v", name, host, res.rs.As[name])
+		}
+	}
+	if _, ok := res.rs.As["web.marathon.mesos."]; ok {
+		t.Error("cluster records should stay in their subdomain")
+	}
+
+	// east goes away, its last records stay
+	east.Close()
+	res.Reload()
+	if _, ok := res.rs.As["web.marathon.east.mesos."]; !ok {
+		t.Error("should keep the records of an unavailable cluster")
+	}
+}
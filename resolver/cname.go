@@ -0,0 +1,50 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain is how many CNAMEs we follow for an answer
+const maxCNAMEChain = 8
+
+// formatCNAME returns the CNAME resource record for target
+func (res *Resolver) formatCNAME(name string, target string) *dns.CNAME {
+	return &dns.CNAME{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeCNAME,
+			Class:  dns.ClassINET,
+			Ttl:    res.ttl(&res.rs, name),
+		},
+		Target: target,
+	}
+}
+
+// cnameChain follows the CNAMEs and DNAMEs of name within the zone and
+// returns them along with the name they lead to, which has no CNAME or is
+// outside the zone
+// it must be called with the records locked
+func (res *Resolver) cnameChain(name string) ([]dns.RR, string) {
+	var chain []dns.RR
+	seen := map[string]bool{name: true}
+
+	for len(chain) < maxCNAMEChain {
+		if targets, ok := res.rs.CNAMEs[name]; ok {
+			chain = append(chain, res.formatCNAME(name, targets[0]))
+			name = targets[0]
+		} else if rrs := res.dnameSubstitute(name); rrs != nil {
+			chain = append(chain, rrs...)
+			name = rrs[1].(*dns.CNAME).Target
+		} else {
+			break
+		}
+
+		// loops end at the first repeated name
+		if seen[name] || !dns.IsSubDomain(res.zone(), name) {
+			break
+		}
+		seen[name] = true
+	}
+
+	return chain, name
+}
@@ -0,0 +1,64 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCNAMEChain(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.rs.Insert("db.mesos.", "chronos.marathon-0.6.0.mesos.", "CNAME")
+	res.rs.Insert("www.mesos.", "db.mesos.", "CNAME")
+	res.rs.Insert("ext.mesos.", "db.example.com.", "CNAME")
+	res.rs.Insert("loop1.mesos.", "loop2.mesos.", "CNAME")
+	res.rs.Insert("loop2.mesos.", "loop1.mesos.", "CNAME")
+
+	var tests = []struct {
+		name   string
+		qtype  uint16
+		cnames int
+		others int
+	}{
+		{"www.mesos.", dns.TypeA, 2, 1},
+		{"WWW.mesos.", dns.TypeA, 2, 1},
+		{"db.mesos.", dns.TypeA, 1, 1},
+		{"www.mesos.", dns.TypeCNAME, 1, 0},
+		{"ext.mesos.", dns.TypeA, 1, 0},
+		{"loop1.mesos.", dns.TypeA, 2, 0},
+	}
+
+	for _, tt := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(tt.name, tt.qtype)
+		w := &fakeWriter{}
+		res.HandleMesos(w, r)
+
+		if w.msg.Rcode != dns.RcodeSuccess {
+			t.Errorf("%s %s: expected NOERROR, got %s", tt.name, dns.TypeToString[tt.qtype], dns.RcodeToString[w.msg.Rcode])
+			continue
+		}
+
+		var cnames, others int
+		for i, rr := range w.msg.Answer {
+			if _, ok := rr.(*dns.CNAME); !ok {
+				others++
+				continue
+			}
+			if i != cnames {
+				t.Errorf("%s: CNAMEs should come first", tt.name)
+			}
+			cnames++
+		}
+		if cnames != tt.cnames || others != tt.others {
+			t.Errorf("%s %s: expected %d CNAMEs and %d others, got %v", tt.name, dns.TypeToString[tt.qtype], tt.cnames, tt.others, w.msg.Answer)
+		}
+		if len(w.msg.Answer) > 0 && w.msg.Answer[0].Header().Name != tt.name {
+			t.Errorf("%s: the answer should start at the question", tt.name)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+// debugState is what /debug/state reports about the running process
+type debugState struct {
+	Goroutines   int            `json:"goroutines"`
+	HeapBytes    uint64         `json:"heap_bytes"`
+	Serial       uint32         `json:"serial"`
+	Records      map[string]int `json:"records"`
+	Fetched      *time.Time     `json:"fetched,omitempty"`
+	Reloaded     *time.Time     `json:"reloaded,omitempty"`
+	ReloadMillis float64        `json:"reload_ms"`
+	Config       records.Config `json:"config"`
+}
+
+// unixNano returns the time of the unix nanoseconds in v, nil if they
+// were never set
+func unixNano(v *int64) *time.Time {
+	n := atomic.LoadInt64(v)
+	if n == 0 {
+		return nil
+	}
+	t := time.Unix(0, n).UTC()
+	return &t
+}
+
+// handleDebugState reports the goroutines, memory, record counts and
+// reloads of the process along with its configuration, to look into
+// problems in production
+func (res *Resolver) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	if !only("GET", w, r) {
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	count := func(set map[string][]string) int {
+		n := 0
+		for _, values := range set {
+			n += len(values)
+		}
+		return n
+	}
+
+	res.rsLock.RLock()
+	counts := map[string]int{
+		"a":     count(res.rs.As),
+		"srv":   count(res.rs.SRVs),
+		"txt":   count(res.rs.TXTs),
+		"cname": count(res.rs.CNAMEs),
+		"tlsa":  count(res.rs.TLSAs),
+		"sshfp": count(res.rs.SSHFPs),
+		"uri":   count(res.rs.URIs),
+	}
+	res.rsLock.RUnlock()
+
+	writeJSON(w, http.StatusOK, debugState{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapBytes:    mem.HeapAlloc,
+		Serial:       atomic.LoadUint32(&res.serial),
+		Records:      counts,
+		Fetched:      unixNano(&res.fetched),
+		Reloaded:     unixNano(&res.reloaded),
+		ReloadMillis: float64(atomic.LoadInt64(&res.reloadTook)) / float64(time.Millisecond),
+		Config:       res.redactedConfig(),
+	})
+}
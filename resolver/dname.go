@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+)
+
+// formatDNAME returns the DNAME resource record redirecting the names
+// below name to target
+func (res *Resolver) formatDNAME(name string, target string) *dns.DNAME {
+	return &dns.DNAME{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeDNAME,
+			Class:  dns.ClassINET,
+			Ttl:    res.ttl(&res.rs, name),
+		},
+		Target: target,
+	}
+}
+
+// dname returns the most specific of the DNAMEs whose subtree name is
+// below, "" if there is none
+func (res *Resolver) dname(name string) string {
+	owner := ""
+	for o := range res.config().DNAMEs {
+		if o != name && dns.IsSubDomain(o, name) && dns.CountLabel(o) > dns.CountLabel(owner) {
+			owner = o
+		}
+	}
+	return owner
+}
+
+// dnameSubstitute returns the DNAME that redirects name, along with the
+// CNAME synthesized from it (RFC 6672), nil if no DNAME applies
+func (res *Resolver) dnameSubstitute(name string) []dns.RR {
+	owner := res.dname(name)
+	if owner == "" {
+		return nil
+	}
+
+	target := res.config().DNAMEs[owner]
+	prefix := name[:len(name)-len(owner)]
+	if _, ok := dns.IsDomainName(prefix + target); !ok {
+		return nil
+	}
+
+	dname := res.formatDNAME(owner, target)
+	cname := res.formatCNAME(name, prefix+target)
+	cname.Hdr.Ttl = dname.Hdr.Ttl
+	return []dns.RR{dname, cname}
+}
@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDNAME(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Config.DNAMEs = map[string]string{
+		"old.mesos.":    "marathon-0.6.0.mesos.",
+		"legacy.mesos.": "example.com.",
+	}
+	res.names = newNameTree(&res.rs)
+	for name := range res.Config.DNAMEs {
+		res.names.insert(name)
+	}
+
+	var tests = []struct {
+		name  string
+		qtype uint16
+		rcode int
+		types []uint16
+	}{
+		{"chronos.old.mesos.", dns.TypeA, dns.RcodeSuccess, []uint16{dns.TypeDNAME, dns.TypeCNAME, dns.TypeA}},
+		{"Chronos.OLD.mesos.", dns.TypeA, dns.RcodeSuccess, []uint16{dns.TypeDNAME, dns.TypeCNAME, dns.TypeA}},
+		{"missing.old.mesos.", dns.TypeA, dns.RcodeSuccess, []uint16{dns.TypeDNAME, dns.TypeCNAME}},
+		{"db.legacy.mesos.", dns.TypeA, dns.RcodeSuccess, []uint16{dns.TypeDNAME, dns.TypeCNAME}},
+		{"old.mesos.", dns.TypeDNAME, dns.RcodeSuccess, []uint16{dns.TypeDNAME}},
+		{"old.mesos.", dns.TypeA, dns.RcodeSuccess, nil},
+	}
+
+	for _, tt := range tests {
+		w := &fakeWriter{}
+		res.HandleMesos(w, new(dns.Msg).SetQuestion(tt.name, tt.qtype))
+
+		if w.msg.Rcode != tt.rcode {
+			t.Errorf("%s %s: expected %s, got %s", tt.name, dns.TypeToString[tt.qtype], dns.RcodeToString[tt.rcode], dns.RcodeToString[w.msg.Rcode])
+			continue
+		}
+		var types []uint16
+		for _, rr := range w.msg.Answer {
+			types = append(types, rr.Header().Rrtype)
+		}
+		if len(types) != len(tt.types) {
+			t.Errorf("%s %s: expected %v, got %v", tt.name, dns.TypeToString[tt.qtype], tt.types, w.msg.Answer)
+			continue
+		}
+		for i := range types {
+			if types[i] != tt.types[i] {
+				t.Errorf("%s %s: expected %v, got %v", tt.name, dns.TypeToString[tt.qtype], tt.types, w.msg.Answer)
+				break
+			}
+		}
+	}
+
+	// the synthesized CNAME answers the question
+	w := &fakeWriter{}
+	res.HandleMesos(w, new(dns.Msg).SetQuestion("chronos.old.mesos.", dns.TypeA))
+	cname := w.msg.Answer[1].(*dns.CNAME)
+	if cname.Hdr.Name != "chronos.old.mesos." || cname.Target != "chronos.marathon-0.6.0.mesos." {
+		t.Errorf("unexpected synthesized cname %v", cname)
+	}
+	if dname := w.msg.Answer[0].(*dns.DNAME); dname.Hdr.Name != "old.mesos." || cname.Hdr.Ttl != dname.Hdr.Ttl {
+		t.Errorf("unexpected dname %v", dname)
+	}
+}
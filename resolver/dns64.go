@@ -0,0 +1,43 @@
+package resolver
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// dns64Prefix returns the NAT64 prefix of prefix, nil if it is empty or
+// invalid - Check rejects invalid ones
+func dns64Prefix(prefix string) *net.IPNet {
+	if prefix == "" {
+		return nil
+	}
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil || network.IP.To4() != nil {
+		return nil
+	}
+	return network
+}
+
+// synthesizeAAAA returns the AAAA record with the IPv4 address of a
+// embedded in prefix (RFC 6052, section 2.2), for IPv6-only clients to
+// reach it through NAT64
+func synthesizeAAAA(prefix *net.IPNet, a *dns.A) *dns.AAAA {
+	ones, _ := prefix.Mask.Size()
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.IP.To16())
+
+	// the address follows the prefix, skipping bits 64 to 71
+	j := ones / 8
+	for _, b := range a.A.To4() {
+		if j == 8 {
+			j++
+		}
+		ip[j] = b
+		j++
+	}
+
+	hdr := a.Hdr
+	hdr.Rrtype = dns.TypeAAAA
+	return &dns.AAAA{Hdr: hdr, AAAA: ip}
+}
@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSynthesizeAAAA(t *testing.T) {
+	// the examples of RFC 6052, section 2.4
+	var tests = []struct {
+		prefix, ip6 string
+	}{
+		{"2001:db8::/32", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::c000:221"},
+	}
+
+	a := &dns.A{Hdr: dns.RR_Header{Name: "web.mesos.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.ParseIP("192.0.2.33")}
+	for _, tt := range tests {
+		rr := synthesizeAAAA(dns64Prefix(tt.prefix), a)
+		if !rr.AAAA.Equal(net.ParseIP(tt.ip6)) || rr.Hdr.Rrtype != dns.TypeAAAA || rr.Hdr.Ttl != 60 {
+			t.Errorf("%s: expected %s, got %v", tt.prefix, tt.ip6, rr)
+		}
+	}
+}
+
+func TestDNS64(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.dns64 = dns64Prefix("64:ff9b::/96")
+
+	w := &fakeWriter{}
+	res.HandleMesos(w, new(dns.Msg).SetQuestion("chronos.marathon-0.6.0.mesos.", dns.TypeAAAA))
+	if len(w.msg.Answer) != 1 || w.msg.Answer[0].(*dns.AAAA).AAAA.String() != "64:ff9b::102:304" {
+		t.Errorf("expected 64:ff9b::102:304, got %v", w.msg.Answer)
+	}
+
+	// names without A records still don't exist
+	w = &fakeWriter{}
+	res.HandleMesos(w, new(dns.Msg).SetQuestion("missing.mesos.", dns.TypeAAAA))
+	if w.msg.Rcode != dns.RcodeNameError {
+		t.Errorf("expected NXDOMAIN, got %s", dns.RcodeToString[w.msg.Rcode])
+	}
+}
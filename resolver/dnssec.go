@@ -0,0 +1,322 @@
+package resolver
+
+import (
+	"crypto"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// sigValidity is how long the signatures we make stay valid, they are
+// made per response so this only has to outlive caches
+const sigValidity = 7 * 24 * time.Hour
+
+// signer holds the keys we sign the mesos domain with - the KSK signs the
+// DNSKEY set, the ZSK everything else
+// a nil *signer signs nothing
+type signer struct {
+	ksk     *dns.DNSKEY
+	kskPriv crypto.Signer
+	zsk     *dns.DNSKEY
+	zskPriv crypto.Signer
+}
+
+// newSigner loads the KSK and ZSK from the BIND style key files in
+// config, or generates a fresh pair if none are configured
+func newSigner(config records.Config) (*signer, error) {
+	s := &signer{}
+	zone := config.Domain + "."
+
+	var err error
+	if config.DNSSECKSK == "" && config.DNSSECZSK == "" {
+		if s.ksk, s.kskPriv, err = generateKey(zone, 257, config.TTL); err != nil {
+			return nil, err
+		}
+		if s.zsk, s.zskPriv, err = generateKey(zone, 256, config.TTL); err != nil {
+			return nil, err
+		}
+		logging.Verbose.Println("generated DNSSEC keys, DS for the parent zone: " +
+			s.ksk.ToDS(dns.SHA256).String())
+		return s, nil
+	}
+
+	if s.ksk, s.kskPriv, err = readKey(config.DNSSECKSK); err != nil {
+		return nil, err
+	}
+	if s.zsk, s.zskPriv, err = readKey(config.DNSSECZSK); err != nil {
+		return nil, err
+	}
+
+	for _, k := range []*dns.DNSKEY{s.ksk, s.zsk} {
+		if !strings.EqualFold(k.Hdr.Name, zone) {
+			return nil, errors.New("dnssec key for " + k.Hdr.Name + " does not match domain " + zone)
+		}
+		k.Hdr.Name = zone
+	}
+
+	return s, nil
+}
+
+// generateKey makes an ECDSA P-256 key for zone
+func generateKey(zone string, flags uint16, ttl int) (*dns.DNSKEY, crypto.Signer, error) {
+	k := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: uint32(ttl)},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+
+	priv, err := k.Generate(256)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return k, priv.(crypto.Signer), nil
+}
+
+// readKey reads the public and private halves of a key from the files
+// prefix.key and prefix.private, as written by dnssec-keygen
+func readKey(prefix string) (*dns.DNSKEY, crypto.Signer, error) {
+	pub, err := os.Open(prefix + ".key")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer pub.Close()
+
+	rr, err := dns.ReadRR(pub, prefix+".key")
+	if err != nil {
+		return nil, nil, err
+	}
+	k, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return nil, nil, errors.New(prefix + ".key does not hold a DNSKEY")
+	}
+
+	private, err := os.Open(prefix + ".private")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer private.Close()
+
+	priv, err := k.ReadPrivateKey(private, prefix+".private")
+	if err != nil {
+		return nil, nil, err
+	}
+	s, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New(prefix + ".private cannot sign")
+	}
+
+	return k, s, nil
+}
+
+// keys returns the DNSKEY set for the zone apex
+func (s *signer) keys() []dns.RR {
+	return []dns.RR{s.ksk, s.zsk}
+}
+
+// sign returns RRSIGs for every RRset in rrs
+func (s *signer) sign(rrs []dns.RR) []dns.RR {
+	type key struct {
+		name  string
+		rtype uint16
+	}
+
+	var order []key
+	sets := make(map[key][]dns.RR)
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			continue
+		}
+		k := key{strings.ToLower(rr.Header().Name), rr.Header().Rrtype}
+		if _, ok := sets[k]; !ok {
+			order = append(order, k)
+		}
+		sets[k] = append(sets[k], rr)
+	}
+
+	now := time.Now()
+
+	var sigs []dns.RR
+	for _, k := range order {
+		set := sets[k]
+
+		key, priv := s.zsk, s.zskPriv
+		if k.rtype == dns.TypeDNSKEY {
+			key, priv = s.ksk, s.kskPriv
+		}
+
+		sig := &dns.RRSIG{
+			Hdr:        dns.RR_Header{Name: set[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: set[0].Header().Ttl},
+			KeyTag:     key.KeyTag(),
+			SignerName: key.Hdr.Name,
+			Algorithm:  key.Algorithm,
+			Inception:  uint32(now.Add(-time.Hour).Unix()),
+			Expiration: uint32(now.Add(sigValidity).Unix()),
+		}
+		if err := sig.Sign(priv, set); err != nil {
+			logging.Error.Println(err)
+			continue
+		}
+		sigs = append(sigs, sig)
+	}
+
+	return sigs
+}
+
+// canonicalLess orders names as RFC 4034 section 6.1 does - label by
+// label from the right, case insensitive
+func canonicalLess(a, b string) bool {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if la[i] != lb[j] {
+			return la[i] < lb[j]
+		}
+	}
+
+	return len(la) < len(lb)
+}
+
+// nsecChain returns the names in the zone that own records, in canonical
+// order starting at the apex
+func nsecChain(rs *records.RecordGenerator, zone string) []string {
+	seen := map[string]bool{zone: true}
+	names := []string{zone}
+
+	for _, set := range []map[string][]string{rs.As, rs.SRVs, rs.TXTs, rs.CNAMEs, rs.TLSAs, rs.SSHFPs, rs.URIs} {
+		for name := range set {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+	return names
+}
+
+// nsec returns the NSEC record of the i-th name in the chain
+func (res *Resolver) nsec(i int) dns.RR {
+	config := res.config()
+	name := res.chain[i]
+	next := res.chain[(i+1)%len(res.chain)]
+
+	types := []uint16{dns.TypeRRSIG, dns.TypeNSEC}
+	if name == res.zone() {
+		types = append(types, dns.TypeNS, dns.TypeSOA, dns.TypeDNSKEY)
+	}
+	if _, ok := res.rs.As[name]; ok {
+		types = append(types, dns.TypeA)
+		if res.dns64 != nil {
+			// synthesized from the A records
+			types = append(types, dns.TypeAAAA)
+		}
+		if len(res.locRecords(&res.rs, name, name)) > 0 {
+			types = append(types, dns.TypeLOC)
+		}
+	}
+	if _, ok := res.rs.SRVs[name]; ok {
+		types = append(types, dns.TypeSRV)
+	}
+	// the apex has the zone metadata
+	if _, ok := res.rs.TXTs[name]; ok || (name == res.zone() && config.ZoneMetadata) {
+		types = append(types, dns.TypeTXT)
+	}
+	if _, ok := res.rs.CNAMEs[name]; ok {
+		types = append(types, dns.TypeCNAME)
+	}
+	if _, ok := res.rs.TLSAs[name]; ok {
+		types = append(types, dns.TypeTLSA)
+	}
+	if _, ok := res.rs.SSHFPs[name]; ok {
+		types = append(types, dns.TypeSSHFP)
+	}
+	if _, ok := res.rs.URIs[name]; ok {
+		types = append(types, dns.TypeURI)
+	}
+	if _, ok := config.DNAMEs[name]; ok {
+		types = append(types, dns.TypeDNAME)
+	}
+	if _, ok := config.CAA[name]; ok {
+		types = append(types, dns.TypeCAA)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	ttl := uint32(config.TTL)
+	if min := uint32(config.SOAMinttl); min < ttl {
+		ttl = min
+	}
+
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: ttl},
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+}
+
+// covering returns the index of the NSEC record that owns or covers name,
+// the last name in the chain at or before it
+func (res *Resolver) covering(name string) int {
+	i := sort.Search(len(res.chain), func(i int) bool { return canonicalLess(name, res.chain[i]) })
+	if i == 0 {
+		return len(res.chain) - 1
+	}
+	return i - 1
+}
+
+// denial returns the NSEC records proving the negative answer for dom -
+// the record for dom itself (NODATA) or the one covering it, plus the one
+// covering the wildcard at the closest encloser (NXDOMAIN)
+func (res *Resolver) denial(dom string, nxdomain bool) []dns.RR {
+	if len(res.chain) == 0 {
+		return nil
+	}
+
+	i := res.covering(dom)
+	rrs := []dns.RR{res.nsec(i)}
+	if !nxdomain {
+		return rrs
+	}
+
+	ce := dom
+	for ce != res.zone() && !res.exists(ce) {
+		labels := dns.SplitDomainName(ce)
+		if len(labels) <= 1 {
+			ce = res.zone()
+			break
+		}
+		ce = strings.Join(labels[1:], ".") + "."
+	}
+
+	if j := res.covering("*." + ce); j != i {
+		rrs = append(rrs, res.nsec(j))
+	}
+	return rrs
+}
+
+// dnssec adds the DNSSEC records to m, our answer for dom, if we sign
+// the zone and the client asked for them with the DO bit
+func (res *Resolver) dnssec(m *dns.Msg, r *dns.Msg, dom string) {
+	if res.signer == nil {
+		return
+	}
+	if opt := r.IsEdns0(); opt == nil || !opt.Do() {
+		return
+	}
+
+	if len(m.Answer) == 0 && (m.Rcode == dns.RcodeSuccess || m.Rcode == dns.RcodeNameError) {
+		m.Ns = append(m.Ns, res.denial(dom, m.Rcode == dns.RcodeNameError)...)
+	}
+
+	m.Answer = append(m.Answer, res.signer.sign(m.Answer)...)
+	m.Ns = append(m.Ns, res.signer.sign(m.Ns)...)
+}
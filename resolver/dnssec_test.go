@@ -0,0 +1,188 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCanonicalLess(t *testing.T) {
+	// RFC 4034 section 6.1
+	ordered := []string{
+		"example.",
+		"a.example.",
+		"yljkjljk.a.example.",
+		"Z.a.example.",
+		"zABC.a.EXAMPLE.",
+		"z.example.",
+		"*.z.example.",
+		"\\200.z.example.",
+	}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		if !canonicalLess(ordered[i], ordered[i+1]) || canonicalLess(ordered[i+1], ordered[i]) {
+			t.Errorf("expected %s before %s", ordered[i], ordered[i+1])
+		}
+	}
+}
+
+func signedDNS(t *testing.T) *Resolver {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Config.DNSSEC = true
+	res.signer, err = newSigner(res.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.chain = nsecChain(&res.rs, res.zone())
+
+	return res
+}
+
+func signedQuery(res *Resolver, name string, qtype uint16) *dns.Msg {
+	r := new(dns.Msg)
+	r.SetQuestion(name, qtype)
+	r.SetEdns0(4096, true)
+
+	w := &fakeWriter{}
+	res.HandleMesos(w, r)
+	return w.msg
+}
+
+// verify checks that every RRset in rrs has a valid signature by key
+func verify(t *testing.T, rrs []dns.RR, key *dns.DNSKEY) {
+	type rrset struct {
+		name  string
+		rtype uint16
+	}
+
+	sets := make(map[rrset][]dns.RR)
+	sigs := make(map[rrset]*dns.RRSIG)
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs[rrset{sig.Hdr.Name, sig.TypeCovered}] = sig
+		} else {
+			k := rrset{rr.Header().Name, rr.Header().Rrtype}
+			sets[k] = append(sets[k], rr)
+		}
+	}
+
+	for k, set := range sets {
+		sig, ok := sigs[k]
+		if !ok {
+			t.Errorf("%s %s: not signed", k.name, dns.TypeToString[k.rtype])
+			continue
+		}
+		if err := sig.Verify(key, set); err != nil {
+			t.Errorf("%s %s: %v", k.name, dns.TypeToString[k.rtype], err)
+		}
+	}
+}
+
+func TestDNSSECAnswers(t *testing.T) {
+	res := signedDNS(t)
+
+	m := signedQuery(res, "chronos.marathon-0.6.0.mesos.", dns.TypeA)
+	if len(m.Answer) < 2 {
+		t.Fatal("expected a signed answer")
+	}
+	verify(t, m.Answer, res.signer.zsk)
+
+	m = signedQuery(res, "mesos.", dns.TypeDNSKEY)
+	if len(m.Answer) != 3 {
+		t.Fatal("expected both keys and a signature")
+	}
+	verify(t, m.Answer, res.signer.ksk)
+
+	// no DO bit, no DNSSEC records
+	r := new(dns.Msg)
+	r.SetQuestion("chronos.marathon-0.6.0.mesos.", dns.TypeA)
+	w := &fakeWriter{}
+	res.HandleMesos(w, r)
+	for _, rr := range w.msg.Answer {
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			t.Error("should not sign for clients without DO")
+		}
+	}
+}
+
+func TestDNSSECDenial(t *testing.T) {
+	res := signedDNS(t)
+
+	var tests = []struct {
+		name  string
+		qtype uint16
+		rcode int
+		nsecs int
+	}{
+		{"chronos.marathon-0.6.0.mesos.", dns.TypeMX, dns.RcodeSuccess, 1},
+		{"marathon-0.6.0.mesos.", dns.TypeA, dns.RcodeSuccess, 1},
+		{"missing.mesos.", dns.TypeA, dns.RcodeNameError, 2},
+	}
+
+	for _, tt := range tests {
+		m := signedQuery(res, tt.name, tt.qtype)
+		if m.Rcode != tt.rcode {
+			t.Errorf("%s: expected rcode %d, got %d", tt.name, tt.rcode, m.Rcode)
+			continue
+		}
+
+		var nsecs []*dns.NSEC
+		for _, rr := range m.Ns {
+			if nsec, ok := rr.(*dns.NSEC); ok {
+				nsecs = append(nsecs, nsec)
+			}
+		}
+		if len(nsecs) != tt.nsecs {
+			t.Errorf("%s: expected %d NSEC records, got %d", tt.name, tt.nsecs, len(nsecs))
+			continue
+		}
+
+		nsec := nsecs[0]
+		if nsec.Hdr.Name == tt.name {
+			for _, rtype := range nsec.TypeBitMap {
+				if rtype == tt.qtype {
+					t.Errorf("%s: NSEC claims the type exists", tt.name)
+				}
+			}
+		} else if !canonicalLess(nsec.Hdr.Name, tt.name) ||
+			(nsec.NextDomain != res.zone() && !canonicalLess(tt.name, nsec.NextDomain)) {
+			t.Errorf("%s: %s does not cover the name", tt.name, nsec)
+		}
+
+		verify(t, m.Ns, res.signer.zsk)
+	}
+}
+
+// nsecTypes returns the types the NSEC record of name lists
+func nsecTypes(res *Resolver, name string) map[uint16]bool {
+	types := make(map[uint16]bool)
+	for _, rtype := range res.nsec(res.covering(name)).(*dns.NSEC).TypeBitMap {
+		types[rtype] = true
+	}
+	return types
+}
+
+func TestNSECTypes(t *testing.T) {
+	res := signedDNS(t)
+	if nsecTypes(res, res.zone())[dns.TypeTXT] {
+		t.Error("expected no TXT at the apex without zone metadata")
+	}
+
+	res.Config.ZoneMetadata = true
+	if types := nsecTypes(res, res.zone()); !types[dns.TypeTXT] || !types[dns.TypeSOA] {
+		t.Errorf("expected TXT at the apex with zone metadata, got %v", types)
+	}
+
+	name := "chronos.marathon-0.6.0.mesos."
+	if types := nsecTypes(res, name); !types[dns.TypeA] || types[dns.TypeAAAA] {
+		t.Errorf("expected A but no AAAA without dns64, got %v", types)
+	}
+	res.dns64 = dns64Prefix("64:ff9b::/96")
+	if types := nsecTypes(res, name); !types[dns.TypeAAAA] {
+		t.Errorf("expected the synthesized AAAA with dns64, got %v", types)
+	}
+}
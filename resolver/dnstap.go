@@ -0,0 +1,306 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// dnstapContentType is what the frame streams carry
+const dnstapContentType = "protobuf:dnstap.Dnstap"
+
+// dnstapBuffer is how many messages wait to be written before new ones
+// are dropped, so a slow collector never holds up the answers
+const dnstapBuffer = 1024
+
+// frame streams control frames and their content type field
+const (
+	fstrmAccept      = 1
+	fstrmStart       = 2
+	fstrmStop        = 3
+	fstrmReady       = 4
+	fstrmFinish      = 5
+	fstrmContentType = 1
+)
+
+// dnstap message types
+const (
+	dnstapAuthQuery      = 1
+	dnstapAuthResponse   = 2
+	dnstapClientQuery    = 5
+	dnstapClientResponse = 6
+)
+
+// dnstap holds the encoded messages until RunDnstap writes them
+type dnstap struct {
+	frames   chan []byte
+	identity string
+}
+
+func newDnstap() *dnstap {
+	identity, _ := os.Hostname()
+	return &dnstap{
+		frames:   make(chan []byte, dnstapBuffer),
+		identity: identity,
+	}
+}
+
+// send queues a message, or drops it if the queue is full
+func (d *dnstap) send(frame []byte) {
+	select {
+	case d.frames <- frame:
+	default:
+		logging.CurLog.DnstapDropped += 1
+	}
+}
+
+// frame encodes the dnstap message of type mtype for m, exchanged by
+// mesos-dns version with the client behind w, which asked at qt and, for
+// responses, was answered at rt
+func (d *dnstap) frame(mtype int, version string, w dns.ResponseWriter, m *dns.Msg, qt, rt time.Time) []byte {
+	wire, err := m.Pack()
+	if err != nil {
+		return nil
+	}
+
+	var b []byte
+	b = pbVarint(b, 1, uint64(mtype))
+
+	family, protocol := 1, 1
+	client, clientPort := addrParts(w.RemoteAddr())
+	local, localPort := addrParts(w.LocalAddr())
+	if client.To4() == nil {
+		family = 2
+	} else {
+		client, local = client.To4(), local.To4()
+	}
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		protocol = 2
+	}
+	b = pbVarint(b, 2, uint64(family))
+	b = pbVarint(b, 3, uint64(protocol))
+	b = pbBytes(b, 4, client)
+	b = pbBytes(b, 5, local)
+	b = pbVarint(b, 6, uint64(clientPort))
+	b = pbVarint(b, 7, uint64(localPort))
+	b = pbVarint(b, 8, uint64(qt.Unix()))
+	b = pbFixed32(b, 9, uint32(qt.Nanosecond()))
+
+	if rt.IsZero() {
+		b = pbBytes(b, 10, wire)
+	} else {
+		b = pbVarint(b, 12, uint64(rt.Unix()))
+		b = pbFixed32(b, 13, uint32(rt.Nanosecond()))
+		b = pbBytes(b, 14, wire)
+	}
+
+	var f []byte
+	f = pbBytes(f, 1, []byte(d.identity))
+	f = pbBytes(f, 2, []byte("mesos-dns "+version))
+	f = pbBytes(f, 14, b)
+	// type MESSAGE
+	return pbVarint(f, 15, 1)
+}
+
+// addrParts returns the IP and port of a UDP or TCP address
+func addrParts(addr net.Addr) (net.IP, int) {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP, addr.Port
+	case *net.TCPAddr:
+		return addr.IP, addr.Port
+	}
+	return nil, 0
+}
+
+// pbVarint appends a varint field to a protobuf message
+func pbVarint(b []byte, field int, v uint64) []byte {
+	b = pbUvarint(b, uint64(field)<<3)
+	return pbUvarint(b, v)
+}
+
+// pbFixed32 appends a fixed32 field to a protobuf message
+func pbFixed32(b []byte, field int, v uint32) []byte {
+	b = pbUvarint(b, uint64(field)<<3|5)
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// pbBytes appends a length delimited field to a protobuf message
+func pbBytes(b []byte, field int, v []byte) []byte {
+	b = pbUvarint(b, uint64(field)<<3|2)
+	b = pbUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func pbUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// dnstapWriter sends the response written to dnstap
+type dnstapWriter struct {
+	dns.ResponseWriter
+	d       *dnstap
+	mtype   int
+	version string
+	start   time.Time
+}
+
+func (w *dnstapWriter) WriteMsg(m *dns.Msg) error {
+	if f := w.d.frame(w.mtype, w.version, w.ResponseWriter, m, w.start, time.Now()); f != nil {
+		w.d.send(f)
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// Write sends the packed responses, e.g. from the answer cache, to
+// dnstap too
+func (w *dnstapWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if m.Unpack(b) == nil {
+		if f := w.d.frame(w.mtype, w.version, w.ResponseWriter, m, w.start, time.Now()); f != nil {
+			w.d.send(f)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// dnstapped sends the queries h answers and its responses to dnstap, as
+// authoritative messages for the mesos domain and as client messages
+// for the names we forward
+func (res *Resolver) dnstapped(h dns.Handler) dns.Handler {
+	if res.dnstap == nil {
+		return h
+	}
+
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		query, response := dnstapClientQuery, dnstapClientResponse
+		if len(r.Question) > 0 && dns.IsSubDomain(res.config().Domain+".", dns.Fqdn(r.Question[0].Name)) {
+			query, response = dnstapAuthQuery, dnstapAuthResponse
+		}
+
+		start := time.Now()
+		if f := res.dnstap.frame(query, res.Version, w, r, start, time.Time{}); f != nil {
+			res.dnstap.send(f)
+		}
+		h.ServeDNS(&dnstapWriter{ResponseWriter: w, d: res.dnstap, mtype: response, version: res.Version, start: start}, r)
+	})
+}
+
+// RunDnstap writes the dnstap messages as a frame stream to the Dnstap
+// unix socket or file until ctx is done
+func (res *Resolver) RunDnstap(ctx context.Context) error {
+	target := res.config().Dnstap
+	socket := strings.HasPrefix(target, "unix:")
+
+	var conn io.ReadWriteCloser
+	var err error
+	if socket {
+		conn, err = net.DialTimeout("unix", strings.TrimPrefix(target, "unix:"), 5*time.Second)
+	} else {
+		conn, err = os.Create(target)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// a socket is a bidirectional stream, which starts with a handshake
+	if socket {
+		if err := writeControl(conn, fstrmReady, true); err != nil {
+			return err
+		}
+		if err := readControl(conn, fstrmAccept); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(conn)
+	if err := writeControl(bw, fstrmStart, true); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := writeControl(bw, fstrmStop, false); err != nil {
+				return err
+			}
+			if err := bw.Flush(); err != nil || !socket {
+				return err
+			}
+			return readControl(conn, fstrmFinish)
+		case f := <-res.dnstap.frames:
+			if err := writeFrame(bw, f); err != nil {
+				return err
+			}
+		}
+
+		if len(res.dnstap.frames) == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeFrame writes a data frame
+func writeFrame(w io.Writer, f []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(f))); err != nil {
+		return err
+	}
+	_, err := w.Write(f)
+	return err
+}
+
+// writeControl writes a control frame of type ctype, with the dnstap
+// content type if typed
+func writeControl(w io.Writer, ctype uint32, typed bool) error {
+	body := make([]byte, 4, 12+len(dnstapContentType))
+	binary.BigEndian.PutUint32(body, ctype)
+	if typed {
+		var field [8]byte
+		binary.BigEndian.PutUint32(field[:4], fstrmContentType)
+		binary.BigEndian.PutUint32(field[4:], uint32(len(dnstapContentType)))
+		body = append(append(body, field[:]...), dnstapContentType...)
+	}
+
+	// a zero length escapes control frames from data frames
+	if err := binary.Write(w, binary.BigEndian, [2]uint32{0, uint32(len(body))}); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// readControl reads a control frame and checks that it is of type ctype
+func readControl(r io.Reader, ctype uint32) error {
+	var head [2]uint32
+	if err := binary.Read(r, binary.BigEndian, &head); err != nil {
+		return err
+	}
+	if head[0] != 0 || head[1] < 4 || head[1] > 512 {
+		return errors.New("dnstap: expected a control frame")
+	}
+
+	body := make([]byte, head[1])
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(body) != ctype {
+		return errors.New("dnstap: unexpected control frame")
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// pbFields decodes the varint and length delimited fields of a protobuf
+// message, enough to check the dnstap messages
+func pbFields(t *testing.T, b []byte) map[int][]byte {
+	fields := make(map[int][]byte)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			fields[field] = pbUvarint(nil, v)
+			b = b[n:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			fields[field] = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case 5:
+			fields[field] = b[:4]
+			b = b[4:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func pbInt(b []byte) int {
+	v, _ := binary.Uvarint(b)
+	return int(v)
+}
+
+func TestDnstapFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnstap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.fstrm")
+
+	res := New(records.Config{Domain: "mesos", Dnstap: path})
+	res.Version = "test"
+	h := res.dnstapped(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		// mesos answers are packed, like the ones from the answer cache
+		if r.Question[0].Name == "web.marathon.mesos." {
+			wire, _ := m.Pack()
+			w.Write(wire)
+			return
+		}
+		w.WriteMsg(m)
+	}))
+	h.ServeDNS(&fakeWriter{}, new(dns.Msg).SetQuestion("web.marathon.mesos.", dns.TypeA))
+	h.ServeDNS(&fakeWriter{remote: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4000}}, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- res.RunDnstap(ctx) }()
+	for len(res.dnstap.frames) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	if err := readControl(r, fstrmStart); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		mtype    int
+		family   int
+		protocol int
+		port     int
+		name     string
+	}{
+		{dnstapAuthQuery, 1, 1, 12345, "web.marathon.mesos."},
+		{dnstapAuthResponse, 1, 1, 12345, "web.marathon.mesos."},
+		{dnstapClientQuery, 2, 2, 4000, "example.com."},
+		{dnstapClientResponse, 2, 2, 4000, "example.com."},
+	}
+	for _, tt := range tests {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			t.Fatal(err)
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			t.Fatal(err)
+		}
+
+		top := pbFields(t, frame)
+		if string(top[2]) != "mesos-dns test" || pbInt(top[15]) != 1 {
+			t.Errorf("unexpected dnstap frame %v", top)
+		}
+		msg := pbFields(t, top[14])
+		if pbInt(msg[1]) != tt.mtype || pbInt(msg[2]) != tt.family || pbInt(msg[3]) != tt.protocol || pbInt(msg[6]) != tt.port {
+			t.Errorf("%s: unexpected message %v", tt.name, msg)
+		}
+
+		wire := msg[10]
+		if tt.mtype == dnstapAuthResponse || tt.mtype == dnstapClientResponse {
+			wire = msg[14]
+		}
+		m := new(dns.Msg)
+		if err := m.Unpack(wire); err != nil || m.Question[0].Name != tt.name {
+			t.Errorf("%s: unexpected dns message %v %v", tt.name, m, err)
+		}
+	}
+
+	if err := readControl(r, fstrmStop); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDnstapSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnstap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// a collector that completes the handshake and counts the frames
+	frames := make(chan int)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		n := 0
+		if readControl(conn, fstrmReady) != nil || writeControl(conn, fstrmAccept, true) != nil ||
+			readControl(conn, fstrmStart) != nil {
+			frames <- -1
+			return
+		}
+		for {
+			var size uint32
+			if binary.Read(conn, binary.BigEndian, &size) != nil {
+				break
+			}
+			if size == 0 {
+				// the STOP control frame
+				var body [2]uint32
+				binary.Read(conn, binary.BigEndian, &body)
+				writeControl(conn, fstrmFinish, false)
+				break
+			}
+			io.CopyN(ioutil.Discard, conn, int64(size))
+			n++
+		}
+		frames <- n
+	}()
+
+	res := New(records.Config{Domain: "mesos", Dnstap: "unix:" + path})
+	h := res.dnstapped(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(new(dns.Msg).SetReply(r))
+	}))
+	h.ServeDNS(&fakeWriter{}, new(dns.Msg).SetQuestion("web.marathon.mesos.", dns.TypeA))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- res.RunDnstap(ctx) }()
+	for len(res.dnstap.frames) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := <-frames; n != 2 {
+		t.Errorf("expected the collector to get 2 frames, got %d", n)
+	}
+}
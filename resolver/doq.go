@@ -0,0 +1,218 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/quic"
+)
+
+// DNS over QUIC error codes (RFC 9250, section 4.3)
+const (
+	doqNoError       = 0x0
+	doqInternalError = 0x1
+	doqProtocolError = 0x2
+)
+
+// doqTimeout is how long a client has to send its query on a stream
+const doqTimeout = 10 * time.Second
+
+// ServeDoQ answers DNS over QUIC (RFC 9250) on Listener:DoQPort until ctx
+// is done
+func (res *Resolver) ServeDoQ(ctx context.Context) error {
+	config := res.config()
+	cert, err := tls.LoadX509KeyPair(config.DoQCert, config.DoQKey)
+	if err != nil {
+		return errors.New("failed to load the doq certificate: " + err.Error())
+	}
+
+	var l *quic.Endpoint
+	if f := res.sockets["doq"]; f != nil {
+		var pc net.PacketConn
+		if pc, err = net.FilePacketConn(f); err == nil {
+			l, err = quic.NewEndpoint(pc, doqConfig(cert))
+		}
+	} else {
+		addr := net.JoinHostPort(config.Listener, strconv.Itoa(config.DoQPort))
+		l, err = quic.Listen("udp", addr, doqConfig(cert))
+	}
+	if err != nil {
+		return errors.New("failed to setup doq server: " + err.Error())
+	}
+	return res.serveDoQ(ctx, l)
+}
+
+// doqConfig returns the QUIC configuration of a DoQ server with cert
+func doqConfig(cert tls.Certificate) *quic.Config {
+	return &quic.Config{TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"doq"},
+		MinVersion:   tls.VersionTLS13,
+	}}
+}
+
+// serveDoQ accepts DNS over QUIC connections on l until ctx is done
+func (res *Resolver) serveDoQ(ctx context.Context, l *quic.Endpoint) error {
+	res.listening.set("doq", true)
+	defer res.listening.set("doq", false)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		closing, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		l.Close(closing)
+	}()
+
+	h := res.handler()
+	for {
+		conn, err := l.Accept(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return errors.New("not serving doq any more: " + err.Error())
+		}
+		go res.serveDoQConn(ctx, conn, h)
+	}
+}
+
+// serveDoQConn answers the queries on conn, one per stream, until the
+// client closes it
+func (res *Resolver) serveDoQConn(ctx context.Context, conn *quic.Conn, h dns.Handler) {
+	defer conn.Abort(&quic.ApplicationError{Code: doqNoError})
+
+	for {
+		s, err := conn.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		go res.serveDoQStream(conn, s, h)
+	}
+}
+
+// serveDoQStream reads the query on s, which the client sends with a
+// two byte length prefix and then closes, and answers it on s
+func (res *Resolver) serveDoQStream(conn *quic.Conn, s *quic.Stream, h dns.Handler) {
+	config := res.config()
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), doqTimeout)
+	defer cancel()
+	s.SetReadContext(ctx)
+	s.SetWriteContext(ctx)
+
+	var length uint16
+	if err := binary.Read(s, binary.BigEndian, &length); err != nil {
+		s.Reset(doqProtocolError)
+		return
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(s, b); err != nil {
+		s.Reset(doqProtocolError)
+		return
+	}
+
+	r := new(dns.Msg)
+	// the id is 0, the stream tells queries apart (RFC 9250, 4.2.1)
+	if err := r.Unpack(b); err != nil || r.Id != 0 || len(r.Question) != 1 {
+		conn.Abort(&quic.ApplicationError{Code: doqProtocolError, Reason: "invalid query"})
+		return
+	}
+
+	w := &doqWriter{conn: conn, s: s, r: r, raw: b, secrets: config.TSIGKeys}
+	if t := r.IsTsig(); t != nil {
+		w.tsigErr = errors.New("unknown tsig key")
+		if secret, ok := config.TSIGKeys[t.Hdr.Name]; ok {
+			w.tsigErr = dns.TsigVerify(b, secret, "", false)
+		}
+	}
+	h.ServeDNS(w, r)
+
+	// dropped, by a rate limit or an ACL
+	if !w.written {
+		s.Reset(doqInternalError)
+	}
+}
+
+// doqWriter writes responses to a DNS over QUIC stream
+type doqWriter struct {
+	conn    *quic.Conn
+	s       *quic.Stream
+	r       *dns.Msg
+	raw     []byte
+	secrets map[string]string
+	tsigErr error
+	written bool
+}
+
+// LocalAddr is a TCP address, DoQ streams carry responses of any size
+// like TCP does
+func (w *doqWriter) LocalAddr() net.Addr {
+	return net.TCPAddrFromAddrPort(w.conn.LocalAddr())
+}
+
+// RemoteAddr is a TCP address, so responses aren't truncated
+func (w *doqWriter) RemoteAddr() net.Addr {
+	return net.TCPAddrFromAddrPort(w.conn.RemoteAddr())
+}
+
+func (w *doqWriter) WriteMsg(m *dns.Msg) error {
+	var b []byte
+	var err error
+	if t := m.IsTsig(); t != nil {
+		var mac string
+		if q := w.r.IsTsig(); q != nil {
+			mac = q.MAC
+		}
+		b, _, err = dns.TsigGenerate(m, w.secrets[t.Hdr.Name], mac, false)
+	} else {
+		b, err = m.Pack()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// Write sends b with its length prefix, more than one message can be
+// written for zone transfers
+func (w *doqWriter) Write(b []byte) (int, error) {
+	if len(b) > dns.MaxMsgSize {
+		return 0, errors.New("response too large")
+	}
+
+	w.written = true
+	out := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(out, uint16(len(b)))
+	copy(out[2:], b)
+	if _, err := w.s.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), w.s.Flush()
+}
+
+func (w *doqWriter) Close() error {
+	return w.s.Close()
+}
+
+func (w *doqWriter) TsigStatus() error {
+	return w.tsigErr
+}
+
+func (w *doqWriter) TsigTimersOnly(bool) {}
+
+func (w *doqWriter) Hijack() {}
@@ -0,0 +1,137 @@
+package resolver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/quic"
+)
+
+// testCert returns a self-signed certificate for localhost
+func testCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// doqExchange sends m over a new stream of conn and reads the response
+func doqExchange(ctx context.Context, conn *quic.Conn, m *dns.Msg) (*dns.Msg, error) {
+	s, err := conn.NewStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	s.SetReadContext(ctx)
+	s.SetWriteContext(ctx)
+
+	b, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	binary.Write(s, binary.BigEndian, uint16(len(b)))
+	s.Write(b)
+	s.CloseWrite()
+
+	var length uint16
+	if err := binary.Read(s, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	b = make([]byte, length)
+	if _, err := io.ReadFull(s, b); err != nil {
+		return nil, err
+	}
+
+	in := new(dns.Msg)
+	return in, in.Unpack(b)
+}
+
+func TestDoQ(t *testing.T) {
+	res, err := fakeDNS(8059)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc("mesos.", res.HandleMesos)
+	dns.DefaultServeMux, mux = mux, dns.DefaultServeMux
+	defer func() { dns.DefaultServeMux = mux }()
+
+	l, err := quic.Listen("udp", "127.0.0.1:0", doqConfig(testCert(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- res.serveDoQ(ctx, l) }()
+
+	client, err := quic.Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	conn, err := client.Dial(ctx, "udp", l.LocalAddr().String(), &quic.Config{
+		TLSConfig: &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"doq"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Abort(nil)
+
+	// every query on its own stream, with the id 0
+	for _, name := range []string{"chronos.marathon-0.6.0.mesos.", "missing.mesos."} {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		m.Id = 0
+
+		in, err := doqExchange(ctx, conn, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.Id != 0 || in.Question[0].Name != name {
+			t.Errorf("%s: unexpected response %v", name, in)
+		}
+		if name == "missing.mesos." {
+			if in.Rcode != dns.RcodeNameError {
+				t.Errorf("%s: expected NXDOMAIN, got %s", name, dns.RcodeToString[in.Rcode])
+			}
+		} else if len(in.Answer) == 0 {
+			t.Errorf("%s: expected answers, got %v", name, in)
+		}
+	}
+
+	if !res.listening.get()["doq"] {
+		t.Error("doq should be listed as bound")
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Error(err)
+	}
+}
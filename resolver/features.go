@@ -0,0 +1,109 @@
+package resolver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// featuresName is the CHAOS TXT name the enabled features are served at
+const featuresName = "features.mesos-dns."
+
+// features tells which optional subsystems are enabled, by the name of
+// their configuration setting or, for metrics backends, of the backend
+func (res *Resolver) features() map[string]bool {
+	c := *res.config()
+	return map[string]bool{
+		"recurseon":     c.RecurseOn,
+		"cachesize":     c.CacheSize > 0,
+		"coalesce":      res.flights != nil,
+		"ratelimit":     res.limiter != nil,
+		"rrl":           res.rrl != nil,
+		"querylog":      res.queryLog != nil,
+		"dns64":         c.DNS64Prefix != "",
+		"doq":           c.DoQPort > 0,
+		"rpz":           len(c.RPZ) > 0,
+		"push":          c.PushPort > 0,
+		"dnstap":        res.dnstap != nil,
+		"answercache":   res.answers != nil,
+		"acls":          len(c.AllowQuery) > 0 || len(c.AllowRecursion) > 0,
+		"blocklists":    len(c.Blocklists) > 0,
+		"localzones":    c.LocalZones,
+		"loc":           len(c.LOCAttributes) > 0,
+		"caa":           len(c.CAA) > 0,
+		"dnames":        len(c.DNAMEs) > 0,
+		"tlsa":          c.TLSALabel != "",
+		"sshfp":         c.SSHFPAttribute != "" || c.SSHFPFile != "",
+		"stubzones":     len(c.StubZones) > 0,
+		"hostsfiles":    len(c.HostsFiles) > 0,
+		"qnameminimize": c.QNameMinimize,
+		"dnssec":        c.DNSSEC,
+		"validation":    c.DNSSECValidate,
+		"zonetransfers": len(c.AXFRAllow) > 0 || len(c.TSIGKeys) > 0,
+		"catalog":       c.CatalogZone != "",
+		"notify":        len(c.Notify) > 0,
+		"peers":         len(c.Peers) > 0,
+		"warmup":        c.WarmupFromPeers,
+		"clusters":      len(c.Clusters) > 0,
+		"filters":       len(c.Filters) > 0,
+		"canary":        c.CanarySeconds > 0,
+		"httpon":        c.HTTPOn,
+		"adminapi":      c.HTTPOn && c.AdminToken != "",
+		"tracing":       c.TraceEndpoint != "",
+		"statsd":        c.StatsdAddress != "",
+		"selfreport":    c.SelfReportSeconds > 0,
+		"log":           true,
+	}
+}
+
+// featuresResponse is the body of /v1/features
+type featuresResponse struct {
+	Version  string          `json:"version"`
+	Features map[string]bool `json:"features"`
+}
+
+// handleFeatures returns the enabled features
+func (res *Resolver) handleFeatures(w http.ResponseWriter, r *http.Request) {
+	if !only("GET", w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, featuresResponse{Version: res.Version, Features: res.features()})
+}
+
+// chaosMsg answers CHAOS TXT queries for featuresName with a name=on or
+// name=off record for every feature, nil for any other query
+func (res *Resolver) chaosMsg(r *dns.Msg) *dns.Msg {
+	q := r.Question[0]
+	if q.Qclass != dns.ClassCHAOS || !strings.EqualFold(q.Name, featuresName) {
+		return nil
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	if q.Qtype != dns.TypeTXT && q.Qtype != dns.TypeANY {
+		return m
+	}
+
+	features := res.features()
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		state := "off"
+		if features[name] {
+			state = "on"
+		}
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+			Txt: []string{name + "=" + state},
+		})
+	}
+	return m
+}
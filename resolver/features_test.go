@@ -0,0 +1,80 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestFeaturesAPI(t *testing.T) {
+	res := acmeDNS(t)
+	res.Version = "test"
+	res.Config.AdminToken = "secret"
+	res.Config.HTTPOn = true
+	res.Config.DNSSEC = false
+
+	// no token needed
+	rec := apiRequest(res.httpHandler(), "GET", "/v1/features", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var resp featuresResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Version != "test" || !resp.Features["adminapi"] || resp.Features["dnssec"] {
+		t.Errorf("unexpected features %+v", resp)
+	}
+	if len(resp.Features) != len(res.features()) {
+		t.Errorf("expected every feature, got %v", resp.Features)
+	}
+}
+
+func TestChaosFeatures(t *testing.T) {
+	res := acmeDNS(t)
+	res.Config.HTTPOn = true
+
+	var tests = []struct {
+		name    string
+		class   uint16
+		qtype   uint16
+		answers int
+	}{
+		{"features.mesos-dns.", dns.ClassCHAOS, dns.TypeTXT, len(res.features())},
+		{"Features.Mesos-DNS.", dns.ClassCHAOS, dns.TypeTXT, len(res.features())},
+		{"features.mesos-dns.", dns.ClassCHAOS, dns.TypeA, 0},
+		{"features.mesos-dns.", dns.ClassINET, dns.TypeTXT, -1},
+		{"version.bind.", dns.ClassCHAOS, dns.TypeTXT, -1},
+	}
+
+	for _, tt := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(tt.name, tt.qtype)
+		r.Question[0].Qclass = tt.class
+
+		m := res.chaosMsg(r)
+		if tt.answers < 0 {
+			if m != nil {
+				t.Errorf("%s class %d: should not be answered", tt.name, tt.class)
+			}
+			continue
+		}
+		if m == nil || len(m.Answer) != tt.answers {
+			t.Errorf("%s %d: expected %d answers, got %v", tt.name, tt.qtype, tt.answers, m)
+		}
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion(featuresName, dns.TypeTXT)
+	r.Question[0].Qclass = dns.ClassCHAOS
+	found := false
+	for _, rr := range res.chaosMsg(r).Answer {
+		found = found || rr.(*dns.TXT).Txt[0] == "httpon=on"
+	}
+	if !found {
+		t.Error("expected httpon=on")
+	}
+}
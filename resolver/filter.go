@@ -0,0 +1,80 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// Filter decides which records a client gets in answer to a query in
+// the mesos domain, e.g. to enforce a compliance or tenant policy
+// Filters are compiled in and register themselves with RegisterFilter,
+// the Filters setting picks the ones to run, in order
+type Filter interface {
+	// Filter returns the records of answers client may see for qname
+	Filter(client net.IP, qname string, qtype uint16, answers []dns.RR) []dns.RR
+}
+
+// FilterFunc is a function that is a Filter
+type FilterFunc func(client net.IP, qname string, qtype uint16, answers []dns.RR) []dns.RR
+
+// Filter calls f
+func (f FilterFunc) Filter(client net.IP, qname string, qtype uint16, answers []dns.RR) []dns.RR {
+	return f(client, qname, qtype, answers)
+}
+
+var (
+	filtersLock sync.Mutex
+	filters     = make(map[string]Filter)
+)
+
+// RegisterFilter makes f available as name, usually from the init
+// function of the package that implements it
+func RegisterFilter(name string, f Filter) {
+	filtersLock.Lock()
+	defer filtersLock.Unlock()
+
+	if _, ok := filters[name]; ok {
+		panic("filter " + name + " registered twice")
+	}
+	filters[name] = f
+}
+
+// lookupFilters returns the registered filters called names
+func lookupFilters(names []string) ([]Filter, error) {
+	filtersLock.Lock()
+	defer filtersLock.Unlock()
+
+	var fs []Filter
+	for _, name := range names {
+		f, ok := filters[name]
+		if !ok {
+			return nil, errors.New("unknown filter " + name)
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+// filter runs the configured filters over the answers to r
+func (res *Resolver) filter(w dns.ResponseWriter, r *dns.Msg, answers []dns.RR) []dns.RR {
+	if len(res.filters) == 0 {
+		return answers
+	}
+
+	var client net.IP
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		client = addr.IP
+	case *net.TCPAddr:
+		client = addr.IP
+	}
+
+	q := r.Question[0]
+	for _, f := range res.filters {
+		answers = f.Filter(client, q.Name, q.Qtype, answers)
+	}
+	return answers
+}
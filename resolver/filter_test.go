@@ -0,0 +1,53 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestFilter(t *testing.T) {
+	// only 10.0.0.0/8 sees chronos
+	RegisterFilter("test-tenant", FilterFunc(func(client net.IP, qname string, qtype uint16, answers []dns.RR) []dns.RR {
+		_, tenant, _ := net.ParseCIDR("10.0.0.0/8")
+		if qname == "chronos.marathon-0.6.0.mesos." && !tenant.Contains(client) {
+			return nil
+		}
+		return answers
+	}))
+
+	if _, err := lookupFilters([]string{"missing"}); err == nil {
+		t.Error("should not find unregistered filters")
+	}
+
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.filters, err = lookupFilters([]string{"test-tenant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		client  string
+		name    string
+		answers int
+	}{
+		{"10.1.2.3", "chronos.marathon-0.6.0.mesos.", 1},
+		{"192.168.0.1", "chronos.marathon-0.6.0.mesos.", 0},
+		{"192.168.0.1", "liquor-store.marathon-0.6.0.mesos.", 2},
+	}
+
+	for _, tt := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(tt.name, dns.TypeA)
+		w := &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP(tt.client), Port: 12345}}
+		res.HandleMesos(w, r)
+
+		if len(w.msg.Answer) != tt.answers {
+			t.Errorf("%s %s: expected %d answers, got %d", tt.client, tt.name, tt.answers, len(w.msg.Answer))
+		}
+	}
+}
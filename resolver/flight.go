@@ -0,0 +1,100 @@
+package resolver
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// flightKey identifies forwarded queries that can share an upstream
+// exchange - on top of the question it holds what changes the response
+type flightKey struct {
+	name  string
+	qtype uint16
+	class uint16
+	proto string
+	cd    bool
+	do    bool
+}
+
+func flightKeyFor(r *dns.Msg, proto string) flightKey {
+	q := r.Question[0]
+	k := flightKey{
+		name:  strings.ToLower(q.Name),
+		qtype: q.Qtype,
+		class: q.Qclass,
+		proto: proto,
+		cd:    r.CheckingDisabled,
+	}
+	if opt := r.IsEdns0(); opt != nil {
+		k.do = opt.Do()
+	}
+	return k
+}
+
+// flight is an upstream exchange in progress, m and err are set when
+// done is closed
+type flight struct {
+	done chan struct{}
+	m    *dns.Msg
+	err  error
+}
+
+// flights coalesces identical forwarded queries, so a storm of them
+// makes one upstream exchange
+// a nil *flights coalesces nothing
+type flights struct {
+	sync.Mutex
+	items map[flightKey]*flight
+}
+
+func newFlights() *flights {
+	return &flights{items: make(map[flightKey]*flight)}
+}
+
+// do returns the response of forward for r, made once for all the
+// queries like r that arrive while it is in flight - shared is set for
+// the ones that waited for another query's exchange, their response is
+// a copy with the id and question of r
+func (f *flights) do(r *dns.Msg, proto string, forward func() (*dns.Msg, error)) (m *dns.Msg, shared bool, err error) {
+	if f == nil {
+		m, err = forward()
+		return m, false, err
+	}
+
+	k := flightKeyFor(r, proto)
+
+	f.Lock()
+	if fl, ok := f.items[k]; ok {
+		f.Unlock()
+
+		<-fl.done
+		if fl.m == nil {
+			return nil, true, fl.err
+		}
+		m = fl.m.Copy()
+		m.Id = r.Id
+		m.Question = append([]dns.Question(nil), r.Question...)
+		return m, true, fl.err
+	}
+
+	fl := &flight{done: make(chan struct{})}
+	f.items[k] = fl
+	f.Unlock()
+
+	m, err = forward()
+
+	// the waiters copy their own, ours is changed on the way out
+	if m != nil {
+		fl.m = m.Copy()
+	}
+	fl.err = err
+
+	f.Lock()
+	delete(f.items, k)
+	f.Unlock()
+	close(fl.done)
+
+	return m, false, err
+}
@@ -0,0 +1,98 @@
+package resolver
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestFlights(t *testing.T) {
+	f := newFlights()
+
+	var exchanges int32
+	release := make(chan struct{})
+	forward := func() (*dns.Msg, error) {
+		atomic.AddInt32(&exchanges, 1)
+		<-release
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		m.Id = 1
+		m.Response = true
+		rr, _ := dns.NewRR("example.com. 60 IN A 10.0.0.1")
+		m.Answer = append(m.Answer, rr)
+		return m, nil
+	}
+
+	var wg sync.WaitGroup
+	var shared int32
+	answers := make([]*dns.Msg, 10)
+	for i := range answers {
+		r := new(dns.Msg)
+		r.SetQuestion("Example.COM.", dns.TypeA)
+		r.Id = uint16(i + 1)
+
+		wg.Add(1)
+		go func(i int, r *dns.Msg) {
+			defer wg.Done()
+			m, s, err := f.do(r, "udp", forward)
+			if err != nil {
+				t.Error(err)
+			}
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+			answers[i] = m
+		}(i, r)
+	}
+
+	// let the queries pile up behind the first one
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if exchanges != 1 || shared != 9 {
+		t.Errorf("expected 1 exchange shared 9 times, got %d exchanges and %d shared", exchanges, shared)
+	}
+	for i, m := range answers {
+		if m == nil || len(m.Answer) != 1 {
+			t.Errorf("query %d: expected the answer, got %v", i, m)
+			continue
+		}
+		if m.Id != uint16(i+1) && m.Id != 1 {
+			t.Errorf("query %d: got the id %d of another query", i, m.Id)
+		}
+	}
+
+	// different questions and finished flights don't share
+	var tests = []struct {
+		name  string
+		qtype uint16
+		proto string
+	}{
+		{"example.com.", dns.TypeA, "udp"},
+		{"example.com.", dns.TypeAAAA, "udp"},
+		{"example.com.", dns.TypeA, "tcp"},
+	}
+	for _, tt := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(tt.name, tt.qtype)
+		if _, s, _ := f.do(r, tt.proto, forward); s {
+			t.Errorf("%s %d %s: should not be shared", tt.name, tt.qtype, tt.proto)
+		}
+	}
+	if len(f.items) != 0 {
+		t.Errorf("flights should be gone, got %d", len(f.items))
+	}
+
+	// no flights without coalescing
+	var none *flights
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+	if m, s, _ := none.do(r, "udp", forward); m == nil || s {
+		t.Error("a nil flights should forward every query")
+	}
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// healthOrder puts answers for tasks failing their health checks after
+// the healthy ones with HealthFirst, and omits them while they are at
+// most HealthOmitShare of the answers
+// tasks on slaves entering maintenance fail them, and are put last when
+// MaintenanceAgents is deprioritize
+// it must be called with the records locked
+func (res *Resolver) healthOrder(answers []dns.RR) []dns.RR {
+	config := res.config()
+	first := config.HealthFirst || config.MaintenanceAgents == "deprioritize"
+	if !first && config.HealthOmitShare == 0 {
+		return answers
+	}
+
+	var healthy, unhealthy []dns.RR
+	for _, rr := range answers {
+		if res.unhealthy(rr) {
+			unhealthy = append(unhealthy, rr)
+		} else {
+			healthy = append(healthy, rr)
+		}
+	}
+
+	if len(unhealthy) == 0 {
+		return answers
+	}
+
+	if len(healthy) > 0 && float64(len(unhealthy)) <= config.HealthOmitShare*float64(len(answers)) {
+		logging.CurLog.MesosUnhealthy += len(unhealthy)
+		return healthy
+	}
+
+	if !first {
+		return answers
+	}
+	return append(healthy, unhealthy...)
+}
+
+// unhealthy reports whether rr points at tasks failing their health
+// checks
+func (res *Resolver) unhealthy(rr dns.RR) bool {
+	name := strings.ToLower(rr.Header().Name)
+
+	switch rr := rr.(type) {
+	case *dns.A:
+		return res.rs.Unhealthy(name, rr.A.String())
+	case *dns.SRV:
+		host := strings.TrimSuffix(rr.Target, ".") + ":" + strconv.Itoa(int(rr.Port))
+		return res.rs.Unhealthy(name, host)
+	}
+	return false
+}
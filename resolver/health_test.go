@@ -0,0 +1,63 @@
+package resolver
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestHealthOrder(t *testing.T) {
+	var sj records.StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1"},
+			{"id": "s2", "hostname": "10.0.0.2"},
+			{"id": "s3", "hostname": "10.0.0.3"}
+		],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING", "statuses": [{"healthy": false}]},
+			{"name": "web", "slave_id": "s2", "state": "TASK_RUNNING", "statuses": [{"healthy": true}]},
+			{"name": "web", "slave_id": "s3", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		first bool
+		share float64
+		hosts []string
+	}{
+		{false, 0, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{true, 0, []string{"10.0.0.2", "10.0.0.3", "10.0.0.1"}},
+		{false, 0.5, []string{"10.0.0.2", "10.0.0.3"}},
+		{false, 0.2, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{true, 0.2, []string{"10.0.0.2", "10.0.0.3", "10.0.0.1"}},
+	}
+
+	for _, tt := range tests {
+		res := &Resolver{Config: records.Config{Domain: "mesos", TTL: 60, HealthFirst: tt.first, HealthOmitShare: tt.share}}
+		res.rs.InsertState(sj, res.Config)
+
+		var answers []dns.RR
+		for _, host := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+			rr, err := res.formatA("web.marathon.mesos.", host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			answers = append(answers, rr)
+		}
+
+		var hosts []string
+		for _, rr := range res.healthOrder(answers) {
+			hosts = append(hosts, rr.(*dns.A).A.String())
+		}
+		if !reflect.DeepEqual(hosts, tt.hosts) {
+			t.Errorf("first %v share %v: expected %v, got %v", tt.first, tt.share, tt.hosts, hosts)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// hopOption is the EDNS0 option code, from the local/experimental range,
+// carrying how many times a query has been forwarded by mesos-dns
+const hopOption = 65432
+
+// hops returns how many mesos-dns instances already forwarded r
+func hops(r *dns.Msg) int {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return 0
+	}
+
+	for _, o := range opt.Option {
+		if l, ok := o.(*dns.EDNS0_LOCAL); ok && l.Code == hopOption && len(l.Data) == 2 {
+			return int(binary.BigEndian.Uint16(l.Data))
+		}
+	}
+
+	return 0
+}
+
+// withHops returns a copy of r carrying a hop count of n
+func withHops(r *dns.Msg, n int) *dns.Msg {
+	q := r.Copy()
+
+	opt := q.IsEdns0()
+	if opt == nil {
+		q.SetEdns0(dns.MinMsgSize, false)
+		opt = q.IsEdns0()
+	}
+
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, uint16(n))
+
+	options := opt.Option[:0]
+	for _, o := range opt.Option {
+		if l, ok := o.(*dns.EDNS0_LOCAL); ok && l.Code == hopOption {
+			continue
+		}
+		options = append(options, o)
+	}
+	opt.Option = append(options, &dns.EDNS0_LOCAL{Code: hopOption, Data: data})
+
+	return q
+}
+
+// withoutHops returns a copy of r without a hop count
+func withoutHops(r *dns.Msg) *dns.Msg {
+	q := r.Copy()
+
+	if opt := q.IsEdns0(); opt != nil {
+		options := opt.Option[:0]
+		for _, o := range opt.Option {
+			if l, ok := o.(*dns.EDNS0_LOCAL); ok && l.Code == hopOption {
+				continue
+			}
+			options = append(options, o)
+		}
+		opt.Option = options
+	}
+
+	return q
+}
+
+// countsHops reports whether nameserver may be another mesos-dns, a peer
+// or a resolver of a stub zone, which the hop count is for - the other
+// nameservers don't know our private option
+func (res *Resolver) countsHops(nameserver string) bool {
+	config := res.config()
+
+	host, _, err := net.SplitHostPort(nameserver)
+	if err != nil {
+		host = nameserver
+	}
+	for _, peer := range config.Peers {
+		if ip, _ := peerAddr(peer, config.Port); ip == host {
+			return true
+		}
+	}
+
+	for _, addrs := range config.StubZones {
+		for _, addr := range addrs {
+			if addr == nameserver || addr == host {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forwarded returns the copy of r we forward to nameserver, with the hop
+// count raised if it counts hops and without one otherwise
+func (res *Resolver) forwarded(r *dns.Msg, nameserver string) *dns.Msg {
+	if res.countsHops(nameserver) {
+		return withHops(r, hops(r)+1)
+	}
+	return withoutHops(r)
+}
+
+// stripOPT removes the EDNS0 OPT record from m
+func stripOPT(m *dns.Msg) {
+	extra := m.Extra[:0]
+	for _, rr := range m.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	m.Extra = extra
+}
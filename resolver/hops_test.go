@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestHops(t *testing.T) {
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+
+	if hops(r) != 0 {
+		t.Error("plain query should have no hops")
+	}
+
+	q := withHops(r, 1)
+	if hops(q) != 1 {
+		t.Error("expected 1 hop")
+	}
+	if r.IsEdns0() != nil {
+		t.Error("withHops should not modify the original query")
+	}
+
+	q = withHops(q, 2)
+	if hops(q) != 2 || len(q.IsEdns0().Option) != 1 {
+		t.Error("withHops should replace the hop count")
+	}
+}
+
+func TestForwardedHops(t *testing.T) {
+	res := &Resolver{Config: records.Config{
+		Port:      53,
+		Peers:     []string{"192.0.2.7"},
+		StubZones: map[string][]string{"corp.": {"192.0.2.8:5353"}},
+	}}
+
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+	r = withHops(r, 1)
+
+	var tests = []struct {
+		nameserver string
+		hops       int
+	}{
+		{"192.0.2.7:53", 2},
+		{"192.0.2.8:5353", 2},
+		{"8.8.8.8:53", 0},
+	}
+	for _, tt := range tests {
+		q := res.forwarded(r, tt.nameserver)
+		if hops(q) != tt.hops {
+			t.Errorf("%s: expected %d hops, got %d", tt.nameserver, tt.hops, hops(q))
+		}
+	}
+
+	if hops(r) != 1 {
+		t.Error("forwarded should not modify the original query")
+	}
+
+	// no OPT record just for the hops
+	plain := new(dns.Msg)
+	plain.SetQuestion("example.com.", dns.TypeA)
+	if q := res.forwarded(plain, "8.8.8.8:53"); q.IsEdns0() != nil {
+		t.Error("expected no EDNS0 to resolvers that don't count hops")
+	}
+}
+
+func TestHopLimit(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Config.Resolvers = []string{"192.0.2.1"}
+
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+	r = withHops(r, res.Config.MaxForwardHops)
+
+	before := logging.CurLog.NonMesosHopLimit
+	w := &fakeWriter{}
+	res.HandleNonMesos(w, r)
+
+	if w.msg == nil || w.msg.Rcode != dns.RcodeServerFailure {
+		t.Fatal("expected SERVFAIL once the hop limit is reached")
+	}
+	if logging.CurLog.NonMesosHopLimit != before+1 {
+		t.Error("hop limit should be counted")
+	}
+}
+
+func TestReferral(t *testing.T) {
+	in := new(dns.Msg)
+	if referral(in) != "" {
+		t.Error("empty message is not a referral")
+	}
+
+	ns, _ := dns.NewRR("example.com. 60 IN NS ns1.example.com.")
+	in.Ns = []dns.RR{ns}
+	if referral(in) != "ns1.example.com.:53" {
+		t.Error("should follow the NS name without glue")
+	}
+
+	in.Extra = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "ns1.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+		A:   net.ParseIP("192.0.2.53"),
+	}}
+	if referral(in) != "192.0.2.53:53" {
+		t.Error("should prefer glue")
+	}
+
+	soa, _ := dns.NewRR("example.com. 60 IN SOA ns1.example.com. root.example.com. 1 60 60 60 60")
+	in.Ns = append(in.Ns, soa)
+	if referral(in) != "" {
+		t.Error("SOA in authority means a negative answer, not a referral")
+	}
+}
@@ -0,0 +1,174 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// hostsPoll is how often the hosts files are checked for changes
+var hostsPoll = 5 * time.Second
+
+// hostsFiles holds the addresses of the names in the HostsFiles
+// a nil *hostsFiles holds none
+type hostsFiles struct {
+	sync.RWMutex
+	names  map[string][]net.IP
+	mtimes map[string]time.Time
+}
+
+func newHostsFiles() *hostsFiles {
+	return &hostsFiles{names: make(map[string][]net.IP)}
+}
+
+// parseHosts reads the addresses of names from a file in hosts format,
+// an address followed by its names on each line, '#' starts a comment
+func parseHosts(rd io.Reader, names map[string][]net.IP) error {
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+
+		for _, f := range fields[1:] {
+			name := dns.Fqdn(strings.ToLower(f))
+			if _, ok := dns.IsDomainName(name); !ok {
+				continue
+			}
+			names[name] = append(names[name], ip)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// load reads paths again if any of them changed since the last load and
+// reports whether it did
+// a file that fails to load is skipped and the error logged
+func (h *hostsFiles) load(paths []string) bool {
+	mtimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err == nil {
+			mtimes[path] = fi.ModTime()
+		}
+	}
+
+	h.RLock()
+	same := h.mtimes != nil && len(mtimes) == len(h.mtimes)
+	for path, mtime := range mtimes {
+		same = same && h.mtimes[path].Equal(mtime)
+	}
+	h.RUnlock()
+	if same {
+		return false
+	}
+
+	names := make(map[string][]net.IP)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			logging.Error.Println(err)
+			continue
+		}
+
+		err = parseHosts(f, names)
+		f.Close()
+		if err != nil {
+			logging.Error.Println(path+":", err)
+		}
+	}
+
+	h.Lock()
+	h.names, h.mtimes = names, mtimes
+	h.Unlock()
+
+	logging.Verbose.Printf("loaded %d names from hosts files\n", len(names))
+	return true
+}
+
+// addrs returns the addresses of name, ok is false if no hosts file
+// lists it
+func (h *hostsFiles) addrs(name string) (ips []net.IP, ok bool) {
+	if h == nil {
+		return nil, false
+	}
+
+	h.RLock()
+	defer h.RUnlock()
+	ips, ok = h.names[strings.ToLower(name)]
+	return ips, ok
+}
+
+// insert puts the IPv4 addresses of the names in zone into rg
+func (h *hostsFiles) insert(rg *records.RecordGenerator, zone string) {
+	if h == nil {
+		return
+	}
+
+	h.RLock()
+	defer h.RUnlock()
+
+	for name, ips := range h.names {
+		if !dns.IsSubDomain(zone, name) {
+			continue
+		}
+		for _, ip := range ips {
+			if ip.To4() != nil {
+				rg.Insert(name, ip.String(), "A")
+			}
+		}
+	}
+}
+
+// hostsMsg answers a question for an external name listed in a hosts
+// file - it returns nil if none lists it
+func (res *Resolver) hostsMsg(r *dns.Msg) *dns.Msg {
+	ips, ok := res.hosts.addrs(r.Question[0].Name)
+	if !ok {
+		return nil
+	}
+	return res.addressMsg(r, ips)
+}
+
+// WatchHostsFiles serves the changes to the HostsFiles until ctx is done
+func (res *Resolver) WatchHostsFiles(ctx context.Context) error {
+	ticker := time.NewTicker(hostsPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if res.hosts.load(res.config().HostsFiles) {
+			res.rsLock.Lock()
+			res.publish()
+			res.rsLock.Unlock()
+		}
+	}
+}
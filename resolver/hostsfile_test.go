@@ -0,0 +1,84 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestParseHosts(t *testing.T) {
+	names := make(map[string][]net.IP)
+	err := parseHosts(strings.NewReader(`
+# comment
+10.0.0.1   db.mesos   db-alias.mesos # trailing comment
+fd00::1    db.example.com
+10.0.0.2   DB.example.com
+bogus      ignored.example.com
+10.0.0.3
+`), names)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]net.IP{
+		"db.mesos.":       {net.ParseIP("10.0.0.1").To4()},
+		"db-alias.mesos.": {net.ParseIP("10.0.0.1").To4()},
+		"db.example.com.": {net.ParseIP("fd00::1"), net.ParseIP("10.0.0.2").To4()},
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %v, got %v", want, names)
+	}
+}
+
+func TestHostsFiles(t *testing.T) {
+	f, err := ioutil.TempFile("", "mesos-dns-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("10.0.0.1 db.mesos db.example.com\nfd00::1 db.example.com\n")
+	f.Close()
+
+	config := records.Config{Domain: "mesos", TTL: 60, HostsFiles: []string{f.Name()}}
+	res := New(config)
+	res.base.InsertState(records.StateJSON{}, config)
+	res.publish()
+
+	if hosts := res.rs.As["db.mesos."]; !reflect.DeepEqual(hosts, []string{"10.0.0.1"}) {
+		t.Errorf("expected db.mesos. in the records, got %v", hosts)
+	}
+
+	m := res.hostsMsg(new(dns.Msg).SetQuestion("DB.example.com.", dns.TypeAAAA))
+	if m == nil || len(m.Answer) != 1 || m.Answer[0].(*dns.AAAA).AAAA.String() != "fd00::1" {
+		t.Errorf("expected the AAAA record of db.example.com., got %v", m)
+	}
+	if m := res.hostsMsg(new(dns.Msg).SetQuestion("www.example.com.", dns.TypeA)); m != nil {
+		t.Errorf("expected no answer for a name not in the hosts files, got %v", m)
+	}
+
+	// only changed files are read again
+	if res.hosts.load(config.HostsFiles) {
+		t.Error("expected no reload of unchanged files")
+	}
+	ioutil.WriteFile(f.Name(), []byte("10.0.0.2 db.mesos\n"), 0644)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(f.Name(), future, future)
+	if !res.hosts.load(config.HostsFiles) {
+		t.Fatal("expected a changed file to be read again")
+	}
+
+	res.publish()
+	if hosts := res.rs.As["db.mesos."]; !reflect.DeepEqual(hosts, []string{"10.0.0.2"}) {
+		t.Errorf("expected the new address of db.mesos., got %v", hosts)
+	}
+	if _, ok := res.hosts.addrs("db.example.com."); ok {
+		t.Error("expected db.example.com. to be gone")
+	}
+}
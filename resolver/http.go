@@ -0,0 +1,419 @@
+package resolver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/mesosphere/mesos-dns/tracing"
+)
+
+// LaunchHTTP serves the HTTP API on HTTPListener:HTTPPort until ctx is
+// done
+func (res *Resolver) LaunchHTTP(ctx context.Context) error {
+	config := res.config()
+	addr := net.JoinHostPort(config.HTTPListener, strconv.Itoa(config.HTTPPort))
+	server := &http.Server{Addr: addr, Handler: res.httpHandler()}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			server.Close()
+		case <-done:
+		}
+	}()
+
+	var err error
+	if f := res.sockets["http"]; f != nil {
+		var l net.Listener
+		if l, err = net.FileListener(f); err == nil {
+			err = server.Serve(l)
+		}
+	} else {
+		err = server.ListenAndServe()
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("failed to setup http server: " + err.Error())
+}
+
+// httpHandler routes the HTTP API
+func (res *Resolver) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", res.handleHealth)
+	mux.HandleFunc("/ready", res.handleReady)
+	mux.HandleFunc("/v1/openapi.json", handleOpenAPI)
+	mux.HandleFunc("/v1/features", res.handleFeatures)
+	mux.HandleFunc("/v1/lookup", res.handleLookup)
+	mux.HandleFunc("/v1/acme", res.admin(res.handleACME))
+	mux.HandleFunc("/v1/reload", res.admin(res.handleReload))
+	mux.HandleFunc("/v1/config", res.admin(res.handleConfig))
+	mux.HandleFunc("/v1/loglevel", res.admin(handleLogLevel))
+	mux.HandleFunc("/v1/records", res.admin(res.handleRecords))
+	mux.HandleFunc("/v1/records/static", res.admin(res.handleStaticList))
+	mux.HandleFunc("/v1/records/static/", res.admin(res.handleStatic))
+	mux.HandleFunc("/v1/zone", res.admin(res.handleZone))
+	mux.HandleFunc("/debug/state", res.admin(res.handleDebugState))
+	mux.HandleFunc("/debug/pprof/", res.admin(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", res.admin(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", res.admin(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", res.admin(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", res.admin(pprof.Trace))
+	mux.HandleFunc("/", handleNotFound)
+	return requestID(traced(mux))
+}
+
+// statusWriter remembers the status code of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// traced records a span for each request, continuing the trace of the
+// client if it sends a traceparent header
+func traced(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := tracing.FromTraceparent(r.Header.Get("traceparent"), "http "+r.Method+" "+r.URL.Path)
+		defer span.Finish()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+
+		span.Tag("http.method", r.Method)
+		span.Tag("http.path", r.URL.Path)
+		span.Tag("http.status_code", strconv.Itoa(sw.status))
+		span.Tag("request_id", w.Header().Get(requestIDHeader))
+	})
+}
+
+// admin only lets requests that carry the AdminToken as bearer token
+// through to h, the admin API is off without one
+func (res *Resolver) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if res.authorized(w, r) {
+			h(w, r)
+		}
+	}
+}
+
+// authorized reports whether r carries the admin token, and answers it
+// with an error if it doesn't
+func (res *Resolver) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token := res.config().AdminToken
+	if token == "" {
+		writeError(w, http.StatusForbidden, errForbidden, "admin api disabled", "set admintoken to enable it")
+		return false
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errUnauthorized, "invalid admin token", "")
+		return false
+	}
+	return true
+}
+
+// writeJSON sends v as the JSON body of a response with status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Error.Println(err)
+	}
+}
+
+// acmeRequest is the body of /v1/acme requests
+type acmeRequest struct {
+	Domain string `json:"domain"`
+	Value  string `json:"value"`
+}
+
+// acmeResponse describes a published challenge
+type acmeResponse struct {
+	Name    string    `json:"name"`
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// handleACME publishes (POST) and withdraws (DELETE) ACME DNS-01
+// challenges for names in the mesos domain
+func (res *Resolver) handleACME(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "DELETE" {
+		methodNotAllowed(w, "POST, DELETE")
+		return
+	}
+
+	var req acmeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+	if req.Domain == "" || req.Value == "" {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "domain and value are required", "")
+		return
+	}
+
+	if r.Method == "DELETE" {
+		removed, err := res.removeChallenge(req.Domain, req.Value)
+		switch {
+		case err != nil:
+			writeError(w, http.StatusBadRequest, errInvalidRequest, err.Error(), "")
+		case !removed:
+			writeError(w, http.StatusNotFound, errNotFound, "no such challenge", "")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	name, expires, err := res.addChallenge(req.Domain, req.Value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, err.Error(), "")
+		return
+	}
+
+	logging.Verbose.Println("acme challenge published at " + name)
+	writeJSON(w, http.StatusCreated, acmeResponse{Name: name, Value: req.Value, Expires: expires})
+}
+
+// only lets requests with the given method through, answering the rest
+// with 405
+func only(method string, w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != method {
+		methodNotAllowed(w, method)
+		return false
+	}
+	return true
+}
+
+// reloadResponse reports the zone after a forced reload
+type reloadResponse struct {
+	Serial uint32 `json:"serial"`
+}
+
+// handleReload refreshes the records from the mesos master right away
+func (res *Resolver) handleReload(w http.ResponseWriter, r *http.Request) {
+	if !only("POST", w, r) {
+		return
+	}
+
+	logging.Verbose.Println("reload requested through the api")
+	res.CheckPeers()
+	res.Reload()
+
+	writeJSON(w, http.StatusOK, reloadResponse{Serial: atomic.LoadUint32(&res.serial)})
+}
+
+// logLevelRequest sets the verbosity for a while
+type logLevelRequest struct {
+	Level   int `json:"level"`
+	Seconds int `json:"seconds"`
+}
+
+// logLevelResponse reports the verbosity in use, and until when if it
+// was set through the api
+type logLevelResponse struct {
+	Level      int        `json:"level"`
+	Configured int        `json:"configured"`
+	Until      *time.Time `json:"until,omitempty"`
+}
+
+// handleLogLevel reports (GET), sets for a while (PUT) and resets
+// (DELETE) the verbosity of the logs, without a restart
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, errInvalidRequest, "invalid request body", err.Error())
+			return
+		}
+		if req.Level < 0 || req.Level > 2 || req.Seconds < 0 {
+			writeError(w, http.StatusBadRequest, errInvalidRequest, "level must be 0, 1 or 2", "seconds must not be negative")
+			return
+		}
+
+		d := logging.DefaultRaise
+		if req.Seconds > 0 {
+			d = time.Duration(req.Seconds) * time.Second
+		}
+		logging.Raise(req.Level, d)
+		logging.Error.Println("log level set to " + strconv.Itoa(req.Level) + " for " + d.String() + " through the api")
+	case "DELETE":
+		logging.Restore()
+		logging.Error.Println("log level reset through the api")
+	default:
+		methodNotAllowed(w, "GET, PUT, DELETE")
+		return
+	}
+
+	current, configured, until := logging.Level()
+	resp := logLevelResponse{Level: current, Configured: configured}
+	if !until.IsZero() {
+		resp.Until = &until
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// redacted replaces secrets in the configuration we hand out
+const redacted = "<redacted>"
+
+// handleConfig returns the configuration in use, without secrets
+func (res *Resolver) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if !only("GET", w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res.redactedConfig())
+}
+
+// redactedConfig returns the configuration in use with its secrets
+// replaced
+func (res *Resolver) redactedConfig() records.Config {
+	c := *res.config()
+	if c.MasterPassword != "" {
+		c.MasterPassword = redacted
+	}
+	if c.AdminToken != "" {
+		c.AdminToken = redacted
+	}
+	keys := make(map[string]string, len(c.TSIGKeys))
+	for name := range c.TSIGKeys {
+		keys[name] = redacted
+	}
+	c.TSIGKeys = keys
+	return c
+}
+
+// recordsResponse is every record served from the mesos domain
+type recordsResponse struct {
+	Serial uint32              `json:"serial"`
+	A      map[string][]string `json:"a"`
+	SRV    map[string][]string `json:"srv"`
+	TXT    map[string][]string `json:"txt"`
+	CNAME  map[string][]string `json:"cname"`
+	TLSA   map[string][]string `json:"tlsa"`
+	SSHFP  map[string][]string `json:"sshfp"`
+	URI    map[string][]string `json:"uri"`
+}
+
+// handleRecords returns the records being served
+func (res *Resolver) handleRecords(w http.ResponseWriter, r *http.Request) {
+	if !only("GET", w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res.records())
+}
+
+// records returns a copy of the records being served
+func (res *Resolver) records() recordsResponse {
+	res.rsLock.RLock()
+	rs := res.rs.Copy()
+	res.rsLock.RUnlock()
+
+	return recordsResponse{
+		Serial: atomic.LoadUint32(&res.serial),
+		A:      rs.As,
+		SRV:    rs.SRVs,
+		TXT:    rs.TXTs,
+		CNAME:  rs.CNAMEs,
+		TLSA:   rs.TLSAs,
+		SSHFP:  rs.SSHFPs,
+		URI:    rs.URIs,
+	}
+}
+
+// handleStaticList returns the records added through the API
+func (res *Resolver) handleStaticList(w http.ResponseWriter, r *http.Request) {
+	if !only("GET", w, r) {
+		return
+	}
+
+	res.rsLock.RLock()
+	list := res.static.list()
+	res.rsLock.RUnlock()
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// staticRequest is the body of PUT /v1/records/static/<type>/<name>
+type staticRequest struct {
+	Values []string `json:"values"`
+}
+
+// staticResponse describes records added through the API
+type staticResponse struct {
+	Type   string   `json:"type"`
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// handleStatic sets (PUT) and removes (DELETE) the records of
+// /v1/records/static/<type>/<name>
+func (res *Resolver) handleStatic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" && r.Method != "DELETE" {
+		methodNotAllowed(w, "PUT, DELETE")
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/records/static/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		writeError(w, http.StatusNotFound, errNotFound, "no such endpoint", "expected /v1/records/static/<type>/<name>")
+		return
+	}
+	rtype, name := strings.ToUpper(parts[0]), parts[1]
+
+	if r.Method == "DELETE" {
+		removed, err := res.removeStatic(rtype, name)
+		switch {
+		case err != nil:
+			writeError(w, http.StatusBadRequest, errInvalidRequest, err.Error(), "")
+		case !removed:
+			writeError(w, http.StatusNotFound, errNotFound, "no such static records", "")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	var req staticRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+	if len(req.Values) == 0 {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "values are required", "use DELETE to remove records")
+		return
+	}
+
+	name, err := res.setStatic(rtype, name, req.Values)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, err.Error(), "")
+		return
+	}
+
+	logging.Verbose.Println("static " + rtype + " records set for " + name)
+	writeJSON(w, http.StatusOK, staticResponse{Type: rtype, Name: name, Values: req.Values})
+}
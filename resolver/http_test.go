@@ -0,0 +1,341 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func apiRequest(h http.Handler, method string, path string, token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminAuth(t *testing.T) {
+	res := acmeDNS(t)
+	h := res.httpHandler()
+
+	body := `{"domain": "myapp.marathon.mesos", "value": "token"}`
+	if rec := apiRequest(h, "POST", "/v1/acme", "", body); rec.Code != http.StatusForbidden {
+		t.Errorf("admin api should be off without a token, got %d", rec.Code)
+	}
+
+	res.Config.AdminToken = "secret"
+	if rec := apiRequest(h, "POST", "/v1/acme", "", body); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", rec.Code)
+	}
+	if rec := apiRequest(h, "POST", "/v1/acme", "wrong", body); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with the wrong token, got %d", rec.Code)
+	}
+	if rec := apiRequest(h, "POST", "/v1/acme", "secret", body); rec.Code != http.StatusCreated {
+		t.Errorf("expected 201 with the token, got %d", rec.Code)
+	}
+}
+
+func TestACMEAPI(t *testing.T) {
+	res := acmeDNS(t)
+	res.Config.AdminToken = "secret"
+	h := res.httpHandler()
+
+	rec := apiRequest(h, "POST", "/v1/acme", "secret", `{"domain": "myapp.marathon.mesos", "value": "token"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp acmeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Name != "_acme-challenge.myapp.marathon.mesos." || len(res.rs.TXTs[resp.Name]) != 1 {
+		t.Errorf("challenge not published: %+v", resp)
+	}
+
+	var tests = []struct {
+		method string
+		body   string
+		code   int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", `{"domain": "example.com", "value": "token"}`, http.StatusBadRequest},
+		{"POST", `{"domain": "myapp.marathon.mesos"}`, http.StatusBadRequest},
+		{"POST", `not json`, http.StatusBadRequest},
+		{"DELETE", `{"domain": "myapp.marathon.mesos", "value": "other"}`, http.StatusNotFound},
+		{"DELETE", `{"domain": "myapp.marathon.mesos", "value": "token"}`, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		if rec := apiRequest(h, tt.method, "/v1/acme", "secret", tt.body); rec.Code != tt.code {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.body, tt.code, rec.Code)
+		}
+	}
+
+	if len(res.rs.TXTs[resp.Name]) != 0 {
+		t.Error("challenge should be withdrawn")
+	}
+}
+
+func TestStateAPI(t *testing.T) {
+	res := acmeDNS(t)
+	res.Config.AdminToken = "secret"
+	res.Config.MasterUser = "mesos-dns"
+	res.Config.MasterPassword = "hunter2"
+	res.Config.TSIGKeys = map[string]string{"transfer.": "c2VjcmV0"}
+	h := res.httpHandler()
+
+	rec := apiRequest(h, "GET", "/v1/config", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "hunter2") || strings.Contains(body, "c2VjcmV0") || strings.Contains(body, `"secret"`) {
+		t.Error("config should not contain secrets:", body)
+	}
+	if !strings.Contains(body, "mesos-dns") {
+		t.Error("config should contain the rest of the settings")
+	}
+
+	rec = apiRequest(h, "GET", "/v1/records", "secret", "")
+	var records recordsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records.A["chronos.marathon-0.6.0.mesos."]) != 1 || len(records.SRV) == 0 {
+		t.Errorf("expected the served records, got %+v", records)
+	}
+
+	if rec := apiRequest(h, "GET", "/v1/reload", "secret", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("reload should need POST, got %d", rec.Code)
+	}
+
+	// no master to reload from
+	res.Config.Masters = []string{"127.0.0.1:1"}
+	serial := res.serial
+	if rec := apiRequest(h, "POST", "/v1/reload", "secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+	if res.serial == serial {
+		t.Error("reload should have changed the records")
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	res := acmeDNS(t)
+	res.Config.AdminToken = "secret"
+	h := res.httpHandler()
+
+	var tests = []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		code   string
+	}{
+		{"GET", "/v1/nowhere", "secret", "", http.StatusNotFound, errNotFound},
+		{"GET", "/v1/acme", "secret", "", http.StatusMethodNotAllowed, errMethodNotAllowed},
+		{"POST", "/v1/acme", "secret", "not json", http.StatusBadRequest, errInvalidRequest},
+		{"POST", "/v1/acme", "wrong", "", http.StatusUnauthorized, errUnauthorized},
+	}
+
+	for _, tt := range tests {
+		rec := apiRequest(h, tt.method, tt.path, tt.token, tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.status, rec.Code)
+			continue
+		}
+
+		var resp apiErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Errorf("%s %s: error body is not json: %v", tt.method, tt.path, err)
+			continue
+		}
+		if resp.Error.Code != tt.code || resp.Error.Message == "" {
+			t.Errorf("%s %s: unexpected error %+v", tt.method, tt.path, resp.Error)
+		}
+		if id := rec.Header().Get(requestIDHeader); id == "" || resp.Error.RequestID != id {
+			t.Errorf("%s %s: request id %q does not match header %q", tt.method, tt.path, resp.Error.RequestID, id)
+		}
+	}
+
+	// clients may bring their own request id
+	req := httptest.NewRequest("GET", "/v1/nowhere", nil)
+	req.Header.Set(requestIDHeader, "abc123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get(requestIDHeader) != "abc123" {
+		t.Error("should keep the request id of the client")
+	}
+}
+
+func TestLogLevelAPI(t *testing.T) {
+	res := New(records.Config{Domain: "mesos", AdminToken: "secret"})
+	h := res.httpHandler()
+	defer logging.SetLevel(0)
+	logging.SetLevel(0)
+
+	var tests = []struct {
+		method string
+		body   string
+		code   int
+		level  int
+		raised bool
+	}{
+		{"GET", "", http.StatusOK, 0, false},
+		{"PUT", `{"level": 2, "seconds": 60}`, http.StatusOK, 2, true},
+		{"GET", "", http.StatusOK, 2, true},
+		{"PUT", `{"level": 3}`, http.StatusBadRequest, 0, false},
+		{"PUT", `not json`, http.StatusBadRequest, 0, false},
+		{"POST", "", http.StatusMethodNotAllowed, 0, false},
+		{"DELETE", "", http.StatusOK, 0, false},
+	}
+
+	for _, tt := range tests {
+		rec := apiRequest(h, tt.method, "/v1/loglevel", "secret", tt.body)
+		if rec.Code != tt.code {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.body, tt.code, rec.Code)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		var resp logLevelResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Level != tt.level || resp.Configured != 0 || (resp.Until != nil) != tt.raised {
+			t.Errorf("%s %s: unexpected level %+v", tt.method, tt.body, resp)
+		}
+	}
+}
+
+func TestDebugAPI(t *testing.T) {
+	res := acmeDNS(t)
+	res.Config.AdminToken = "secret"
+	res.Config.MasterPassword = "hunter2"
+	res.reloaded = time.Now().UnixNano()
+	h := res.httpHandler()
+
+	if rec := apiRequest(h, "GET", "/debug/state", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin token, got %d", rec.Code)
+	}
+	if rec := apiRequest(h, "GET", "/debug/pprof/", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected pprof to need the admin token, got %d", rec.Code)
+	}
+
+	rec := apiRequest(h, "GET", "/debug/state", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "hunter2") {
+		t.Error("state should not contain secrets:", rec.Body.String())
+	}
+
+	var state debugState
+	if err := json.NewDecoder(rec.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Goroutines == 0 || state.HeapBytes == 0 {
+		t.Errorf("expected the runtime stats, got %+v", state)
+	}
+	if state.Records["a"] == 0 || state.Reloaded == nil || state.Config.Domain != "mesos" {
+		t.Errorf("expected the records, the last reload and the config, got %+v", state)
+	}
+
+	rec = apiRequest(h, "GET", "/debug/pprof/goroutine?debug=1", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine") {
+		t.Errorf("expected a goroutine profile, got %d", rec.Code)
+	}
+}
+
+func TestZoneAPI(t *testing.T) {
+	res := acmeDNS(t)
+	res.Config.AdminToken = "secret"
+	h := res.httpHandler()
+
+	if rec := apiRequest(h, "GET", "/v1/zone", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin token, got %d", rec.Code)
+	}
+
+	rec := apiRequest(h, "GET", "/v1/zone", "secret", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/dns" {
+		t.Fatalf("expected a zone file, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// the zone file holds what a transfer would
+	var rrs []dns.RR
+	zp := dns.NewZoneParser(rec.Body, "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) < 2 || rrs[0].Header().Rrtype != dns.TypeSOA || rrs[0].Header().Name != "mesos." {
+		t.Fatalf("expected the zone to start with its SOA, got %v", rrs)
+	}
+	if want := 1 + len(res.nsRecords()) + len(res.zoneRecords(&res.rs)); len(rrs) != want {
+		t.Errorf("expected %d records, got %d", want, len(rrs))
+	}
+}
+
+func TestHealthAPI(t *testing.T) {
+	res := New(records.Config{Domain: "mesos"})
+	h := res.httpHandler()
+
+	res.listening.set("tcp", true)
+	if rec := apiRequest(h, "GET", "/health", "", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 until udp is bound too, got %d", rec.Code)
+	}
+
+	res.listening.set("udp", true)
+	rec := apiRequest(h, "GET", "/health", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp healthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "ok" || !resp.Listeners["tcp"] || !resp.Listeners["udp"] {
+		t.Errorf("unexpected health %+v", resp)
+	}
+}
+
+func TestReadyAPI(t *testing.T) {
+	res := New(records.Config{Domain: "mesos", RefreshSeconds: 60, ReadyRefreshPeriods: 3})
+	h := res.httpHandler()
+
+	var tests = []struct {
+		fetched time.Duration
+		code    int
+	}{
+		{0, http.StatusServiceUnavailable},
+		{time.Minute, http.StatusOK},
+		{4 * time.Minute, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		res.fetched = 0
+		if tt.fetched > 0 {
+			res.fetched = time.Now().Add(-tt.fetched).UnixNano()
+		}
+		rec := apiRequest(h, "GET", "/ready", "", "")
+		if rec.Code != tt.code {
+			t.Errorf("fetched %s ago: expected %d, got %d: %s", tt.fetched, tt.code, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// InspectOptions is where the records and resolve subcommands get their
+// answers: the HTTP API of a running instance at API, or records
+// generated once from Config if API is empty
+type InspectOptions struct {
+	API     string
+	Token   string
+	Timeout time.Duration
+	Config  records.Config
+	Format  string
+}
+
+// call sends body to path of the HTTP API as JSON and decodes the
+// response into v, or copies it if v is a writer
+func (o InspectOptions) call(method string, path string, body interface{}, v interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(o.API, "/")+path, rd)
+	if err != nil {
+		return err
+	}
+	if o.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+o.Token)
+	}
+
+	resp, err := (&http.Client{Timeout: o.Timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e apiErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error.Message != "" {
+			return errors.New(path + ": " + e.Error.Message)
+		}
+		return errors.New(path + ": " + resp.Status)
+	}
+	if out, ok := v.(io.Writer); ok {
+		_, err = io.Copy(out, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// PrintRecords writes every record o points at to w, as a table or as
+// JSON
+func PrintRecords(w io.Writer, o InspectOptions) error {
+	if o.Format != "table" && o.Format != "json" {
+		return errors.New("unknown format " + o.Format)
+	}
+
+	var recs recordsResponse
+	if o.API != "" {
+		if err := o.call("GET", "/v1/records", nil, &recs); err != nil {
+			return err
+		}
+	} else {
+		res := New(o.Config)
+		if err := res.generate(); err != nil {
+			return err
+		}
+		recs = res.records()
+	}
+
+	if o.Format == "json" {
+		return printJSON(w, recs)
+	}
+
+	type row struct{ name, rtype, value string }
+	var rows []row
+	for _, set := range []struct {
+		rtype string
+		names map[string][]string
+	}{
+		{"A", recs.A}, {"CNAME", recs.CNAME}, {"SRV", recs.SRV}, {"TXT", recs.TXT},
+		{"TLSA", recs.TLSA}, {"SSHFP", recs.SSHFP}, {"URI", recs.URI},
+	} {
+		for name, values := range set.names {
+			for _, value := range values {
+				rows = append(rows, row{name, set.rtype, value})
+			}
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].name != rows[j].name {
+			return rows[i].name < rows[j].name
+		}
+		return rows[i].rtype < rows[j].rtype
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tVALUE")
+	for _, r := range rows {
+		fmt.Fprintln(tw, r.name+"\t"+r.rtype+"\t"+r.value)
+	}
+	return tw.Flush()
+}
+
+// PrintResolve answers the query for name and qtype as the instance o
+// points at would, and writes the answers to w as a table or as JSON - a
+// name with * labels stands for every name it matches
+func PrintResolve(w io.Writer, o InspectOptions, name string, qtype string) error {
+	if o.Format != "table" && o.Format != "json" {
+		return errors.New("unknown format " + o.Format)
+	}
+
+	q := lookupQuery{Name: name, Type: qtype}
+	m, err := lookupMsg(q)
+	if err != nil {
+		return err
+	}
+
+	var answers []lookupAnswer
+	if o.API != "" {
+		var resp lookupResponse
+		if err := o.call("POST", "/v1/lookup", lookupRequest{Queries: []lookupQuery{q}}, &resp); err != nil {
+			return err
+		}
+		answers = resp.Answers
+	} else {
+		res := New(o.Config)
+		if err := res.generate(); err != nil {
+			return err
+		}
+
+		msgs := []*dns.Msg{m}
+		if wildcard(m.Question[0].Name) {
+			msgs = nil
+			for _, match := range res.matchNames(m.Question[0].Name) {
+				each := m.Copy()
+				each.Question[0].Name = match
+				msgs = append(msgs, each)
+			}
+		}
+
+		client := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+		for _, m := range msgs {
+			answers = append(answers, res.lookup(client, m))
+		}
+	}
+
+	if o.Format == "json" {
+		return printJSON(w, lookupResponse{Answers: answers})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, ans := range answers {
+		fmt.Fprintln(tw, ";; "+ans.Name+"\t"+ans.Type+"\t"+ans.Rcode)
+		for _, r := range ans.Records {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", r.Name, r.TTL, r.Type, r.Data)
+		}
+	}
+	return tw.Flush()
+}
+
+// PrintZone writes every record o points at to w as an RFC 1035 zone
+// file
+func PrintZone(w io.Writer, o InspectOptions) error {
+	if o.API != "" {
+		return o.call("GET", "/v1/zone", nil, w)
+	}
+
+	res := New(o.Config)
+	if err := res.generate(); err != nil {
+		return err
+	}
+	return res.writeZone(w)
+}
@@ -0,0 +1,93 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+func TestPrintRecords(t *testing.T) {
+	master := fakeMaster(t, "web")
+	defer master.Close()
+
+	o := InspectOptions{Format: "table", Config: records.Config{
+		Domain:         "mesos",
+		Listener:       "127.0.0.1",
+		Mname:          "mesos-dns.mesos.",
+		InactiveAgents: "drop",
+		Masters:        []string{master.Listener.Addr().String()},
+	}}
+
+	var b bytes.Buffer
+	if err := PrintRecords(&b, o); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(b.String(), "\n")
+	if strings.Fields(lines[0])[0] != "NAME" {
+		t.Errorf("expected a header, got %q", lines[0])
+	}
+	if !strings.Contains(b.String(), "web.marathon.mesos.  A     10.0.0.1") {
+		t.Errorf("expected web.marathon.mesos. in\n%s", b.String())
+	}
+
+	// from a running instance
+	res := acmeDNS(t)
+	res.Config.AdminToken = "secret"
+	srv := httptest.NewServer(res.httpHandler())
+	defer srv.Close()
+
+	o = InspectOptions{API: srv.URL, Token: "secret", Timeout: time.Second, Format: "json"}
+	b.Reset()
+	if err := PrintRecords(&b, o); err != nil {
+		t.Fatal(err)
+	}
+	var recs recordsResponse
+	if err := json.Unmarshal(b.Bytes(), &recs); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs.A["liquor-store.marathon-0.6.0.mesos."]) == 0 {
+		t.Errorf("expected the records of the instance, got %v", recs.A)
+	}
+
+	o.Token = "wrong"
+	if err := PrintRecords(&b, o); err == nil || !strings.Contains(err.Error(), "invalid admin token") {
+		t.Errorf("expected the API error, got %v", err)
+	}
+}
+
+func TestPrintResolve(t *testing.T) {
+	res := acmeDNS(t)
+	srv := httptest.NewServer(res.httpHandler())
+	defer srv.Close()
+
+	o := InspectOptions{API: srv.URL, Timeout: time.Second, Format: "json"}
+	var b bytes.Buffer
+	if err := PrintResolve(&b, o, "liquor-store.marathon-0.6.0.mesos", "A"); err != nil {
+		t.Fatal(err)
+	}
+	var resp lookupResponse
+	if err := json.Unmarshal(b.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Answers) != 1 || resp.Answers[0].Rcode != "NOERROR" || len(resp.Answers[0].Records) == 0 {
+		t.Errorf("unexpected answers %+v", resp.Answers)
+	}
+
+	o.Format = "table"
+	b.Reset()
+	if err := PrintResolve(&b, o, "missing.marathon.mesos", "A"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), ";; missing.marathon.mesos.  A  NXDOMAIN") {
+		t.Errorf("unexpected table %q", b.String())
+	}
+
+	if err := PrintResolve(&b, o, "liquor-store.marathon-0.6.0.mesos", "BOGUS"); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
@@ -0,0 +1,53 @@
+package resolver
+
+import (
+	"math"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// formatLOC returns the LOC resource record for loc, with the default
+// size (1m) and precision (10km horizontal, 10m vertical) of RFC 1876
+func (res *Resolver) formatLOC(rs *records.RecordGenerator, name string, loc records.Location) *dns.LOC {
+	return &dns.LOC{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeLOC,
+			Class:  dns.ClassINET,
+			Ttl:    res.ttl(rs, name),
+		},
+		Size:      0x12,
+		HorizPre:  0x16,
+		VertPre:   0x13,
+		Latitude:  uint32(dns.LOC_EQUATOR + int64(math.Round(loc.Latitude*dns.LOC_DEGREES))),
+		Longitude: uint32(dns.LOC_PRIMEMERIDIAN + int64(math.Round(loc.Longitude*dns.LOC_DEGREES))),
+		Altitude:  uint32(math.Round((loc.Altitude + dns.LOC_ALTITUDEBASE) * 100)),
+	}
+}
+
+// locationOf returns the location of the LOC record rr, as formatLOC
+// made it
+func locationOf(rr *dns.LOC) records.Location {
+	return records.Location{
+		Latitude:  float64(int64(rr.Latitude)-dns.LOC_EQUATOR) / dns.LOC_DEGREES,
+		Longitude: float64(int64(rr.Longitude)-dns.LOC_PRIMEMERIDIAN) / dns.LOC_DEGREES,
+		Altitude:  float64(rr.Altitude)/100 - dns.LOC_ALTITUDEBASE,
+	}
+}
+
+// locRecords returns the LOC records of the slaves the A records of dom
+// in rs point at, one for each location, named name
+func (res *Resolver) locRecords(rs *records.RecordGenerator, name string, dom string) []dns.RR {
+	var rrs []dns.RR
+	seen := make(map[records.Location]bool)
+	for _, host := range rs.As[dom] {
+		loc, ok := rs.Location(host)
+		if !ok || seen[loc] {
+			continue
+		}
+		seen[loc] = true
+		rrs = append(rrs, res.formatLOC(rs, name, loc))
+	}
+	return rrs
+}
@@ -0,0 +1,57 @@
+package resolver
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestLOC(t *testing.T) {
+	var sj records.StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1", "attributes": {"lat": 52.37, "lon": "4.89", "alt": 2}},
+			{"id": "s2", "hostname": "10.0.0.2", "attributes": {"lat": 52.37, "lon": 4.89, "alt": 2}},
+			{"id": "s3", "hostname": "10.0.0.3", "attributes": {"lat": -33.8688, "lon": 151.2093}},
+			{"id": "s4", "hostname": "10.0.0.4", "attributes": {"lat": 95, "lon": 0}},
+			{"id": "s5", "hostname": "10.0.0.5"}
+		],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING"},
+			{"name": "web", "slave_id": "s2", "state": "TASK_RUNNING"},
+			{"name": "db", "slave_id": "s3", "state": "TASK_RUNNING"},
+			{"name": "bad", "slave_id": "s4", "state": "TASK_RUNNING"},
+			{"name": "none", "slave_id": "s5", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := records.Config{Domain: "mesos", TTL: 60, LOCAttributes: []string{"lat", "lon", "alt"}}
+	res := New(config)
+	res.rs.InsertState(sj, config)
+
+	var tests = []struct {
+		name string
+		locs []string
+	}{
+		// one record for the two slaves at the same place
+		{"web.marathon.mesos.", []string{"52 22 12.000 N 04 53 24.000 E 2m 1m 10000m 10m"}},
+		{"db.marathon.mesos.", []string{"33 52 7.680 S 151 12 33.480 E 0m 1m 10000m 10m"}},
+		{"bad.marathon.mesos.", nil},
+		{"none.marathon.mesos.", nil},
+	}
+
+	for _, tt := range tests {
+		var locs []string
+		for _, rr := range res.locRecords(&res.rs, tt.name, tt.name) {
+			locs = append(locs, rr.(*dns.LOC).String()[len(rr.Header().String()):])
+		}
+		if len(locs) != len(tt.locs) || (len(locs) > 0 && locs[0] != tt.locs[0]) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.locs, locs)
+		}
+	}
+}
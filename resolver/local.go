@@ -0,0 +1,175 @@
+package resolver
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// rootServers holds the root hints served for priming queries of "."
+var rootServers = [][2]string{
+	{"a.root-servers.net.", "198.41.0.4"},
+	{"b.root-servers.net.", "170.247.170.2"},
+	{"c.root-servers.net.", "192.33.4.12"},
+	{"d.root-servers.net.", "199.7.91.13"},
+	{"e.root-servers.net.", "192.203.230.10"},
+	{"f.root-servers.net.", "192.5.5.241"},
+	{"g.root-servers.net.", "192.112.36.4"},
+	{"h.root-servers.net.", "198.97.190.53"},
+	{"i.root-servers.net.", "192.36.148.17"},
+	{"j.root-servers.net.", "192.58.128.30"},
+	{"k.root-servers.net.", "193.0.14.129"},
+	{"l.root-servers.net.", "199.7.83.42"},
+	{"m.root-servers.net.", "202.12.27.33"},
+}
+
+// loopbackPTRs are the names in the local zones that map back to localhost
+var loopbackPTRs = map[string]bool{
+	"1.0.0.127.in-addr.arpa.": true,
+	"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.": true,
+}
+
+// localZones are the RFC 6303 locally served reverse zones plus the
+// RFC 6761 localhost zone
+var localZones = []string{
+	"localhost.",
+	"0.in-addr.arpa.",
+	"127.in-addr.arpa.",
+	"254.169.in-addr.arpa.",
+	"10.in-addr.arpa.",
+	"16.172.in-addr.arpa.",
+	"17.172.in-addr.arpa.",
+	"18.172.in-addr.arpa.",
+	"19.172.in-addr.arpa.",
+	"20.172.in-addr.arpa.",
+	"21.172.in-addr.arpa.",
+	"22.172.in-addr.arpa.",
+	"23.172.in-addr.arpa.",
+	"24.172.in-addr.arpa.",
+	"25.172.in-addr.arpa.",
+	"26.172.in-addr.arpa.",
+	"27.172.in-addr.arpa.",
+	"28.172.in-addr.arpa.",
+	"29.172.in-addr.arpa.",
+	"30.172.in-addr.arpa.",
+	"31.172.in-addr.arpa.",
+	"168.192.in-addr.arpa.",
+	"2.0.192.in-addr.arpa.",
+	"100.51.198.in-addr.arpa.",
+	"113.0.203.in-addr.arpa.",
+	"255.255.255.255.in-addr.arpa.",
+	"0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.",
+	"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.",
+	"d.f.ip6.arpa.",
+	"8.e.f.ip6.arpa.",
+	"9.e.f.ip6.arpa.",
+	"a.e.f.ip6.arpa.",
+	"b.e.f.ip6.arpa.",
+	"8.b.d.0.1.0.0.2.ip6.arpa.",
+}
+
+// localZone returns the locally served zone name belongs to
+func localZone(name string) (string, bool) {
+	for _, z := range localZones {
+		if dns.IsSubDomain(z, name) {
+			return z, true
+		}
+	}
+
+	return "", false
+}
+
+// localSOA returns the SOA resource record for a locally served zone
+func localSOA(zone string) *dns.SOA {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    10800,
+		},
+		Ns:      zone,
+		Mbox:    "nobody.invalid.",
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   1200,
+		Expire:  604800,
+		Minttl:  10800,
+	}
+}
+
+// localAnswer answers queries for the root and the locally served zones
+// without going upstream - it returns nil if the question should be
+// forwarded
+func (res *Resolver) localAnswer(r *dns.Msg) *dns.Msg {
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.RecursionAvailable = res.config().RecurseOn
+
+	if name == "." {
+		if q.Qtype != dns.TypeNS {
+			return nil
+		}
+
+		for _, hint := range rootServers {
+			ns, ip := hint[0], hint[1]
+			m.Answer = append(m.Answer, &dns.NS{
+				Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 518400},
+				Ns:  ns,
+			})
+			m.Extra = append(m.Extra, &dns.A{
+				Hdr: dns.RR_Header{Name: ns, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 518400},
+				A:   net.ParseIP(ip).To4(),
+			})
+		}
+
+		// not authoritative for the root - these are hints
+		m.Authoritative = false
+		return m
+	}
+
+	zone, ok := localZone(name)
+	if !ok {
+		return nil
+	}
+
+	hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: 10800}
+
+	switch {
+	case zone == "localhost.":
+		switch q.Qtype {
+		case dns.TypeA, dns.TypeANY:
+			hdr.Rrtype = dns.TypeA
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.IPv4(127, 0, 0, 1).To4()})
+		case dns.TypeAAAA:
+			hdr.Rrtype = dns.TypeAAAA
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: net.IPv6loopback})
+		}
+	case loopbackPTRs[name]:
+		if q.Qtype == dns.TypePTR || q.Qtype == dns.TypeANY {
+			hdr.Rrtype = dns.TypePTR
+			m.Answer = append(m.Answer, &dns.PTR{Hdr: hdr, Ptr: "localhost."})
+		}
+	case name == zone && q.Qtype == dns.TypeSOA:
+		m.Answer = append(m.Answer, localSOA(zone))
+	case name == zone && q.Qtype == dns.TypeNS:
+		hdr.Rrtype = dns.TypeNS
+		m.Answer = append(m.Answer, &dns.NS{Hdr: hdr, Ns: zone})
+	}
+
+	if len(m.Answer) == 0 {
+		// the zone apexes, the localhost names and the loopback PTRs
+		// exist, everything else in the local zones does not
+		if name != zone && zone != "localhost." && !loopbackPTRs[name] {
+			m.SetRcode(r, dns.RcodeNameError)
+		}
+		m.Ns = append(m.Ns, localSOA(zone))
+	}
+
+	return m
+}
@@ -0,0 +1,52 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestLocalAnswer(t *testing.T) {
+	var res Resolver
+
+	var tests = []struct {
+		name    string
+		qtype   uint16
+		local   bool
+		rcode   int
+		answers int
+	}{
+		{".", dns.TypeNS, true, dns.RcodeSuccess, 13},
+		{".", dns.TypeSOA, false, 0, 0},
+		{"localhost.", dns.TypeA, true, dns.RcodeSuccess, 1},
+		{"foo.localhost.", dns.TypeAAAA, true, dns.RcodeSuccess, 1},
+		{"1.0.0.127.in-addr.arpa.", dns.TypePTR, true, dns.RcodeSuccess, 1},
+		{"1.0.0.127.in-addr.arpa.", dns.TypeA, true, dns.RcodeSuccess, 0},
+		{"4.3.2.10.in-addr.arpa.", dns.TypePTR, true, dns.RcodeNameError, 0},
+		{"168.192.in-addr.arpa.", dns.TypeSOA, true, dns.RcodeSuccess, 1},
+		{"8.8.8.8.in-addr.arpa.", dns.TypePTR, false, 0, 0},
+		{"google.com.", dns.TypeA, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(tt.name, tt.qtype)
+
+		m := res.localAnswer(r)
+		if (m != nil) != tt.local {
+			t.Errorf("%s %s: expected local %v", tt.name, dns.TypeToString[tt.qtype], tt.local)
+			continue
+		}
+		if m == nil {
+			continue
+		}
+
+		if m.Rcode != tt.rcode {
+			t.Errorf("%s %s: expected rcode %d got %d", tt.name, dns.TypeToString[tt.qtype], tt.rcode, m.Rcode)
+		}
+
+		if len(m.Answer) != tt.answers {
+			t.Errorf("%s %s: expected %d answers got %d", tt.name, dns.TypeToString[tt.qtype], tt.answers, len(m.Answer))
+		}
+	}
+}
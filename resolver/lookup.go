@@ -0,0 +1,204 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// maxLookups is the most queries a single /v1/lookup request may carry
+const maxLookups = 1000
+
+// lookupQuery is a name and record type to look up, type defaults to A
+type lookupQuery struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// lookupRequest is the body of /v1/lookup requests
+type lookupRequest struct {
+	Queries []lookupQuery `json:"queries"`
+}
+
+// lookupRecord is a record of an answer, data is its rdata in zone file
+// format
+type lookupRecord struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  uint32 `json:"ttl"`
+	Data string `json:"data"`
+}
+
+// lookupAnswer is the answer to one lookupQuery
+type lookupAnswer struct {
+	Name    string         `json:"name"`
+	Type    string         `json:"type"`
+	Rcode   string         `json:"rcode"`
+	Records []lookupRecord `json:"records"`
+}
+
+// lookupResponse holds the answers in the order of the queries
+type lookupResponse struct {
+	Answers []lookupAnswer `json:"answers"`
+}
+
+// handleLookup answers a batch of queries for names in the mesos domain,
+// as the DNS server would answer the client - a name with * labels is a
+// pattern that stands for every name it matches the client may query,
+// with the admin token only as it walks the zone like a transfer
+func (res *Resolver) handleLookup(w http.ResponseWriter, r *http.Request) {
+	if !only("POST", w, r) {
+		return
+	}
+
+	var req lookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+	if len(req.Queries) == 0 || len(req.Queries) > maxLookups {
+		writeError(w, http.StatusBadRequest, errInvalidRequest,
+			"queries must hold 1 to "+strconv.Itoa(maxLookups)+" queries", "")
+		return
+	}
+
+	client := &net.TCPAddr{}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client.IP = net.ParseIP(host)
+	}
+	if !res.queryAllowed(&lookupWriter{remote: client}) {
+		logging.CurLog.QueryACLRefused += 1
+		writeError(w, http.StatusForbidden, errForbidden, "client may not query", "it is not in allowquery")
+		return
+	}
+
+	var msgs []*dns.Msg
+	authorized := false
+	for i, q := range req.Queries {
+		m, err := lookupMsg(q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errInvalidRequest, err.Error(), "query "+strconv.Itoa(i))
+			return
+		}
+		if !wildcard(m.Question[0].Name) {
+			msgs = append(msgs, m)
+			continue
+		}
+
+		if !authorized && !res.authorized(w, r) {
+			return
+		}
+		authorized = true
+
+		for _, name := range res.matchNames(m.Question[0].Name) {
+			// names in role subzones the client may not query
+			if !res.roleAllowed(&lookupWriter{remote: client}, name) {
+				continue
+			}
+			each := m.Copy()
+			each.Question[0].Name = name
+			msgs = append(msgs, each)
+		}
+	}
+	if len(msgs) > maxLookups {
+		writeError(w, http.StatusBadRequest, errInvalidRequest,
+			"queries match more than "+strconv.Itoa(maxLookups)+" names", "")
+		return
+	}
+
+	answers := make([]lookupAnswer, len(msgs))
+	for i, m := range msgs {
+		answers[i] = res.lookup(client, m)
+	}
+	writeJSON(w, http.StatusOK, lookupResponse{Answers: answers})
+}
+
+// wildcard reports whether name has * labels
+func wildcard(name string) bool {
+	for _, label := range dns.SplitDomainName(name) {
+		if label == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupMsg returns the DNS query for q
+func lookupMsg(q lookupQuery) (*dns.Msg, error) {
+	if _, ok := dns.IsDomainName(q.Name); !ok || q.Name == "" {
+		return nil, errors.New("invalid name " + strconv.Quote(q.Name))
+	}
+
+	qtype := dns.TypeA
+	if q.Type != "" {
+		t, ok := dns.StringToType[strings.ToUpper(q.Type)]
+		if !ok || t == dns.TypeAXFR || t == dns.TypeIXFR {
+			return nil, errors.New("invalid type " + strconv.Quote(q.Type))
+		}
+		qtype = t
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(strings.ToLower(q.Name)), qtype)
+	return m, nil
+}
+
+// lookup answers the query m from client, names outside the mesos
+// domain are refused rather than forwarded
+func (res *Resolver) lookup(client net.Addr, m *dns.Msg) lookupAnswer {
+	q := m.Question[0]
+	lw := &lookupWriter{remote: client}
+
+	if dns.IsSubDomain(res.zone(), q.Name) {
+		res.HandleMesos(lw, m)
+	}
+
+	ans := lookupAnswer{
+		Name:    q.Name,
+		Type:    dns.TypeToString[q.Qtype],
+		Rcode:   dns.RcodeToString[dns.RcodeRefused],
+		Records: []lookupRecord{},
+	}
+	if lw.msg == nil {
+		return ans
+	}
+
+	ans.Rcode = dns.RcodeToString[lw.msg.Rcode]
+	for _, rr := range lw.msg.Answer {
+		h := rr.Header()
+		ans.Records = append(ans.Records, lookupRecord{
+			Name: h.Name,
+			Type: dns.TypeToString[h.Rrtype],
+			TTL:  h.Ttl,
+			Data: strings.TrimPrefix(rr.String(), h.String()),
+		})
+	}
+	return ans
+}
+
+// lookupWriter keeps the response to a query made through the API
+type lookupWriter struct {
+	dns.ResponseWriter
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (w *lookupWriter) RemoteAddr() net.Addr {
+	return w.remote
+}
+
+func (w *lookupWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *lookupWriter) Write(b []byte) (int, error) {
+	w.msg = new(dns.Msg)
+	return len(b), w.msg.Unpack(b)
+}
@@ -0,0 +1,122 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLookupAPI(t *testing.T) {
+	res := acmeDNS(t)
+	h := res.httpHandler()
+
+	body := `{"queries": [
+		{"name": "chronos.marathon-0.6.0.mesos"},
+		{"name": "_liquor-store._tcp.marathon-0.6.0.mesos.", "type": "srv"},
+		{"name": "missing.mesos", "type": "A"},
+		{"name": "google.com"}
+	]}`
+	rec := apiRequest(h, "POST", "/v1/lookup", "", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp lookupResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name    string
+		qtype   string
+		rcode   string
+		records int
+	}{
+		{"chronos.marathon-0.6.0.mesos.", "A", "NOERROR", 1},
+		{"_liquor-store._tcp.marathon-0.6.0.mesos.", "SRV", "NOERROR", 3},
+		{"missing.mesos.", "A", "NXDOMAIN", 0},
+		{"google.com.", "A", "REFUSED", 0},
+	}
+
+	if len(resp.Answers) != len(tests) {
+		t.Fatalf("expected %d answers, got %+v", len(tests), resp.Answers)
+	}
+	for i, tt := range tests {
+		ans := resp.Answers[i]
+		if ans.Name != tt.name || ans.Type != tt.qtype || ans.Rcode != tt.rcode || len(ans.Records) != tt.records {
+			t.Errorf("%s %s: expected %s with %d records, got %+v", tt.name, tt.qtype, tt.rcode, tt.records, ans)
+		}
+	}
+	if data := resp.Answers[0].Records[0].Data; data != "1.2.3.4" {
+		t.Errorf("expected the address as data, got %q", data)
+	}
+
+	var errors = []string{
+		`not json`,
+		`{"queries": []}`,
+		`{"queries": [{"name": ""}]}`,
+		`{"queries": [{"name": "a.mesos", "type": "AXFR"}]}`,
+		`{"queries": [{"name": "a.mesos", "type": "BOGUS"}]}`,
+		`{"queries": [` + strings.Repeat(`{"name": "a.mesos"},`, maxLookups) + `{"name": "a.mesos"}]}`,
+	}
+	for _, body := range errors {
+		if rec := apiRequest(h, "POST", "/v1/lookup", "", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%.40s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	if rec := apiRequest(h, "GET", "/v1/lookup", "", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestLookupPatterns(t *testing.T) {
+	res := acmeDNS(t)
+	res.Config.AdminToken = "secret"
+	h := res.httpHandler()
+
+	body := `{"queries": [{"name": "*.marathon-0.6.0.mesos"}]}`
+	if rec := apiRequest(h, "POST", "/v1/lookup", "", body); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected patterns to need the admin token, got %d", rec.Code)
+	}
+
+	lookup := func() []lookupAnswer {
+		rec := apiRequest(h, "POST", "/v1/lookup", "secret", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var resp lookupResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Answers
+	}
+	if answers := lookup(); len(answers) == 0 {
+		t.Fatal("expected the pattern to match names")
+	}
+
+	// the test client isn't in the role's networks
+	res.Config.RoleZones = true
+	res.Config.RoleACLs = map[string][]string{"marathon-0.6.0": {"10.1.0.0/16"}}
+	if answers := lookup(); len(answers) != 0 {
+		t.Errorf("expected no names of a refused role, got %+v", answers)
+	}
+}
+
+func TestLookupACL(t *testing.T) {
+	res := acmeDNS(t)
+	h := res.httpHandler()
+	body := `{"queries": [{"name": "chronos.marathon-0.6.0.mesos"}]}`
+
+	// the test client is 192.0.2.1
+	res.Config.AllowQuery = []string{"10.0.0.0/8"}
+	if rec := apiRequest(h, "POST", "/v1/lookup", "", body); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 outside allowquery, got %d", rec.Code)
+	}
+
+	res.Config.AllowQuery = []string{"192.0.2.0/24"}
+	if rec := apiRequest(h, "POST", "/v1/lookup", "", body); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 inside allowquery, got %d", rec.Code)
+	}
+}
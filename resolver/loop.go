@@ -0,0 +1,151 @@
+package resolver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// loopDetector finds resolvers that forward our queries back to us by
+// sending each one a probe for a random name - if a probe comes back to
+// this instance the resolver is part of a forwarding loop
+// a nil *loopDetector detects nothing
+type loopDetector struct {
+	sync.Mutex
+	probes  map[string]string
+	looping map[string]bool
+
+	// found holds the resolvers caught by the current round of probes,
+	// which replaces looping once all of its probes are back
+	found map[string]bool
+	round int
+}
+
+func newLoopDetector() *loopDetector {
+	return &loopDetector{
+		probes:  make(map[string]string),
+		looping: make(map[string]bool),
+		found:   make(map[string]bool),
+	}
+}
+
+// probe returns a fresh probe name for resolver
+func (l *loopDetector) probe(resolver string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	name := hex.EncodeToString(b) + ".mesos-dns-loop.invalid."
+
+	l.Lock()
+	l.probes[name] = resolver
+	l.Unlock()
+
+	return name
+}
+
+// caught reports whether name is one of our probes and marks the
+// resolver it was sent to as looping
+func (l *loopDetector) caught(name string) bool {
+	if l == nil {
+		return false
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	resolver, ok := l.probes[strings.ToLower(name)]
+	if ok {
+		l.looping[resolver] = true
+		l.found[resolver] = true
+	}
+
+	return ok
+}
+
+// isLooping reports whether resolver forwards back to us
+func (l *loopDetector) isLooping(resolver string) bool {
+	if l == nil {
+		return false
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	return l.looping[resolver]
+}
+
+// done forgets the probe name once its answer is back or timed out
+func (l *loopDetector) done(name string) {
+	l.Lock()
+	delete(l.probes, name)
+	l.Unlock()
+}
+
+// start begins a round of probes and returns its number - the results
+// of the last round stand until this one finishes
+func (l *loopDetector) start() int {
+	l.Lock()
+	defer l.Unlock()
+
+	l.round++
+	l.found = make(map[string]bool)
+	return l.round
+}
+
+// finish makes the results of round the current ones, unless a later
+// round has started since
+func (l *loopDetector) finish(round int) {
+	l.Lock()
+	defer l.Unlock()
+
+	if round == l.round {
+		l.looping = l.found
+		l.found = make(map[string]bool)
+	}
+}
+
+// DetectLoops probes every resolver for forwarding loops - a resolver
+// whose probe comes back is skipped until a round of probes finds it
+// doesn't loop anymore
+func (res *Resolver) DetectLoops() {
+	if res.loops == nil {
+		return
+	}
+
+	round := res.loops.start()
+
+	var wg sync.WaitGroup
+	for _, resolver := range res.config().Resolvers {
+		name := res.loops.probe(resolver)
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeHINFO)
+
+		wg.Add(1)
+		go func(m *dns.Msg, resolver string, name string) {
+			defer wg.Done()
+
+			// the answer doesn't matter, only whether the probe reaches us
+			res.resolveOut(m, resolver+":53", "udp", 0)
+			res.loops.done(name)
+		}(m, resolver, name)
+	}
+
+	go func() {
+		wg.Wait()
+		res.loops.finish(round)
+	}()
+}
+
+// loopMsg answers a probe that came back to us with SERVFAIL so the
+// loop ends here
+func (res *Resolver) loopMsg(r *dns.Msg) *dns.Msg {
+	logging.CurLog.NonMesosLoops += 1
+	logging.Error.Println("forwarding loop detected: " + r.Question[0].Name + " came back to us")
+
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeServerFailure)
+	return m
+}
@@ -0,0 +1,52 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestLoopDetection(t *testing.T) {
+	res := New(records.Config{
+		RecurseOn: true,
+		Resolvers: []string{"10.0.0.1", "10.0.0.2"},
+	})
+
+	round := res.loops.start()
+	name := res.loops.probe("10.0.0.2")
+
+	// the probe comes back to us
+	r := new(dns.Msg)
+	r.SetQuestion(name, dns.TypeHINFO)
+	w := &fakeWriter{}
+	res.HandleNonMesos(w, r)
+
+	if w.msg.Rcode != dns.RcodeServerFailure {
+		t.Error("should break the loop with SERVFAIL")
+	}
+
+	if !res.loops.isLooping("10.0.0.2") || res.loops.isLooping("10.0.0.1") {
+		t.Error("should only mark the probed resolver as looping")
+	}
+
+	resolvers := res.resolvers()
+	if len(resolvers) != 1 || resolvers[0] != "10.0.0.1" {
+		t.Error("should skip looping resolvers, got", resolvers)
+	}
+
+	res.loops.finish(round)
+	if !res.loops.isLooping("10.0.0.2") {
+		t.Error("should keep the loops the round found")
+	}
+
+	// the results stand until the next round is done
+	round = res.loops.start()
+	if !res.loops.isLooping("10.0.0.2") {
+		t.Error("should keep the loops of the last round while probing")
+	}
+	res.loops.finish(round)
+	if len(res.resolvers()) != 2 {
+		t.Error("should forget loops the last round didn't find")
+	}
+}
@@ -0,0 +1,32 @@
+package resolver
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// metadata returns the TXT records at the zone apex that tell which
+// cluster, version and records we serve, as key=value pairs
+func (res *Resolver) metadata(name string) []dns.RR {
+	config := res.config()
+	values := []string{
+		"version=" + res.Version,
+		"serial=" + strconv.FormatUint(uint64(atomic.LoadUint32(&res.serial)), 10),
+	}
+	if config.ClusterName != "" {
+		values = append([]string{"cluster=" + config.ClusterName}, values...)
+	}
+	if fetched := atomic.LoadInt64(&res.fetched); fetched != 0 {
+		values = append(values, "generated="+time.Unix(0, fetched).UTC().Format(time.RFC3339))
+	}
+
+	var rrs []dns.RR
+	for _, v := range values {
+		rr, _ := res.formatTXT(name, v)
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
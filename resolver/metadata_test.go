@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestZoneMetadata(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Version = "0.1"
+	res.Config.ClusterName = "prod"
+	res.bumpSerial()
+	res.fetched = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC).UnixNano()
+
+	query := func() []string {
+		r := new(dns.Msg)
+		r.SetQuestion("mesos.", dns.TypeTXT)
+		w := &fakeWriter{}
+		res.HandleMesos(w, r)
+
+		var txts []string
+		for _, rr := range w.msg.Answer {
+			txts = append(txts, rr.(*dns.TXT).Txt...)
+		}
+		sort.Strings(txts)
+		return txts
+	}
+
+	if txts := query(); len(txts) != 0 {
+		t.Errorf("metadata should be off, got %v", txts)
+	}
+
+	res.Config.ZoneMetadata = true
+	expected := []string{
+		"cluster=prod",
+		"generated=2015-06-01T12:00:00Z",
+		"serial=" + strconv.FormatUint(uint64(res.serial), 10),
+		"version=0.1",
+	}
+	if txts := query(); !reflect.DeepEqual(txts, expected) {
+		t.Errorf("expected %v, got %v", expected, txts)
+	}
+}
@@ -0,0 +1,75 @@
+package resolver
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// minimize resolves r by following the referral to the nameserver for
+// zone, asking each nameserver only for the NS records of the next label
+// below the zone it serves until it is down to the full name (RFC 7816),
+// so servers on the way don't learn names they have no need for
+// it follows at most cnt more referrals and falls back to asking for the
+// full name when a nameserver can't answer minimized queries
+func (res *Resolver) minimize(r *dns.Msg, zone string, nameserver string, proto string, cnt int) (*dns.Msg, error) {
+	qname := r.Question[0].Name
+	labels := dns.SplitDomainName(qname)
+
+	for {
+		n := dns.CountLabel(zone) + 1
+		if n >= len(labels) || !dns.IsSubDomain(zone, qname) {
+			return res.resolveOut(r, nameserver, proto, cnt)
+		}
+		child := strings.Join(labels[len(labels)-n:], ".") + "."
+
+		q := r.Copy()
+		q.Id = dns.Id()
+		q.Question = []dns.Question{{Name: child, Qtype: dns.TypeNS, Qclass: r.Question[0].Qclass}}
+
+		in, err := res.exchange(q, nameserver, proto)
+		if err != nil {
+			return res.resolveOut(r, nameserver, proto, cnt)
+		}
+		logging.CurLog.NonMesosMinimized += 1
+
+		switch ns := referral(in); {
+		case ns != "":
+			if cnt <= 0 {
+				logging.CurLog.NonMesosHopLimit += 1
+				return nil, errors.New("too many referrals resolving " + qname)
+			}
+
+			logging.CurLog.NonMesosRecursed += 1
+			zone, nameserver, cnt = referralZone(in), ns, cnt-1
+
+		// nothing exists below a name that doesn't exist
+		case in.Rcode == dns.RcodeNameError:
+			m := in.Copy()
+			m.Id = r.Id
+			m.Question = r.Question
+			m.Answer = nil
+			return m, nil
+
+		// no zone cut, the same nameserver serves the child
+		case in.Rcode == dns.RcodeSuccess:
+			zone = child
+
+		default:
+			return res.resolveOut(r, nameserver, proto, cnt)
+		}
+	}
+}
+
+// referralZone returns the zone a referral delegates to, the owner of its
+// NS records
+func referralZone(in *dns.Msg) string {
+	for _, rr := range in.Ns {
+		if ns, ok := rr.(*dns.NS); ok {
+			return ns.Hdr.Name
+		}
+	}
+	return "."
+}
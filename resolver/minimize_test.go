@@ -0,0 +1,111 @@
+package resolver
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// fakeAuthority serves an authoritative zone for the parents of
+// www.example.com., recording the names it is asked for
+func fakeAuthority(t *testing.T, nxdomain string) (string, func() []string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var asked []string
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		name := r.Question[0].Name
+		mu.Lock()
+		asked = append(asked, name)
+		mu.Unlock()
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		switch {
+		case name == nxdomain:
+			m.Rcode = dns.RcodeNameError
+		case name == "www.example.com.":
+			rr, _ := dns.NewRR("www.example.com. 60 IN A 192.0.2.1")
+			m.Answer = []dns.RR{rr}
+		}
+		w.WriteMsg(m)
+	})
+
+	server := &dns.Server{PacketConn: pc, Handler: handler}
+	go server.ActivateAndServe()
+
+	names := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), asked...)
+	}
+	return pc.LocalAddr().String(), names, func() { server.Shutdown() }
+}
+
+func TestMinimize(t *testing.T) {
+	res := &Resolver{Config: records.Config{Timeout: 1}}
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.com.", dns.TypeA)
+
+	addr, asked, stop := fakeAuthority(t, "")
+	defer stop()
+
+	m, err := res.minimize(r, ".", addr, "udp", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Id != r.Id || len(m.Answer) != 1 {
+		t.Errorf("expected the answer for the full name, got %v", m)
+	}
+
+	expected := []string{"com.", "example.com.", "www.example.com."}
+	if !reflect.DeepEqual(asked(), expected) {
+		t.Errorf("expected queries for %v, got %v", expected, asked())
+	}
+}
+
+func TestMinimizeNXDomain(t *testing.T) {
+	res := &Resolver{Config: records.Config{Timeout: 1}}
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.com.", dns.TypeA)
+
+	addr, asked, stop := fakeAuthority(t, "example.com.")
+	defer stop()
+
+	m, err := res.minimize(r, ".", addr, "udp", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Rcode != dns.RcodeNameError || m.Question[0].Name != "www.example.com." {
+		t.Errorf("expected NXDOMAIN for the full name, got %v", m)
+	}
+
+	expected := []string{"com.", "example.com."}
+	if !reflect.DeepEqual(asked(), expected) {
+		t.Errorf("the full name should not be sent, got queries for %v", asked())
+	}
+}
+
+func TestReferralZone(t *testing.T) {
+	in := new(dns.Msg)
+	if referralZone(in) != "." {
+		t.Error("expected the root without NS records")
+	}
+
+	ns, _ := dns.NewRR("example.com. 60 IN NS ns1.example.com.")
+	in.Ns = []dns.RR{ns}
+	if referralZone(in) != "example.com." {
+		t.Error("expected the delegated zone")
+	}
+}
@@ -0,0 +1,109 @@
+package resolver
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// nameTree holds the names of the zone by their labels from the root, so
+// finding names by suffix or pattern does not scan every name
+type nameTree struct {
+	children map[string]*nameTree
+
+	// owner is set if records are owned by the name ending here, it is an
+	// empty non-terminal otherwise
+	owner bool
+}
+
+// newNameTree returns the tree of the names with records in rs
+func newNameTree(rs *records.RecordGenerator) *nameTree {
+	t := &nameTree{}
+	for _, set := range []map[string][]string{rs.As, rs.SRVs, rs.TXTs, rs.CNAMEs, rs.TLSAs, rs.SSHFPs, rs.URIs} {
+		for name := range set {
+			t.insert(name)
+		}
+	}
+	return t
+}
+
+// insert adds name, which must be lower case
+func (t *nameTree) insert(name string) {
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - 1; i >= 0; i-- {
+		next, ok := t.children[labels[i]]
+		if !ok {
+			if t.children == nil {
+				t.children = make(map[string]*nameTree)
+			}
+			next = &nameTree{}
+			t.children[labels[i]] = next
+		}
+		t = next
+	}
+	t.owner = true
+}
+
+// exists reports whether name owns records or has names below it
+func (t *nameTree) exists(name string) bool {
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - 1; i >= 0; i-- {
+		next, ok := t.children[labels[i]]
+		if !ok {
+			return false
+		}
+		t = next
+	}
+	return true
+}
+
+// match returns the names with records that match pattern, where a *
+// label matches any one label, in order
+func (t *nameTree) match(pattern string) []string {
+	labels := dns.SplitDomainName(strings.ToLower(pattern))
+
+	var names []string
+	var walk func(t *nameTree, i int, suffix string)
+	walk = func(t *nameTree, i int, suffix string) {
+		if i < 0 {
+			if t.owner {
+				names = append(names, suffix)
+			}
+			return
+		}
+
+		if labels[i] != "*" {
+			if next, ok := t.children[labels[i]]; ok {
+				walk(next, i-1, labels[i]+"."+suffix)
+			}
+			return
+		}
+		for label, next := range t.children {
+			walk(next, i-1, label+"."+suffix)
+		}
+	}
+	walk(t, len(labels)-1, "")
+
+	sort.Strings(names)
+	return names
+}
+
+// tree returns the names of the served records, it must be called with
+// the records locked
+func (res *Resolver) tree() *nameTree {
+	if res.names == nil {
+		// records that were never published
+		return newNameTree(&res.rs)
+	}
+	return res.names
+}
+
+// matchNames returns the names with records that match pattern
+func (res *Resolver) matchNames(pattern string) []string {
+	res.rsLock.RLock()
+	defer res.rsLock.RUnlock()
+
+	return res.tree().match(pattern)
+}
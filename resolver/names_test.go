@@ -0,0 +1,123 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestNameTree(t *testing.T) {
+	tree := &nameTree{}
+	for _, name := range []string{"web.marathon.mesos.", "_web._tcp.marathon.mesos.", "db.marathon.mesos.", "job.chronos.mesos."} {
+		tree.insert(name)
+	}
+
+	var exists = []struct {
+		name   string
+		exists bool
+	}{
+		{"web.marathon.mesos.", true},
+		{"marathon.mesos.", true},
+		{"_tcp.marathon.mesos.", true},
+		{"mesos.", true},
+		{"api.marathon.mesos.", false},
+		{"web.marathon.mesos.example.", false},
+		{"eb.marathon.mesos.", false},
+	}
+	for _, tt := range exists {
+		if got := tree.exists(tt.name); got != tt.exists {
+			t.Errorf("%s: expected exists %v, got %v", tt.name, tt.exists, got)
+		}
+	}
+
+	var matches = []struct {
+		pattern string
+		names   []string
+	}{
+		{"*.marathon.mesos.", []string{"db.marathon.mesos.", "web.marathon.mesos."}},
+		{"*.*.mesos.", []string{"db.marathon.mesos.", "job.chronos.mesos.", "web.marathon.mesos."}},
+		{"_web.*.marathon.mesos.", []string{"_web._tcp.marathon.mesos."}},
+		{"Web.*.Mesos.", []string{"web.marathon.mesos."}},
+		{"*.mesos.", nil},
+		{"*.other.", nil},
+	}
+	for _, tt := range matches {
+		if got := tree.match(tt.pattern); !reflect.DeepEqual(got, tt.names) {
+			t.Errorf("%s: expected %v, got %v", tt.pattern, tt.names, got)
+		}
+	}
+}
+
+// bigDNS returns a resolver serving n tasks on 1000 slaves
+func bigDNS(b *testing.B, n int) *Resolver {
+	var slaves, tasks []string
+	for i := 0; i < 1000; i++ {
+		ip := net.IPv4(10, 0, byte(i/256), byte(i%256)).String()
+		slaves = append(slaves, `{"id": "s`+strconv.Itoa(i)+`", "hostname": "`+ip+`"}`)
+	}
+	for i := 0; i < n; i++ {
+		app := "app" + strconv.Itoa(i/4)
+		tasks = append(tasks, `{"id": "`+app+`.`+strconv.Itoa(i)+`", "name": "`+app+`", "slave_id": "s`+
+			strconv.Itoa(i%1000)+`", "state": "TASK_RUNNING", "resources": {"ports": "[31000-31000]"}}`)
+	}
+
+	var sj records.StateJSON
+	err := json.Unmarshal([]byte(`{"slaves": [`+strings.Join(slaves, ",")+`], "frameworks": [{"name": "marathon", "tasks": [`+
+		strings.Join(tasks, ",")+`]}]}`), &sj)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	config := records.Config{Domain: "mesos", TTL: 60, SOAMinttl: 60, Mname: "ns1.mesos.", Email: "root.mesos.", Listener: "10.1.0.1"}
+	res := New(config)
+	res.base.InsertState(sj, config)
+	res.rsLock.Lock()
+	res.publish()
+	res.rsLock.Unlock()
+	return res
+}
+
+func benchmarkQuery(b *testing.B, name string, qtype uint16) {
+	res := bigDNS(b, 50000)
+	w := &fakeWriter{}
+	r := new(dns.Msg)
+	r.SetQuestion(name, qtype)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res.HandleMesos(w, r)
+	}
+}
+
+func BenchmarkHandleMesosA(b *testing.B) {
+	benchmarkQuery(b, "app1234.marathon.mesos.", dns.TypeA)
+}
+
+func BenchmarkHandleMesosSRV(b *testing.B) {
+	benchmarkQuery(b, "_app1234._tcp.marathon.mesos.", dns.TypeSRV)
+}
+
+func BenchmarkHandleMesosNXDomain(b *testing.B) {
+	benchmarkQuery(b, "missing.marathon.mesos.", dns.TypeA)
+}
+
+func BenchmarkHandleMesosNoData(b *testing.B) {
+	benchmarkQuery(b, "_tcp.marathon.mesos.", dns.TypeA)
+}
+
+func BenchmarkNameTree(b *testing.B) {
+	res := bigDNS(b, 50000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newNameTree(&res.rs)
+	}
+}
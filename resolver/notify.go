@@ -0,0 +1,79 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// notifyTries is how many times a NOTIFY is sent before giving up on a
+// secondary that doesn't acknowledge it
+const notifyTries = 3
+
+// notifyAddr returns ns with the default DNS port if it has none
+func notifyAddr(ns string) string {
+	if _, _, err := net.SplitHostPort(ns); err == nil {
+		return ns
+	}
+	return net.JoinHostPort(ns, "53")
+}
+
+// notify tells every secondary in Notify that the zone is now at serial
+// (RFC 1996), so they transfer it without waiting for the SOA refresh
+func (res *Resolver) notify(serial uint32) {
+	var wg sync.WaitGroup
+	for _, ns := range res.config().Notify {
+		wg.Add(1)
+		go func(ns string) {
+			defer wg.Done()
+			if err := res.sendNotify(notifyAddr(ns), serial); err != nil {
+				logging.CurLog.NotifiesFailed += 1
+				logging.Error.Println("notify " + ns + ": " + err.Error())
+				return
+			}
+			logging.CurLog.Notifies += 1
+		}(ns)
+	}
+	wg.Wait()
+}
+
+// sendNotify sends a NOTIFY for serial to addr and waits for the
+// acknowledgement, retrying on timeouts
+func (res *Resolver) sendNotify(addr string, serial uint32) error {
+	config := res.config()
+	soa, _ := res.formatSOA(res.zone())
+	soa.Serial = serial
+
+	m := new(dns.Msg)
+	m.SetNotify(res.zone())
+	m.Authoritative = true
+	m.Answer = []dns.RR{soa}
+
+	c := new(dns.Client)
+	c.Timeout = 5 * time.Second
+	if config.Timeout != 0 {
+		c.Timeout = time.Duration(config.Timeout) * time.Second
+	}
+
+	var err error
+	for i := 0; i < notifyTries; i++ {
+		var in *dns.Msg
+		in, _, err = c.Exchange(m, addr)
+		if err != nil {
+			continue
+		}
+
+		if in.Opcode != dns.OpcodeNotify || in.Rcode != dns.RcodeSuccess {
+			return errors.New("answered with " + dns.OpcodeToString[in.Opcode] + " " +
+				dns.RcodeToString[in.Rcode] + " for serial " + strconv.FormatUint(uint64(serial), 10))
+		}
+		return nil
+	}
+
+	return err
+}
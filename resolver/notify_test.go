@@ -0,0 +1,64 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestNotifyAddr(t *testing.T) {
+	var tests = []struct {
+		ns, addr string
+	}{
+		{"10.0.0.1", "10.0.0.1:53"},
+		{"10.0.0.1:5353", "10.0.0.1:5353"},
+		{"::1", "[::1]:53"},
+		{"[::1]:5353", "[::1]:5353"},
+	}
+
+	for _, tt := range tests {
+		if addr := notifyAddr(tt.ns); addr != tt.addr {
+			t.Errorf("%s: expected %s, got %s", tt.ns, tt.addr, addr)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(chan *dns.Msg, 1)
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, r *dns.Msg) {
+		got <- r
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})
+
+	server := &dns.Server{PacketConn: pc, Handler: mux}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	res := &Resolver{Config: records.Config{
+		Domain: "mesos",
+		Mname:  "mesos-dns.mesos.",
+		Email:  "root.mesos-dns.mesos.",
+	}}
+
+	if err := res.sendNotify(pc.LocalAddr().String(), 42); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-got
+	if r.Opcode != dns.OpcodeNotify || r.Question[0].Name != "mesos." || r.Question[0].Qtype != dns.TypeSOA {
+		t.Error("expected a NOTIFY for the mesos SOA")
+	}
+	if soa, ok := r.Answer[0].(*dns.SOA); !ok || soa.Serial != 42 {
+		t.Error("NOTIFY should carry the new serial")
+	}
+}
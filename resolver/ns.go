@@ -0,0 +1,48 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// nameservers returns the names of the nameservers for the zone
+func (res *Resolver) nameservers() []string {
+	config := res.config()
+	if len(config.Nameservers) > 0 {
+		return config.Nameservers
+	}
+	return []string{config.Mname}
+}
+
+// nsRecords returns the NS records of the zone apex
+func (res *Resolver) nsRecords() []dns.RR {
+	var rrs []dns.RR
+	for _, ns := range res.nameservers() {
+		rrs = append(rrs, &dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   res.zone(),
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+				Ttl:    uint32(res.config().TTL),
+			},
+			Ns: ns,
+		})
+	}
+	return rrs
+}
+
+// glue returns the A records we have for the nameservers in the zone
+// it must be called with the records locked
+func (res *Resolver) glue() []dns.RR {
+	var rrs []dns.RR
+	for _, ns := range res.nameservers() {
+		ns = strings.ToLower(ns)
+		for _, host := range res.rs.As[ns] {
+			if rr, err := res.formatA(ns, host); err == nil {
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+	return rrs
+}
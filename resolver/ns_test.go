@@ -0,0 +1,56 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestApexNS(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		r := new(dns.Msg)
+		r.SetQuestion(name, qtype)
+		w := &fakeWriter{}
+		res.HandleMesos(w, r)
+		return w.msg
+	}
+
+	m := query("mesos.", dns.TypeNS)
+	if len(m.Answer) != 1 || m.Answer[0].(*dns.NS).Ns != res.Config.Mname {
+		t.Fatalf("expected the mname as NS, got %v", m.Answer)
+	}
+	if !m.Authoritative {
+		t.Error("apex answers should be authoritative")
+	}
+
+	var glue bool
+	for _, rr := range m.Extra {
+		if a, ok := rr.(*dns.A); ok && a.Hdr.Name == res.Config.Mname {
+			glue = true
+		}
+	}
+	if !glue {
+		t.Error("expected the address of the nameserver")
+	}
+
+	m = query("mesos.", dns.TypeSOA)
+	if len(m.Answer) != 1 || len(m.Ns) != 1 || m.Ns[0].Header().Rrtype != dns.TypeNS {
+		t.Errorf("expected the SOA with NS in the authority section, got %v", m)
+	}
+
+	res.Config.Nameservers = []string{"ns1.example.com.", "ns2.example.com."}
+	if m = query("mesos.", dns.TypeNS); len(m.Answer) != 2 || len(m.Extra) != 0 {
+		t.Errorf("expected the configured nameservers without glue, got %v", m)
+	}
+
+	// NS below the apex is NODATA
+	m = query("chronos.marathon-0.6.0.mesos.", dns.TypeNS)
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 1 {
+		t.Errorf("expected NODATA, got %v", m)
+	}
+}
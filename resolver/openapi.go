@@ -0,0 +1,369 @@
+package resolver
+
+import (
+	"net/http"
+)
+
+// openAPI describes the HTTP API, keep it in step with httpHandler
+const openAPI = `{
+  "openapi": "3.0.0",
+  "info": {
+    "title": "Mesos-DNS HTTP API",
+    "version": "v1",
+    "description": "Admin endpoints need the admintoken as bearer token."
+  },
+  "servers": [{"url": "/"}],
+  "components": {
+    "securitySchemes": {
+      "admin": {"type": "http", "scheme": "bearer"}
+    },
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "properties": {
+          "error": {
+            "type": "object",
+            "required": ["code", "message", "request_id"],
+            "properties": {
+              "code": {"type": "string", "enum": ["invalid_request", "unauthorized", "forbidden", "not_found", "method_not_allowed"]},
+              "message": {"type": "string"},
+              "details": {"type": "string"},
+              "request_id": {"type": "string"}
+            }
+          }
+        }
+      },
+      "Features": {
+        "type": "object",
+        "properties": {
+          "version": {"type": "string"},
+          "features": {"type": "object", "description": "Whether each feature is enabled, by the name of its setting", "additionalProperties": {"type": "boolean"}}
+        }
+      },
+      "LookupRequest": {
+        "type": "object",
+        "required": ["queries"],
+        "properties": {
+          "queries": {
+            "type": "array",
+            "minItems": 1,
+            "maxItems": 1000,
+            "items": {
+              "type": "object",
+              "required": ["name"],
+              "properties": {
+                "name": {"type": "string", "description": "A name, or a pattern where * labels match any label, which needs the admin token", "example": "search.marathon.mesos"},
+                "type": {"type": "string", "default": "A", "example": "SRV"}
+              }
+            }
+          }
+        }
+      },
+      "LookupResponse": {
+        "type": "object",
+        "properties": {
+          "answers": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "name": {"type": "string"},
+                "type": {"type": "string"},
+                "rcode": {"type": "string", "example": "NOERROR"},
+                "records": {
+                  "type": "array",
+                  "items": {
+                    "type": "object",
+                    "properties": {
+                      "name": {"type": "string"},
+                      "type": {"type": "string"},
+                      "ttl": {"type": "integer"},
+                      "data": {"type": "string", "example": "10.9.87.94"}
+                    }
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "RecordSet": {
+        "type": "object",
+        "description": "Record values by name",
+        "additionalProperties": {"type": "array", "items": {"type": "string"}}
+      },
+      "ACMERequest": {
+        "type": "object",
+        "required": ["domain", "value"],
+        "properties": {
+          "domain": {"type": "string", "example": "search.marathon.mesos"},
+          "value": {"type": "string"}
+        }
+      },
+      "ACMEResponse": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string", "example": "_acme-challenge.search.marathon.mesos."},
+          "value": {"type": "string"},
+          "expires": {"type": "string", "format": "date-time"}
+        }
+      },
+      "DebugState": {
+        "type": "object",
+        "properties": {
+          "goroutines": {"type": "integer"},
+          "heap_bytes": {"type": "integer", "format": "int64"},
+          "serial": {"type": "integer", "format": "int64"},
+          "records": {"type": "object", "additionalProperties": {"type": "integer"}},
+          "fetched": {"type": "string", "format": "date-time"},
+          "reloaded": {"type": "string", "format": "date-time"},
+          "reload_ms": {"type": "number"},
+          "config": {"type": "object"}
+        }
+      },
+      "Health": {
+        "type": "object",
+        "properties": {
+          "status": {"type": "string", "enum": ["ok", "unavailable"]},
+          "listeners": {"type": "object", "additionalProperties": {"type": "boolean"}}
+        }
+      },
+      "Ready": {
+        "type": "object",
+        "properties": {
+          "status": {"type": "string", "enum": ["ready", "not ready"]},
+          "fetched": {"type": "string", "format": "date-time"},
+          "reason": {"type": "string"}
+        }
+      },
+      "LogLevel": {
+        "type": "object",
+        "properties": {
+          "level": {"type": "integer", "enum": [0, 1, 2]},
+          "configured": {"type": "integer", "enum": [0, 1, 2]},
+          "until": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Records": {
+        "type": "object",
+        "properties": {
+          "serial": {"type": "integer", "format": "int64"},
+          "a": {"$ref": "#/components/schemas/RecordSet"},
+          "srv": {"$ref": "#/components/schemas/RecordSet"},
+          "txt": {"$ref": "#/components/schemas/RecordSet"},
+          "cname": {"$ref": "#/components/schemas/RecordSet"},
+          "tlsa": {"$ref": "#/components/schemas/RecordSet"},
+          "sshfp": {"$ref": "#/components/schemas/RecordSet"},
+          "uri": {"$ref": "#/components/schemas/RecordSet"}
+        }
+      },
+      "StaticRequest": {
+        "type": "object",
+        "required": ["values"],
+        "properties": {
+          "values": {"type": "array", "items": {"type": "string"}, "example": ["10.9.87.95"]}
+        }
+      },
+      "StaticResponse": {
+        "type": "object",
+        "properties": {
+          "type": {"type": "string", "enum": ["A", "SRV", "TXT", "CNAME"]},
+          "name": {"type": "string"},
+          "values": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    },
+    "responses": {
+      "Error": {
+        "description": "The request failed",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      }
+    }
+  },
+  "paths": {
+    "/health": {
+      "get": {
+        "summary": "Whether the process is alive and its DNS listeners are bound",
+        "responses": {
+          "200": {"description": "Healthy", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Health"}}}},
+          "503": {"description": "A DNS listener is not bound", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Health"}}}}
+        }
+      }
+    },
+    "/ready": {
+      "get": {
+        "summary": "Whether records were recently loaded from the masters",
+        "responses": {
+          "200": {"description": "Ready", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Ready"}}}},
+          "503": {"description": "Not ready", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Ready"}}}}
+        }
+      }
+    },
+    "/v1/openapi.json": {
+      "get": {
+        "summary": "This specification",
+        "responses": {"200": {"description": "OpenAPI specification"}}
+      }
+    },
+    "/v1/features": {
+      "get": {
+        "summary": "The optional subsystems enabled on this instance",
+        "responses": {
+          "200": {"description": "Features", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Features"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/lookup": {
+      "post": {
+        "summary": "Look up many names in the Mesos domain at once",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LookupRequest"}}}},
+        "responses": {
+          "200": {"description": "Answers, in the order of the queries", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LookupResponse"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/acme": {
+      "post": {
+        "summary": "Publish an ACME DNS-01 challenge",
+        "security": [{"admin": []}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ACMERequest"}}}},
+        "responses": {
+          "201": {"description": "Published", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ACMEResponse"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Withdraw an ACME DNS-01 challenge",
+        "security": [{"admin": []}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ACMERequest"}}}},
+        "responses": {
+          "204": {"description": "Withdrawn"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/reload": {
+      "post": {
+        "summary": "Regenerate the records from the Mesos master now",
+        "security": [{"admin": []}],
+        "responses": {
+          "200": {"description": "Reloaded", "content": {"application/json": {"schema": {"type": "object", "properties": {"serial": {"type": "integer", "format": "int64"}}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/config": {
+      "get": {
+        "summary": "The configuration in use, without secrets",
+        "security": [{"admin": []}],
+        "responses": {
+          "200": {"description": "Configuration", "content": {"application/json": {"schema": {"type": "object"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/loglevel": {
+      "get": {
+        "summary": "The verbosity of the logs",
+        "security": [{"admin": []}],
+        "responses": {
+          "200": {"description": "Log level", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LogLevel"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Set the verbosity of the logs for a while",
+        "security": [{"admin": []}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["level"], "properties": {"level": {"type": "integer", "enum": [0, 1, 2]}, "seconds": {"type": "integer"}}}}}},
+        "responses": {
+          "200": {"description": "Log level set", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LogLevel"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Go back to the configured verbosity",
+        "security": [{"admin": []}],
+        "responses": {
+          "200": {"description": "Log level reset", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LogLevel"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/records": {
+      "get": {
+        "summary": "Every record served for the Mesos domain",
+        "security": [{"admin": []}],
+        "responses": {
+          "200": {"description": "Records", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Records"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/zone": {
+      "get": {
+        "summary": "Every record served for the Mesos domain, as an RFC 1035 zone file",
+        "security": [{"admin": []}],
+        "responses": {
+          "200": {"description": "Zone file", "content": {"text/dns": {"schema": {"type": "string"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/records/static": {
+      "get": {
+        "summary": "The static records, by type and name",
+        "security": [{"admin": []}],
+        "responses": {
+          "200": {"description": "Static records", "content": {"application/json": {"schema": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/RecordSet"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/records/static/{type}/{name}": {
+      "parameters": [
+        {"name": "type", "in": "path", "required": true, "schema": {"type": "string", "enum": ["a", "srv", "txt", "cname"]}},
+        {"name": "name", "in": "path", "required": true, "schema": {"type": "string"}, "example": "search.marathon.mesos"}
+      ],
+      "put": {
+        "summary": "Serve static records for a name, replacing the generated ones",
+        "security": [{"admin": []}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/StaticRequest"}}}},
+        "responses": {
+          "200": {"description": "Set", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/StaticResponse"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Remove the static records of a name",
+        "security": [{"admin": []}],
+        "responses": {
+          "204": {"description": "Removed"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/debug/state": {
+      "get": {
+        "summary": "Goroutines, memory, record counts, reloads and configuration, for debugging",
+        "security": [{"admin": []}],
+        "responses": {
+          "200": {"description": "Process state", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DebugState"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  }
+}
+`
+
+// handleOpenAPI serves the specification of the HTTP API
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if !only("GET", w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(openAPI))
+}
@@ -0,0 +1,56 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	res := acmeDNS(t)
+	h := res.httpHandler()
+
+	// no token needed
+	rec := apiRequest(h, "GET", "/v1/openapi.json", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var spec struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&spec); err != nil {
+		t.Fatal("spec is not json:", err)
+	}
+
+	var endpoints = []struct {
+		path   string
+		method string
+	}{
+		{"/health", "get"},
+		{"/ready", "get"},
+		{"/v1/openapi.json", "get"},
+		{"/v1/features", "get"},
+		{"/v1/lookup", "post"},
+		{"/v1/acme", "post"},
+		{"/v1/acme", "delete"},
+		{"/v1/reload", "post"},
+		{"/v1/config", "get"},
+		{"/v1/loglevel", "get"},
+		{"/v1/loglevel", "put"},
+		{"/v1/loglevel", "delete"},
+		{"/v1/records", "get"},
+		{"/v1/zone", "get"},
+		{"/v1/records/static", "get"},
+		{"/v1/records/static/{type}/{name}", "put"},
+		{"/v1/records/static/{type}/{name}", "delete"},
+		{"/debug/state", "get"},
+	}
+
+	for _, e := range endpoints {
+		if _, ok := spec.Paths[e.path][e.method]; !ok {
+			t.Errorf("%s %s is not described", e.method, e.path)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package resolver
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// turns counts the queries for every name, for round-robin answers
+// a nil *turns always returns the first turn
+type turns struct {
+	sync.Mutex
+	items map[string]int
+}
+
+func newTurns() *turns {
+	return &turns{items: make(map[string]int)}
+}
+
+// next returns the turn of the query for name
+func (t *turns) next(name string) int {
+	if t == nil {
+		return 0
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	n := t.items[name]
+	t.items[name] = n + 1
+	return n
+}
+
+// reset forgets every name, the records they counted are gone
+func (t *turns) reset() {
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	t.items = make(map[string]int)
+	t.Unlock()
+}
+
+// order reorders the answers to the query from w for load balancing,
+// following AnswerOrder
+// it must be called with the records locked
+func (res *Resolver) order(w dns.ResponseWriter, answers []dns.RR) []dns.RR {
+	if len(answers) < 2 {
+		return answers
+	}
+
+	switch res.config().AnswerOrder {
+	case "roundrobin":
+		return rotateAnswers(answers, res.turns.next(strings.ToLower(answers[0].Header().Name)))
+	case "weighted":
+		return weightAnswers(answers, res.weight)
+	case "hash":
+		return hashAnswers(answers, clientSubnet(w))
+	case "sorted":
+		return sortAnswers(answers)
+	}
+	return shuffleAnswers(answers)
+}
+
+// rotateAnswers sorts answers and moves the first turn of them to the end
+func rotateAnswers(answers []dns.RR, turn int) []dns.RR {
+	answers = sortAnswers(answers)
+	n := turn % len(answers)
+	return append(answers[n:], answers[:n]...)
+}
+
+// weightAnswers shuffles answers so that each is first with a chance
+// proportional to its weight
+func weightAnswers(answers []dns.RR, weight func(dns.RR) float64) []dns.RR {
+	keys := make(map[dns.RR]float64, len(answers))
+	for _, rr := range answers {
+		// Efraimidis-Spirakis: sorting by u^(1/w) is weighted sampling
+		keys[rr] = math.Pow(rand.Float64(), 1/weight(rr))
+	}
+
+	sort.SliceStable(answers, func(i, j int) bool {
+		return keys[answers[i]] > keys[answers[j]]
+	})
+	return answers
+}
+
+// hashAnswers orders answers by their hash with client, so that a client
+// gets the same order every time and the first answer is spread evenly
+// over clients
+func hashAnswers(answers []dns.RR, client string) []dns.RR {
+	keys := make(map[dns.RR]uint64, len(answers))
+	for _, rr := range answers {
+		h := fnv.New64a()
+		h.Write([]byte(client))
+		h.Write([]byte(rr.String()))
+		keys[rr] = h.Sum64()
+	}
+
+	sort.SliceStable(answers, func(i, j int) bool {
+		return keys[answers[i]] < keys[answers[j]]
+	})
+	return answers
+}
+
+// sortAnswers orders answers by their text
+func sortAnswers(answers []dns.RR) []dns.RR {
+	sort.SliceStable(answers, func(i, j int) bool {
+		return answers[i].String() < answers[j].String()
+	})
+	return answers
+}
+
+// weight is the weight of the slave rr points at
+func (res *Resolver) weight(rr dns.RR) float64 {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return res.rs.Weight(rr.A.String())
+	case *dns.SRV:
+		if hosts := res.rs.As[strings.ToLower(rr.Target)]; len(hosts) > 0 {
+			return res.rs.Weight(hosts[0])
+		}
+	}
+	return 1
+}
+
+// clientSubnet returns the /24 or /56 network of the client behind w
+func clientSubnet(w dns.ResponseWriter) string {
+	var ip net.IP
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.TCPAddr:
+		ip = addr.IP
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	if ip != nil {
+		return ip.Mask(net.CIDRMask(56, 128)).String()
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func orderHosts(answers []dns.RR) []string {
+	var hosts []string
+	for _, rr := range answers {
+		hosts = append(hosts, rr.(*dns.A).A.String())
+	}
+	return hosts
+}
+
+func TestAnswerOrder(t *testing.T) {
+	var sj records.StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [
+			{"id": "s1", "hostname": "10.0.0.1", "resources": {"cpus": 1000000}},
+			{"id": "s2", "hostname": "10.0.0.2", "resources": {"cpus": 1}},
+			{"id": "s3", "hostname": "10.0.0.3", "resources": {"cpus": 1}}
+		],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING"},
+			{"name": "web", "slave_id": "s2", "state": "TASK_RUNNING"},
+			{"name": "web", "slave_id": "s3", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answers := func(res *Resolver) []dns.RR {
+		var rrs []dns.RR
+		for _, host := range []string{"10.0.0.3", "10.0.0.1", "10.0.0.2"} {
+			rr, err := res.formatA("web.marathon.mesos.", host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rrs = append(rrs, rr)
+		}
+		return rrs
+	}
+	client := func(ip string) *fakeWriter {
+		return &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP(ip), Port: 53}}
+	}
+
+	var tests = []struct {
+		order string
+		first []string
+	}{
+		{"sorted", []string{"10.0.0.1", "10.0.0.1", "10.0.0.1"}},
+		{"roundrobin", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{"weighted", []string{"10.0.0.1", "10.0.0.1", "10.0.0.1"}},
+	}
+
+	for _, tt := range tests {
+		config := records.Config{Domain: "mesos", TTL: 60, AnswerOrder: tt.order}
+		res := New(config)
+		res.rs.InsertState(sj, config)
+
+		var first []string
+		for range tt.first {
+			first = append(first, orderHosts(res.order(client("192.0.2.1"), answers(res)))[0])
+		}
+		if !reflect.DeepEqual(first, tt.first) {
+			t.Errorf("%s: expected %v first, got %v", tt.order, tt.first, first)
+		}
+	}
+
+	// the same subnet gets the same order, others are spread out
+	res := New(records.Config{Domain: "mesos", TTL: 60, AnswerOrder: "hash"})
+	want := orderHosts(res.order(client("192.0.2.1"), answers(res)))
+	if got := orderHosts(res.order(client("192.0.2.200"), answers(res))); !reflect.DeepEqual(got, want) {
+		t.Errorf("hash: expected %v for the same subnet, got %v", want, got)
+	}
+
+	firsts := make(map[string]bool)
+	for i := 0; i < 64; i++ {
+		ip := net.IPv4(10, byte(i), 0, 1).String()
+		firsts[orderHosts(res.order(client(ip), answers(res)))[0]] = true
+	}
+	if len(firsts) != 3 {
+		t.Errorf("hash: expected every host first for some subnet, got %v", firsts)
+	}
+}
+
+func TestAnswerCacheOrder(t *testing.T) {
+	for _, order := range []string{"", "random", "roundrobin", "weighted", "hash", "sorted"} {
+		res := New(records.Config{Domain: "mesos", TTL: 60, AnswerOrder: order, AnswerCacheSize: 10})
+		if cached := res.answers != nil; cached != (order == "sorted") {
+			t.Errorf("%q: expected the answer cache only for sorted answers, got %v", order, cached)
+		}
+	}
+}
+
+func TestClientSubnet(t *testing.T) {
+	var tests = []struct {
+		addr   net.Addr
+		subnet string
+	}{
+		{&net.UDPAddr{IP: net.ParseIP("192.0.2.77")}, "192.0.2.0"},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8:1:2ff::1")}, "2001:db8:1:200::"},
+		{&net.UnixAddr{}, ""},
+	}
+
+	for _, tt := range tests {
+		if subnet := clientSubnet(&fakeWriter{remote: tt.addr}); subnet != tt.subnet {
+			t.Errorf("%v: expected %q, got %q", tt.addr, tt.subnet, subnet)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package resolver
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// overrideMsg answers a question for an external name pinned in
+// Config.Overrides - it returns nil if the name is not overridden
+func (res *Resolver) overrideMsg(r *dns.Msg) *dns.Msg {
+	q := r.Question[0]
+
+	addrs, ok := res.config().Overrides[strings.ToLower(q.Name)]
+	if !ok {
+		return nil
+	}
+
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return res.addressMsg(r, ips)
+}
+
+// addressMsg answers a question for an external name with the addresses
+// of the name, IPv4 addresses as A and IPv6 as AAAA records
+func (res *Resolver) addressMsg(r *dns.Msg, ips []net.IP) *dns.Msg {
+	config := res.config()
+	q := r.Question[0]
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.RecursionAvailable = config.RecurseOn
+
+	ttl := uint32(config.TTL)
+	for _, ip := range ips {
+		hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: ttl}
+		ip4 := ip.To4()
+
+		switch {
+		case ip4 != nil && (q.Qtype == dns.TypeA || q.Qtype == dns.TypeANY):
+			hdr.Rrtype = dns.TypeA
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: ip4})
+		case ip4 == nil && (q.Qtype == dns.TypeAAAA || q.Qtype == dns.TypeANY):
+			hdr.Rrtype = dns.TypeAAAA
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+
+	// other qtypes get NODATA, the name exists
+	return m
+}
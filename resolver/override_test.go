@@ -0,0 +1,44 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestOverrideMsg(t *testing.T) {
+	res := Resolver{Config: records.Config{
+		TTL: 60,
+		Overrides: map[string][]string{
+			"api.saas.com.": {"10.0.0.1", "10.0.0.2", "fd00::1"},
+		},
+	}}
+
+	var tests = []struct {
+		name    string
+		qtype   uint16
+		found   bool
+		answers int
+	}{
+		{"api.saas.com.", dns.TypeA, true, 2},
+		{"API.saas.com.", dns.TypeAAAA, true, 1},
+		{"api.saas.com.", dns.TypeMX, true, 0},
+		{"www.saas.com.", dns.TypeA, false, 0},
+	}
+
+	for _, tt := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(tt.name, tt.qtype)
+
+		m := res.overrideMsg(r)
+		if (m != nil) != tt.found {
+			t.Errorf("%s: expected override %v", tt.name, tt.found)
+			continue
+		}
+
+		if m != nil && len(m.Answer) != tt.answers {
+			t.Errorf("%s: expected %d answers got %d", tt.name, tt.answers, len(m.Answer))
+		}
+	}
+}
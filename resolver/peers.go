@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// peers tracks which of the other mesos-dns instances are healthy, that
+// is they answer authoritatively for our domain
+// a nil *peers has no healthy peers
+type peers struct {
+	sync.Mutex
+	up []string
+}
+
+// healthy returns the IPs of the peers that answered the last check
+func (p *peers) healthy() []string {
+	if p == nil {
+		return nil
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	return p.up
+}
+
+// peerAddr splits a Peers entry into the IP we publish and the address
+// we check, which defaults to our own port
+func peerAddr(peer string, port int) (ip string, addr string) {
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		return host, peer
+	}
+	return peer, net.JoinHostPort(peer, strconv.Itoa(port))
+}
+
+// CheckPeers asks every peer for the SOA of our domain and keeps the ones
+// that answer to publish at resolvers.domain
+func (res *Resolver) CheckPeers() {
+	config := res.config()
+	if res.peers == nil {
+		return
+	}
+
+	var lock sync.Mutex
+	var up []string
+
+	var wg sync.WaitGroup
+	for _, peer := range config.Peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+
+			ip, addr := peerAddr(peer, config.Port)
+			if !res.peerHealthy(addr) {
+				logging.Verbose.Println("peer " + peer + " is not answering")
+				return
+			}
+
+			lock.Lock()
+			up = append(up, ip)
+			lock.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+
+	// stable order so the records only change when health does
+	sort.Strings(up)
+
+	res.peers.Lock()
+	res.peers.up = up
+	res.peers.Unlock()
+}
+
+// peerHealthy reports whether the mesos-dns at addr answers for our domain
+func (res *Resolver) peerHealthy(addr string) bool {
+	config := res.config()
+	m := new(dns.Msg)
+	m.SetQuestion(res.zone(), dns.TypeSOA)
+
+	c := new(dns.Client)
+	c.Timeout = 5 * time.Second
+	if config.Timeout != 0 {
+		c.Timeout = time.Duration(config.Timeout) * time.Second
+	}
+
+	in, _, err := c.Exchange(m, addr)
+	return err == nil && in.Rcode == dns.RcodeSuccess && in.Authoritative
+}
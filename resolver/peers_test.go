@@ -0,0 +1,62 @@
+package resolver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestPeerAddr(t *testing.T) {
+	var tests = []struct {
+		peer, ip, addr string
+	}{
+		{"10.0.0.1", "10.0.0.1", "10.0.0.1:8053"},
+		{"10.0.0.1:53", "10.0.0.1", "10.0.0.1:53"},
+		{"fd00::1", "fd00::1", "[fd00::1]:8053"},
+	}
+
+	for _, tt := range tests {
+		ip, addr := peerAddr(tt.peer, 8053)
+		if ip != tt.ip || addr != tt.addr {
+			t.Errorf("%s: expected %s %s, got %s %s", tt.peer, tt.ip, tt.addr, ip, addr)
+		}
+	}
+}
+
+func TestCheckPeers(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(res.HandleMesos)}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	// nothing listens on the second one
+	dead, err := net.ListenPacket("udp", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.Close()
+
+	res.Config.Timeout = 1
+	res.Config.Peers = []string{pc.LocalAddr().String(), dead.LocalAddr().String()}
+	res.peers = &peers{}
+	res.CheckPeers()
+
+	if up := res.peers.healthy(); !reflect.DeepEqual(up, []string{"127.0.0.1"}) {
+		t.Errorf("expected only the answering peer to be healthy, got %v", up)
+	}
+
+	var none *peers
+	if none.healthy() != nil {
+		t.Error("nil peers should have none healthy")
+	}
+}
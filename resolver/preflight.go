@@ -0,0 +1,103 @@
+package resolver
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// resolvConf is where the system resolvers are read from
+var resolvConf = "/etc/resolv.conf"
+
+// Check is the outcome of one preflight check, a failed fatal check
+// means mesos-dns cannot run
+type Check struct {
+	Name  string
+	Err   error
+	Fatal bool
+}
+
+func (c Check) String() string {
+	switch {
+	case c.Err == nil:
+		return "ok    " + c.Name
+	case c.Fatal:
+		return "FAIL  " + c.Name + ": " + c.Err.Error()
+	default:
+		return "WARN  " + c.Name + ": " + c.Err.Error()
+	}
+}
+
+// Failed reports whether any fatal check in checks failed
+func Failed(checks []Check) bool {
+	for _, c := range checks {
+		if c.Err != nil && c.Fatal {
+			return true
+		}
+	}
+	return false
+}
+
+// Preflight checks that we can bind our ports, read resolv.conf and reach
+// the mesos masters before we start serving
+func (res *Resolver) Preflight() []Check {
+	config := res.config()
+	var checks []Check
+
+	// the sockets systemd passed or Bind opened are bound already
+	addr := net.JoinHostPort(config.Listener, strconv.Itoa(config.Port))
+	if res.sockets["tcp"] == nil {
+		checks = append(checks, Check{Name: "bind tcp " + addr, Err: bindTCP(addr), Fatal: true})
+	}
+	if res.sockets["udp"] == nil {
+		checks = append(checks, Check{Name: "bind udp " + addr, Err: bindUDP(addr), Fatal: true})
+	}
+
+	if config.HTTPOn && res.sockets["http"] == nil {
+		addr := net.JoinHostPort(config.HTTPListener, strconv.Itoa(config.HTTPPort))
+		checks = append(checks, Check{Name: "bind http " + addr, Err: bindTCP(addr), Fatal: true})
+	}
+
+	_, err := dns.ClientConfigFromFile(resolvConf)
+	checks = append(checks, Check{Name: "read " + resolvConf, Err: err})
+
+	timeout := 5 * time.Second
+	if config.Timeout != 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+	masters := config.Masters
+	for _, cl := range config.Clusters {
+		masters = append(masters[:len(masters):len(masters)], cl.Masters...)
+	}
+	for _, master := range masters {
+		checks = append(checks, Check{Name: "reach master " + master, Err: reach(master, timeout)})
+	}
+
+	return checks
+}
+
+func bindTCP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return l.Close()
+}
+
+func bindUDP(addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return pc.Close()
+}
+
+func reach(addr string, timeout time.Duration) error {
+	c, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
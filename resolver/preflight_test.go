@@ -0,0 +1,87 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+func TestPreflight(t *testing.T) {
+	// a master that accepts connections and a port that is taken
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	res := New(records.Config{
+		Listener: "127.0.0.1",
+		Port:     port,
+		Timeout:  1,
+		Masters:  []string{l.Addr().String()},
+	})
+
+	resolvConf = "testdata/missing-resolv.conf"
+	defer func() { resolvConf = "/etc/resolv.conf" }()
+
+	checks := res.Preflight()
+	if len(checks) != 4 {
+		t.Fatalf("expected 4 checks, got %d", len(checks))
+	}
+
+	want := []bool{true, false, true, false}
+	for i, c := range checks {
+		if (c.Err != nil) != want[i] {
+			t.Errorf("%s: expected failure %v", c, want[i])
+		}
+	}
+
+	if !Failed(checks) {
+		t.Error("a taken port should fail the preflight")
+	}
+
+	res.Config.Port = freePort(t)
+	if checks := res.Preflight(); Failed(checks) {
+		t.Errorf("expected to pass with a free port: %v", checks)
+	}
+}
+
+func TestCheckString(t *testing.T) {
+	var tests = []struct {
+		check Check
+		s     string
+	}{
+		{Check{Name: "a"}, "ok    a"},
+		{Check{Name: "a", Err: errors.New("x")}, "WARN  a: x"},
+		{Check{Name: "a", Err: errors.New("x"), Fatal: true}, "FAIL  a: x"},
+	}
+
+	for _, tt := range tests {
+		if tt.check.String() != tt.s {
+			t.Errorf("expected %q, got %q", tt.s, tt.check.String())
+		}
+	}
+}
+
+// freePort returns a port nothing listens on for TCP or UDP
+func freePort(t *testing.T) int {
+	for i := 0; i < 10; i++ {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := pc.LocalAddr().(*net.UDPAddr).Port
+		pc.Close()
+
+		if err := bindTCP("127.0.0.1:" + strconv.Itoa(port)); err == nil {
+			return port
+		}
+	}
+
+	t.Fatal("no free port")
+	return 0
+}
@@ -0,0 +1,131 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ProbeOptions is what the probe asks, of whom and what it expects
+type ProbeOptions struct {
+	Server     string
+	Name       string
+	Type       string
+	Net        string
+	Timeout    time.Duration
+	Warning    time.Duration
+	Critical   time.Duration
+	MinAnswers int
+}
+
+// Probe is the outcome of one probe query, its status follows the
+// monitoring plugin convention of OK, WARNING, CRITICAL and UNKNOWN
+type Probe struct {
+	Server   string   `json:"server"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Status   string   `json:"status"`
+	Rcode    string   `json:"rcode,omitempty"`
+	Answers  int      `json:"answers"`
+	Records  []string `json:"records,omitempty"`
+	Duration float64  `json:"duration_seconds"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// RunProbe sends the query described by o and judges the answer
+func RunProbe(o ProbeOptions) Probe {
+	p := Probe{Server: probeAddr(o.Server), Name: dns.Fqdn(o.Name), Type: strings.ToUpper(o.Type)}
+
+	qtype, ok := dns.StringToType[p.Type]
+	if !ok {
+		p.Status, p.Error = "UNKNOWN", "unknown type "+o.Type
+		return p
+	}
+	if _, ok := dns.IsDomainName(p.Name); !ok {
+		p.Status, p.Error = "UNKNOWN", "invalid name "+o.Name
+		return p
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(p.Name, qtype)
+	c := &dns.Client{Net: o.Net, Timeout: o.Timeout}
+
+	start := time.Now()
+	r, _, err := c.Exchange(m, p.Server)
+	p.Duration = time.Since(start).Seconds()
+	if err != nil {
+		p.Status, p.Error = "CRITICAL", err.Error()
+		return p
+	}
+
+	p.Rcode = dns.RcodeToString[r.Rcode]
+	p.Answers = len(r.Answer)
+	for _, rr := range r.Answer {
+		p.Records = append(p.Records, rr.String())
+	}
+
+	rtt := time.Duration(p.Duration * float64(time.Second))
+	switch {
+	case r.Rcode != dns.RcodeSuccess:
+		p.Status, p.Error = "CRITICAL", "answered "+p.Rcode
+	case p.Answers < o.MinAnswers:
+		p.Status, p.Error = "CRITICAL", fmt.Sprintf("expected at least %d answers", o.MinAnswers)
+	case o.Critical > 0 && rtt > o.Critical:
+		p.Status, p.Error = "CRITICAL", "answered in more than "+o.Critical.String()
+	case o.Warning > 0 && rtt > o.Warning:
+		p.Status, p.Error = "WARNING", "answered in more than "+o.Warning.String()
+	default:
+		p.Status = "OK"
+	}
+	return p
+}
+
+// Code is the exit code of the probe for monitoring plugins
+func (p Probe) Code() int {
+	switch p.Status {
+	case "OK":
+		return 0
+	case "WARNING":
+		return 1
+	case "CRITICAL":
+		return 2
+	}
+	return 3
+}
+
+// Nagios formats the probe as a monitoring plugin status line with
+// performance data, understood by Nagios, Icinga and Sensu
+func (p Probe) Nagios() string {
+	msg := fmt.Sprintf("%s %s: %d answers in %.6fs", p.Name, p.Type, p.Answers, p.Duration)
+	if p.Error != "" {
+		msg = p.Name + " " + p.Type + ": " + p.Error
+	}
+	return fmt.Sprintf("DNS %s - %s | time=%.6fs;;;0 answers=%d;;;0", p.Status, msg, p.Duration, p.Answers)
+}
+
+// Prometheus formats the probe in the text exposition format, with the
+// metric names of the blackbox exporter
+func (p Probe) Prometheus() string {
+	success := 0
+	if p.Status == "OK" {
+		success = 1
+	}
+
+	s := fmt.Sprintf("probe_success %d\nprobe_duration_seconds %f\nprobe_dns_answer_rrs %d\n",
+		success, p.Duration, p.Answers)
+	if rcode, ok := dns.StringToRcode[p.Rcode]; ok {
+		s += fmt.Sprintf("probe_dns_rcode %d\n", rcode)
+	}
+	return s
+}
+
+// probeAddr adds the DNS port to server if it has none
+func probeAddr(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), "53")
+}
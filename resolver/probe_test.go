@@ -0,0 +1,71 @@
+package resolver
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestRunProbe(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(res.HandleMesos)}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	addr := pc.LocalAddr().String()
+	var tests = []struct {
+		o      ProbeOptions
+		status string
+		code   int
+	}{
+		{ProbeOptions{Name: "chronos.marathon-0.6.0.mesos", Type: "A", MinAnswers: 1}, "OK", 0},
+		{ProbeOptions{Name: "chronos.marathon-0.6.0.mesos", Type: "a", MinAnswers: 10}, "CRITICAL", 2},
+		{ProbeOptions{Name: "missing.marathon.mesos", Type: "A"}, "CRITICAL", 2},
+		{ProbeOptions{Name: "chronos.marathon-0.6.0.mesos", Type: "A", Warning: time.Nanosecond}, "WARNING", 1},
+		{ProbeOptions{Name: "chronos.marathon-0.6.0.mesos", Type: "BOGUS"}, "UNKNOWN", 3},
+	}
+
+	for _, tt := range tests {
+		tt.o.Server, tt.o.Timeout = addr, time.Second
+		p := RunProbe(tt.o)
+		if p.Status != tt.status || p.Code() != tt.code {
+			t.Errorf("%+v: expected %s (%d), got %s (%d): %s", tt.o, tt.status, tt.code, p.Status, p.Code(), p.Error)
+		}
+	}
+
+	p := RunProbe(ProbeOptions{Server: addr, Name: "chronos.marathon-0.6.0.mesos", Type: "A", Timeout: time.Second})
+	if s := p.Nagios(); !strings.HasPrefix(s, "DNS OK - chronos.marathon-0.6.0.mesos. A: ") || !strings.Contains(s, "| time=") {
+		t.Errorf("unexpected nagios output %q", s)
+	}
+	if s := p.Prometheus(); !strings.Contains(s, "probe_success 1\n") || !strings.Contains(s, "probe_dns_rcode 0\n") {
+		t.Errorf("unexpected prometheus output %q", s)
+	}
+}
+
+func TestProbeAddr(t *testing.T) {
+	var tests = []struct {
+		server, addr string
+	}{
+		{"10.0.0.1", "10.0.0.1:53"},
+		{"10.0.0.1:8053", "10.0.0.1:8053"},
+		{"fd00::1", "[fd00::1]:53"},
+		{"[fd00::1]", "[fd00::1]:53"},
+	}
+
+	for _, tt := range tests {
+		if addr := probeAddr(tt.server); addr != tt.addr {
+			t.Errorf("%s: expected %s, got %s", tt.server, tt.addr, addr)
+		}
+	}
+}
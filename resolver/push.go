@@ -0,0 +1,520 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// DSO TLV types (RFC 8490, section 10.3, and RFC 8765, section 10.2)
+const (
+	dsoKeepalive   = dns.StatefulTypeKeepAlive
+	dsoSubscribe   = 0x40
+	dsoPush        = 0x41
+	dsoUnsubscribe = 0x42
+	dsoReconfirm   = 0x43
+)
+
+// pushRemoved is the TTL of the records a PUSH removes (RFC 8765,
+// section 6.3.1)
+const pushRemoved = 0xFFFFFFFF
+
+// a session without subscriptions is closed after pushInactivity without
+// a message, one with subscriptions after twice pushKeepalive - the
+// client sends a keepalive at least every pushKeepalive
+const (
+	pushInactivity = 15 * time.Second
+	pushKeepalive  = time.Minute
+)
+
+// pushQueue is how many messages a session holds for a client that reads
+// slowly before it is closed, the client subscribes again and gets the
+// records it missed
+const pushQueue = 256
+
+// pushMaxData is how many bytes of records a PUSH carries at most
+const pushMaxData = 16384
+
+// pushTimeout is how long writing a message to a client may take
+const pushTimeout = 10 * time.Second
+
+// pushes holds the sessions of DNS Push clients, to send them the changes
+// to the records they subscribed to
+type pushes struct {
+	sync.Mutex
+	sessions map[*pushSession]bool
+}
+
+func newPushes() *pushes {
+	return &pushes{sessions: make(map[*pushSession]bool)}
+}
+
+func (p *pushes) add(s *pushSession) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	p.sessions[s] = true
+	p.Unlock()
+}
+
+func (p *pushes) remove(s *pushSession) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	delete(p.sessions, s)
+	p.Unlock()
+}
+
+// changed sends every session the removed and added records it
+// subscribed to - it must be called with the records locked, so the
+// changes go out in order
+func (p *pushes) changed(removed []dns.RR, added []dns.RR) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	for s := range p.sessions {
+		s.push(removed, added)
+	}
+}
+
+// pushSession is the DSO session of a DNS Push client
+type pushSession struct {
+	sync.Mutex
+	conn net.Conn
+	out  chan []byte
+	// subs holds the subscriptions by the id of their SUBSCRIBE
+	subs map[uint16]dns.Question
+}
+
+func newPushSession(conn net.Conn) *pushSession {
+	return &pushSession{conn: conn, out: make(chan []byte, pushQueue), subs: make(map[uint16]dns.Question)}
+}
+
+// write sends the queued messages to the client until out is closed
+func (s *pushSession) write() {
+	for b := range s.out {
+		frame := make([]byte, 2+len(b))
+		binary.BigEndian.PutUint16(frame, uint16(len(b)))
+		copy(frame[2:], b)
+
+		s.conn.SetWriteDeadline(time.Now().Add(pushTimeout))
+		if _, err := s.conn.Write(frame); err != nil {
+			s.conn.Close()
+		}
+	}
+}
+
+// send queues b for the client, closing the session if the client
+// doesn't keep up
+func (s *pushSession) send(b []byte) {
+	select {
+	case s.out <- b:
+	default:
+		logging.Verbose.Println("closing the push session of " + s.conn.RemoteAddr().String() + ", it is not reading")
+		s.conn.Close()
+	}
+}
+
+func (s *pushSession) subscribed() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.subs)
+}
+
+// push sends the client the removed and added records it subscribed to
+func (s *pushSession) push(removed []dns.RR, added []dns.RR) {
+	var rrs []dns.RR
+	s.Lock()
+	for _, q := range s.subs {
+		for _, rr := range removed {
+			if pushMatches(q, rr) {
+				rr = dns.Copy(rr)
+				rr.Header().Ttl = pushRemoved
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+	for _, q := range s.subs {
+		for _, rr := range added {
+			if pushMatches(q, rr) {
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+	s.Unlock()
+
+	for _, m := range pushMessages(rrs) {
+		s.send(m)
+	}
+}
+
+// pushMatches reports whether rr is one of the records q subscribed to
+func pushMatches(q dns.Question, rr dns.RR) bool {
+	h := rr.Header()
+	return strings.EqualFold(h.Name, q.Name) &&
+		(q.Qtype == dns.TypeANY || q.Qtype == h.Rrtype) &&
+		(q.Qclass == dns.ClassANY || q.Qclass == h.Class)
+}
+
+// dsoTLV is a type-length-value of a DSO message
+type dsoTLV struct {
+	typ  uint16
+	data []byte
+}
+
+// dsoMessage returns a DSO message with id and the tlvs, a response with
+// rcode if response is set
+func dsoMessage(id uint16, response bool, rcode int, tlvs ...dsoTLV) []byte {
+	flags := uint16(dns.OpcodeStateful)<<11 | uint16(rcode&0xF)
+	if response {
+		flags |= 1 << 15
+	}
+
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint16(b, id)
+	binary.BigEndian.PutUint16(b[2:], flags)
+	for _, t := range tlvs {
+		b = binary.BigEndian.AppendUint16(b, t.typ)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(t.data)))
+		b = append(b, t.data...)
+	}
+	return b
+}
+
+// dsoTLVs splits the body of a DSO message into its TLVs
+func dsoTLVs(b []byte) ([]dsoTLV, bool) {
+	var tlvs []dsoTLV
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			return nil, false
+		}
+		tlvs = append(tlvs, dsoTLV{typ: binary.BigEndian.Uint16(b), data: b[4 : 4+n]})
+		b = b[4+n:]
+	}
+	return tlvs, true
+}
+
+// keepaliveTLV holds the timeouts we give clients
+func keepaliveTLV() dsoTLV {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(pushInactivity/time.Millisecond))
+	binary.BigEndian.PutUint32(data[4:], uint32(pushKeepalive/time.Millisecond))
+	return dsoTLV{typ: dsoKeepalive, data: data}
+}
+
+// pushMessages returns the PUSH messages carrying rrs, uncompressed
+func pushMessages(rrs []dns.RR) [][]byte {
+	var msgs [][]byte
+	var data []byte
+	for _, rr := range rrs {
+		b := make([]byte, dns.Len(rr))
+		n, err := dns.PackRR(rr, b, 0, nil, false)
+		if err != nil {
+			logging.Error.Println("cannot push " + rr.String() + ": " + err.Error())
+			continue
+		}
+		if len(data)+n > pushMaxData {
+			msgs = append(msgs, dsoMessage(0, false, dns.RcodeSuccess, dsoTLV{typ: dsoPush, data: data}))
+			data = nil
+		}
+		data = append(data, b[:n]...)
+	}
+	if len(data) > 0 {
+		msgs = append(msgs, dsoMessage(0, false, dns.RcodeSuccess, dsoTLV{typ: dsoPush, data: data}))
+	}
+	return msgs
+}
+
+// ServePush serves DNS Push Notifications (RFC 8765) over TLS on
+// Listener:PushPort until ctx is done
+func (res *Resolver) ServePush(ctx context.Context) error {
+	config := res.config()
+	cert, err := tls.LoadX509KeyPair(config.PushCert, config.PushKey)
+	if err != nil {
+		return errors.New("failed to load the push certificate: " + err.Error())
+	}
+
+	var l net.Listener
+	if f := res.sockets["push"]; f != nil {
+		l, err = net.FileListener(f)
+	} else {
+		l, err = net.Listen("tcp", net.JoinHostPort(config.Listener, strconv.Itoa(config.PushPort)))
+	}
+	if err != nil {
+		return errors.New("failed to setup push server: " + err.Error())
+	}
+	return res.servePush(ctx, tls.NewListener(l, pushConfig(cert)))
+}
+
+// pushConfig returns the TLS configuration of a push server with cert
+func pushConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// servePush accepts DSO sessions on l until ctx is done
+func (res *Resolver) servePush(ctx context.Context, l net.Listener) error {
+	res.listening.set("push", true)
+	defer res.listening.set("push", false)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		l.Close()
+	}()
+
+	h := res.handler()
+	for {
+		conn, err := l.Accept()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return errors.New("not serving push any more: " + err.Error())
+		}
+		go res.servePushConn(ctx, conn, h)
+	}
+}
+
+// servePushConn serves the session on conn until the client closes it,
+// lets it time out or breaks the protocol - DSO messages manage the
+// subscriptions, other queries are answered as over TCP
+func (res *Resolver) servePushConn(ctx context.Context, conn net.Conn, h dns.Handler) {
+	s := newPushSession(conn)
+	go s.write()
+	res.pushes.add(s)
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer func() {
+		stop()
+		res.pushes.remove(s)
+		close(s.out)
+	}()
+
+	established := false
+	for {
+		timeout := pushInactivity
+		if s.subscribed() > 0 {
+			timeout = 2 * pushKeepalive
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		b := make([]byte, length)
+		if _, err := io.ReadFull(conn, b); err != nil || len(b) < 12 {
+			return
+		}
+
+		flags := binary.BigEndian.Uint16(b[2:])
+		switch {
+		case int(flags>>11&0xF) != dns.OpcodeStateful:
+			res.servePushQuery(s, b, h)
+		case flags&(1<<15) != 0:
+			// a response, we send no requests
+		case !res.serveDSO(s, b, &established):
+			return
+		}
+	}
+}
+
+// serveDSO acts on the DSO message b, it returns false if the session
+// has to be closed
+func (res *Resolver) serveDSO(s *pushSession, b []byte, established *bool) bool {
+	id := binary.BigEndian.Uint16(b)
+	tlvs, ok := dsoTLVs(b[12:])
+	for _, c := range b[4:12] {
+		ok = ok && c == 0
+	}
+	if !ok || len(tlvs) == 0 {
+		if id != 0 {
+			s.send(dsoMessage(id, true, dns.RcodeFormatError))
+		}
+		return false
+	}
+
+	// unidirectional messages, only once the client has set up the
+	// session
+	primary := tlvs[0]
+	if id == 0 {
+		if !*established {
+			return false
+		}
+		switch primary.typ {
+		case dsoUnsubscribe:
+			if len(primary.data) != 2 {
+				return false
+			}
+			s.Lock()
+			delete(s.subs, binary.BigEndian.Uint16(primary.data))
+			s.Unlock()
+		case dsoReconfirm:
+			// our records are the source, there is nothing to reconfirm
+		default:
+			return false
+		}
+		return true
+	}
+
+	switch primary.typ {
+	case dsoKeepalive:
+		*established = true
+		s.send(dsoMessage(id, true, dns.RcodeSuccess, keepaliveTLV()))
+	case dsoSubscribe:
+		*established = true
+		res.subscribe(s, id, primary.data)
+	default:
+		s.send(dsoMessage(id, true, dns.RcodeStatefulTypeNotImplemented))
+	}
+	return true
+}
+
+// subscribe adds the subscription in data to s and pushes the records it
+// covers
+func (res *Resolver) subscribe(s *pushSession, id uint16, data []byte) {
+	config := res.config()
+	name, off, err := dns.UnpackDomainName(data, 0)
+	if err != nil || len(data) != off+4 {
+		s.send(dsoMessage(id, true, dns.RcodeFormatError))
+		return
+	}
+	q := dns.Question{
+		Name:   strings.ToLower(name),
+		Qtype:  binary.BigEndian.Uint16(data[off:]),
+		Qclass: binary.BigEndian.Uint16(data[off+2:]),
+	}
+
+	s.Lock()
+	_, dup := s.subs[id]
+	s.Unlock()
+
+	var ip net.IP
+	if addr, ok := s.conn.RemoteAddr().(*net.TCPAddr); ok {
+		ip = addr.IP
+	}
+	switch {
+	case dup:
+		s.send(dsoMessage(id, true, dns.RcodeFormatError))
+		return
+	case len(config.AllowQuery) > 0 && !inNetworks(ip, config.AllowQuery):
+		s.send(dsoMessage(id, true, dns.RcodeRefused))
+		return
+	case !dns.IsSubDomain(res.zone(), q.Name):
+		s.send(dsoMessage(id, true, dns.RcodeNotAuth))
+		return
+	case !res.roleAllowed(&pushWriter{s: s}, q.Name):
+		s.send(dsoMessage(id, true, dns.RcodeRefused))
+		return
+	}
+
+	// with the records locked, no change slips in between the records
+	// we push and the subscription
+	res.rsLock.RLock()
+	defer res.rsLock.RUnlock()
+
+	var rrs []dns.RR
+	for _, rr := range res.zoneRecords(&res.rs) {
+		if pushMatches(q, rr) {
+			rrs = append(rrs, rr)
+		}
+	}
+
+	s.Lock()
+	s.subs[id] = q
+	s.Unlock()
+	s.send(dsoMessage(id, true, dns.RcodeSuccess))
+	for _, m := range pushMessages(rrs) {
+		s.send(m)
+	}
+}
+
+// servePushQuery answers the query b sent on the session s
+func (res *Resolver) servePushQuery(s *pushSession, b []byte, h dns.Handler) {
+	r := new(dns.Msg)
+	if err := r.Unpack(b); err != nil || len(r.Question) != 1 {
+		return
+	}
+
+	w := &pushWriter{s: s}
+	if r.IsTsig() != nil {
+		w.tsigErr = errors.New("tsig is not supported on push sessions")
+	}
+	h.ServeDNS(w, r)
+}
+
+// pushWriter writes responses to a push session
+type pushWriter struct {
+	s       *pushSession
+	tsigErr error
+}
+
+func (w *pushWriter) LocalAddr() net.Addr {
+	return w.s.conn.LocalAddr()
+}
+
+// RemoteAddr is the TCP address of the client, so responses aren't
+// truncated
+func (w *pushWriter) RemoteAddr() net.Addr {
+	return w.s.conn.RemoteAddr()
+}
+
+func (w *pushWriter) WriteMsg(m *dns.Msg) error {
+	b, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Write queues b for the client, more than one message can be written
+// for zone transfers
+func (w *pushWriter) Write(b []byte) (int, error) {
+	if len(b) > dns.MaxMsgSize {
+		return 0, errors.New("response too large")
+	}
+
+	w.s.send(append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (w *pushWriter) Close() error {
+	return w.s.conn.Close()
+}
+
+func (w *pushWriter) TsigStatus() error {
+	return w.tsigErr
+}
+
+func (w *pushWriter) TsigTimersOnly(bool) {}
+
+func (w *pushWriter) Hijack() {}
@@ -0,0 +1,150 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// readDSO reads a message from conn and returns its id, rcode and TLVs
+func readDSO(t *testing.T, conn net.Conn) (uint16, int, []dsoTLV) {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+	tlvs, ok := dsoTLVs(b[12:])
+	if !ok {
+		t.Fatalf("invalid TLVs in %v", b)
+	}
+	return binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]) & 0xF), tlvs
+}
+
+// writeDSO sends the DSO request id with tlv to conn
+func writeDSO(conn net.Conn, id uint16, tlv dsoTLV) {
+	b := dsoMessage(id, false, dns.RcodeSuccess, tlv)
+	binary.Write(conn, binary.BigEndian, uint16(len(b)))
+	conn.Write(b)
+}
+
+// pushed returns the records a PUSH carries
+func pushed(t *testing.T, tlvs []dsoTLV) []dns.RR {
+	if len(tlvs) != 1 || tlvs[0].typ != dsoPush {
+		t.Fatalf("expected a push, got %v", tlvs)
+	}
+
+	var rrs []dns.RR
+	for b, off := tlvs[0].data, 0; off < len(b); {
+		rr, next, err := dns.UnpackRR(b, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, rr)
+		off = next
+	}
+	return rrs
+}
+
+func subscribeTLV(name string, qtype uint16) dsoTLV {
+	b := make([]byte, 256)
+	n, _ := dns.PackDomainName(name, b, 0, nil, false)
+	b = binary.BigEndian.AppendUint16(b[:n], qtype)
+	return dsoTLV{typ: dsoSubscribe, data: binary.BigEndian.AppendUint16(b, dns.ClassINET)}
+}
+
+func TestPush(t *testing.T) {
+	res := New(records.Config{Domain: "mesos", TTL: 60, PushPort: 5352,
+		RoleZones: true, RoleACLs: map[string][]string{"dev": {"10.1.0.0/16"}}})
+	publish := func(hosts ...string) {
+		res.rsLock.Lock()
+		defer res.rsLock.Unlock()
+		res.base = records.RecordGenerator{
+			As:   map[string][]string{"web.marathon.mesos.": hosts},
+			SRVs: map[string][]string{},
+			TXTs: map[string][]string{},
+		}
+		res.publish()
+	}
+	publish("10.0.0.1")
+
+	cert := testCert(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", pushConfig(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go res.servePush(ctx, l)
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// keepalive sets up the session
+	writeDSO(conn, 1, dsoTLV{typ: dsoKeepalive, data: make([]byte, 8)})
+	if id, rcode, tlvs := readDSO(t, conn); id != 1 || rcode != dns.RcodeSuccess || len(tlvs) != 1 || tlvs[0].typ != dsoKeepalive {
+		t.Fatalf("unexpected keepalive response %d %d %v", id, rcode, tlvs)
+	}
+
+	// names outside the domain are refused
+	writeDSO(conn, 2, subscribeTLV("example.com.", dns.TypeA))
+	if _, rcode, _ := readDSO(t, conn); rcode != dns.RcodeNotAuth {
+		t.Errorf("expected NOTAUTH, got %d", rcode)
+	}
+
+	// so are the names of roles the client may not query
+	writeDSO(conn, 2, subscribeTLV("web.marathon.dev.mesos.", dns.TypeA))
+	if _, rcode, _ := readDSO(t, conn); rcode != dns.RcodeRefused {
+		t.Errorf("expected REFUSED, got %d", rcode)
+	}
+
+	// the current records come right after the subscription
+	writeDSO(conn, 3, subscribeTLV("web.marathon.mesos.", dns.TypeA))
+	if id, rcode, _ := readDSO(t, conn); id != 3 || rcode != dns.RcodeSuccess {
+		t.Fatalf("unexpected subscribe response %d %d", id, rcode)
+	}
+	_, _, tlvs := readDSO(t, conn)
+	if rrs := pushed(t, tlvs); len(rrs) != 1 || rrs[0].(*dns.A).A.String() != "10.0.0.1" {
+		t.Errorf("expected 10.0.0.1, got %v", rrs)
+	}
+
+	// then the changes
+	publish("10.0.0.2")
+	_, _, tlvs = readDSO(t, conn)
+	rrs := pushed(t, tlvs)
+	if len(rrs) != 2 || rrs[0].Header().Ttl != pushRemoved || rrs[0].(*dns.A).A.String() != "10.0.0.1" ||
+		rrs[1].Header().Ttl != 60 || rrs[1].(*dns.A).A.String() != "10.0.0.2" {
+		t.Errorf("expected 10.0.0.1 removed and 10.0.0.2 added, got %v", rrs)
+	}
+
+	// none after unsubscribing, the next message is the keepalive response
+	writeDSO(conn, 0, dsoTLV{typ: dsoUnsubscribe, data: []byte{0, 3}})
+	writeDSO(conn, 4, dsoTLV{typ: dsoKeepalive, data: make([]byte, 8)})
+	if id, _, _ := readDSO(t, conn); id != 4 {
+		t.Fatal("expected the keepalive response")
+	}
+	publish("10.0.0.3")
+	writeDSO(conn, 5, dsoTLV{typ: dsoKeepalive, data: make([]byte, 8)})
+	if id, _, _ := readDSO(t, conn); id != 5 {
+		t.Error("pushed a change after unsubscribing")
+	}
+
+	// unknown TLVs get DSOTYPENI
+	writeDSO(conn, 6, dsoTLV{typ: 0xf000})
+	if _, rcode, _ := readDSO(t, conn); rcode != dns.RcodeStatefulTypeNotImplemented {
+		t.Errorf("expected DSOTYPENI, got %d", rcode)
+	}
+}
@@ -0,0 +1,119 @@
+package resolver
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// queryEntry is a line of the query log
+type queryEntry struct {
+	Time      string  `json:"time"`
+	Client    string  `json:"client"`
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Rcode     string  `json:"rcode"`
+	Answers   int     `json:"answers"`
+	LatencyMs float64 `json:"latency_ms"`
+	Handler   string  `json:"handler"`
+}
+
+// queryLog writes a sample of the queries as JSON lines
+type queryLog struct {
+	sync.Mutex
+	enc    *json.Encoder
+	sample float64
+}
+
+// newQueryLog returns a queryLog appending to path, or to stdout for "-"
+func newQueryLog(path string, sample float64) (*queryLog, error) {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &queryLog{enc: json.NewEncoder(w), sample: sample}, nil
+}
+
+// sampled reports whether the next query is logged
+func (l *queryLog) sampled() bool {
+	return l.sample >= 1 || rand.Float64() < l.sample
+}
+
+// write logs e
+func (l *queryLog) write(e *queryEntry) {
+	l.Lock()
+	defer l.Unlock()
+	if err := l.enc.Encode(e); err != nil {
+		logging.Error.Println("cannot write the query log:", err)
+	}
+}
+
+// queryLogWriter remembers the response written, for the query log
+type queryLogWriter struct {
+	dns.ResponseWriter
+	m *dns.Msg
+}
+
+func (w *queryLogWriter) WriteMsg(m *dns.Msg) error {
+	w.m = m
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// Write remembers the packed responses, e.g. from the answer cache
+func (w *queryLogWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if m.Unpack(b) == nil {
+		w.m = m
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// queryLogged logs a sample of the queries h answers, with the client,
+// the outcome and how long it took
+func (res *Resolver) queryLogged(h dns.Handler) dns.Handler {
+	if res.queryLog == nil {
+		return h
+	}
+
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if len(r.Question) == 0 || !res.queryLog.sampled() {
+			h.ServeDNS(w, r)
+			return
+		}
+
+		start := time.Now()
+		lw := &queryLogWriter{ResponseWriter: w}
+		h.ServeDNS(lw, r)
+
+		q := r.Question[0]
+		e := &queryEntry{
+			Time:      start.UTC().Format(time.RFC3339Nano),
+			Name:      q.Name,
+			Type:      dns.TypeToString[q.Qtype],
+			Rcode:     "DROPPED",
+			LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+			Handler:   "forwarded",
+		}
+		if ip := remoteIP(w); ip != nil {
+			e.Client = ip.String()
+		}
+		if lw.m != nil {
+			e.Rcode = dns.RcodeToString[lw.m.Rcode]
+			e.Answers = len(lw.m.Answer)
+		}
+		if dns.IsSubDomain(res.config().Domain+".", dns.Fqdn(q.Name)) {
+			e.Handler = "mesos"
+		}
+		res.queryLog.write(e)
+	})
+}
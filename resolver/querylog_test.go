@@ -0,0 +1,106 @@
+package resolver
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestQueryLogged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "querylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queries.log")
+
+	res := New(records.Config{Domain: "mesos", QueryLog: path, QueryLogSample: 1})
+	h := res.queryLogged(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Question[0].Name == "dropped.mesos." {
+			return
+		}
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Name != "example.com." {
+			m.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET}, A: net.IPv4(10, 0, 0, 1)}}
+		} else {
+			m.Rcode = dns.RcodeNameError
+		}
+		// packed like the answers from the answer cache
+		if r.Question[0].Name == "cached.marathon.mesos." {
+			wire, _ := m.Pack()
+			w.Write(wire)
+			return
+		}
+		w.WriteMsg(m)
+	}))
+
+	client := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}
+	for _, q := range []struct {
+		name  string
+		qtype uint16
+	}{
+		{"web.marathon.mesos.", dns.TypeA},
+		{"example.com.", dns.TypeAAAA},
+		{"dropped.mesos.", dns.TypeA},
+		{"cached.marathon.mesos.", dns.TypeA},
+	} {
+		h.ServeDNS(&fakeWriter{remote: client}, new(dns.Msg).SetQuestion(q.name, q.qtype))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []queryEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e queryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+
+	var tests = []queryEntry{
+		{Client: "192.0.2.1", Name: "web.marathon.mesos.", Type: "A", Rcode: "NOERROR", Answers: 1, Handler: "mesos"},
+		{Client: "192.0.2.1", Name: "example.com.", Type: "AAAA", Rcode: "NXDOMAIN", Handler: "forwarded"},
+		{Client: "192.0.2.1", Name: "dropped.mesos.", Type: "A", Rcode: "DROPPED", Handler: "mesos"},
+		{Client: "192.0.2.1", Name: "cached.marathon.mesos.", Type: "A", Rcode: "NOERROR", Answers: 1, Handler: "mesos"},
+	}
+	if len(entries) != len(tests) {
+		t.Fatalf("expected %d entries, got %v", len(tests), entries)
+	}
+	for i, want := range tests {
+		got := entries[i]
+		if got.Time == "" || got.LatencyMs < 0 {
+			t.Errorf("%s: expected the time and latency, got %+v", want.Name, got)
+		}
+		got.Time, got.LatencyMs = "", 0
+		if got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	}
+}
+
+func TestQueryLogSampled(t *testing.T) {
+	l := &queryLog{sample: 0.1}
+	n := 0
+	for i := 0; i < 10000; i++ {
+		if l.sampled() {
+			n++
+		}
+	}
+	if n < 700 || n > 1300 {
+		t.Errorf("expected about 1000 of 10000 queries sampled, got %d", n)
+	}
+}
@@ -0,0 +1,139 @@
+package resolver
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// bucket holds the tokens of a client, one is taken per query, and how
+// many of its last queries had none
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	limited int
+}
+
+// rateLimiter limits the queries of each client, or whatever its keys
+// stand for, with a token bucket that fills at qps tokens a second up to
+// burst
+// a nil *rateLimiter allows everything
+type rateLimiter struct {
+	sync.Mutex
+	qps     float64
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newRateLimiter(qps float64, burst int) *rateLimiter {
+	b := float64(burst)
+	if b < 1 {
+		b = qps
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &rateLimiter{qps: qps, burst: b, buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token for key at now and reports whether it had one,
+// and if not how many queries in a row it has been limited for
+func (l *rateLimiter) allow(key string, now time.Time) (ok bool, limited int) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.sweep(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.qps
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = 0
+		return true, 0
+	}
+
+	b.limited++
+	return false, b.limited
+}
+
+// sweep drops the buckets that filled up again, they are the same as
+// new ones, so keys that went away don't use memory - at most once a
+// second
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Second {
+		return
+	}
+	l.swept = now
+
+	full := time.Duration(l.burst / l.qps * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateClient returns the rate limiting key of the client behind w, its
+// address or, for IPv6, its /64 network
+func rateClient(w dns.ResponseWriter) string {
+	var ip net.IP
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.TCPAddr:
+		ip = addr.IP
+	}
+
+	if ip.To4() == nil && ip != nil {
+		return ip.Mask(net.CIDRMask(64, 128)).String()
+	}
+	return ip.String()
+}
+
+// rateLimited answers queries of clients over RateLimitQPS with REFUSED,
+// or not at all with the drop RateLimitAction, and passes the rest to h
+func (res *Resolver) rateLimited(h dns.Handler) dns.Handler {
+	if res.limiter == nil {
+		return h
+	}
+
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		client := rateClient(w)
+		ok, limited := res.limiter.allow(client, time.Now())
+		if ok {
+			h.ServeDNS(w, r)
+			return
+		}
+
+		logging.CurLog.RateLimited += 1
+		if limited == 1 {
+			logging.CurLog.RateLimitedClients += 1
+			logging.Error.Println("rate limiting queries from " + client)
+		}
+
+		if res.config().RateLimitAction == "drop" {
+			return
+		}
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		res.reply(w, r, m)
+	})
+}
@@ -0,0 +1,88 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("192.0.2.1", now); !ok {
+			t.Fatalf("expected query %d of the burst to be allowed", i)
+		}
+	}
+	for i := 1; i <= 2; i++ {
+		if ok, limited := l.allow("192.0.2.1", now); ok || limited != i {
+			t.Errorf("expected query %d over the burst to be limited, got %v %d", i, ok, limited)
+		}
+	}
+	if ok, _ := l.allow("192.0.2.2", now); !ok {
+		t.Error("expected other clients not to be limited")
+	}
+	if ok, _ := l.allow("192.0.2.1", now.Add(500*time.Millisecond)); !ok {
+		t.Error("expected a token after half a second at 2 qps")
+	}
+
+	// full buckets are swept
+	l.allow("192.0.2.3", now.Add(time.Minute))
+	if _, ok := l.buckets["192.0.2.1"]; ok || len(l.buckets) != 1 {
+		t.Errorf("expected idle clients to be swept, got %v", l.buckets)
+	}
+
+	var nl *rateLimiter
+	if ok, _ := nl.allow("192.0.2.1", now); !ok {
+		t.Error("expected a nil limiter to allow everything")
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	client := func(ip string) *fakeWriter {
+		return &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP(ip), Port: 53}}
+	}
+	served := 0
+	h := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) { served++ })
+
+	for _, action := range []string{"refuse", "drop"} {
+		res := New(records.Config{Domain: "mesos", RateLimitQPS: 0.001, RateLimitBurst: 1, RateLimitAction: action})
+		handler := res.rateLimited(h)
+
+		served = 0
+		r := new(dns.Msg).SetQuestion("web.marathon.mesos.", dns.TypeA)
+		handler.ServeDNS(client("192.0.2.1"), r)
+
+		w := client("192.0.2.1")
+		handler.ServeDNS(w, r)
+		if served != 1 {
+			t.Errorf("%s: expected 1 query served, got %d", action, served)
+		}
+
+		switch action {
+		case "refuse":
+			if w.msg == nil || w.msg.Rcode != dns.RcodeRefused {
+				t.Errorf("%s: expected REFUSED, got %v", action, w.msg)
+			}
+		case "drop":
+			if w.msg != nil {
+				t.Errorf("%s: expected no answer, got %v", action, w.msg)
+			}
+		}
+
+		// IPv6 clients are limited by their /64
+		handler.ServeDNS(client("2001:db8::1"), r)
+		handler.ServeDNS(client("2001:db8::2"), r)
+		if served != 2 {
+			t.Errorf("%s: expected the second client of a /64 to be limited, got %d served", action, served)
+		}
+	}
+
+	if res := New(records.Config{Domain: "mesos"}); res.limiter != nil {
+		t.Error("expected no limiter without ratelimitqps")
+	}
+}
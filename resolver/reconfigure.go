@@ -0,0 +1,57 @@
+package resolver
+
+import (
+	"reflect"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+// hotConfig copies the settings that can change while running from src
+// into dst
+func hotConfig(dst *records.Config, src records.Config) {
+	dst.Resolvers = src.Resolvers
+	dst.TTL = src.TTL
+	dst.Timeout = src.Timeout
+	dst.RefreshSeconds = src.RefreshSeconds
+	dst.Verbosity = src.Verbosity
+	dst.LogBackend = src.LogBackend
+	dst.LogFile = src.LogFile
+	dst.LogMaxSizeMB = src.LogMaxSizeMB
+	dst.LogMaxAgeHours = src.LogMaxAgeHours
+	dst.LogBackups = src.LogBackups
+	dst.SyslogAddress = src.SyslogAddress
+	dst.SyslogTag = src.SyslogTag
+}
+
+// Reconfigure applies the settings in c that can change while running -
+// resolvers, TTL, timeout, refresh interval, verbosity and where the logs
+// go - and warns if
+// others changed, they need a restart
+func (res *Resolver) Reconfigure(c records.Config) {
+	res.rsLock.Lock()
+	defer res.rsLock.Unlock()
+
+	next := *res.config()
+	hotConfig(&next, c)
+	if !reflect.DeepEqual(next, c) {
+		logging.Error.Println("configuration changes other than resolvers, ttl, timeout, " +
+			"refreshSeconds, verbosity and logging need a restart")
+	}
+
+	res.reconfigured.Store(&next)
+
+	// the TTL is in every answer
+	res.answers.reset()
+	logging.Verbose.Println("configuration reloaded")
+}
+
+// config returns the configuration in use, Config until Reconfigure
+// replaces it - it must not be modified, and a request reads it once so
+// the settings it sees agree
+func (res *Resolver) config() *records.Config {
+	if c := res.reconfigured.Load(); c != nil {
+		return c
+	}
+	return &res.Config
+}
@@ -0,0 +1,58 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestReconfigure(t *testing.T) {
+	res := New(records.Config{
+		Domain:         "mesos",
+		Port:           53,
+		TTL:            60,
+		RefreshSeconds: 60,
+		Resolvers:      []string{"8.8.8.8"},
+	})
+
+	c := res.Config
+	c.TTL = 30
+	c.Resolvers = []string{"8.8.4.4"}
+	c.Port = 8053
+	res.Reconfigure(c)
+
+	if res.config().TTL != 30 || res.config().Resolvers[0] != "8.8.4.4" {
+		t.Error("ttl and resolvers should change at runtime")
+	}
+	if res.config().Port != 53 {
+		t.Error("port should need a restart")
+	}
+}
+
+func TestReconfigureWhileServing(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			w := &fakeWriter{}
+			res.HandleMesos(w, new(dns.Msg).SetQuestion("chronos.marathon-0.6.0.mesos.", dns.TypeA))
+			if w.msg == nil || len(w.msg.Answer) == 0 {
+				t.Error("expected answers while reconfiguring")
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		c := *res.config()
+		c.TTL = 30 + i
+		res.Reconfigure(c)
+	}
+	<-done
+}
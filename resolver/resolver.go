@@ -3,63 +3,187 @@
 package resolver
 
 import (
+	"context"
 	"errors"
 	"github.com/mesosphere/mesos-dns/logging"
 	"github.com/mesosphere/mesos-dns/records"
+	"github.com/mesosphere/mesos-dns/tracing"
 	"math/rand"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-var (
-	recurseCnt = 3
-)
-
 // resolveOut queries other nameserver
 // randomly picks from the list that is not mesos
+// it follows at most cnt referrals before giving up
 func (res *Resolver) resolveOut(r *dns.Msg, nameserver string, proto string, cnt int) (*dns.Msg, error) {
-	var in *dns.Msg
-	var err error
+	in, err := res.exchange(r, nameserver, proto)
+	if err != nil {
+		return in, err
+	}
+
+	// recurse
+	if ns := referral(in); ns != "" {
+		if cnt <= 0 {
+			logging.CurLog.NonMesosHopLimit += 1
+			return nil, errors.New("too many referrals resolving " + r.Question[0].Name)
+		}
+
+		logging.CurLog.NonMesosRecursed += 1
+		// the nameservers of a referral don't count hops
+		r = withoutHops(r)
+		if res.config().QNameMinimize {
+			return res.minimize(r, referralZone(in), ns, proto, cnt-1)
+		}
+		return res.resolveOut(r, ns, proto, cnt-1)
+	}
+
+	return in, err
+}
 
+// exchange sends r to nameserver once, with the configured timeout
+func (res *Resolver) exchange(r *dns.Msg, nameserver string, proto string) (*dns.Msg, error) {
+	config := res.config()
 	c := new(dns.Client)
 	c.Net = proto
 
 	var t time.Duration = 5 * 1e9
-	if res.Config.Timeout != 0 {
-		t = time.Duration(int64(res.Config.Timeout * 1e9))
+	if config.Timeout != 0 {
+		t = time.Duration(int64(config.Timeout * 1e9))
 	}
 
 	c.DialTimeout = t
 	c.ReadTimeout = t
 	c.WriteTimeout = t
 
-	in, _, err = c.Exchange(r, nameserver)
-	if err != nil {
-		return in, err
+	in, rtt, err := c.Exchange(r, nameserver)
+	if err == nil {
+		res.stats.timing("upstream", rtt)
 	}
+	return in, err
+}
 
-	// recurse
-	if (in != nil) && (len(in.Answer) == 0) && (!in.MsgHdr.Authoritative) && (len(in.Ns) > 0) && (err != nil) {
+// referral returns the nameserver to ask next if in is a referral - no
+// answer, not authoritative and NS records but no SOA in the authority
+// section - preferring glue addresses over names
+func referral(in *dns.Msg) string {
+	if in == nil || len(in.Answer) > 0 || in.Authoritative || in.Rcode != dns.RcodeSuccess {
+		return ""
+	}
 
-		if cnt == recurseCnt {
-			logging.CurLog.NonMesosRecursed += 1
+	var ns string
+	for _, rr := range in.Ns {
+		switch rr := rr.(type) {
+		case *dns.SOA:
+			return ""
+		case *dns.NS:
+			if ns == "" {
+				ns = rr.Ns
+			}
 		}
+	}
 
-		if cnt > 0 {
+	if ns == "" {
+		return ""
+	}
 
-			if soa, ok := (in.Ns[0]).(*dns.SOA); ok {
-				return res.resolveOut(r, soa.Ns+":53", proto, cnt-1)
-			}
+	for _, rr := range in.Extra {
+		if a, ok := rr.(*dns.A); ok && strings.EqualFold(a.Hdr.Name, ns) {
+			return a.A.String() + ":53"
 		}
+	}
 
+	return ns + ":53"
+}
+
+// errLoop is returned when every resolver forwards back to us
+var errLoop = errors.New("no resolvers without forwarding loops")
+
+// resolvers returns the configured resolvers that don't loop back to us
+func (res *Resolver) resolvers() []string {
+	var resolvers []string
+	for _, r := range res.config().Resolvers {
+		if res.loops.isLooping(r) {
+			logging.CurLog.NonMesosLoops += 1
+			continue
+		}
+		resolvers = append(resolvers, r)
 	}
+	return resolvers
+}
 
-	return in, err
+// upstreamFailed reports whether an upstream answer should make us try
+// another resolver
+func upstreamFailed(m *dns.Msg, err error) bool {
+	if err != nil || m == nil {
+		return true
+	}
+
+	return m.Rcode == dns.RcodeServerFailure || m.Rcode == dns.RcodeRefused
+}
+
+// failover tries each resolver in order until one gives a good answer
+// if none does it returns the last answer
+func (res *Resolver) failover(r *dns.Msg, proto string) (*dns.Msg, error) {
+	var m *dns.Msg
+	err := errLoop
+
+	resolvers := res.upstreams(r.Question[0].Name)
+	for i := 0; i < len(resolvers); i++ {
+		nameserver := resolvers[i]
+		m, err = res.resolveOut(res.forwarded(r, nameserver), nameserver, proto, res.config().MaxReferrals)
+		if !upstreamFailed(m, err) {
+			break
+		}
+
+		logging.CurLog.NonMesosFailover += 1
+		logging.VeryVerbose.Println("resolver " + nameserver + " failed - trying next one")
+	}
+
+	return m, err
+}
+
+// race sends the query to all resolvers at once and returns the first
+// good answer - if none does it returns the last answer
+func (res *Resolver) race(r *dns.Msg, proto string) (*dns.Msg, error) {
+	type answer struct {
+		m   *dns.Msg
+		err error
+	}
+
+	resolvers := res.upstreams(r.Question[0].Name)
+	n := len(resolvers)
+	if n == 0 {
+		return nil, errLoop
+	}
+
+	// buffered so the losers don't block forever
+	answers := make(chan answer, n)
+	for i := 0; i < n; i++ {
+		nameserver := resolvers[i]
+		go func() {
+			m, err := res.resolveOut(res.forwarded(r, nameserver), nameserver, proto, res.config().MaxReferrals)
+			answers <- answer{m, err}
+		}()
+	}
+
+	var a answer
+	for i := 0; i < n; i++ {
+		a = <-answers
+		if !upstreamFailed(a.m, a.err) {
+			return a.m, a.err
+		}
+	}
+
+	return a.m, a.err
 }
 
 // cleanWild strips any wildcards out thus mapping cleanly to the
@@ -88,7 +212,8 @@ func (res *Resolver) splitDomain(dom string) (host string, port int) {
 
 // formatSRV returns the SRV resource record for target
 func (res *Resolver) formatSRV(name string, target string) (*dns.SRV, error) {
-	ttl := uint32(res.Config.TTL)
+	ttl := res.ttl(&res.rs, name)
+	priority, weight := res.rs.SRVWeight(strings.ToLower(name), target)
 
 	h, p := res.splitDomain(target)
 
@@ -99,8 +224,8 @@ func (res *Resolver) formatSRV(name string, target string) (*dns.SRV, error) {
 			Class:  dns.ClassINET,
 			Ttl:    ttl,
 		},
-		Priority: 0,
-		Weight:   0,
+		Priority: priority,
+		Weight:   weight,
 		Port:     uint16(p),
 		Target:   h + ".",
 	}, nil
@@ -108,31 +233,97 @@ func (res *Resolver) formatSRV(name string, target string) (*dns.SRV, error) {
 
 // formatA returns the A resource record for target
 func (res *Resolver) formatA(dom string, target string) (*dns.A, error) {
-	ttl := uint32(res.Config.TTL)
+	ttl := res.ttl(&res.rs, dom)
 
 	h, _ := res.splitDomain(target)
 
-	ip, err := net.ResolveIPAddr("ip4", h)
+	// addresses are resolved when records are generated
+	a := net.ParseIP(h).To4()
+	if a == nil {
+		return nil, errors.New("not an IPv4 address: " + h)
+	}
 
-	if err != nil {
-		return nil, err
-	} else {
-		a := ip.IP
+	return &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   dom,
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl},
+		A: a,
+	}, nil
+}
 
-		return &dns.A{
-			Hdr: dns.RR_Header{
-				Name:   dom,
-				Rrtype: dns.TypeA,
-				Class:  dns.ClassINET,
-				Ttl:    ttl},
-			A: a.To4(),
-		}, nil
+// formatTXT returns the TXT resource record for target
+func (res *Resolver) formatTXT(name string, target string) (*dns.TXT, error) {
+	ttl := res.ttl(&res.rs, name)
+
+	return &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Txt: splitTXT(target),
+	}, nil
+}
+
+// splitTXT splits target into the character-strings of a TXT record,
+// at most 255 bytes each once packed - an escape sequence stays whole
+func splitTXT(target string) []string {
+	var txt []string
+	start, n := 0, 0
+	for i := 0; i < len(target); {
+		size := 1
+		if target[i] == '\\' && i+1 < len(target) {
+			size = 2
+			if i+3 < len(target) && isDigit(target[i+1]) && isDigit(target[i+2]) && isDigit(target[i+3]) {
+				size = 4
+			}
+		}
+		if n == 255 {
+			txt = append(txt, target[start:i])
+			start, n = i, 0
+		}
+		i += size
+		n++
 	}
+	return append(txt, target[start:])
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// ttl returns the TTL of name in rs - its TTL override, the TTL its
+// tasks ask for or TTL - less the age of the records with TTLDecay so
+// clients don't keep stale records around for a full TTL when refreshes
+// stall
+func (res *Resolver) ttl(rs *records.RecordGenerator, name string) uint32 {
+	config := res.config()
+	name = strings.ToLower(name)
+
+	ttl, ok := config.TTLOverrides[name]
+	if !ok {
+		if ttl, ok = rs.TTL(name); !ok {
+			ttl = config.TTL
+		}
+	}
+
+	if fetched := atomic.LoadInt64(&res.fetched); config.TTLDecay && fetched != 0 {
+		ttl -= int(time.Since(time.Unix(0, fetched)) / time.Second)
+		if ttl < 0 {
+			ttl = 0
+		}
+	}
+
+	return uint32(ttl)
 }
 
 // formatSOA returns the SOA resource record for the mesos domain
 func (res *Resolver) formatSOA(dom string) (*dns.SOA, error) {
-	ttl := uint32(res.Config.TTL)
+	config := res.config()
+	ttl := uint32(config.TTL)
 
 	return &dns.SOA{
 		Hdr: dns.RR_Header{
@@ -141,13 +332,13 @@ func (res *Resolver) formatSOA(dom string) (*dns.SOA, error) {
 			Class:  dns.ClassINET,
 			Ttl:    ttl,
 		},
-		Ns:      res.Config.Mname,
-		Mbox:    res.Config.Email,
-		Serial:  uint32(time.Now().Unix()),
-		Refresh: ttl,
-		Retry:   600,
-		Expire:  86400,
-		Minttl:  ttl,
+		Ns:      config.Mname,
+		Mbox:    config.Email,
+		Serial:  atomic.LoadUint32(&res.serial),
+		Refresh: uint32(config.SOARefresh),
+		Retry:   uint32(config.SOARetry),
+		Expire:  uint32(config.SOAExpire),
+		Minttl:  uint32(config.SOAMinttl),
 	}, nil
 }
 
@@ -166,20 +357,145 @@ func shuffleAnswers(answers []dns.RR) []dns.RR {
 
 // HandleNonMesos makes non-mesos queries
 func (res *Resolver) HandleNonMesos(w dns.ResponseWriter, r *dns.Msg) {
+	config := res.config()
 	var err error
 	var m *dns.Msg
 
+	if res.loops.caught(r.Question[0].Name) {
+		res.reply(w, r, res.loopMsg(r))
+		return
+	}
+
+	if m = res.chaosMsg(r); m != nil {
+		res.reply(w, r, m)
+		return
+	}
+
+	if config.LocalZones {
+		if m = res.localAnswer(r); m != nil {
+			logging.CurLog.NonMesosLocal += 1
+
+			res.reply(w, r, m)
+			return
+		}
+	}
+
+	if m = res.overrideMsg(r); m != nil {
+		logging.CurLog.NonMesosRequests += 1
+		logging.CurLog.NonMesosOverridden += 1
+
+		res.reply(w, r, m)
+		return
+	}
+
+	if m = res.hostsMsg(r); m != nil {
+		logging.CurLog.NonMesosRequests += 1
+		logging.CurLog.NonMesosHostsFile += 1
+
+		res.reply(w, r, m)
+		return
+	}
+
+	if !config.RecurseOn {
+		logging.CurLog.NonMesosRequests += 1
+		logging.CurLog.NonMesosRefused += 1
+
+		m = new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+
+		res.reply(w, r, m)
+		return
+	}
+
+	if !res.recursionAllowed(w) {
+		logging.CurLog.NonMesosRequests += 1
+		logging.CurLog.NonMesosACLRefused += 1
+		logging.Verbose.Println("refused to forward " + r.Question[0].Name + " for " +
+			remoteIP(w).String() + ", not in allowrecursion")
+
+		m = new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+
+		res.reply(w, r, m)
+		return
+	}
+
+	if res.blocklist.blocked(r.Question[0].Name) {
+		logging.CurLog.NonMesosRequests += 1
+		logging.CurLog.NonMesosBlocked += 1
+
+		res.reply(w, r, res.blockedMsg(r))
+		return
+	}
+
+	if m, drop := res.rpzMsg(w, r); m != nil || drop {
+		logging.CurLog.NonMesosRequests += 1
+		logging.CurLog.NonMesosRPZ += 1
+
+		if m != nil {
+			res.reply(w, r, m)
+		}
+		return
+	}
+
+	if m = res.cache.get(r); m != nil {
+		logging.CurLog.NonMesosRequests += 1
+		logging.CurLog.NonMesosCached += 1
+
+		res.reply(w, r, res.forClient(r, m))
+		return
+	}
+
+	// fail fast instead of passing the query around chained forwarders
+	if h := hops(r); h >= config.MaxForwardHops {
+		logging.CurLog.NonMesosRequests += 1
+		logging.CurLog.NonMesosHopLimit += 1
+		logging.Error.Println(r.Question[0].Name + " already forwarded " + strconv.Itoa(h) +
+			" times, check the resolvers of chained forwarders")
+
+		m = new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		res.reply(w, r, m)
+		return
+	}
+
 	proto := "udp"
 	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
 		proto = "tcp"
 	}
 
-	for i := 0; i < len(res.Config.Resolvers); i++ {
-		nameserver := res.Config.Resolvers[i] + ":53"
-		m, err = res.resolveOut(r, nameserver, proto, recurseCnt)
+	span := tracing.StartSampledTrace("dns.forward")
+	span.Tag("dns.name", r.Question[0].Name)
+	span.Tag("dns.type", dns.TypeToString[r.Question[0].Qtype])
+	span.Tag("dns.proto", proto)
+	defer span.Finish()
+
+	// failover and race count the hop for the nameservers that may be
+	// chained mesos-dns instances
+	q := r.Copy()
+	if res.validator != nil {
+		// for the signatures to validate
+		if opt := q.IsEdns0(); opt != nil {
+			opt.SetDo()
+			opt.SetUDPSize(dns.DefaultMsgSize)
+		} else {
+			q.SetEdns0(dns.DefaultMsgSize, true)
+		}
+	}
+
+	m, shared, err := res.flights.do(r, proto, func() (*dns.Msg, error) {
+		forward := res.failover
+		if config.RaceResolvers {
+			forward = res.race
+		}
+		m, err := forward(q, proto)
 		if err == nil {
-			break
+			m = res.validated(r, m)
 		}
+		return m, err
+	})
+	if shared {
+		logging.CurLog.NonMesosCoalesced += 1
 	}
 
 	if err != nil {
@@ -198,10 +514,17 @@ func (res *Resolver) HandleNonMesos(w dns.ResponseWriter, r *dns.Msg) {
 	// tracing info
 	logging.CurLog.NonMesosRequests += 1
 
+	span.Tag("dns.rcode", dns.RcodeToString[m.Rcode])
 	if err != nil {
+		span.Tag("error", err.Error())
 		logging.Error.Println(err)
 		logging.CurLog.NonMesosFailed += 1
 	} else {
+		// answers that weren't validated are for the queries with CD set
+		// only
+		if res.validator == nil || !r.CheckingDisabled {
+			res.cache.set(r, m)
+		}
 
 		// nxdomain
 		if len(m.Answer) == 0 {
@@ -211,30 +534,100 @@ func (res *Resolver) HandleNonMesos(w dns.ResponseWriter, r *dns.Msg) {
 		}
 	}
 
-	err = w.WriteMsg(m)
-	if err != nil {
-		logging.Error.Println(err)
-	}
+	res.reply(w, r, res.forClient(r, m))
 }
 
 // HandleMesos is a resolver request handler that responds to a resource
 // question with resource answer(s)
-// it can handle {A, SRV, ANY}
+// it can handle {A, SRV, TXT, SOA, ANY} and answers everything else
+// with NODATA or NXDOMAIN
 func (res *Resolver) HandleMesos(w dns.ResponseWriter, r *dns.Msg) {
+	config := res.config()
 	var err error
 
+	// the budget starts before we wait for a reload to finish, so a slow
+	// reload leaves less time for the answer - the wait itself isn't
+	// bounded
+	b := newBudget(config.AnswerBudget)
+
 	dom := strings.ToLower(cleanWild(r.Question[0].Name))
 	qType := r.Question[0].Qtype
 
+	if qType == dns.TypeAXFR || qType == dns.TypeIXFR {
+		res.transfer(w, r)
+		return
+	}
+
+	if res.forwardUnderscore(dom, qType) {
+		res.HandleNonMesos(w, r)
+		return
+	}
+
+	if !res.roleAllowed(w, dom) {
+		logging.CurLog.MesosRequests += 1
+		logging.CurLog.MesosRefused += 1
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		res.reply(w, r, m)
+		return
+	}
+
+	// the lock is released before the response is written, so a slow
+	// client doesn't hold up a reload
+	res.rsLock.RLock()
+
+	res.canary.compare(dom, qType, &res.base)
+
+	key, cacheable := answerKeyFor(w, r)
+	if cacheable {
+		if ans, ok := res.answers.get(key); ok {
+			logging.CurLog.MesosRequests += 1
+			logging.CurLog.MesosCached += 1
+			switch {
+			case ans.answered:
+				logging.CurLog.MesosSuccess += 1
+			case ans.rcode == dns.RcodeNameError:
+				logging.CurLog.MesosNXDomain += 1
+			case ans.rcode == dns.RcodeSuccess:
+				logging.CurLog.MesosNoData += 1
+			}
+
+			res.rsLock.RUnlock()
+			writeAnswer(w, r, ans)
+			return
+		}
+	}
+
 	m := new(dns.Msg)
 	m.Authoritative = true
-	m.RecursionAvailable = true
+	m.RecursionAvailable = config.RecurseOn
 	m.SetReply(r)
 
+	// answer for the name the CNAMEs and DNAMEs of the question lead
+	// to, unless asked for the CNAME itself
+	name := r.Question[0].Name
+	var chain []dns.RR
+	if qType == dns.TypeCNAME {
+		if targets, ok := res.rs.CNAMEs[dom]; ok {
+			m.Answer = append(m.Answer, res.formatCNAME(name, targets[0]))
+		}
+	} else if chain, dom = res.cnameChain(dom); len(chain) > 0 {
+		// the first CNAME answers the question, a DNAME before it
+		// keeps its own name
+		for _, rr := range chain {
+			if rr.Header().Rrtype == dns.TypeCNAME {
+				rr.Header().Name = name
+				break
+			}
+		}
+		name = dom
+	}
+
 	switch qType {
 	case dns.TypeSRV:
-		for i := 0; i < len(res.rs.SRVs[dom]); i++ {
-			rr, err := res.formatSRV(r.Question[0].Name, res.rs.SRVs[dom][i])
+		for i := 0; i < len(res.rs.SRVs[dom]) && b.left(); i++ {
+			rr, err := res.formatSRV(name, res.rs.SRVs[dom][i])
 			if err != nil {
 				logging.Error.Println(err)
 			} else {
@@ -242,7 +635,7 @@ func (res *Resolver) HandleMesos(w dns.ResponseWriter, r *dns.Msg) {
 			}
 		}
 	case dns.TypeA:
-		for i := 0; i < len(res.rs.As[dom]); i++ {
+		for i := 0; i < len(res.rs.As[dom]) && b.left(); i++ {
 			rr, err := res.formatA(dom, res.rs.As[dom][i])
 			if err != nil {
 				logging.Error.Println(err)
@@ -251,10 +644,26 @@ func (res *Resolver) HandleMesos(w dns.ResponseWriter, r *dns.Msg) {
 			}
 
 		}
+	case dns.TypeAAAA:
+		for i := 0; res.dns64 != nil && i < len(res.rs.As[dom]) && b.left(); i++ {
+			rr, err := res.formatA(dom, res.rs.As[dom][i])
+			if err != nil {
+				logging.Error.Println(err)
+			} else {
+				m.Answer = append(m.Answer, synthesizeAAAA(res.dns64, rr))
+			}
+		}
 	case dns.TypeANY:
+		if dom == res.zone() {
+			if rr, err := res.formatSOA(res.zone()); err == nil {
+				m.Answer = append(m.Answer, rr)
+			}
+			m.Answer = append(m.Answer, res.nsRecords()...)
+		}
+
 		// refactor me
-		for i := 0; i < len(res.rs.As[dom]); i++ {
-			rr, err := res.formatA(r.Question[0].Name, res.rs.As[dom][i])
+		for i := 0; i < len(res.rs.As[dom]) && b.left(); i++ {
+			rr, err := res.formatA(name, res.rs.As[dom][i])
 			if err != nil {
 				logging.Error.Println(err)
 			} else {
@@ -262,7 +671,7 @@ func (res *Resolver) HandleMesos(w dns.ResponseWriter, r *dns.Msg) {
 			}
 		}
 
-		for i := 0; i < len(res.rs.SRVs[dom]); i++ {
+		for i := 0; i < len(res.rs.SRVs[dom]) && b.left(); i++ {
 			rr, err := res.formatSRV(dom, res.rs.SRVs[dom][i])
 			if err != nil {
 				logging.Error.Println(err)
@@ -271,104 +680,731 @@ func (res *Resolver) HandleMesos(w dns.ResponseWriter, r *dns.Msg) {
 			}
 		}
 
+		for i := 0; i < len(res.rs.TXTs[dom]) && b.left(); i++ {
+			rr, err := res.formatTXT(name, res.rs.TXTs[dom][i])
+			if err != nil {
+				logging.Error.Println(err)
+			} else {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+
+	case dns.TypeTXT:
+		for i := 0; i < len(res.rs.TXTs[dom]) && b.left(); i++ {
+			rr, err := res.formatTXT(name, res.rs.TXTs[dom][i])
+			if err != nil {
+				logging.Error.Println(err)
+			} else {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+
+		if dom == res.zone() && config.ZoneMetadata {
+			m.Answer = append(m.Answer, res.metadata(name)...)
+		}
+
 	case dns.TypeSOA:
+		if dom == res.zone() {
+			rr, err := res.formatSOA(res.zone())
+			if err != nil {
+				logging.Error.Println(err)
+			} else {
+				m.Answer = append(m.Answer, rr)
+				m.Ns = append(m.Ns, res.nsRecords()...)
+				m.Extra = append(m.Extra, res.glue()...)
+			}
+		}
 
-		m = new(dns.Msg)
-		m.SetReply(r)
+	case dns.TypeNS:
+		if dom == res.zone() {
+			m.Answer = append(m.Answer, res.nsRecords()...)
+			m.Extra = append(m.Extra, res.glue()...)
+		}
 
-		rr, err := res.formatSOA(r.Question[0].Name)
-		if err != nil {
-			logging.Error.Println(err)
-		} else {
-			m.Ns = append(m.Ns, rr)
+	case dns.TypeLOC:
+		m.Answer = append(m.Answer, res.locRecords(&res.rs, name, dom)...)
+
+	case dns.TypeCAA:
+		m.Answer = append(m.Answer, res.caaRecords(name, dom)...)
+
+	case dns.TypeTLSA:
+		for i := 0; i < len(res.rs.TLSAs[dom]) && b.left(); i++ {
+			rr, err := res.formatTLSA(name, res.rs.TLSAs[dom][i])
+			if err != nil {
+				logging.Error.Println(err)
+			} else {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+
+	case dns.TypeURI:
+		for i := 0; i < len(res.rs.URIs[dom]) && b.left(); i++ {
+			m.Answer = append(m.Answer, res.formatURI(name, res.rs.URIs[dom][i]))
+		}
+
+	case dns.TypeSSHFP:
+		for i := 0; i < len(res.rs.SSHFPs[dom]) && b.left(); i++ {
+			rr, err := res.formatSSHFP(name, res.rs.SSHFPs[dom][i])
+			if err != nil {
+				logging.Error.Println(err)
+			} else {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+
+	case dns.TypeDNAME:
+		if target, ok := config.DNAMEs[dom]; ok {
+			m.Answer = append(m.Answer, res.formatDNAME(name, target))
+		}
+
+	case dns.TypeDNSKEY:
+		if dom == res.zone() && res.signer != nil {
+			m.Answer = append(m.Answer, res.signer.keys()...)
 		}
 
 	}
 
-	// shuffle answers
-	m.Answer = shuffleAnswers(m.Answer)
+	m.Answer = res.filter(w, r, m.Answer)
+
+	m.Answer = res.order(w, m.Answer)
+	m.Answer = res.healthOrder(m.Answer)
+	m.Answer = append(chain, m.Answer...)
+
+	if b.exceeded {
+		logging.CurLog.MesosPartial += 1
+		logging.Error.Println("answer for " + dom + " exceeded the " + strconv.Itoa(config.AnswerBudget) +
+			"ms budget, sending " + strconv.Itoa(len(m.Answer)) + " records")
+		if len(m.Answer) == 0 {
+			err = errBudget
+		}
+		shorten(m.Answer)
+	}
 
 	// tracing info
 	logging.CurLog.MesosRequests += 1
 
 	if err != nil {
 		logging.CurLog.MesosFailed += 1
-	} else if (qType == dns.TypeAAAA) && (len(res.rs.SRVs[dom]) > 0 || len(res.rs.As[dom]) > 0) {
+		m.SetRcode(r, dns.RcodeServerFailure)
+	} else if len(m.Answer) == 0 {
+		res.negative(m, dom)
+	} else {
+		logging.CurLog.MesosSuccess += 1
+	}
 
-		m = new(dns.Msg)
-		m.Authoritative = true
-		m.SetReply(r)
-		// set NOERROR
-		m.SetRcode(r, 0)
-		// leave answer empty (NOERROR --> NODATA)
+	res.dnssec(m, r, dom)
+
+	if !cacheable || res.answers == nil || err != nil || b.exceeded {
+		res.rsLock.RUnlock()
+		res.reply(w, r, m)
+		return
+	}
 
+	// the answer is cached before we let go of the lock, so a reload
+	// can't reset the cache in between and leave a stale answer in it
+	cw := &captureWriter{ResponseWriter: w}
+	res.reply(cw, r, m)
+	if cw.wire != nil {
+		res.answers.set(key, answer{wire: cw.wire, rcode: m.Rcode, answered: len(m.Answer) > 0})
+	}
+	res.rsLock.RUnlock()
+	cw.send()
+}
+
+// zone returns the fqdn of the mesos domain
+func (res *Resolver) zone() string {
+	return res.config().Domain + "."
+}
+
+// exists reports whether dom is a name in the mesos domain - a name with
+// records, the zone apex or an empty non-terminal on the way to a name
+// with records
+func (res *Resolver) exists(dom string) bool {
+	if dom == res.zone() {
+		return true
+	}
+
+	return res.tree().exists(dom)
+}
+
+// negative turns m into a negative answer for dom (RFC 2308) - NODATA
+// if the name exists, NXDOMAIN otherwise, both with the SOA in the
+// authority section so resolvers can cache them for the SOA minimum TTL
+func (res *Resolver) negative(m *dns.Msg, dom string) {
+	if res.exists(dom) {
+		m.Rcode = dns.RcodeSuccess
+		logging.CurLog.MesosNoData += 1
 	} else {
-		// no answers but not a {SOA,SRV} request
-		if len(m.Answer) == 0 && (qType != dns.TypeSOA) && (qType != dns.TypeSRV) {
+		m.Rcode = dns.RcodeNameError
+		logging.CurLog.MesosNXDomain += 1
+		logging.VeryVerbose.Println("total A rrs:\t" + strconv.Itoa(len(res.rs.As)))
+		logging.VeryVerbose.Println("failed looking for " + dom)
+	}
 
-			m = new(dns.Msg)
-			m.SetReply(r)
+	rr, err := res.formatSOA(res.zone())
+	if err != nil {
+		logging.Error.Println(err)
+		return
+	}
 
-			// set NXDOMAIN
-			m.SetRcode(r, 3)
+	// negative answers are cached for min(SOA TTL, SOA minimum)
+	if rr.Minttl < rr.Hdr.Ttl {
+		rr.Hdr.Ttl = rr.Minttl
+	}
+	m.Ns = append(m.Ns, rr)
+}
 
-			rr, err := res.formatSOA(r.Question[0].Name)
-			if err != nil {
-				logging.Error.Println(err)
-			} else {
-				m.Ns = append(m.Ns, rr)
-			}
+// maxSize returns the largest response the client that sent r accepts
+// over w - 512 bytes for plain UDP, the advertised EDNS0 buffer size (up
+// to our own) for EDNS0 clients and no limit over TCP
+func maxSize(w dns.ResponseWriter, r *dns.Msg) int {
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		return dns.MaxMsgSize
+	}
 
-			logging.CurLog.MesosNXDomain += 1
-			logging.VeryVerbose.Println("total A rrs:\t" + strconv.Itoa(len(res.rs.As)))
-			logging.VeryVerbose.Println("failed looking for " + r.Question[0].String())
-		} else {
-			logging.CurLog.MesosSuccess += 1
+	size := dns.MinMsgSize
+	if opt := r.IsEdns0(); opt != nil {
+		size = int(opt.UDPSize())
+		if size < dns.MinMsgSize {
+			size = dns.MinMsgSize
+		}
+		if size > dns.DefaultMsgSize {
+			size = dns.DefaultMsgSize
 		}
 	}
 
-	err = w.WriteMsg(m)
+	return size
+}
+
+// reply writes m in response to r - it compresses the response, adds
+// our EDNS0 OPT record for EDNS0 clients and makes sure the response
+// fits in the client's UDP buffer
+func (res *Resolver) reply(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	m.Compress = true
+
+	if opt := r.IsEdns0(); opt == nil {
+		// we may have added EDNS0 to a forwarded query
+		stripOPT(m)
+	} else if m.IsEdns0() == nil {
+		m.SetEdns0(dns.DefaultMsgSize, opt.Do())
+	}
+
+	if size := maxSize(w, r); m.Len() > size {
+		logging.CurLog.Truncated += 1
+		res.fit(m, size)
+	}
+
+	err := w.WriteMsg(m)
 	if err != nil {
 		logging.Error.Println(err)
 	}
 }
 
-// Serve starts a dns server for net protocol
-func (res *Resolver) Serve(net string) {
-	defer func() {
-		if rec := recover(); rec != nil {
-			logging.Error.Printf("%s\n", rec)
-			os.Exit(1)
+// fit shrinks m to size bytes - the additional and authority sections
+// go first, then either the whole answer with TC set so the client
+// retries over TCP or, with TrimAnswers, the answers that sort last
+// until the rest fits, so the same ones survive whatever their order
+func (res *Resolver) fit(m *dns.Msg, size int) {
+	// keep just the OPT record
+	extra := m.Extra
+	m.Extra = nil
+	for _, rr := range extra {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			m.Extra = append(m.Extra, rr)
 		}
-	}()
+	}
+	m.Ns = nil
+
+	if !res.config().TrimAnswers {
+		m.Truncated = true
+		m.Answer = nil
+		return
+	}
 
+	answers := m.Answer
+	keys := make(map[dns.RR]string, len(answers))
+	sorted := make([]dns.RR, len(answers))
+	for i, rr := range answers {
+		keys[rr] = rr.String()
+		sorted[i] = rr
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return keys[sorted[i]] < keys[sorted[j]] })
+
+	// keep sets the answer to the first n answers in sorted order, in
+	// the order they were in
+	keep := func(n int) {
+		kept := make(map[dns.RR]bool, n)
+		for _, rr := range sorted[:n] {
+			kept[rr] = true
+		}
+		m.Answer = nil
+		for _, rr := range answers {
+			if kept[rr] {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+	}
+	n := sort.Search(len(sorted)+1, func(n int) bool {
+		keep(n)
+		return m.Len() > size
+	})
+	if n > 0 {
+		n--
+	}
+	keep(n)
+}
+
+// handler returns the handler of every DNS server, the handlers
+// registered with the dns package behind our limits and logs
+func (res *Resolver) handler() dns.Handler {
+	return res.dnstapped(res.queryLogged(res.statsdCounted(res.aclChecked(res.rateLimited(res.responseLimited(dns.DefaultServeMux))))))
+}
+
+// Serve runs a dns server for net protocol until ctx is done
+func (res *Resolver) Serve(ctx context.Context, net string) error {
+	config := res.config()
 	server := &dns.Server{
-		Addr:       res.Config.Listener + ":" + strconv.Itoa(res.Config.Port),
+		Addr:       config.Listener + ":" + strconv.Itoa(config.Port),
 		Net:        net,
-		TsigSecret: nil,
+		TsigSecret: config.TSIGKeys,
+		Handler:    res.handler(),
+
+		NotifyStartedFunc: func() { res.listening.set(net, true) },
 	}
+	defer res.listening.set(net, false)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			server.Shutdown()
+		case <-done:
+		}
+	}()
 
-	err := server.ListenAndServe()
-	if err != nil {
-		logging.Error.Printf("Failed to setup "+net+" server: %s\n", err.Error())
-	} else {
-		logging.Error.Printf("Not listening/serving any more requests.")
+	var err error
+	switch {
+	case res.sockets[net] != nil:
+		err = res.serveInherited(server, net)
+	case net == "udp":
+		if server.PacketConn, err = res.listenUDP(server.Addr); err == nil {
+			err = server.ActivateAndServe()
+		}
+	default:
+		err = server.ListenAndServe()
 	}
 
-	os.Exit(1)
+	switch {
+	case ctx.Err() != nil:
+		return nil
+	case err != nil:
+		return errors.New("failed to setup " + net + " server: " + err.Error())
+	}
+	return errors.New("not serving " + net + " any more")
 }
 
 // Resolver holds configuration information and the resource records
 // refactor me
 type Resolver struct {
+	rsLock sync.RWMutex
 	rs     records.RecordGenerator
+
+	// Config is the configuration mesos-dns started with, read the one
+	// in use with config
 	Config records.Config
+
+	// reconfigured is the configuration the last Reconfigure applied, nil
+	// until there is one
+	reconfigured atomic.Pointer[records.Config]
+
+	// Version is the mesos-dns version we report in the zone metadata
+	Version string
+
+	// base holds the records from the last reload, rs is base plus the
+	// records added at runtime
+	base records.RecordGenerator
+
+	// warm is set while base holds records transferred from a peer at
+	// startup instead of ones from the masters
+	warm bool
+
+	// catalog is the catalog zone listing the zones we serve, nil if
+	// there is none
+	catalog *catalog
+
+	// journal holds the last IXFRJournal changes of the zone, oldest
+	// first, for IXFR
+	journal []delta
+
+	// pushes holds the sessions of DNS Push clients, nil if push is
+	// disabled
+	pushes *pushes
+
+	// cache holds forwarded responses, nil if caching is disabled
+	cache *cache
+
+	// flights coalesces identical forwarded queries, nil if disabled
+	flights *flights
+
+	// limiter limits the queries of each client, nil if disabled
+	limiter *rateLimiter
+
+	// rrl limits identical answers to each client network, nil if
+	// disabled
+	rrl *rateLimiter
+
+	// queryLog logs a sample of the queries, nil if disabled
+	queryLog *queryLog
+
+	// dnstap holds the dnstap messages to write, nil if disabled
+	dnstap *dnstap
+
+	// stats collects the timings and rcodes shipped to statsd, nil if
+	// disabled
+	stats *stats
+
+	// blocklist holds names we refuse to forward, nil if none are
+	// configured
+	blocklist *blocklist
+
+	// rpz holds the response policy zones, nil if none are configured
+	rpz *rpz
+
+	// loops tracks resolvers that forward back to us
+	loops *loopDetector
+
+	// peers tracks which other mesos-dns instances answer, nil if none
+	// are configured
+	peers *peers
+
+	// signer signs answers for the mesos domain, nil without DNSSEC
+	signer *signer
+
+	// validator checks the DNSSEC signatures of forwarded answers, nil if
+	// they aren't validated
+	validator *validator
+
+	// answers holds assembled responses for the mesos domain until the
+	// next reload, nil if disabled
+	answers *answers
+
+	// dns64 is the NAT64 prefix AAAA records are synthesized with from A
+	// records, nil without DNS64
+	dns64 *net.IPNet
+
+	// turns counts the queries for every name with the roundrobin
+	// AnswerOrder, nil otherwise
+	turns *turns
+
+	// listening tracks which DNS servers are serving, for /health
+	listening listeners
+
+	// sockets holds the sockets of the servers, by tcp, udp, doq, push
+	// and http, passed by systemd or opened by Bind - servers without one
+	// bind their own
+	sockets map[string]*os.File
+
+	// fetched is when records were last generated, in unix nanoseconds
+	fetched int64
+
+	// reloaded is when the last reload finished, in unix nanoseconds,
+	// and reloadTook how long it took
+	reloaded   int64
+	reloadTook int64
+
+	// clusters holds the last records of the other clusters
+	clusters clusters
+
+	// filters run over every answer in the mesos domain
+	filters []Filter
+
+	// canary holds new records being compared with base before they are
+	// served
+	canary *canary
+
+	// static holds the records added through the API
+	static *staticRecords
+
+	// hosts holds the names in the hosts files, nil if there are none
+	hosts *hostsFiles
+
+	// acme holds the ACME DNS-01 challenges added through the API
+	acme *challenges
+
+	// names holds the names of rs by label, nil until records are
+	// published
+	names *nameTree
+
+	// chain holds the names in the zone in canonical order, for NSEC
+	chain []string
+
+	// serial is the SOA serial, it changes when the records do
+	serial uint32
+}
+
+// New returns a Resolver for config
+func New(config records.Config) *Resolver {
+	res := &Resolver{
+		Config: config,
+		loops:  newLoopDetector(),
+		static: newStaticRecords(),
+		acme:   newChallenges(),
+	}
+
+	if len(config.Peers) > 0 {
+		res.peers = &peers{}
+	}
+
+	if config.AnswerOrder == "roundrobin" {
+		res.turns = newTurns()
+	}
+
+	res.dns64 = dns64Prefix(config.DNS64Prefix)
+
+	if config.CoalesceQueries {
+		res.flights = newFlights()
+	}
+
+	if config.RateLimitQPS > 0 {
+		res.limiter = newRateLimiter(config.RateLimitQPS, config.RateLimitBurst)
+	}
+
+	if config.RRLRate > 0 {
+		res.rrl = newRateLimiter(float64(config.RRLRate), config.RRLRate)
+	}
+
+	if config.QueryLog != "" {
+		l, err := newQueryLog(config.QueryLog, config.QueryLogSample)
+		if err != nil {
+			logging.Error.Println("cannot open the query log:", err)
+			os.Exit(1)
+		}
+		res.queryLog = l
+	}
+
+	if config.Dnstap != "" {
+		res.dnstap = newDnstap()
+	}
+
+	if config.StatsdAddress != "" {
+		res.stats = newStats()
+	}
+
+	if config.PushPort > 0 {
+		res.pushes = newPushes()
+	}
+
+	res.catalog = newCatalog(config)
+
+	fs, err := lookupFilters(config.Filters)
+	if err != nil {
+		logging.Error.Println(err)
+		os.Exit(1)
+	}
+	res.filters = fs
+
+	// cached answers would skip the filters, keep their TTLs and their
+	// order, only sorted answers are the same for every query
+	fixed := config.AnswerOrder == "sorted"
+	if config.AnswerCacheSize > 0 && len(fs) == 0 && !config.TTLDecay && fixed {
+		res.answers = newAnswers(config.AnswerCacheSize)
+	}
+
+	if config.DNSSEC {
+		s, err := newSigner(config)
+		if err != nil {
+			logging.Error.Println("cannot set up dnssec:", err)
+			os.Exit(1)
+		}
+		res.signer = s
+	}
+
+	if config.DNSSECValidate {
+		v, err := newValidator(config.TrustAnchors, res.validationQuery)
+		if err != nil {
+			logging.Error.Println("cannot set up dnssec validation:", err)
+			os.Exit(1)
+		}
+		res.validator = v
+	}
+
+	if config.CacheSize > 0 {
+		res.cache = newCache(config.CacheSize, config.CacheMaxTTL)
+	}
+
+	if len(config.Blocklists) > 0 {
+		res.blocklist = &blocklist{}
+	}
+
+	if len(config.RPZ) > 0 {
+		res.rpz = &rpz{}
+	}
+
+	if len(config.HostsFiles) > 0 {
+		res.hosts = newHostsFiles()
+		res.hosts.load(config.HostsFiles)
+	}
+
+	return res
 }
 
 // Reload triggers a new refresh from mesos master
 func (res *Resolver) Reload() {
+	config := *res.config()
+
+	span := tracing.StartTrace("records.reload")
+	defer span.Finish()
+
+	start := time.Now()
+	defer func() {
+		took := time.Since(start)
+		atomic.StoreInt64(&res.reloaded, time.Now().UnixNano())
+		atomic.StoreInt64(&res.reloadTook, int64(took))
+		res.stats.timing("reload", took)
+	}()
+
+	fetch := tracing.StartSpan("records.fetch", span)
 	t := records.RecordGenerator{}
-	t.ParseState(res.Config)
+	if len(config.Masters) > 0 {
+		t.ParseState(config)
+	} else {
+		// only other clusters
+		t.InsertState(records.StateJSON{}, config)
+	}
+	// in the configured order, so the same states make the same records
+	clusters := res.loadClusters(config)
+	for _, cl := range config.Clusters {
+		if rg, ok := clusters[cl.Name]; ok {
+			t.Merge(&rg, cl.Name)
+		}
+	}
+	if t.As != nil {
+		atomic.StoreInt64(&res.fetched, time.Now().UnixNano())
+	}
+	fetch.Tag("names", strconv.Itoa(len(t.As)+len(t.SRVs)+len(t.TXTs)))
+	fetch.Finish()
+
+	t.InsertPeers(res.peers.healthy(), config)
+	t.InsertUnderscoreTXT(config)
+	t.InsertCNAMEs(config)
+
+	// saved once the records are unlocked
+	var snapshot []dns.RR
+	defer func() {
+		if snapshot == nil {
+			return
+		}
+		if err := saveSnapshot(config.SnapshotFile, res.zone(), snapshot); err != nil {
+			logging.Error.Println("can't save snapshot: " + err.Error())
+		}
+	}()
+
+	res.rsLock.Lock()
+	defer res.rsLock.Unlock()
+
+	if res.warm && t.As == nil {
+		logging.Error.Println("keeping the records from a peer or snapshot until the masters answer")
+		return
+	}
+
+	t.HoldFrameworks(&res.base, time.Now(), time.Duration(config.FlapSeconds)*time.Second)
+
+	// the first records, and the ones replacing a peer's, have nothing to
+	// be compared with
+	if config.CanarySeconds > 0 && res.serial != 0 && !res.warm && !t.Equal(&res.base) {
+		res.startCanary(t, time.Duration(config.CanarySeconds)*time.Second)
+		span.Tag("canary", "true")
+		return
+	}
+
+	res.canary = nil
+	res.warm = false
+	res.base = t
+	res.publish()
+	if config.SnapshotFile != "" && t.As != nil {
+		snapshot = res.zoneRecords(&res.base)
+	}
+	span.Tag("serial", strconv.FormatUint(uint64(res.serial), 10))
+}
+
+// Refresh reloads the records every RefreshSeconds, as configured at the
+// time, until ctx is done - with jitter, and backing off while the
+// masters don't answer
+func (res *Resolver) Refresh(ctx context.Context) error {
+	failures := 0
+	for {
+		delay := refreshDelay(*res.config(), failures)
+		if failures > 0 {
+			logging.Verbose.Println("masters failed " + strconv.Itoa(failures) + " times in a row, next reload in " + delay.String())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		fetched := atomic.LoadInt64(&res.fetched)
+		res.CheckPeers()
+		res.Reload()
+		if atomic.LoadInt64(&res.fetched) != fetched {
+			failures = 0
+		} else {
+			failures++
+		}
+		res.DetectLoops()
+		logging.PrintCurLog()
+	}
+}
+
+// publish serves the records from the last reload plus the ones added at
+// runtime, moving the serial if they changed - the caller holds rsLock
+func (res *Resolver) publish() {
+	config := res.config()
+	t := res.base.Copy()
+	res.hosts.insert(&t, res.zone())
+	res.static.insert(&t)
+	res.acme.insert(&t)
+
+	if res.serial == 0 {
+		res.bumpSerial()
+	} else if !t.Equal(&res.rs) {
+		from := res.serial
+		removed, added := diffRecords(res.zoneRecords(&res.rs), res.zoneRecords(&t))
+		res.bumpSerial()
+		res.journal = appendDelta(res.journal, delta{from: from, to: res.serial, removed: removed, added: added}, config.IXFRJournal)
+		res.pushes.changed(removed, added)
+		go res.notify(res.serial)
+	}
 
 	res.rs = t
+	res.names = newNameTree(&res.rs)
+	for name := range config.CAA {
+		res.names.insert(name)
+	}
+	for name := range config.DNAMEs {
+		res.names.insert(name)
+	}
+	res.answers.reset()
+	res.turns.reset()
+	if res.signer != nil {
+		res.chain = nsecChain(&res.rs, res.zone())
+	}
+}
+
+// bumpSerial moves the SOA serial forward - to the current time if that
+// is ahead of it, by one otherwise so it never goes backwards
+func (res *Resolver) bumpSerial() {
+	serial := atomic.LoadUint32(&res.serial)
+
+	now := uint32(time.Now().Unix())
+	if now > serial {
+		serial = now
+	} else {
+		serial++
+	}
+
+	atomic.StoreUint32(&res.serial, serial)
+	logging.Verbose.Println("zone changed, new serial ", serial)
 }
@@ -1,12 +1,16 @@
 package resolver
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/mesosphere/mesos-dns/logging"
 	"github.com/mesosphere/mesos-dns/records"
 	"github.com/miekg/dns"
 	"io/ioutil"
+	"net"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -78,16 +82,19 @@ func TestShuffleAnswers(t *testing.T) {
 	}
 }
 
-func fakeDNS(port int) (Resolver, error) {
-	var res Resolver
+func fakeDNS(port int) (*Resolver, error) {
+	res := &Resolver{}
 	res.Config = records.Config{
-		TTL:       60,
-		Port:      port,
-		Domain:    "mesos",
-		Resolvers: records.GetLocalDNS(),
-		Listener:  "127.0.0.1",
-		Email:     "root.mesos-dns.mesos.",
-		Mname:     "mesos-dns.mesos.",
+		TTL:            60,
+		Port:           port,
+		Domain:         "mesos",
+		Resolvers:      records.GetLocalDNS(),
+		Listener:       "127.0.0.1",
+		Email:          "root.mesos-dns.mesos.",
+		Mname:          "mesos-dns.mesos.",
+		RecurseOn:      true,
+		MaxForwardHops: 3,
+		SOAMinttl:      30,
 	}
 
 	b, err := ioutil.ReadFile("../factories/fake.json")
@@ -101,9 +108,9 @@ func fakeDNS(port int) (Resolver, error) {
 		return res, err
 	}
 
-	masters := []string{"144.76.157.37:5050"}
+	res.Config.Masters = []string{"144.76.157.37:5050"}
 	res.rs = records.RecordGenerator{}
-	res.rs.InsertState(sj, "mesos", "mesos-dns.mesos.", "127.0.0.1", masters)
+	res.rs.InsertState(sj, res.Config)
 
 	return res, nil
 }
@@ -153,8 +160,8 @@ func TestHandler(t *testing.T) {
 	}
 
 	dns.HandleFunc("mesos.", res.HandleMesos)
-	go res.Serve("udp")
-	go res.Serve("tcp")
+	go res.Serve(context.Background(), "udp")
+	go res.Serve(context.Background(), "tcp")
 
 	// wait for startup ? lame
 	time.Sleep(10 * time.Millisecond)
@@ -251,8 +258,8 @@ func TestNonMesosHandler(t *testing.T) {
 	}
 
 	dns.HandleFunc(".", res.HandleNonMesos)
-	go res.Serve("udp")
-	go res.Serve("tcp")
+	go res.Serve(context.Background(), "udp")
+	go res.Serve(context.Background(), "tcp")
 
 	// wait for startup ? lame
 	time.Sleep(10 * time.Millisecond)
@@ -268,3 +275,333 @@ func TestNonMesosHandler(t *testing.T) {
 	}
 
 }
+
+func TestUpstreamFailed(t *testing.T) {
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+
+	if !upstreamFailed(nil, nil) {
+		t.Error("a missing answer is a failure")
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeServerFailure)
+	if !upstreamFailed(m, nil) {
+		t.Error("SERVFAIL is a failure")
+	}
+
+	m.SetRcode(r, dns.RcodeNameError)
+	if upstreamFailed(m, nil) {
+		t.Error("NXDOMAIN is a good answer")
+	}
+}
+
+// fakeWriter is a dns.ResponseWriter that keeps the written message
+type fakeWriter struct {
+	dns.ResponseWriter
+	msg    *dns.Msg
+	remote net.Addr
+}
+
+func (w *fakeWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *fakeWriter) Write(b []byte) (int, error) {
+	w.msg = new(dns.Msg)
+	return len(b), w.msg.Unpack(b)
+}
+
+func (w *fakeWriter) RemoteAddr() net.Addr {
+	if w.remote != nil {
+		return w.remote
+	}
+	return &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}
+}
+
+func (w *fakeWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+}
+
+func TestRecurseOff(t *testing.T) {
+	res := Resolver{Config: records.Config{RecurseOn: false}}
+
+	r := new(dns.Msg)
+	r.SetQuestion("google.com.", dns.TypeA)
+
+	w := &fakeWriter{}
+	res.HandleNonMesos(w, r)
+
+	if w.msg == nil || w.msg.Rcode != dns.RcodeRefused {
+		t.Error("should refuse queries outside the domain")
+	}
+}
+
+func TestReplyTruncation(t *testing.T) {
+	var res Resolver
+
+	r := new(dns.Msg)
+	r.SetQuestion("big.mesos.", dns.TypeA)
+
+	big := func() *dns.Msg {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for i := 0; i < 100; i++ {
+			rr, _ := res.formatA("big.mesos.", "10.0.0."+strconv.Itoa(i))
+			m.Answer = append(m.Answer, rr)
+		}
+		return m
+	}
+
+	// plain UDP is limited to 512 bytes
+	w := &fakeWriter{}
+	res.reply(w, r, big())
+	if !w.msg.Truncated || len(w.msg.Answer) != 0 {
+		t.Error("should truncate large UDP responses")
+	}
+
+	// EDNS0 clients get what fits in their buffer
+	r.SetEdns0(4096, false)
+	w = &fakeWriter{}
+	res.reply(w, r, big())
+	if w.msg.Truncated || len(w.msg.Answer) != 100 {
+		t.Error("should honor the EDNS0 buffer size")
+	}
+
+	if w.msg.IsEdns0() == nil {
+		t.Error("should answer EDNS0 with EDNS0")
+	}
+
+	// TCP is not limited
+	r = new(dns.Msg)
+	r.SetQuestion("big.mesos.", dns.TypeA)
+	w = &fakeWriter{remote: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}}
+	res.reply(w, r, big())
+	if w.msg.Truncated || len(w.msg.Answer) != 100 {
+		t.Error("should not truncate TCP responses")
+	}
+}
+
+func TestReplyTrim(t *testing.T) {
+	res := Resolver{Config: records.Config{TrimAnswers: true}}
+
+	r := new(dns.Msg)
+	r.SetQuestion("big.mesos.", dns.TypeA)
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	for i := 0; i < 100; i++ {
+		rr, _ := res.formatA("big.mesos.", "10.0.0."+strconv.Itoa(i))
+		m.Answer = append(m.Answer, rr)
+	}
+	first := m.Answer[0]
+
+	w := &fakeWriter{}
+	res.reply(w, r, m)
+
+	if w.msg.Truncated {
+		t.Error("should not set TC when trimming")
+	}
+
+	if n := len(w.msg.Answer); n == 0 || n == 100 || w.msg.Len() > dns.MinMsgSize {
+		t.Errorf("should trim to what fits in 512 bytes, got %d answers", n)
+	}
+
+	if w.msg.Answer[0] != first {
+		t.Error("should keep the answers in their order")
+	}
+
+	// the same answers survive whatever order they are in
+	survivors := func(m *dns.Msg) map[string]bool {
+		set := make(map[string]bool)
+		for _, rr := range m.Answer {
+			set[rr.String()] = true
+		}
+		return set
+	}
+	want := survivors(w.msg)
+	for i := 0; i < 10; i++ {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for j := 0; j < 100; j++ {
+			rr, _ := res.formatA("big.mesos.", "10.0.0."+strconv.Itoa(j))
+			m.Answer = append(m.Answer, rr)
+		}
+		m.Answer = shuffleAnswers(m.Answer)
+
+		w := &fakeWriter{}
+		res.reply(w, r, m)
+		if got := survivors(w.msg); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected the same %d answers to survive, got %d others", len(want), len(got))
+		}
+	}
+}
+
+func TestNegativeAnswers(t *testing.T) {
+	res, err := fakeDNS(8055)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name    string
+		qtype   uint16
+		rcode   int
+		answers int
+	}{
+		{"mesos.", dns.TypeSOA, dns.RcodeSuccess, 1},
+		{"chronos.marathon-0.6.0.mesos.", dns.TypeSOA, dns.RcodeSuccess, 0},
+		{"chronos.marathon-0.6.0.mesos.", dns.TypeAAAA, dns.RcodeSuccess, 0},
+		{"chronos.marathon-0.6.0.mesos.", dns.TypeMX, dns.RcodeSuccess, 0},
+		{"chronos.marathon-0.6.0.mesos.", dns.TypeTXT, dns.RcodeSuccess, 0},
+		{"_chronos._tcp.marathon-0.6.0.mesos.", dns.TypeA, dns.RcodeSuccess, 0},
+		{"marathon-0.6.0.mesos.", dns.TypeA, dns.RcodeSuccess, 0},
+		{"missing.mesos.", dns.TypeSRV, dns.RcodeNameError, 0},
+		{"missing.mesos.", dns.TypeMX, dns.RcodeNameError, 0},
+	}
+
+	for _, tt := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(tt.name, tt.qtype)
+
+		w := &fakeWriter{}
+		res.HandleMesos(w, r)
+		m := w.msg
+
+		if m.Rcode != tt.rcode || len(m.Answer) != tt.answers {
+			t.Errorf("%s %s: expected rcode %d with %d answers, got %d with %d",
+				tt.name, dns.TypeToString[tt.qtype], tt.rcode, tt.answers, m.Rcode, len(m.Answer))
+			continue
+		}
+
+		if tt.answers > 0 {
+			continue
+		}
+
+		if len(m.Ns) != 1 {
+			t.Errorf("%s: missing SOA in the authority section", tt.name)
+			continue
+		}
+
+		soa := m.Ns[0].(*dns.SOA)
+		if soa.Hdr.Name != "mesos." || soa.Hdr.Ttl != 30 || soa.Minttl != 30 {
+			t.Errorf("%s: wrong negative SOA %s", tt.name, soa)
+		}
+	}
+}
+
+func TestSerial(t *testing.T) {
+	var res Resolver
+
+	res.bumpSerial()
+	first := res.serial
+	if first == 0 {
+		t.Fatal("should set a serial")
+	}
+
+	// serials never go backwards, even within the same second
+	res.bumpSerial()
+	if res.serial <= first {
+		t.Error("serial should increase")
+	}
+
+	soa, _ := res.formatSOA("mesos.")
+	if soa.Serial != res.serial {
+		t.Error("SOA should carry the current serial")
+	}
+}
+
+func TestTTLDecay(t *testing.T) {
+	res := &Resolver{Config: records.Config{TTL: 60}}
+
+	var tests = []struct {
+		decay bool
+		age   time.Duration
+		ttl   uint32
+	}{
+		{false, 30 * time.Second, 60},
+		{true, 0, 60},
+		{true, 30 * time.Second, 30},
+		{true, time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		res.Config.TTLDecay = tt.decay
+		res.fetched = time.Now().Add(-tt.age).UnixNano()
+		if ttl := res.ttl(&res.rs, "web.marathon.mesos."); ttl != tt.ttl {
+			t.Errorf("decay %v after %v: expected ttl %d, got %d", tt.decay, tt.age, tt.ttl, ttl)
+		}
+	}
+
+	// records never fetched keep the full TTL
+	res.fetched = 0
+	if ttl := res.ttl(&res.rs, "web.marathon.mesos."); ttl != 60 {
+		t.Errorf("expected the full ttl without records, got %d", ttl)
+	}
+}
+
+func TestTTLOverrides(t *testing.T) {
+	res := &Resolver{Config: records.Config{
+		Domain:       "mesos",
+		TTL:          60,
+		TTLLabel:     "DNS_TTL",
+		TTLOverrides: map[string]int{"leader.mesos.": 600, "web.marathon.mesos.": 30},
+	}}
+
+	var sj records.StateJSON
+	err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "s1", "hostname": "10.0.0.1"}],
+		"frameworks": [{"name": "marathon", "tasks": [
+			{"name": "web", "slave_id": "s1", "state": "TASK_RUNNING", "labels": [{"key": "DNS_TTL", "value": "5"}]},
+			{"name": "api", "slave_id": "s1", "state": "TASK_RUNNING", "labels": [{"key": "DNS_TTL", "value": "5"}]},
+			{"name": "db", "slave_id": "s1", "state": "TASK_RUNNING"}
+		]}]
+	}`), &sj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.rs.InsertState(sj, res.Config)
+
+	var tests = []struct {
+		name string
+		ttl  uint32
+	}{
+		{"leader.mesos.", 600},
+		{"web.marathon.mesos.", 30},
+		{"API.marathon.mesos.", 5},
+		{"db.marathon.mesos.", 60},
+	}
+
+	for _, tt := range tests {
+		if ttl := res.ttl(&res.rs, tt.name); ttl != tt.ttl {
+			t.Errorf("%s: expected ttl %d, got %d", tt.name, tt.ttl, ttl)
+		}
+	}
+}
+
+func TestFormatTXTLong(t *testing.T) {
+	res := &Resolver{}
+	for _, value := range []string{
+		"label=" + strings.Repeat("x", 600),
+		"json=" + strings.Repeat(`{\"k\":\"v\"}`, 40),
+		"",
+	} {
+		rr, err := res.formatTXT("web.marathon.mesos.", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := new(dns.Msg).SetQuestion("web.marathon.mesos.", dns.TypeTXT)
+		m.Answer = []dns.RR{rr}
+		wire, err := m.Pack()
+		if err != nil {
+			t.Fatalf("%d bytes: %v", len(value), err)
+		}
+		if err := m.Unpack(wire); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(m.Answer[0].(*dns.TXT).Txt, ""); got != value {
+			t.Errorf("expected %q, got %q", value, got)
+		}
+	}
+}
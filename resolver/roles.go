@@ -0,0 +1,26 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// roleAllowed reports whether the client behind w may query dom - names
+// in the subzone of a role in RoleACLs are only answered for clients in
+// its networks
+func (res *Resolver) roleAllowed(w dns.ResponseWriter, dom string) bool {
+	config := res.config()
+	if !config.RoleZones || len(config.RoleACLs) == 0 {
+		return true
+	}
+
+	for role, cidrs := range config.RoleACLs {
+		zone := role + "." + res.zone()
+		if dom != zone && !strings.HasSuffix(dom, "."+zone) {
+			continue
+		}
+		return inNetworks(remoteIP(w), cidrs)
+	}
+	return true
+}
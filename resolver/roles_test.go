@@ -0,0 +1,43 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+func TestRoleAllowed(t *testing.T) {
+	res := &Resolver{Config: records.Config{
+		Domain:    "mesos",
+		RoleZones: true,
+		RoleACLs:  map[string][]string{"dev": {"10.1.0.0/16"}, "ops": {}},
+	}}
+
+	var tests = []struct {
+		client  string
+		dom     string
+		allowed bool
+	}{
+		{"10.1.2.3", "web.marathon.dev.mesos.", true},
+		{"10.2.2.3", "web.marathon.dev.mesos.", false},
+		{"10.2.2.3", "dev.mesos.", false},
+		{"10.2.2.3", "web.marathon.mesos.", true},
+		{"10.2.2.3", "web.marathon.qa.mesos.", true},
+		{"10.2.2.3", "web.marathon.undev.mesos.", true},
+		{"10.1.2.3", "web.marathon.ops.mesos.", false},
+	}
+
+	for _, tt := range tests {
+		w := &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP(tt.client), Port: 53}}
+		if allowed := res.roleAllowed(w, tt.dom); allowed != tt.allowed {
+			t.Errorf("%s %s: expected %v, got %v", tt.client, tt.dom, tt.allowed, allowed)
+		}
+	}
+
+	res.Config.RoleZones = false
+	w := &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP("10.2.2.3"), Port: 53}}
+	if !res.roleAllowed(w, "web.marathon.dev.mesos.") {
+		t.Error("acls should not apply without rolezones")
+	}
+}
@@ -0,0 +1,314 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// actions of response policies (draft-vixie-dnsop-dns-rpz, section 3)
+const (
+	rpzNXDomain = iota
+	rpzNoData
+	rpzPassthru
+	rpzDrop
+	rpzTCPOnly
+	rpzRewrite
+	rpzLocal
+)
+
+// rpzTimeout is how long transferring a response policy zone may take
+const rpzTimeout = 30 * time.Second
+
+// rpzPolicy is what a response policy zone does with the queries for a
+// name: one of the actions, the CNAME target of a rewrite or the records
+// of local data
+type rpzPolicy struct {
+	action int
+	target string
+	rrs    []dns.RR
+}
+
+// rpzZone holds the policies of a response policy zone, by the name they
+// trigger on - a policy in wild triggers on the subdomains of its name
+type rpzZone struct {
+	exact map[string]*rpzPolicy
+	wild  map[string]*rpzPolicy
+}
+
+// parseRPZ returns the policies of the records rrs of the response policy
+// zone origin, only QNAME triggers are supported
+func parseRPZ(rrs []dns.RR, origin string) *rpzZone {
+	z := &rpzZone{exact: make(map[string]*rpzPolicy), wild: make(map[string]*rpzPolicy)}
+
+	skipped := 0
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header().Name)
+		if name == origin || !dns.IsSubDomain(origin, name) {
+			continue
+		}
+
+		trigger := strings.TrimSuffix(name, origin)
+		// an old style passthru rewrites the trigger to itself
+		self := trigger
+		labels := dns.SplitDomainName(trigger)
+		if strings.HasPrefix(labels[len(labels)-1], "rpz-") {
+			// IP, NSDNAME and client IP triggers
+			skipped++
+			continue
+		}
+
+		set := z.exact
+		if labels[0] == "*" {
+			set, trigger = z.wild, strings.TrimPrefix(trigger, "*.")
+		}
+		p := set[trigger]
+		if p == nil {
+			p = &rpzPolicy{action: rpzLocal}
+			set[trigger] = p
+		}
+
+		cname, ok := rr.(*dns.CNAME)
+		if !ok {
+			p.rrs = append(p.rrs, rr)
+			continue
+		}
+		switch target := strings.ToLower(cname.Target); target {
+		case ".":
+			p.action = rpzNXDomain
+		case "*.":
+			p.action = rpzNoData
+		case "rpz-passthru.", self:
+			p.action = rpzPassthru
+		case "rpz-drop.":
+			p.action = rpzDrop
+		case "rpz-tcp-only.":
+			p.action = rpzTCPOnly
+		default:
+			p.action, p.target = rpzRewrite, target
+		}
+	}
+
+	if skipped > 0 {
+		logging.Verbose.Printf("%s: skipped %d records with unsupported triggers\n", origin, skipped)
+	}
+	return z
+}
+
+// policy returns the policy for name, nil if there is none - an exact
+// trigger wins over wildcards, and longer wildcards over shorter ones
+func (z *rpzZone) policy(name string) *rpzPolicy {
+	if p := z.exact[name]; p != nil {
+		return p
+	}
+
+	off, end := dns.NextLabel(name, 0)
+	for ; !end; off, end = dns.NextLabel(name, off) {
+		if p := z.wild[name[off:]]; p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// rpz holds the response policy zones, in the configured order
+type rpz struct {
+	sync.RWMutex
+	zones []*rpzZone
+}
+
+// loadRPZ reads the records of the response policy zone z, from its file
+// or with a zone transfer from its primary
+func loadRPZ(z records.RPZ, secrets map[string]string) ([]dns.RR, error) {
+	var rrs []dns.RR
+	if z.File != "" {
+		f, err := os.Open(z.File)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		zp := dns.NewZoneParser(f, z.Zone, z.File)
+		for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+			rrs = append(rrs, rr)
+		}
+		return rrs, zp.Err()
+	}
+
+	m := new(dns.Msg)
+	m.SetAxfr(z.Zone)
+	tr := &dns.Transfer{DialTimeout: rpzTimeout, ReadTimeout: rpzTimeout, TsigSecret: secrets}
+	if z.TSIGKey != "" {
+		m.SetTsig(z.TSIGKey, dns.HmacSHA256, 300, time.Now().Unix())
+	}
+
+	env, err := tr.In(m, z.Primary)
+	if err != nil {
+		return nil, err
+	}
+	for e := range env {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		rrs = append(rrs, e.RR...)
+	}
+	if len(rrs) == 0 {
+		return nil, errors.New("empty transfer")
+	}
+	return rrs, nil
+}
+
+// load replaces the policies with the ones in zones, a zone that fails
+// to load keeps its last policies and the error is logged
+func (p *rpz) load(zones []records.RPZ, secrets map[string]string) {
+	p.RLock()
+	loaded := append([]*rpzZone(nil), p.zones...)
+	p.RUnlock()
+	if len(loaded) != len(zones) {
+		loaded = make([]*rpzZone, len(zones))
+	}
+
+	for i, z := range zones {
+		rrs, err := loadRPZ(z, secrets)
+		if err != nil {
+			logging.Error.Println("cannot load rpz " + z.Zone + ": " + err.Error())
+			continue
+		}
+		loaded[i] = parseRPZ(rrs, z.Zone)
+		logging.Verbose.Printf("loaded %d policies from rpz %s\n", len(loaded[i].exact)+len(loaded[i].wild), z.Zone)
+	}
+
+	p.Lock()
+	p.zones = loaded
+	p.Unlock()
+}
+
+// policy returns the policy of the first zone with one for name, nil if
+// none has
+func (p *rpz) policy(name string) *rpzPolicy {
+	if p == nil {
+		return nil
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	name = strings.ToLower(name)
+	for _, z := range p.zones {
+		if z == nil {
+			continue
+		}
+		if policy := z.policy(name); policy != nil {
+			return policy
+		}
+	}
+	return nil
+}
+
+// rpzWriter keeps the answer to the target of a rewrite
+type rpzWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+// RemoteAddr is a TCP address, the answer is truncated when it is sent
+// with the rewrite
+func (w *rpzWriter) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: remoteIP(w.ResponseWriter)}
+}
+
+func (w *rpzWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *rpzWriter) Write(b []byte) (int, error) {
+	w.msg = new(dns.Msg)
+	return len(b), w.msg.Unpack(b)
+}
+
+// rpzMsg returns the response the policy for the question of r calls
+// for, nil to forward it as usual - drop is set if the query gets no
+// response at all
+func (res *Resolver) rpzMsg(w dns.ResponseWriter, r *dns.Msg) (m *dns.Msg, drop bool) {
+	// the target of a rewrite is answered as it is
+	if _, ok := w.(*rpzWriter); ok {
+		return nil, false
+	}
+
+	q := r.Question[0]
+	p := res.rpz.policy(q.Name)
+	if p == nil {
+		return nil, false
+	}
+
+	m = new(dns.Msg)
+	m.SetReply(r)
+	m.RecursionAvailable = true
+
+	switch p.action {
+	case rpzNXDomain:
+		m.SetRcode(r, dns.RcodeNameError)
+	case rpzNoData:
+	case rpzPassthru:
+		return nil, false
+	case rpzDrop:
+		return nil, true
+	case rpzTCPOnly:
+		if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+			return nil, false
+		}
+		m.Truncated = true
+	case rpzLocal:
+		for _, rr := range p.rrs {
+			if q.Qtype == dns.TypeANY || q.Qtype == rr.Header().Rrtype {
+				rr = dns.Copy(rr)
+				rr.Header().Name = q.Name
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+	case rpzRewrite:
+		target := p.target
+		if strings.HasPrefix(target, "*.") {
+			target = strings.ToLower(q.Name) + target[2:]
+		}
+		m.Answer = append(m.Answer, &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: q.Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: uint32(res.config().TTL)},
+			Target: target,
+		})
+		if q.Qtype == dns.TypeCNAME {
+			break
+		}
+
+		// answer for the target, in the mesos domain or forwarded
+		cw := &rpzWriter{ResponseWriter: w}
+		chase := new(dns.Msg)
+		chase.SetQuestion(target, q.Qtype)
+		chase.RecursionDesired = r.RecursionDesired
+		dns.DefaultServeMux.ServeDNS(cw, chase)
+		if cw.msg != nil {
+			m.Rcode = cw.msg.Rcode
+			m.Answer = append(m.Answer, cw.msg.Answer...)
+		}
+	}
+	return m, false
+}
+
+// RefreshRPZ loads the configured response policy zones and reloads them
+// every RPZRefresh seconds
+func (res *Resolver) RefreshRPZ() {
+	config := res.config()
+	res.rpz.load(config.RPZ, config.TSIGKeys)
+
+	ticker := time.NewTicker(time.Second * time.Duration(config.RPZRefresh))
+	for range ticker.C {
+		res.rpz.load(config.RPZ, config.TSIGKeys)
+	}
+}
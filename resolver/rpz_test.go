@@ -0,0 +1,135 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+const testRPZ = `$TTL 60
+@                   SOA  localhost. root.localhost. 1 3600 600 86400 60
+@                   NS   localhost.
+bad.example.com     CNAME .
+*.bad.example.com   CNAME .
+empty.example.com   CNAME *.
+ok.bad.example.com  CNAME rpz-passthru.
+old.bad.example.com CNAME old.bad.example.com.
+quiet.example.com   CNAME rpz-drop.
+big.example.com     CNAME rpz-tcp-only.
+moved.example.com   CNAME chronos.marathon-0.6.0.mesos.
+*.garden.example    CNAME *.walled.example.
+local.example.com   A    192.0.2.1
+local.example.com   TXT  "local"
+32.1.2.0.192.rpz-ip CNAME .
+`
+
+func TestRPZ(t *testing.T) {
+	f, err := ioutil.TempFile("", "rpz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(testRPZ)
+	f.Close()
+
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.rpz = &rpz{}
+	res.rpz.load([]records.RPZ{{Zone: "rpz.local.", File: f.Name()}}, nil)
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc("mesos.", res.HandleMesos)
+	dns.DefaultServeMux, mux = mux, dns.DefaultServeMux
+	defer func() { dns.DefaultServeMux = mux }()
+
+	var tests = []struct {
+		name   string
+		qtype  uint16
+		tcp    bool
+		rcode  int
+		answer []string
+		drop   bool
+	}{
+		{"bad.example.com.", dns.TypeA, false, dns.RcodeNameError, nil, false},
+		{"www.bad.example.com.", dns.TypeA, false, dns.RcodeNameError, nil, false},
+		{"Empty.Example.com.", dns.TypeA, false, dns.RcodeSuccess, nil, false},
+		{"local.example.com.", dns.TypeA, false, dns.RcodeSuccess, []string{"local.example.com.\t60\tIN\tA\t192.0.2.1"}, false},
+		{"local.example.com.", dns.TypeAAAA, false, dns.RcodeSuccess, nil, false},
+		{"quiet.example.com.", dns.TypeA, false, 0, nil, true},
+		{"moved.example.com.", dns.TypeA, false, dns.RcodeSuccess, []string{
+			"moved.example.com.\t60\tIN\tCNAME\tchronos.marathon-0.6.0.mesos.",
+			"chronos.marathon-0.6.0.mesos.\t60\tIN\tA\t1.2.3.4",
+		}, false},
+		{"x.garden.example.", dns.TypeCNAME, false, dns.RcodeSuccess, []string{"x.garden.example.\t60\tIN\tCNAME\tx.garden.example.walled.example."}, false},
+	}
+
+	for _, tt := range tests {
+		w := &fakeWriter{}
+		m, drop := res.rpzMsg(w, new(dns.Msg).SetQuestion(tt.name, tt.qtype))
+		if drop != tt.drop {
+			t.Errorf("%s: expected drop %v, got %v", tt.name, tt.drop, drop)
+			continue
+		}
+		if drop {
+			continue
+		}
+		if m == nil {
+			t.Errorf("%s: expected a policy", tt.name)
+			continue
+		}
+		if m.Rcode != tt.rcode || len(m.Answer) != len(tt.answer) {
+			t.Errorf("%s: expected %s %v, got %v", tt.name, dns.RcodeToString[tt.rcode], tt.answer, m)
+			continue
+		}
+		for i, rr := range m.Answer {
+			if rr.String() != tt.answer[i] {
+				t.Errorf("%s: expected %s, got %s", tt.name, tt.answer[i], rr)
+			}
+		}
+	}
+
+	// forwarded as usual
+	for _, name := range []string{"ok.bad.example.com.", "example.com.", "192.0.2.1.", "other.example.org."} {
+		if m, drop := res.rpzMsg(&fakeWriter{}, new(dns.Msg).SetQuestion(name, dns.TypeA)); m != nil || drop {
+			t.Errorf("%s: expected no policy, got %v", name, m)
+		}
+	}
+
+	// tcp-only truncates over UDP only
+	m, _ := res.rpzMsg(&fakeWriter{}, new(dns.Msg).SetQuestion("big.example.com.", dns.TypeA))
+	if m == nil || !m.Truncated {
+		t.Errorf("expected a truncated answer over UDP, got %v", m)
+	}
+	tcp := &fakeWriter{remote: &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}}
+	if m, _ := res.rpzMsg(tcp, new(dns.Msg).SetQuestion("big.example.com.", dns.TypeA)); m != nil {
+		t.Errorf("expected no policy over TCP, got %v", m)
+	}
+
+	// a zone that fails to load keeps its policies
+	res.rpz.load([]records.RPZ{{Zone: "rpz.local.", File: "/nonexistent"}}, nil)
+	if res.rpz.policy("bad.example.com.") == nil {
+		t.Error("dropped the policies of a zone that failed to load")
+	}
+}
+
+func TestParseRPZPassthru(t *testing.T) {
+	var rrs []dns.RR
+	zp := dns.NewZoneParser(strings.NewReader(testRPZ), "rpz.local.", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	z := parseRPZ(rrs, "rpz.local.")
+
+	for _, name := range []string{"ok.bad.example.com.", "old.bad.example.com."} {
+		if p := z.policy(name); p == nil || p.action != rpzPassthru {
+			t.Errorf("%s: expected passthru, got %+v", name, p)
+		}
+	}
+}
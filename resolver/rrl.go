@@ -0,0 +1,101 @@
+package resolver
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// rrlWriter limits the identical responses written to a client network,
+// see responseLimited
+type rrlWriter struct {
+	dns.ResponseWriter
+	res *Resolver
+}
+
+// WriteMsg writes m unless the client's network got RRLRate answers for
+// the same name and type in the last second, then it writes every
+// RRLSlip-th of them truncated, so real clients retry over TCP, and
+// drops the rest
+func (w *rrlWriter) WriteMsg(m *dns.Msg) error {
+	send, slip := w.limit(m)
+	switch {
+	case send:
+		return w.ResponseWriter.WriteMsg(m)
+	case slip:
+		return w.ResponseWriter.WriteMsg(truncated(m))
+	}
+	return nil
+}
+
+// Write limits the packed responses, e.g. from the answer cache, as
+// WriteMsg does
+func (w *rrlWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return w.ResponseWriter.Write(b)
+	}
+
+	send, slip := w.limit(m)
+	switch {
+	case send:
+		return w.ResponseWriter.Write(b)
+	case slip:
+		return len(b), w.ResponseWriter.WriteMsg(truncated(m))
+	}
+	return len(b), nil
+}
+
+// limit reports whether m is sent as it is or, failing that, slipped
+// truncated
+func (w *rrlWriter) limit(m *dns.Msg) (send bool, slip bool) {
+	if len(m.Question) == 0 {
+		return true, false
+	}
+
+	q := m.Question[0]
+	key := strings.ToLower(q.Name) + "/" + dns.TypeToString[q.Qtype] + "/" + clientSubnet(w)
+	ok, limited := w.res.rrl.allow(key, time.Now())
+	if ok {
+		return true, false
+	}
+
+	logging.CurLog.RRLLimited += 1
+	if n := w.res.config().RRLSlip; n > 0 && limited%n == 0 {
+		logging.CurLog.RRLSlipped += 1
+		return false, true
+	}
+	return false, false
+}
+
+// truncated returns an empty copy of m with the TC bit set
+func truncated(m *dns.Msg) *dns.Msg {
+	tc := m.Copy()
+	tc.Truncated = true
+	tc.Answer, tc.Ns = nil, nil
+
+	tc.Extra = nil
+	if opt := m.IsEdns0(); opt != nil {
+		tc.Extra = []dns.RR{opt}
+	}
+	return tc
+}
+
+// responseLimited applies response rate limiting to the answers h sends
+// over UDP, where the source address can be spoofed to point the answers
+// at a victim - TCP clients are who they claim to be
+func (res *Resolver) responseLimited(h dns.Handler) dns.Handler {
+	if res.rrl == nil {
+		return h
+	}
+
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+			w = &rrlWriter{ResponseWriter: w, res: res}
+		}
+		h.ServeDNS(w, r)
+	})
+}
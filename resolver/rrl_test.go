@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestResponseLimited(t *testing.T) {
+	res := New(records.Config{Domain: "mesos", RRLRate: 2, RRLSlip: 2})
+	h := res.responseLimited(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET}, A: net.IPv4(10, 0, 0, 1)}}
+		w.WriteMsg(m)
+	}))
+
+	query := func(name string, addr net.Addr) *dns.Msg {
+		w := &fakeWriter{remote: addr}
+		h.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeA))
+		return w.msg
+	}
+	udp := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}
+
+	var answered, slipped, dropped int
+	for i := 0; i < 6; i++ {
+		m := query("web.marathon.mesos.", udp)
+		switch {
+		case m == nil:
+			dropped++
+		case m.Truncated && len(m.Answer) == 0:
+			slipped++
+		default:
+			answered++
+		}
+	}
+	if answered != 2 || slipped != 2 || dropped != 2 {
+		t.Errorf("expected 2 answered, 2 slipped and 2 dropped, got %d %d %d", answered, slipped, dropped)
+	}
+
+	// other names, networks and TCP are limited separately or not at all
+	if m := query("db.marathon.mesos.", udp); m == nil || m.Truncated {
+		t.Error("expected another name to be answered")
+	}
+	if m := query("web.marathon.mesos.", &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 53}); m == nil || m.Truncated {
+		t.Error("expected another network to be answered")
+	}
+	if m := query("web.marathon.mesos.", &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}); m == nil || m.Truncated {
+		t.Error("expected TCP to be answered")
+	}
+}
+
+func TestResponseLimitedAnswerCache(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.answers = newAnswers(10)
+	res.Config.RRLRate, res.Config.RRLSlip = 2, 0
+	res.rrl = newRateLimiter(2, 2)
+	h := res.responseLimited(dns.HandlerFunc(res.HandleMesos))
+
+	answered := 0
+	for i := 0; i < 10; i++ {
+		w := &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}}
+		h.ServeDNS(w, new(dns.Msg).SetQuestion("chronos.marathon-0.6.0.mesos.", dns.TypeA))
+		if w.msg != nil {
+			answered++
+		}
+	}
+	if answered != 2 {
+		t.Errorf("expected 2 of the cached answers, got %d", answered)
+	}
+}
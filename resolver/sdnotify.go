@@ -0,0 +1,107 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/systemd"
+	"github.com/miekg/dns"
+)
+
+// Inherit serves DNS on the sockets in files, passed by systemd, instead
+// of binding Listener:Port - the ones on another port are ignored
+func (res *Resolver) Inherit(files []*os.File) {
+	config := res.config()
+	for _, f := range files {
+		var proto string
+		var port int
+		if l, err := net.FileListener(f); err == nil {
+			proto, port = "tcp", l.Addr().(*net.TCPAddr).Port
+			l.Close()
+		} else if pc, err := net.FilePacketConn(f); err == nil {
+			proto, port = "udp", pc.LocalAddr().(*net.UDPAddr).Port
+			pc.Close()
+		}
+
+		if proto == "" || port != config.Port {
+			logging.Error.Println("ignoring socket " + f.Name() + " from systemd, it is not a dns socket on port " + strconv.Itoa(config.Port))
+			continue
+		}
+		if res.sockets == nil {
+			res.sockets = make(map[string]*os.File)
+		}
+		res.sockets[proto] = f
+		logging.Verbose.Println("serving " + proto + " on the socket from systemd")
+	}
+}
+
+// serveInherited runs server on the socket systemd passed or Bind opened
+// for proto, which stays open when server stops so it can be restarted
+func (res *Resolver) serveInherited(server *dns.Server, proto string) error {
+	config := res.config()
+	var err error
+	f := res.sockets[proto]
+	if proto == "udp" {
+		server.PacketConn, err = net.FilePacketConn(f)
+		if conn, ok := server.PacketConn.(*net.UDPConn); ok && config.ReplySource != "" {
+			server.PacketConn = newSourceConn(conn, net.ParseIP(config.ReplySource))
+		}
+	} else {
+		server.Listener, err = net.FileListener(f)
+	}
+	if err != nil {
+		return err
+	}
+	return server.ActivateAndServe()
+}
+
+// RunSystemd tells systemd we are ready once the DNS servers are bound,
+// and keeps its watchdog from restarting us while they are, until ctx is
+// done
+func (res *Resolver) RunSystemd(ctx context.Context) error {
+	bound := func() bool {
+		for _, b := range res.listening.get() {
+			if !b {
+				return false
+			}
+		}
+		return true
+	}
+
+	poll := time.NewTicker(100 * time.Millisecond)
+	defer poll.Stop()
+	for !bound() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-poll.C:
+		}
+	}
+	if err := systemd.Notify("READY=1\nSTATUS=serving " + res.zone()); err != nil {
+		return err
+	}
+
+	var watchdog <-chan time.Time
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		t := time.NewTicker(interval / 2)
+		defer t.Stop()
+		watchdog = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return systemd.Notify("STOPPING=1")
+		case <-watchdog:
+			if bound() {
+				if err := systemd.Notify("WATCHDOG=1"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package resolver
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// systemdSockets returns tcp and udp sockets on the same free port, as
+// systemd would pass them
+func systemdSockets(t *testing.T) (int, []*os.File) {
+	for i := 0; i < 10; i++ {
+		l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		if err != nil {
+			l.Close()
+			continue
+		}
+
+		tcp, _ := l.File()
+		udp, _ := pc.File()
+		l.Close()
+		pc.Close()
+		return port, []*os.File{tcp, udp}
+	}
+	t.Fatal("no free port")
+	return 0, nil
+}
+
+func TestInherit(t *testing.T) {
+	port, files := systemdSockets(t)
+
+	res := New(records.Config{Domain: "mesos", Listener: "127.0.0.1", Port: port})
+	res.Inherit(files)
+	if res.sockets["tcp"] != files[0] || res.sockets["udp"] != files[1] {
+		t.Fatalf("expected both sockets to be used, got %v", res.sockets)
+	}
+
+	other := New(records.Config{Domain: "mesos", Port: port + 1})
+	other.Inherit(files)
+	if len(other.sockets) != 0 {
+		t.Errorf("should ignore sockets on other ports, got %v", other.sockets)
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		w.WriteMsg(m)
+	})
+	dns.DefaultServeMux, mux = mux, dns.DefaultServeMux
+	defer func() { dns.DefaultServeMux = mux }()
+
+	// a restarted server gets the socket again
+	for i := 0; i < 2; i++ {
+		for _, proto := range []string{"udp", "tcp"} {
+			ctx, cancel := context.WithCancel(context.Background())
+			served := make(chan error, 1)
+			go func() { served <- res.Serve(ctx, proto) }()
+			for !res.listening.get()[proto] {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c := &dns.Client{Net: proto}
+			in, _, err := c.Exchange(new(dns.Msg).SetQuestion("example.com.", dns.TypeA), net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+			if err != nil || in.Rcode != dns.RcodeNameError {
+				t.Errorf("%s: expected an answer on the inherited socket, got %v, %v", proto, in, err)
+			}
+
+			cancel()
+			if err := <-served; err != nil {
+				t.Error(err)
+			}
+		}
+	}
+}
+
+func TestRunSystemd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	os.Setenv("WATCHDOG_USEC", "20000")
+	defer os.Unsetenv("WATCHDOG_USEC")
+
+	res := New(records.Config{Domain: "mesos"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- res.RunSystemd(ctx) }()
+
+	read := func(wait time.Duration) string {
+		b := make([]byte, 256)
+		conn.SetReadDeadline(time.Now().Add(wait))
+		n, err := conn.Read(b)
+		if err != nil {
+			return ""
+		}
+		return string(b[:n])
+	}
+
+	// nothing until the servers are bound
+	if got := read(150 * time.Millisecond); got != "" {
+		t.Errorf("expected nothing before the servers are bound, got %q", got)
+	}
+	res.listening.set("tcp", true)
+	res.listening.set("udp", true)
+	if got := read(time.Second); got != "READY=1\nSTATUS=serving mesos." {
+		t.Errorf("expected READY=1, got %q", got)
+	}
+	if got := read(time.Second); got != "WATCHDOG=1" {
+		t.Errorf("expected WATCHDOG=1, got %q", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for got := read(time.Second); got != "STOPPING=1"; got = read(time.Second) {
+		if got != "WATCHDOG=1" {
+			t.Fatalf("expected STOPPING=1, got %q", got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// procFDs lists the open file descriptors of this process
+var procFDs = "/proc/self/fd"
+
+// usage is a sample of the resources mesos-dns holds
+type usage struct {
+	heap       uint64
+	goroutines int
+	fds        int // -1 if unknown
+}
+
+// sampleUsage reads the current heap size, goroutines and open files
+func sampleUsage() usage {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	u := usage{heap: mem.HeapAlloc, goroutines: runtime.NumGoroutine(), fds: -1}
+	if fds, err := ioutil.ReadDir(procFDs); err == nil {
+		u.fds = len(fds)
+	}
+
+	return u
+}
+
+// warnings returns a message for every threshold in config u crosses,
+// thresholds of 0 are off
+func (res *Resolver) warnings(u usage) []string {
+	config := res.config()
+	var warns []string
+
+	if limit := uint64(config.HeapWarnMB) << 20; limit > 0 && u.heap > limit {
+		warns = append(warns, "heap is "+strconv.FormatUint(u.heap>>20, 10)+" MB, above "+
+			strconv.Itoa(config.HeapWarnMB)+" MB")
+	}
+
+	if limit := config.GoroutineWarn; limit > 0 && u.goroutines > limit {
+		warns = append(warns, strconv.Itoa(u.goroutines)+" goroutines, above "+strconv.Itoa(limit))
+	}
+
+	if limit := config.FDWarn; limit > 0 && u.fds > limit {
+		warns = append(warns, strconv.Itoa(u.fds)+" open files, above "+strconv.Itoa(limit))
+	}
+
+	return warns
+}
+
+// report samples resource usage, exports it with the other stats and
+// warns about crossed thresholds
+func (res *Resolver) report() {
+	u := sampleUsage()
+
+	logging.CurLog.HeapBytes = int(u.heap)
+	logging.CurLog.Goroutines = u.goroutines
+	logging.CurLog.OpenFDs = u.fds
+
+	logging.Verbose.Println("heap " + strconv.FormatUint(u.heap>>20, 10) + " MB, " +
+		strconv.Itoa(u.goroutines) + " goroutines, " + strconv.Itoa(u.fds) + " open files")
+	for _, w := range res.warnings(u) {
+		logging.Error.Println("resource warning: " + w)
+	}
+}
+
+// SelfReport reports resource usage every SelfReportSeconds
+func (res *Resolver) SelfReport() {
+	res.report()
+
+	ticker := time.NewTicker(time.Second * time.Duration(res.config().SelfReportSeconds))
+	for _ = range ticker.C {
+		res.report()
+	}
+}
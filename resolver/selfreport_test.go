@@ -0,0 +1,39 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+func TestSampleUsage(t *testing.T) {
+	u := sampleUsage()
+	if u.heap == 0 || u.goroutines == 0 {
+		t.Errorf("implausible usage %+v", u)
+	}
+
+	procFDs = "testdata/missing"
+	defer func() { procFDs = "/proc/self/fd" }()
+	if u := sampleUsage(); u.fds != -1 {
+		t.Error("open files should be unknown without /proc")
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	u := usage{heap: 300 << 20, goroutines: 50, fds: 10}
+
+	res := Resolver{}
+	if len(res.warnings(u)) != 0 {
+		t.Error("no thresholds should mean no warnings")
+	}
+
+	res.Config = records.Config{HeapWarnMB: 256, GoroutineWarn: 100, FDWarn: 5}
+	if warns := res.warnings(u); len(warns) != 2 {
+		t.Errorf("expected heap and open file warnings, got %v", warns)
+	}
+
+	u.fds = -1
+	if warns := res.warnings(u); len(warns) != 1 {
+		t.Errorf("unknown open files should not warn, got %v", warns)
+	}
+}
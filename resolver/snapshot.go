@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// saveSnapshot writes the records rrs of zone to path as a zone file,
+// through a temporary file renamed over it so a crash never leaves half a
+// snapshot
+func saveSnapshot(path string, zone string, rrs []dns.RR) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "; %s snapshot, written by mesos-dns\n", zone)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", zone)
+	for _, rr := range rrs {
+		fmt.Fprintln(bw, rr.String())
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readSnapshot rebuilds the records in the snapshot at path
+func (res *Resolver) readSnapshot(path string, config records.Config) (records.RecordGenerator, error) {
+	t := records.RecordGenerator{}
+	t.InsertState(records.StateJSON{}, config)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return t, err
+	}
+	defer f.Close()
+
+	var rrs []dns.RR
+	zp := dns.NewZoneParser(f, res.zone(), path)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return t, err
+	}
+	if len(rrs) == 0 {
+		return t, errors.New("empty snapshot")
+	}
+	restoreRecords(&t, rrs, config)
+	return t, nil
+}
+
+// LoadSnapshot serves the records saved to SnapshotFile by the last
+// successful reload, so a restart while the masters are down doesn't
+// serve an empty zone
+// it reports whether there was a snapshot, the records are replaced by
+// the next successful reload
+func (res *Resolver) LoadSnapshot() bool {
+	config := *res.config()
+	if config.SnapshotFile == "" {
+		return false
+	}
+
+	t, err := res.readSnapshot(config.SnapshotFile, config)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Error.Println("can't load snapshot: " + err.Error())
+		}
+		return false
+	}
+
+	res.rsLock.Lock()
+	if res.serial != 0 {
+		// the masters answered first
+		res.rsLock.Unlock()
+		return false
+	}
+	res.base = t
+	res.warm = true
+	res.publish()
+	res.rsLock.Unlock()
+
+	logging.Verbose.Println("loaded snapshot " + config.SnapshotFile + " with " + strconv.Itoa(len(t.As)) + " names")
+	return true
+}
@@ -0,0 +1,101 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+func TestSnapshot(t *testing.T) {
+	master := fakeMaster(t, "web")
+	defer master.Close()
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := records.Config{
+		Domain:         "mesos",
+		TTL:            60,
+		Timeout:        1,
+		Listener:       "127.0.0.1",
+		Mname:          "mesos-dns.mesos.",
+		InactiveAgents: "drop",
+		Masters:        []string{master.Listener.Addr().String()},
+		SnapshotFile:   filepath.Join(dir, "records.zone"),
+	}
+	res := New(config)
+	if res.LoadSnapshot() {
+		t.Fatal("expected no snapshot before the first reload")
+	}
+	res.Reload()
+	if _, err := os.Stat(config.SnapshotFile); err != nil {
+		t.Fatalf("expected a snapshot after the reload: %v", err)
+	}
+
+	// a restart while the masters are down
+	config.Masters = []string{"127.0.0.2:1"}
+	res = New(config)
+	if !res.LoadSnapshot() {
+		t.Fatal("expected to load the snapshot")
+	}
+	res.Reload()
+	if !res.warm || len(res.rs.As["web.marathon.mesos."]) == 0 {
+		t.Errorf("expected the records of the snapshot to be kept, got %v", res.rs.As)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("expected only the snapshot in %s, got %d files", dir, len(files))
+	}
+}
+
+func TestSnapshotRestoresRecords(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := &res.rs
+	rs.Insert("_443._tcp.chronos.marathon-0.6.0.mesos.", "3 1 1 abcdef", "TLSA")
+	rs.Insert("chronos.marathon-0.6.0.mesos.", "4 2 abcdef", "SSHFP")
+	rs.Insert("_http.chronos.marathon-0.6.0.mesos.", "http://chronos.marathon-0.6.0.mesos:8080/", "URI")
+	rs.Insert("chronos.marathon-0.6.0.mesos.", `config={"a": "b"}`, "TXT")
+	for _, host := range rs.As["chronos.marathon-0.6.0.mesos."] {
+		rs.SetLocation(host, records.Location{Latitude: 52.52, Longitude: 13.405, Altitude: 34})
+	}
+	srv := "_liquor-store._tcp.marathon-0.6.0.mesos."
+	rs.SetSRVWeight(srv, rs.SRVs[srv][0], 1, 10)
+	rs.SetTTL("chronos.marathon-0.6.0.mesos.", 5)
+
+	f, err := ioutil.TempFile("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	before := res.zoneRecords(rs)
+	if err := saveSnapshot(f.Name(), res.zone(), before); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := res.readSnapshot(f.Name(), res.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := res.zoneRecords(&restored)
+	if len(after) != len(before) {
+		t.Fatalf("expected\n%v\ngot\n%v", before, after)
+	}
+	for i := range before {
+		if before[i].String() != after[i].String() {
+			t.Errorf("expected %s, got %s", before[i], after[i])
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package resolver
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// listenUDP opens the UDP socket of the dns server at addr
+// the server answers queries on a *net.UDPConn from the address they
+// arrived on (IP_PKTINFO), so clients on multi-homed hosts get answers
+// from the address they asked even if we listen on 0.0.0.0 - with
+// ReplySource every answer is sent from that address instead
+func (res *Resolver) listenUDP(addr string) (net.PacketConn, error) {
+	config := res.config()
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ReplySource == "" {
+		return conn, nil
+	}
+	return newSourceConn(conn, net.ParseIP(config.ReplySource)), nil
+}
+
+// sourceConn is a UDP socket that sends every packet from src
+type sourceConn struct {
+	*net.UDPConn
+	src net.IP
+	v4  *ipv4.PacketConn
+	v6  *ipv6.PacketConn
+}
+
+func newSourceConn(conn *net.UDPConn, src net.IP) *sourceConn {
+	c := &sourceConn{UDPConn: conn, src: src}
+	if src.To4() != nil {
+		c.v4 = ipv4.NewPacketConn(conn)
+	} else {
+		c.v6 = ipv6.NewPacketConn(conn)
+	}
+	return c
+}
+
+// WriteTo sends b to addr from src
+func (c *sourceConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.v4 != nil {
+		return c.v4.WriteTo(b, &ipv4.ControlMessage{Src: c.src}, addr)
+	}
+	return c.v6.WriteTo(b, &ipv6.ControlMessage{Src: c.src}, addr)
+}
@@ -0,0 +1,69 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// replyFrom sends a query to 127.0.0.2 on a server listening on 0.0.0.0
+// and returns the address the answer came from
+func replyFrom(t *testing.T, res *Resolver) string {
+	conn, err := res.listenUDP("0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        conn,
+		Handler:           dns.HandlerFunc(res.HandleMesos),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	<-started
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	r := new(dns.Msg)
+	r.SetQuestion("mesos.", dns.TypeSOA)
+	b, _ := r.Pack()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	if _, err := client.WriteTo(b, &net.UDPAddr{IP: net.ParseIP("127.0.0.2"), Port: port}); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, dns.MaxMsgSize)
+	_, from, err := client.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return from.(*net.UDPAddr).IP.String()
+}
+
+func TestReplySource(t *testing.T) {
+	res := &Resolver{Config: records.Config{
+		Domain: "mesos",
+		Mname:  "mesos-dns.mesos.",
+		Email:  "root.mesos-dns.mesos.",
+	}}
+
+	if from := replyFrom(t, res); from != "127.0.0.2" {
+		t.Errorf("expected the answer from the address queried, got %s", from)
+	}
+
+	res.Config.ReplySource = "127.0.0.1"
+	if from := replyFrom(t, res); from != "127.0.0.1" {
+		t.Errorf("expected the answer from the reply source, got %s", from)
+	}
+}
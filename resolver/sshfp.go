@@ -0,0 +1,39 @@
+package resolver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// formatSSHFP returns the SSHFP resource record for value, "algorithm
+// type fingerprint"
+func (res *Resolver) formatSSHFP(name string, value string) (*dns.SSHFP, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		return nil, errors.New("invalid sshfp " + value + " for " + name)
+	}
+
+	alg, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return nil, errors.New("invalid sshfp " + value + " for " + name)
+	}
+	typ, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil {
+		return nil, errors.New("invalid sshfp " + value + " for " + name)
+	}
+
+	return &dns.SSHFP{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeSSHFP,
+			Class:  dns.ClassINET,
+			Ttl:    res.ttl(&res.rs, name),
+		},
+		Algorithm:   uint8(alg),
+		Type:        uint8(typ),
+		FingerPrint: fields[2],
+	}, nil
+}
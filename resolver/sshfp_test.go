@@ -0,0 +1,24 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestSSHFP(t *testing.T) {
+	res := New(records.Config{Domain: "mesos", TTL: 60})
+	res.rs.InsertState(records.StateJSON{}, res.Config)
+	res.rs.Insert("agent1.slave.mesos.", "4 2 0a1b2c", "SSHFP")
+
+	w := &fakeWriter{}
+	res.HandleMesos(w, new(dns.Msg).SetQuestion("agent1.slave.mesos.", dns.TypeSSHFP))
+	if len(w.msg.Answer) != 1 {
+		t.Fatalf("expected an SSHFP record, got %v", w.msg.Answer)
+	}
+	rr, ok := w.msg.Answer[0].(*dns.SSHFP)
+	if !ok || rr.Algorithm != 4 || rr.Type != 2 || rr.FingerPrint != "0a1b2c" {
+		t.Errorf("unexpected SSHFP record %v", w.msg.Answer[0])
+	}
+}
@@ -0,0 +1,152 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// staticRecords holds the records added through the API, by type and
+// name - they replace the generated records of the same name and type
+// until removed and are guarded by rsLock
+// a nil *staticRecords holds none
+type staticRecords struct {
+	items map[string]map[string][]string
+}
+
+func newStaticRecords() *staticRecords {
+	return &staticRecords{items: make(map[string]map[string][]string)}
+}
+
+// insert puts the static records into rg
+func (s *staticRecords) insert(rg *records.RecordGenerator) {
+	// no state was loaded
+	if s == nil || rg.As == nil {
+		return
+	}
+
+	if rg.CNAMEs == nil {
+		rg.CNAMEs = make(map[string][]string)
+	}
+
+	sets := map[string]map[string][]string{"A": rg.As, "SRV": rg.SRVs, "TXT": rg.TXTs, "CNAME": rg.CNAMEs}
+	for rtype, names := range s.items {
+		for name, values := range names {
+			sets[rtype][name] = append([]string(nil), values...)
+		}
+	}
+}
+
+func (s *staticRecords) set(rtype string, name string, values []string) {
+	if s.items[rtype] == nil {
+		s.items[rtype] = make(map[string][]string)
+	}
+	s.items[rtype][name] = values
+}
+
+// remove drops the static records of a name and type and reports whether
+// there were any
+func (s *staticRecords) remove(rtype string, name string) bool {
+	if _, ok := s.items[rtype][name]; !ok {
+		return false
+	}
+
+	delete(s.items[rtype], name)
+	if len(s.items[rtype]) == 0 {
+		delete(s.items, rtype)
+	}
+	return true
+}
+
+// list returns a copy of the static records
+func (s *staticRecords) list() map[string]map[string][]string {
+	l := make(map[string]map[string][]string, len(s.items))
+	for rtype, names := range s.items {
+		l[rtype] = make(map[string][]string, len(names))
+		for name, values := range names {
+			l[rtype][name] = append([]string(nil), values...)
+		}
+	}
+	return l
+}
+
+// staticName checks a static record for name of type rtype and returns
+// name as we store it
+func (res *Resolver) staticName(rtype string, name string, values []string) (string, error) {
+	name = dns.Fqdn(strings.ToLower(name))
+	if _, ok := dns.IsDomainName(name); !ok {
+		return "", errors.New("invalid name " + name)
+	}
+	if name != res.zone() && !strings.HasSuffix(name, "."+res.zone()) {
+		return "", errors.New(name + " is not in " + res.zone())
+	}
+
+	for _, v := range values {
+		switch rtype {
+		case "A":
+			if ip := net.ParseIP(v); ip == nil || ip.To4() == nil {
+				return "", errors.New(v + " is not an IPv4 address")
+			}
+		case "SRV":
+			host, port, err := net.SplitHostPort(v)
+			if err != nil || host == "" {
+				return "", errors.New(v + " is not host:port")
+			}
+			if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+				return "", errors.New(v + " has an invalid port")
+			}
+		case "TXT":
+		case "CNAME":
+			if _, ok := dns.IsDomainName(v); !ok || len(values) != 1 {
+				return "", errors.New("a name has one canonical name")
+			}
+		default:
+			return "", errors.New("unsupported record type " + rtype)
+		}
+	}
+
+	return name, nil
+}
+
+// setStatic serves values as the rtype records of name until removed
+func (res *Resolver) setStatic(rtype string, name string, values []string) (string, error) {
+	rtype = strings.ToUpper(rtype)
+	name, err := res.staticName(rtype, name, values)
+	if err != nil {
+		return "", err
+	}
+	if rtype == "CNAME" {
+		values = []string{dns.Fqdn(strings.ToLower(values[0]))}
+	}
+
+	res.rsLock.Lock()
+	defer res.rsLock.Unlock()
+
+	res.static.set(rtype, name, values)
+	res.publish()
+	return name, nil
+}
+
+// removeStatic goes back to the generated rtype records of name and
+// reports whether there were static ones
+func (res *Resolver) removeStatic(rtype string, name string) (bool, error) {
+	rtype = strings.ToUpper(rtype)
+	name, err := res.staticName(rtype, name, nil)
+	if err != nil {
+		return false, err
+	}
+
+	res.rsLock.Lock()
+	defer res.rsLock.Unlock()
+
+	if !res.static.remove(rtype, name) {
+		return false, nil
+	}
+
+	res.publish()
+	return true, nil
+}
@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestStaticName(t *testing.T) {
+	res := acmeDNS(t)
+
+	var tests = []struct {
+		rtype  string
+		name   string
+		values []string
+		ok     bool
+	}{
+		{"A", "shop.mesos", []string{"10.0.0.5"}, true},
+		{"A", "shop.mesos", []string{"fd00::5"}, false},
+		{"A", "shop.example.com", []string{"10.0.0.5"}, false},
+		{"SRV", "_shop._tcp.mesos", []string{"shop.mesos:8080"}, true},
+		{"SRV", "_shop._tcp.mesos", []string{"shop.mesos"}, false},
+		{"SRV", "_shop._tcp.mesos", []string{"shop.mesos:http"}, false},
+		{"TXT", "shop.mesos", []string{"anything"}, true},
+		{"MX", "shop.mesos", []string{"mail.mesos"}, false},
+	}
+
+	for _, tt := range tests {
+		if _, err := res.staticName(tt.rtype, tt.name, tt.values); (err == nil) != tt.ok {
+			t.Errorf("%s %s %v: expected ok %v, got %v", tt.rtype, tt.name, tt.values, tt.ok, err)
+		}
+	}
+}
+
+func TestStaticRecords(t *testing.T) {
+	res := acmeDNS(t)
+	res.static = newStaticRecords()
+	res.Config.AdminToken = "secret"
+	h := res.httpHandler()
+
+	name := "chronos.marathon-0.6.0.mesos."
+	generated := res.rs.As[name]
+
+	rec := apiRequest(h, "PUT", "/v1/records/static/a/"+name, "secret", `{"values": ["10.0.0.5"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if !reflect.DeepEqual(res.rs.As[name], []string{"10.0.0.5"}) {
+		t.Errorf("static records should replace the generated ones, got %v", res.rs.As[name])
+	}
+
+	// survive reloads
+	res.publish()
+	if !reflect.DeepEqual(res.rs.As[name], []string{"10.0.0.5"}) {
+		t.Error("static records should survive reloads")
+	}
+
+	if list := res.static.list(); !reflect.DeepEqual(list["A"][name], []string{"10.0.0.5"}) {
+		t.Errorf("unexpected list %v", list)
+	}
+
+	var tests = []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"GET", "/v1/records/static", "", http.StatusOK},
+		{"POST", "/v1/records/static/a/" + name, "", http.StatusMethodNotAllowed},
+		{"PUT", "/v1/records/static/a/", `{"values": ["10.0.0.5"]}`, http.StatusNotFound},
+		{"PUT", "/v1/records/static/a/" + name, `{"values": []}`, http.StatusBadRequest},
+		{"PUT", "/v1/records/static/a/" + name, `{"values": ["x"]}`, http.StatusBadRequest},
+		{"DELETE", "/v1/records/static/srv/" + name, "", http.StatusNotFound},
+		{"DELETE", "/v1/records/static/a/" + name, "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		if rec := apiRequest(h, tt.method, tt.path, "secret", tt.body); rec.Code != tt.code {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.code, rec.Code)
+		}
+	}
+
+	if !reflect.DeepEqual(res.rs.As[name], generated) {
+		t.Errorf("removing static records should restore the generated ones, got %v", res.rs.As[name])
+	}
+}
@@ -0,0 +1,274 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// statsdPacket is the most we put in a statsd datagram, so it is not
+// fragmented on an ethernet network
+const statsdPacket = 1400
+
+// statsdSamples is how many timings of a kind are kept between flushes
+const statsdSamples = 1000
+
+// statsdGauges are the stats that are levels rather than counts
+var statsdGauges = map[string]bool{"HeapBytes": true, "Goroutines": true, "OpenFDs": true}
+
+// stats collects what the statsd emitter ships besides the counters in
+// logging.CurLog, a nil *stats collects nothing
+type stats struct {
+	sync.Mutex
+	counts  map[string]int
+	timings map[string][]float64
+	last    logging.LogOut
+}
+
+func newStats() *stats {
+	return &stats{counts: make(map[string]int), timings: make(map[string][]float64)}
+}
+
+// count adds one to the counter name
+func (s *stats) count(name string) {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	s.counts[name]++
+	s.Unlock()
+}
+
+// timing records that name took d
+func (s *stats) timing(name string, d time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	if len(s.timings[name]) < statsdSamples {
+		s.timings[name] = append(s.timings[name], float64(d)/float64(time.Millisecond))
+	}
+	s.Unlock()
+}
+
+// metric is a stat to ship, kind is c (counter), g (gauge) or ms
+// (timing)
+type metric struct {
+	name  string
+	value float64
+	kind  string
+}
+
+// flush returns the stats since the last flush and starts over
+func (s *stats) flush() []metric {
+	s.Lock()
+	defer s.Unlock()
+
+	var ms []metric
+	cur := logging.CurLog
+	now, last := reflect.ValueOf(cur), reflect.ValueOf(s.last)
+	for i := 0; i < now.NumField(); i++ {
+		field := now.Type().Field(i).Name
+		v := now.Field(i).Int()
+		if statsdGauges[field] {
+			ms = append(ms, metric{snakeCase(field), float64(v), "g"})
+		} else {
+			ms = append(ms, metric{snakeCase(field), float64(v - last.Field(i).Int()), "c"})
+		}
+	}
+	s.last = cur
+
+	counts := make([]string, 0, len(s.counts))
+	for name := range s.counts {
+		counts = append(counts, name)
+	}
+	sort.Strings(counts)
+	for _, name := range counts {
+		ms = append(ms, metric{name, float64(s.counts[name]), "c"})
+	}
+
+	timings := make([]string, 0, len(s.timings))
+	for name := range s.timings {
+		timings = append(timings, name)
+	}
+	sort.Strings(timings)
+	for _, name := range timings {
+		for _, t := range s.timings[name] {
+			ms = append(ms, metric{name, t, "ms"})
+		}
+	}
+	s.counts = make(map[string]int)
+	s.timings = make(map[string][]float64)
+	return ms
+}
+
+// snakeCase turns a field name into a metric name, NonMesosRequests
+// into non_mesos_requests and OpenFDs into open_fds
+func snakeCase(s string) string {
+	var b []rune
+	rs := []rune(s)
+	plural := func(i int) bool {
+		return rs[i] == 's' && (i+1 == len(rs) || unicode.IsUpper(rs[i+1]))
+	}
+	for i, r := range rs {
+		if unicode.IsUpper(r) && i > 0 && (unicode.IsLower(rs[i-1]) ||
+			(i+1 < len(rs) && unicode.IsLower(rs[i+1]) && !plural(i+1))) {
+			b = append(b, '_')
+		}
+		b = append(b, unicode.ToLower(r))
+	}
+	return string(b)
+}
+
+// statsdLines formats ms as statsd lines, timings as they are
+func statsdLines(prefix string, ms []metric) []string {
+	lines := make([]string, 0, len(ms))
+	for _, m := range ms {
+		lines = append(lines, prefix+"."+m.name+":"+strconv.FormatFloat(m.value, 'f', -1, 64)+"|"+m.kind)
+	}
+	return lines
+}
+
+// graphiteLines formats ms as graphite plaintext lines at now, timings
+// summed up as their count, mean and max
+func graphiteLines(prefix string, ms []metric, now time.Time) []string {
+	ts := " " + strconv.FormatInt(now.Unix(), 10)
+	line := func(name string, v float64) string {
+		return prefix + "." + name + " " + strconv.FormatFloat(v, 'f', -1, 64) + ts
+	}
+
+	var lines []string
+	for i := 0; i < len(ms); {
+		m := ms[i]
+		if m.kind != "ms" {
+			lines = append(lines, line(m.name, m.value))
+			i++
+			continue
+		}
+
+		var n, sum, max float64
+		for ; i < len(ms) && ms[i].name == m.name && ms[i].kind == "ms"; i++ {
+			n, sum = n+1, sum+ms[i].value
+			if ms[i].value > max {
+				max = ms[i].value
+			}
+		}
+		lines = append(lines, line(m.name+".count", n), line(m.name+".mean", sum/n), line(m.name+".max", max))
+	}
+	return lines
+}
+
+// statsdWriter counts the responses by rcode
+type statsdWriter struct {
+	dns.ResponseWriter
+	s *stats
+}
+
+func (w *statsdWriter) WriteMsg(m *dns.Msg) error {
+	w.count(m)
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// Write counts the packed responses, e.g. from the answer cache
+func (w *statsdWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if m.Unpack(b) == nil {
+		w.count(m)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// count counts the rcode of m
+func (w *statsdWriter) count(m *dns.Msg) {
+	if rcode, ok := dns.RcodeToString[m.Rcode]; ok {
+		w.s.count("rcode." + strings.ToLower(rcode))
+	}
+}
+
+// statsdCounted counts the rcodes of the responses h sends
+func (res *Resolver) statsdCounted(h dns.Handler) dns.Handler {
+	if res.stats == nil {
+		return h
+	}
+
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		h.ServeDNS(&statsdWriter{ResponseWriter: w, s: res.stats}, r)
+	})
+}
+
+// RunStatsd ships the stats to StatsdAddress every StatsdFlushSeconds,
+// until ctx is done
+func (res *Resolver) RunStatsd(ctx context.Context) error {
+	config := *res.config()
+
+	network := "udp"
+	if config.StatsdFormat == "graphite" {
+		network = "tcp"
+	}
+	conn, err := net.DialTimeout(network, config.StatsdAddress, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ticker := time.NewTicker(time.Duration(config.StatsdFlushSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		var done bool
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-ticker.C:
+		}
+
+		ms := res.stats.flush()
+		if config.StatsdFormat == "graphite" {
+			lines := graphiteLines(config.StatsdPrefix, ms, time.Now())
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+				return err
+			}
+		} else {
+			// a lost datagram is a lost flush, statsd is best effort
+			for _, p := range statsdPackets(statsdLines(config.StatsdPrefix, ms)) {
+				conn.Write([]byte(p))
+			}
+		}
+
+		if done {
+			return nil
+		}
+	}
+}
+
+// statsdPackets packs lines into datagrams of at most statsdPacket bytes
+func statsdPackets(lines []string) []string {
+	var packets []string
+	p := ""
+	for _, l := range lines {
+		if p != "" && len(p)+1+len(l) > statsdPacket {
+			packets = append(packets, p)
+			p = ""
+		}
+		if p != "" {
+			p += "\n"
+		}
+		p += l
+	}
+	if p != "" {
+		packets = append(packets, p)
+	}
+	return packets
+}
@@ -0,0 +1,135 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func statsdHandler(res *Resolver) dns.Handler {
+	return res.statsdCounted(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		if r.Question[0].Name == "cached.mesos." {
+			// packed, like the answers from the answer cache
+			m.SetReply(r)
+			wire, _ := m.Pack()
+			w.Write(wire)
+			return
+		}
+		m.SetRcode(r, dns.RcodeNameError)
+		w.WriteMsg(m)
+	}))
+}
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	res := New(records.Config{Domain: "mesos", StatsdAddress: conn.LocalAddr().String(),
+		StatsdFormat: "statsd", StatsdPrefix: "dns", StatsdFlushSeconds: 10})
+	statsdHandler(res).ServeDNS(&fakeWriter{}, new(dns.Msg).SetQuestion("missing.mesos.", dns.TypeA))
+	statsdHandler(res).ServeDNS(&fakeWriter{}, new(dns.Msg).SetQuestion("cached.mesos.", dns.TypeA))
+	res.stats.timing("reload", 1500*time.Microsecond)
+
+	// a done context flushes once and returns
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := res.RunStatsd(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		b := make([]byte, 2048)
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			break
+		}
+		if n > statsdPacket {
+			t.Errorf("expected packets of at most %d bytes, got %d", statsdPacket, n)
+		}
+		lines = append(lines, strings.Split(string(b[:n]), "\n")...)
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	}
+
+	got := strings.Join(lines, "\n")
+	for _, want := range []string{"dns.rcode.nxdomain:1|c", "dns.rcode.noerror:1|c", "dns.reload:1.5|ms", "dns.non_mesos_nx_domain:", "dns.goroutines:"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in\n%s", want, got)
+		}
+	}
+	if !strings.Contains(got, "|g") {
+		t.Errorf("expected gauges in\n%s", got)
+	}
+}
+
+func TestGraphite(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	res := New(records.Config{Domain: "mesos", StatsdAddress: l.Addr().String(),
+		StatsdFormat: "graphite", StatsdPrefix: "dns", StatsdFlushSeconds: 10})
+	res.stats.timing("upstream", 2*time.Millisecond)
+	res.stats.timing("upstream", 4*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- res.RunStatsd(ctx) }()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	values := make(map[string]string)
+	s := bufio.NewScanner(conn)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 {
+			t.Fatalf("expected name, value and time, got %q", s.Text())
+		}
+		values[fields[0]] = fields[1]
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"dns.upstream.count": "2",
+		"dns.upstream.mean":  "3",
+		"dns.upstream.max":   "4",
+	} {
+		if values[name] != want {
+			t.Errorf("%s: expected %s, got %q", name, want, values[name])
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"MesosRequests":      "mesos_requests",
+		"NonMesosACLRefused": "non_mesos_acl_refused",
+		"RRLSlipped":         "rrl_slipped",
+		"OpenFDs":            "open_fds",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+}
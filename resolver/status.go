@@ -0,0 +1,90 @@
+package resolver
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// listeners tracks which of the DNS servers are bound and serving
+type listeners struct {
+	sync.Mutex
+	bound map[string]bool
+}
+
+// set records whether the server for net is serving
+func (l *listeners) set(net string, bound bool) {
+	l.Lock()
+	defer l.Unlock()
+	if l.bound == nil {
+		l.bound = make(map[string]bool)
+	}
+	l.bound[net] = bound
+}
+
+// get returns whether the tcp and udp servers, and the others that were
+// started, are serving
+func (l *listeners) get() map[string]bool {
+	l.Lock()
+	defer l.Unlock()
+	bound := map[string]bool{"tcp": false, "udp": false}
+	for net, b := range l.bound {
+		bound[net] = b
+	}
+	return bound
+}
+
+// healthResponse is the body of /health
+type healthResponse struct {
+	Status    string          `json:"status"`
+	Listeners map[string]bool `json:"listeners"`
+}
+
+// handleHealth reports whether the process is alive and its DNS servers
+// are bound, for liveness checks
+func (res *Resolver) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !only("GET", w, r) {
+		return
+	}
+
+	resp := healthResponse{Status: "ok", Listeners: res.listening.get()}
+	code := http.StatusOK
+	for _, bound := range resp.Listeners {
+		if !bound {
+			resp.Status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, resp)
+}
+
+// readyResponse is the body of /ready
+type readyResponse struct {
+	Status  string     `json:"status"`
+	Fetched *time.Time `json:"fetched,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+}
+
+// handleReady reports whether we serve records from the masters, loaded
+// within the last ReadyRefreshPeriods refreshes, for readiness checks
+func (res *Resolver) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !only("GET", w, r) {
+		return
+	}
+
+	c := *res.config()
+	resp := readyResponse{Status: "ready", Fetched: unixNano(&res.fetched)}
+	window := time.Duration(c.ReadyRefreshPeriods*c.RefreshSeconds) * time.Second
+	switch {
+	case resp.Fetched == nil:
+		resp.Status, resp.Reason = "not ready", "no records loaded from the masters yet"
+	case time.Since(time.Unix(0, atomic.LoadInt64(&res.fetched))) > window:
+		resp.Status, resp.Reason = "not ready", "masters not reached for "+window.String()
+	}
+
+	code := http.StatusOK
+	if resp.Status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, resp)
+}
@@ -0,0 +1,43 @@
+package resolver
+
+import (
+	"net"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// stubZone returns the most specific of the StubZones name is in, "" if
+// it is in none
+func stubZone(config records.Config, name string) string {
+	zone := ""
+	for z := range config.StubZones {
+		if dns.IsSubDomain(z, name) && dns.CountLabel(z) >= dns.CountLabel(zone) {
+			zone = z
+		}
+	}
+	return zone
+}
+
+// upstreams returns the addresses the query for name is forwarded to,
+// the resolvers of its stub zone or else the Resolvers
+func (res *Resolver) upstreams(name string) []string {
+	config := *res.config()
+
+	if zone := stubZone(config, dns.Fqdn(name)); zone != "" {
+		addrs := make([]string, 0, len(config.StubZones[zone]))
+		for _, addr := range config.StubZones[zone] {
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				addr = net.JoinHostPort(addr, "53")
+			}
+			addrs = append(addrs, addr)
+		}
+		return addrs
+	}
+
+	var addrs []string
+	for _, r := range res.resolvers() {
+		addrs = append(addrs, r+":53")
+	}
+	return addrs
+}
@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestStubZone(t *testing.T) {
+	config := records.Config{StubZones: map[string][]string{
+		"consul.":           {"10.0.0.2:8600"},
+		"example.com.":      {"10.1.0.53"},
+		"corp.example.com.": {"10.2.0.53", "fd00::53"},
+	}}
+
+	var tests = []struct {
+		name, zone string
+	}{
+		{"web.service.consul.", "consul."},
+		{"www.example.com.", "example.com."},
+		{"db.corp.example.com.", "corp.example.com."},
+		{"corp.example.com.", "corp.example.com."},
+		{"notcorp.example.com.", "example.com."},
+		{"google.com.", ""},
+	}
+	for _, tt := range tests {
+		if zone := stubZone(config, tt.name); zone != tt.zone {
+			t.Errorf("%s: expected zone %q, got %q", tt.name, tt.zone, zone)
+		}
+	}
+
+	config.Resolvers = []string{"8.8.8.8"}
+	res := New(config)
+	for name, want := range map[string][]string{
+		"db.corp.example.com.": {"10.2.0.53:53", "[fd00::53]:53"},
+		"web.service.consul.":  {"10.0.0.2:8600"},
+		"google.com.":          {"8.8.8.8:53"},
+	} {
+		if got := res.upstreams(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestStubZoneForward(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 10.0.0.7")
+		m.Answer = []dns.RR{rr}
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	// the resolvers are never asked
+	res := New(records.Config{
+		Domain:         "mesos",
+		Timeout:        1,
+		RecurseOn:      true,
+		MaxForwardHops: 3,
+		Resolvers:      []string{"127.0.0.2"},
+		StubZones:      map[string][]string{"consul.": {pc.LocalAddr().String()}},
+	})
+
+	w := &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53}}
+	res.HandleNonMesos(w, new(dns.Msg).SetQuestion("web.service.consul.", dns.TypeA))
+	if w.msg == nil || len(w.msg.Answer) != 1 || w.msg.Answer[0].(*dns.A).A.String() != "10.0.0.7" {
+		t.Errorf("expected the answer of the stub zone's resolver, got %v", w.msg)
+	}
+}
@@ -0,0 +1,40 @@
+package resolver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// formatTLSA returns the TLSA resource record for value, "usage selector
+// type data"
+func (res *Resolver) formatTLSA(name string, value string) (*dns.TLSA, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 4 {
+		return nil, errors.New("invalid tlsa " + value + " for " + name)
+	}
+
+	var n [3]uint8
+	for i := range n {
+		v, err := strconv.ParseUint(fields[i], 10, 8)
+		if err != nil {
+			return nil, errors.New("invalid tlsa " + value + " for " + name)
+		}
+		n[i] = uint8(v)
+	}
+
+	return &dns.TLSA{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeTLSA,
+			Class:  dns.ClassINET,
+			Ttl:    res.ttl(&res.rs, name),
+		},
+		Usage:        n[0],
+		Selector:     n[1],
+		MatchingType: n[2],
+		Certificate:  fields[3],
+	}, nil
+}
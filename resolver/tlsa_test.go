@@ -0,0 +1,28 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestTLSA(t *testing.T) {
+	res := New(records.Config{Domain: "mesos", TTL: 60})
+	res.rs.InsertState(records.StateJSON{}, res.Config)
+	res.rs.Insert("_443._tcp.web.marathon.mesos.", "3 1 1 0a1b2c", "TLSA")
+
+	w := &fakeWriter{}
+	res.HandleMesos(w, new(dns.Msg).SetQuestion("_443._tcp.web.marathon.mesos.", dns.TypeTLSA))
+	if len(w.msg.Answer) != 1 {
+		t.Fatalf("expected a TLSA record, got %v", w.msg.Answer)
+	}
+	rr, ok := w.msg.Answer[0].(*dns.TLSA)
+	if !ok || rr.Usage != 3 || rr.Selector != 1 || rr.MatchingType != 1 || rr.Certificate != "0a1b2c" || rr.Hdr.Ttl != 60 {
+		t.Errorf("unexpected TLSA record %v", w.msg.Answer[0])
+	}
+
+	if _, err := res.formatTLSA("x.mesos.", "3 1 1"); err == nil {
+		t.Error("expected an error for an invalid TLSA value")
+	}
+}
@@ -0,0 +1,21 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// forwardUnderscore reports whether the query for dom should go to the
+// resolvers - non-SRV queries for underscore names like _dmarc that we
+// have no records for, if UnderscoreNames is forward
+func (res *Resolver) forwardUnderscore(dom string, qtype uint16) bool {
+	if res.config().UnderscoreNames != "forward" || qtype == dns.TypeSRV || !strings.HasPrefix(dom, "_") {
+		return false
+	}
+
+	res.rsLock.RLock()
+	defer res.rsLock.RUnlock()
+
+	return !res.exists(dom)
+}
@@ -0,0 +1,65 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestForwardUnderscore(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name    string
+		qtype   uint16
+		forward bool
+	}{
+		{"_dmarc.mesos.", dns.TypeTXT, true},
+		{"_acme-challenge.chronos.marathon-0.6.0.mesos.", dns.TypeTXT, true},
+		{"_dmarc.mesos.", dns.TypeSRV, false},
+		{"_chronos._tcp.marathon-0.6.0.mesos.", dns.TypeTXT, false},
+		{"_tcp.marathon-0.6.0.mesos.", dns.TypeTXT, false},
+		{"missing.mesos.", dns.TypeTXT, false},
+	}
+
+	if res.forwardUnderscore("_dmarc.mesos.", dns.TypeTXT) {
+		t.Error("should not forward by default")
+	}
+
+	res.Config.UnderscoreNames = "forward"
+	for _, tt := range tests {
+		if res.forwardUnderscore(tt.name, tt.qtype) != tt.forward {
+			t.Errorf("%s %s: expected forward %v", tt.name, dns.TypeToString[tt.qtype], tt.forward)
+		}
+	}
+}
+
+func TestUnderscoreTXT(t *testing.T) {
+	res, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Config.UnderscoreNames = "forward"
+	res.Config.UnderscoreTXT = map[string][]string{
+		"_acme-challenge.chronos.marathon-0.6.0.mesos.": {"token"},
+	}
+	res.rs.InsertUnderscoreTXT(res.Config)
+
+	r := new(dns.Msg)
+	r.SetQuestion("_acme-challenge.chronos.marathon-0.6.0.mesos.", dns.TypeTXT)
+	w := &fakeWriter{}
+	res.HandleMesos(w, r)
+
+	if len(w.msg.Answer) != 1 || w.msg.Answer[0].(*dns.TXT).Txt[0] != "token" {
+		t.Fatalf("expected the configured TXT record, got %v", w.msg.Answer)
+	}
+
+	r.SetQuestion("_acme-challenge.chronos.marathon-0.6.0.mesos.", dns.TypeA)
+	res.HandleMesos(w, r)
+	if w.msg.Rcode != dns.RcodeSuccess || len(w.msg.Answer) != 0 {
+		t.Error("other types should get NODATA")
+	}
+}
@@ -0,0 +1,20 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+)
+
+// formatURI returns the URI resource record for target
+func (res *Resolver) formatURI(name string, target string) *dns.URI {
+	return &dns.URI{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeURI,
+			Class:  dns.ClassINET,
+			Ttl:    res.ttl(&res.rs, name),
+		},
+		Priority: 1,
+		Weight:   1,
+		Target:   target,
+	}
+}
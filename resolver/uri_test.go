@@ -0,0 +1,24 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+func TestURI(t *testing.T) {
+	res := New(records.Config{Domain: "mesos", TTL: 60})
+	res.rs.InsertState(records.StateJSON{}, res.Config)
+	res.rs.Insert("_api._tcp.web.marathon.mesos.", "https://web.marathon.mesos:31000/v2", "URI")
+
+	w := &fakeWriter{}
+	res.HandleMesos(w, new(dns.Msg).SetQuestion("_api._tcp.web.marathon.mesos.", dns.TypeURI))
+	if len(w.msg.Answer) != 1 {
+		t.Fatalf("expected a URI record, got %v", w.msg.Answer)
+	}
+	rr, ok := w.msg.Answer[0].(*dns.URI)
+	if !ok || rr.Target != "https://web.marathon.mesos:31000/v2" || rr.Priority != 1 || rr.Weight != 1 {
+		t.Errorf("unexpected URI record %v", w.msg.Answer[0])
+	}
+}
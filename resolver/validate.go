@@ -0,0 +1,35 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// DryRun reloads the records once and writes them to w as JSON, as
+// /v1/records returns them, without serving anything
+// it fails if masters are configured and none of them answered
+func (res *Resolver) DryRun(w io.Writer) error {
+	if err := res.generate(); err != nil {
+		return err
+	}
+	return printJSON(w, res.records())
+}
+
+// generate reloads the records once, it fails if masters are configured
+// and none of them answered
+func (res *Resolver) generate() error {
+	res.Reload()
+	if len(res.config().Masters) > 0 && atomic.LoadInt64(&res.fetched) == 0 {
+		return errors.New("no master answered")
+	}
+	return nil
+}
+
+// printJSON writes v to w as indented JSON
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,44 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+func TestDryRun(t *testing.T) {
+	master := fakeMaster(t, "web")
+	defer master.Close()
+
+	config := records.Config{
+		Domain:         "mesos",
+		Listener:       "127.0.0.1",
+		Mname:          "mesos-dns.mesos.",
+		InactiveAgents: "drop",
+		Masters:        []string{master.Listener.Addr().String()},
+	}
+
+	var b bytes.Buffer
+	if err := New(config).DryRun(&b); err != nil {
+		t.Fatal(err)
+	}
+	var got recordsResponse
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Serial == 0 {
+		t.Error("expected a serial")
+	}
+	if !reflect.DeepEqual(got.A["web.marathon.mesos."], []string{"10.0.0.1"}) {
+		t.Errorf("expected web.marathon.mesos. at 10.0.0.1, got %v", got.A["web.marathon.mesos."])
+	}
+
+	// the masters are gone
+	master.Close()
+	if err := New(config).DryRun(&b); err == nil {
+		t.Error("expected an error without a master")
+	}
+}
@@ -0,0 +1,536 @@
+package resolver
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/miekg/dns"
+)
+
+// the security of a forwarded answer (RFC 4035, section 4.3)
+const (
+	insecure = iota
+	secure
+	bogus
+)
+
+// validation errors: there is no chain of trust to a zone's keys, or
+// there is one and it is broken
+var (
+	errNoChain = errors.New("no chain of trust")
+	errBogus   = errors.New("bogus chain of trust")
+)
+
+// validatorMaxDepth bounds the zones a chain of trust goes through
+const validatorMaxDepth = 16
+
+// validatorMaxTTL caps how long validated keys are kept
+const validatorMaxTTL = time.Hour
+
+// trustedKeys are the validated DNSKEY set of a zone
+type trustedKeys struct {
+	keys    []*dns.DNSKEY
+	expires time.Time
+}
+
+// validator checks the DNSSEC signatures of forwarded answers, with keys
+// it follows from the trust anchors down to the signer - the DS and
+// DNSKEY sets it needs come from query
+type validator struct {
+	anchors map[string][]dns.RR
+	query   func(name string, qtype uint16) (*dns.Msg, error)
+
+	sync.Mutex
+	keys map[string]trustedKeys
+
+	// cuts holds the delegations proven unsigned and when the proofs
+	// expire
+	cuts map[string]time.Time
+}
+
+// newValidator returns a validator trusting anchors, DS or DNSKEY
+// records in zone file format
+func newValidator(anchors []string, query func(string, uint16) (*dns.Msg, error)) (*validator, error) {
+	v := &validator{
+		anchors: make(map[string][]dns.RR),
+		query:   query,
+		keys:    make(map[string]trustedKeys),
+		cuts:    make(map[string]time.Time),
+	}
+	for _, a := range anchors {
+		rr, err := dns.NewRR(a)
+		if err != nil {
+			return nil, err
+		}
+		if rr == nil {
+			continue
+		}
+		switch rr.(type) {
+		case *dns.DS, *dns.DNSKEY:
+		default:
+			return nil, errors.New("trust anchor " + a + " is not a DS or DNSKEY record")
+		}
+		zone := strings.ToLower(rr.Header().Name)
+		v.anchors[zone] = append(v.anchors[zone], rr)
+	}
+	return v, nil
+}
+
+// rrset is the records of a name and type, and the signatures over them
+type rrset struct {
+	rrs  []dns.RR
+	sigs []*dns.RRSIG
+}
+
+// rrsets groups rrs by name and type, in the order they appear
+func rrsets(rrs []dns.RR) []*rrset {
+	type key struct {
+		name  string
+		rtype uint16
+	}
+	var sets []*rrset
+	byKey := make(map[key]*rrset)
+	get := func(k key) *rrset {
+		s := byKey[k]
+		if s == nil {
+			s = &rrset{}
+			byKey[k] = s
+			sets = append(sets, s)
+		}
+		return s
+	}
+
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header().Name)
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			s := get(key{name, sig.TypeCovered})
+			s.sigs = append(s.sigs, sig)
+			continue
+		}
+		s := get(key{name, rr.Header().Rrtype})
+		s.rrs = append(s.rrs, rr)
+	}
+
+	// signatures over records that aren't there
+	all := sets[:0]
+	for _, s := range sets {
+		if len(s.rrs) > 0 {
+			all = append(all, s)
+		}
+	}
+	return all
+}
+
+// validate returns the security of the answer section of m - only
+// positive answers can be secure, denials of existence aren't checked
+func (v *validator) validate(m *dns.Msg) int {
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) == 0 {
+		return insecure
+	}
+
+	security := secure
+	for _, s := range rrsets(m.Answer) {
+		switch v.verify(s, 0) {
+		case bogus:
+			return bogus
+		case insecure:
+			security = insecure
+		}
+	}
+	return security
+}
+
+// verify returns the security of the RRset s, which is secure if one of
+// its signatures verifies with the trusted keys of the signer - without
+// such a signature it is insecure only if it is outside the signed zones
+func (v *validator) verify(s *rrset, depth int) int {
+	if security := v.signed(s, depth); security != insecure {
+		return security
+	}
+
+	// the signatures may have been stripped
+	owner := strings.ToLower(s.rrs[0].Header().Name)
+	if s.rrs[0].Header().Rrtype == dns.TypeDS {
+		// a DS set is in the parent zone
+		owner = parentName(owner)
+	}
+	return v.unsignedSecurity(owner, depth)
+}
+
+// signed returns the security of the RRset s going by its signatures
+// alone: secure if one of them verifies with the trusted keys of the
+// signer, bogus if the signer has trusted keys but none verifies and
+// insecure if no signer has any
+func (v *validator) signed(s *rrset, depth int) int {
+	owner := strings.ToLower(s.rrs[0].Header().Name)
+	ds := s.rrs[0].Header().Rrtype == dns.TypeDS
+
+	security := insecure
+	now := time.Now()
+	for _, sig := range s.sigs {
+		signer := strings.ToLower(sig.SignerName)
+		// a DS set is signed by the parent zone
+		if !dns.IsSubDomain(signer, owner) || (ds && signer == owner) {
+			continue
+		}
+
+		keys, err := v.zoneKeys(signer, depth+1)
+		if err == errBogus {
+			security = bogus
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		security = bogus
+		if !sig.ValidityPeriod(now) {
+			continue
+		}
+		for _, k := range keys {
+			if k.KeyTag() == sig.KeyTag && k.Algorithm == sig.Algorithm && sig.Verify(k, s.rrs) == nil {
+				return secure
+			}
+		}
+	}
+	return security
+}
+
+// unsignedSecurity returns the security of the records of name that
+// aren't signed with trusted keys: insecure if no trust anchor is above
+// name or a delegation between them is proven unsigned, bogus otherwise
+func (v *validator) unsignedSecurity(name string, depth int) int {
+	if depth > validatorMaxDepth || !v.anchored(name) {
+		return insecure
+	}
+
+	// nothing below an unsigned delegation can be signed
+	zones := ancestors(name)
+	now := time.Now()
+	v.Lock()
+	for _, zone := range zones {
+		if expires, ok := v.cuts[zone]; ok && now.Before(expires) {
+			v.Unlock()
+			return insecure
+		}
+	}
+	v.Unlock()
+
+	// the closest zone cut decides
+	for _, zone := range zones {
+		if v.anchors[zone] != nil {
+			return bogus
+		}
+		signed, unsigned := v.delegation(zone, depth)
+		switch {
+		case signed:
+			return bogus
+		case unsigned:
+			return insecure
+		}
+	}
+	return bogus
+}
+
+// anchored reports whether a trust anchor is at or above name
+func (v *validator) anchored(name string) bool {
+	for zone := range v.anchors {
+		if dns.IsSubDomain(zone, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// delegation asks for the DS set of zone and reports whether it proves
+// a signed zone, a validated DS set, or an unsigned delegation, a
+// validated NSEC or NSEC3 denial - neither if zone isn't a zone cut or
+// the answer proves nothing
+func (v *validator) delegation(zone string, depth int) (signed bool, unsigned bool) {
+	m, err := v.query(zone, dns.TypeDS)
+	if err != nil || m.Rcode != dns.RcodeSuccess {
+		return false, false
+	}
+	if s := answerSet(m, zone, dns.TypeDS); s != nil {
+		return v.signed(s, depth+1) == secure, false
+	}
+
+	var nsec3s []*dns.NSEC3
+	for _, s := range rrsets(m.Ns) {
+		if t := s.rrs[0].Header().Rrtype; (t != dns.TypeNSEC && t != dns.TypeNSEC3) || v.signed(s, depth+1) != secure {
+			continue
+		}
+		for _, rr := range s.rrs {
+			switch rr := rr.(type) {
+			case *dns.NSEC:
+				if strings.EqualFold(rr.Hdr.Name, zone) && unsignedCut(rr.TypeBitMap) {
+					return false, v.cut(zone, rr.Hdr.Ttl)
+				}
+			case *dns.NSEC3:
+				nsec3s = append(nsec3s, rr)
+			}
+		}
+	}
+
+	for _, n := range nsec3s {
+		if n.Match(zone) && unsignedCut(n.TypeBitMap) {
+			return false, v.cut(zone, n.Hdr.Ttl)
+		}
+	}
+
+	// an opt-out delegation has no NSEC3 of its own: its closest
+	// encloser has one, and an opt-out NSEC3 covers the next closer name
+	// (RFC 5155, section 8.6)
+	zones := ancestors(zone)
+	for i := 1; i < len(zones); i++ {
+		if !nsec3Matches(nsec3s, zones[i]) {
+			continue
+		}
+		for _, n := range nsec3s {
+			if n.Flags&1 == 1 && n.Cover(zones[i-1]) {
+				return false, v.cut(zone, n.Hdr.Ttl)
+			}
+		}
+		break
+	}
+	return false, false
+}
+
+// cut keeps that the delegation zone is unsigned for ttl seconds, at
+// most validatorMaxTTL
+func (v *validator) cut(zone string, ttl uint32) bool {
+	d := time.Duration(ttl) * time.Second
+	if d > validatorMaxTTL {
+		d = validatorMaxTTL
+	}
+
+	v.Lock()
+	v.cuts[strings.ToLower(zone)] = time.Now().Add(d)
+	v.Unlock()
+	return true
+}
+
+// unsignedCut reports whether the types of an NSEC or NSEC3 record are
+// those of a delegation without DS, seen from the parent
+func unsignedCut(types []uint16) bool {
+	ns := false
+	for _, t := range types {
+		switch t {
+		case dns.TypeNS:
+			ns = true
+		case dns.TypeDS, dns.TypeSOA:
+			return false
+		}
+	}
+	return ns
+}
+
+// nsec3Matches reports whether one of nsec3s is the NSEC3 record of name
+func nsec3Matches(nsec3s []*dns.NSEC3, name string) bool {
+	for _, n := range nsec3s {
+		if n.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ancestors returns name and the names above it, up to the root
+func ancestors(name string) []string {
+	names := []string{name}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		names = append(names, name[off:])
+	}
+	if name != "." {
+		names = append(names, ".")
+	}
+	return names
+}
+
+// parentName returns the name above name, the root for the root
+func parentName(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
+
+// zoneKeys returns the validated DNSKEY set of zone, errNoChain if it
+// can't be followed from a trust anchor and errBogus if it doesn't hold
+func (v *validator) zoneKeys(zone string, depth int) ([]*dns.DNSKEY, error) {
+	if depth > validatorMaxDepth {
+		return nil, errNoChain
+	}
+
+	v.Lock()
+	cached, ok := v.keys[zone]
+	v.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.keys, nil
+	}
+
+	// the DS set of the parent, unless we trust the zone itself
+	refs := v.anchors[zone]
+	if refs == nil {
+		m, err := v.query(zone, dns.TypeDS)
+		if err != nil || m.Rcode != dns.RcodeSuccess {
+			return nil, errNoChain
+		}
+		s := answerSet(m, zone, dns.TypeDS)
+		if s == nil {
+			return nil, errNoChain
+		}
+		switch v.verify(s, depth) {
+		case insecure:
+			return nil, errNoChain
+		case bogus:
+			return nil, errBogus
+		}
+		refs = s.rrs
+	}
+
+	m, err := v.query(zone, dns.TypeDNSKEY)
+	if err != nil || m.Rcode != dns.RcodeSuccess {
+		return nil, errBogus
+	}
+	s := answerSet(m, zone, dns.TypeDNSKEY)
+	if s == nil {
+		return nil, errBogus
+	}
+
+	var keys []*dns.DNSKEY
+	ttl := validatorMaxTTL
+	for _, rr := range s.rrs {
+		keys = append(keys, rr.(*dns.DNSKEY))
+		if d := time.Duration(rr.Header().Ttl) * time.Second; d < ttl {
+			ttl = d
+		}
+	}
+
+	// the DNSKEY set is signed by a key the references point at
+	now := time.Now()
+	for _, sig := range s.sigs {
+		if !sig.ValidityPeriod(now) {
+			continue
+		}
+		for _, k := range keys {
+			if k.KeyTag() != sig.KeyTag || k.Algorithm != sig.Algorithm || !referenced(k, refs) {
+				continue
+			}
+			if sig.Verify(k, s.rrs) == nil {
+				v.Lock()
+				v.keys[zone] = trustedKeys{keys: keys, expires: now.Add(ttl)}
+				v.Unlock()
+				return keys, nil
+			}
+		}
+	}
+
+	logging.Verbose.Println("no trusted key signs the DNSKEY set of " + zone)
+	return nil, errBogus
+}
+
+// answerSet returns the RRset of name and rtype in the answer of m, nil
+// if there is none
+func answerSet(m *dns.Msg, name string, rtype uint16) *rrset {
+	for _, s := range rrsets(m.Answer) {
+		h := s.rrs[0].Header()
+		if h.Rrtype == rtype && strings.EqualFold(h.Name, name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// referenced reports whether one of refs, DS or DNSKEY records, points
+// at the key k
+func referenced(k *dns.DNSKEY, refs []dns.RR) bool {
+	for _, ref := range refs {
+		switch ref := ref.(type) {
+		case *dns.DS:
+			ds := k.ToDS(ref.DigestType)
+			if ds != nil && ds.KeyTag == ref.KeyTag && strings.EqualFold(ds.Digest, ref.Digest) {
+				return true
+			}
+		case *dns.DNSKEY:
+			if ref.Algorithm == k.Algorithm && ref.Flags == k.Flags && ref.PublicKey == k.PublicKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validationQuery asks the upstream resolvers for the DNSSEC records of
+// name the validator needs, over TCP as they don't fit in 512 bytes
+func (res *Resolver) validationQuery(name string, qtype uint16) (*dns.Msg, error) {
+	q := new(dns.Msg)
+	q.SetQuestion(name, qtype)
+	q.SetEdns0(dns.DefaultMsgSize, true)
+	return res.failover(q, "tcp")
+}
+
+// validated returns the upstream answer m to r with the AD bit set if it
+// validates, or a SERVFAIL if it is bogus - answers for queries with CD
+// set are passed on as they are
+func (res *Resolver) validated(r *dns.Msg, m *dns.Msg) *dns.Msg {
+	if res.validator == nil || m == nil {
+		return m
+	}
+
+	m.AuthenticatedData = false
+	if r.CheckingDisabled {
+		return m
+	}
+
+	switch res.validator.validate(m) {
+	case secure:
+		m.AuthenticatedData = true
+	case bogus:
+		logging.CurLog.NonMesosBogus += 1
+		logging.Verbose.Println("dnssec validation failed for " + r.Question[0].Name)
+
+		m = new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		m.RecursionAvailable = true
+	}
+	return m
+}
+
+// forClient returns m without the DNSSEC records the validator asked for
+// if r didn't ask for them, and without the AD bit unless r set DO or AD
+// (RFC 6840, section 5.8)
+func (res *Resolver) forClient(r *dns.Msg, m *dns.Msg) *dns.Msg {
+	if res.validator == nil || m == nil {
+		return m
+	}
+	if opt := r.IsEdns0(); opt != nil && opt.Do() {
+		return m
+	}
+
+	// m may be shared with other queries
+	m = m.Copy()
+	m.AuthenticatedData = m.AuthenticatedData && r.AuthenticatedData
+
+	qtype := r.Question[0].Qtype
+	strip := func(rrs []dns.RR) []dns.RR {
+		kept := rrs[:0]
+		for _, rr := range rrs {
+			switch t := rr.Header().Rrtype; t {
+			case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+				if t != qtype {
+					continue
+				}
+			}
+			kept = append(kept, rr)
+		}
+		return kept
+	}
+	m.Answer = strip(m.Answer)
+	m.Ns = strip(m.Ns)
+	return m
+}
@@ -0,0 +1,169 @@
+package resolver
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testSigner signs the records of a test zone with a single key
+type testSigner struct {
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newTestSigner(t *testing.T, zone string) testSigner {
+	k, priv, err := generateKey(zone, 257, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSigner{k, priv}
+}
+
+func (s testSigner) sign(t *testing.T, rrs ...dns.RR) []dns.RR {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrs[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrs[0].Header().Ttl},
+		KeyTag:     s.key.KeyTag(),
+		SignerName: s.key.Hdr.Name,
+		Algorithm:  s.key.Algorithm,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := sig.Sign(s.priv, rrs); err != nil {
+		t.Fatal(err)
+	}
+	return append(rrs, sig)
+}
+
+func TestValidator(t *testing.T) {
+	root := newTestSigner(t, ".")
+	example := newTestSigner(t, "example.")
+	unsigned := "unsigned.example."
+	optOut := "optout.example."
+
+	nsec := &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: unsigned, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 60},
+		NextDomain: "z.example.",
+		TypeBitMap: []uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC},
+	}
+	// the only NSEC3 record of example., which covers every other name
+	hash := dns.HashName("example.", dns.SHA1, 0, "")
+	nsec3 := &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: hash + ".example.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 60},
+		Hash:       dns.SHA1,
+		Flags:      1,
+		HashLength: 20,
+		NextDomain: hash,
+		TypeBitMap: []uint16{dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM},
+	}
+
+	// what the upstream resolvers answer for DS and DNSKEY queries
+	answers := map[string][]dns.RR{
+		".":        root.sign(t, root.key),
+		"example.": example.sign(t, example.key),
+	}
+	dsAnswers := map[string][]dns.RR{
+		"example.": root.sign(t, example.key.ToDS(dns.SHA256)),
+	}
+	// the proofs that a delegation has no DS set
+	dsDenials := map[string][]dns.RR{
+		unsigned: example.sign(t, nsec),
+		optOut:   example.sign(t, nsec3),
+	}
+	queries := 0
+	query := func(name string, qtype uint16) (*dns.Msg, error) {
+		queries++
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		if qtype == dns.TypeDS {
+			m.Answer = dsAnswers[name]
+			m.Ns = dsDenials[name]
+		} else {
+			m.Answer = answers[name]
+		}
+		return m, nil
+	}
+
+	v, err := newValidator([]string{root.key.ToDS(dns.SHA256).String()}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := func(name string, ip string) dns.RR {
+		rr, _ := dns.NewRR(name + " 60 IN A " + ip)
+		return rr
+	}
+	msg := func(rrs ...dns.RR) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion(rrs[0].Header().Name, dns.TypeA)
+		m.Answer = rrs
+		return m
+	}
+
+	signed := example.sign(t, a("www.example.", "192.0.2.1"))
+	forged := append([]dns.RR{a("www.example.", "192.0.2.66")}, signed[1])
+	expired := example.sign(t, a("old.example.", "192.0.2.2"))
+	expired[1].(*dns.RRSIG).Expiration = uint32(time.Now().Add(-time.Minute).Unix())
+
+	var tests = []struct {
+		name     string
+		m        *dns.Msg
+		security int
+	}{
+		{"signed", msg(signed...), secure},
+		{"unsigned", msg(a("www.example.", "192.0.2.1")), bogus},
+		{"unsigned delegation", msg(a("www."+unsigned, "192.0.2.3")), insecure},
+		{"opt-out delegation", msg(a(optOut, "192.0.2.4")), insecure},
+		{"unproven delegation", msg(a("www.other.example.", "192.0.2.5")), bogus},
+		{"forged", msg(forged...), bogus},
+		{"expired", msg(expired...), bogus},
+		{"no chain of trust", msg(a("www."+unsigned, "192.0.2.3"), &dns.RRSIG{
+			Hdr:         dns.RR_Header{Name: "www." + unsigned, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 60},
+			TypeCovered: dns.TypeA, Algorithm: dns.ECDSAP256SHA256, SignerName: unsigned,
+		}), insecure},
+		{"signed by a stranger", msg(newTestSigner(t, "example.").sign(t, a("www.example.", "192.0.2.1"))...), bogus},
+		{"nxdomain", new(dns.Msg).SetRcode(new(dns.Msg).SetQuestion("x.example.", dns.TypeA), dns.RcodeNameError), insecure},
+	}
+	for _, tt := range tests {
+		if security := v.validate(tt.m); security != tt.security {
+			t.Errorf("%s: expected security %d, got %d", tt.name, tt.security, security)
+		}
+	}
+
+	// the keys of a zone are validated once
+	queries = 0
+	v.validate(msg(signed...))
+	if queries != 0 {
+		t.Errorf("expected the validated keys to be kept, made %d queries", queries)
+	}
+	v.validate(msg(a("mail."+unsigned, "192.0.2.3")))
+	if queries != 0 {
+		t.Errorf("expected the unsigned delegation to be kept, made %d queries", queries)
+	}
+
+	res := &Resolver{validator: v}
+	r := new(dns.Msg).SetQuestion("www.example.", dns.TypeA)
+	m := res.validated(r, msg(signed...))
+	if !m.AuthenticatedData {
+		t.Error("expected the AD bit on a validated answer")
+	}
+	if m := res.validated(r, msg(forged...)); m.Rcode != dns.RcodeServerFailure {
+		t.Errorf("expected SERVFAIL for a bogus answer, got %s", dns.RcodeToString[m.Rcode])
+	}
+	r.CheckingDisabled = true
+	if m := res.validated(r, msg(forged...)); m.Rcode != dns.RcodeSuccess || m.AuthenticatedData {
+		t.Errorf("expected the bogus answer as it is with CD set, got %v", m)
+	}
+
+	// the signatures are for clients that set DO
+	r.CheckingDisabled = false
+	if stripped := res.forClient(r, m); len(stripped.Answer) != 1 || stripped.AuthenticatedData {
+		t.Errorf("expected no signatures and no AD bit without DO, got %v", stripped)
+	}
+	r.SetEdns0(dns.DefaultMsgSize, true)
+	if kept := res.forClient(r, m); len(kept.Answer) != 2 || !kept.AuthenticatedData {
+		t.Errorf("expected the signatures and the AD bit with DO, got %v", kept)
+	}
+}
@@ -0,0 +1,176 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// Warmup serves the records of the first peer that transfers our zone,
+// so we answer before the first fetch from the masters completes
+// it reports whether any peer did, the records are replaced by the next
+// successful reload
+func (res *Resolver) Warmup() bool {
+	config := *res.config()
+	if !config.WarmupFromPeers {
+		return false
+	}
+
+	for _, peer := range config.Peers {
+		_, addr := peerAddr(peer, config.Port)
+		t, err := res.transferFrom(addr, config)
+		if err != nil {
+			logging.Error.Println("can't warm up from peer " + peer + ": " + err.Error())
+			continue
+		}
+
+		res.rsLock.Lock()
+		if res.serial != 0 {
+			// the masters answered first
+			res.rsLock.Unlock()
+			return false
+		}
+		res.base = t
+		res.warm = true
+		res.publish()
+		res.rsLock.Unlock()
+
+		logging.Verbose.Println("warmed up from peer " + peer + " with " + strconv.Itoa(len(t.As)) + " names")
+		return true
+	}
+	return false
+}
+
+// transferFrom reads our zone from the mesos-dns at addr with AXFR,
+// signed with our first TSIG key if we have any
+func (res *Resolver) transferFrom(addr string, config records.Config) (records.RecordGenerator, error) {
+	t := records.RecordGenerator{}
+	t.InsertState(records.StateJSON{}, config)
+
+	m := new(dns.Msg)
+	m.SetAxfr(res.zone())
+
+	timeout := 5 * time.Second
+	if config.Timeout != 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+	tr := &dns.Transfer{DialTimeout: timeout, ReadTimeout: timeout, TsigSecret: config.TSIGKeys}
+	if len(config.TSIGKeys) > 0 {
+		var names []string
+		for name := range config.TSIGKeys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		m.SetTsig(names[0], dns.HmacSHA256, 300, time.Now().Unix())
+	}
+
+	env, err := tr.In(m, addr)
+	if err != nil {
+		return t, err
+	}
+
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			return t, e.Error
+		}
+		rrs = append(rrs, e.RR...)
+	}
+	if len(rrs) == 0 {
+		return t, errors.New("empty transfer")
+	}
+	restoreRecords(&t, rrs, config)
+	return t, nil
+}
+
+// restoreRecords adds the records rrs of a zone transfer or a snapshot
+// to t, with the SRV weights, TTLs and slave locations they carry - the
+// SOA and NS records are our own, DNAME and CAA records come from the
+// config and the TTLs are left alone with TTLDecay, they have aged
+func restoreRecords(t *records.RecordGenerator, rrs []dns.RR, config records.Config) {
+	locs := make(map[string][]records.Location)
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header().Name)
+
+		switch rr := rr.(type) {
+		case *dns.A:
+			t.Insert(name, rr.A.String(), "A")
+		case *dns.SRV:
+			target := strings.TrimSuffix(strings.ToLower(rr.Target), ".")
+			host := target + ":" + strconv.Itoa(int(rr.Port))
+			if !hasHost(t.SRVs[name], host) {
+				t.Insert(name, host, "SRV")
+			}
+			if rr.Priority != 0 || rr.Weight != 0 {
+				t.SetSRVWeight(name, host, rr.Priority, rr.Weight)
+			}
+		case *dns.TXT:
+			t.Insert(name, strings.Join(rr.Txt, ""), "TXT")
+		case *dns.CNAME:
+			t.Insert(name, strings.ToLower(rr.Target), "CNAME")
+		case *dns.TLSA:
+			t.Insert(name, fmt.Sprintf("%d %d %d %s", rr.Usage, rr.Selector, rr.MatchingType, rr.Certificate), "TLSA")
+		case *dns.SSHFP:
+			t.Insert(name, fmt.Sprintf("%d %d %s", rr.Algorithm, rr.Type, rr.FingerPrint), "SSHFP")
+		case *dns.URI:
+			t.Insert(name, rr.Target, "URI")
+		case *dns.LOC:
+			locs[name] = append(locs[name], locationOf(rr))
+		default:
+			continue
+		}
+
+		ttl := int(rr.Header().Ttl)
+		if _, ok := config.TTLOverrides[name]; !ok && !config.TTLDecay && ttl != config.TTL {
+			t.SetTTL(name, ttl)
+		}
+	}
+
+	// a slave is at a location every name pointing at it has
+	names := make(map[string][]string)
+	for name, hosts := range t.As {
+		for _, host := range hosts {
+			names[host] = append(names[host], name)
+		}
+	}
+	for host, hostNames := range names {
+		sort.Strings(hostNames)
+		for _, loc := range locs[hostNames[0]] {
+			everywhere := true
+			for _, name := range hostNames[1:] {
+				everywhere = everywhere && hasLocation(locs[name], loc)
+			}
+			if everywhere {
+				t.SetLocation(host, loc)
+				break
+			}
+		}
+	}
+}
+
+// hasHost reports whether host is one of hosts
+func hasHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLocation reports whether loc is one of locs
+func hasLocation(locs []records.Location, loc records.Location) bool {
+	for _, l := range locs {
+		if l == loc {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mesosphere/mesos-dns/records"
+)
+
+func TestWarmup(t *testing.T) {
+	peer, err := fakeDNS(8053)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer.Config.AXFRAllow = []string{"127.0.0.0/8"}
+	peer.bumpSerial()
+
+	addr, stop := fakeXfrServer(t, peer)
+	defer stop()
+
+	config := records.Config{Domain: "mesos", TTL: 60, Timeout: 1, Peers: []string{"127.0.0.2:1", addr}}
+	res := New(config)
+	if res.Warmup() {
+		t.Fatal("expected no warmup unless warmupfrompeers is set")
+	}
+
+	config.WarmupFromPeers = true
+	res = New(config)
+	if !res.Warmup() {
+		t.Fatal("expected to warm up from the second peer")
+	}
+	if !res.warm || res.serial == 0 {
+		t.Error("expected the records of the peer to be published")
+	}
+
+	for _, name := range []string{"chronos.marathon-0.6.0.mesos.", "_liquor-store._tcp.marathon-0.6.0.mesos."} {
+		want := append(peer.rs.As[name], peer.rs.SRVs[name]...)
+		got := append(res.rs.As[name], res.rs.SRVs[name]...)
+		if len(want) == 0 || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v from the peer, got %v", name, want, got)
+		}
+	}
+
+	// the masters replace them
+	res.Reload()
+	if res.warm || len(res.rs.As["chronos.marathon-0.6.0.mesos."]) != 0 {
+		t.Error("expected the reload to replace the records of the peer")
+	}
+}
@@ -0,0 +1,322 @@
+package resolver
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/miekg/dns"
+)
+
+// delta holds the records removed and added by a reload that moved the
+// SOA serial from `from` to `to`, for IXFR
+type delta struct {
+	from    uint32
+	to      uint32
+	removed []dns.RR
+	added   []dns.RR
+}
+
+// appendDelta adds d to journal, dropping the oldest changes beyond max
+func appendDelta(journal []delta, d delta, max int) []delta {
+	journal = append(journal, d)
+	if len(journal) > max {
+		journal = append([]delta(nil), journal[len(journal)-max:]...)
+	}
+	return journal
+}
+
+// journalSince returns the changes of journal from serial to to, nil if
+// they are not all there
+func journalSince(journal []delta, serial uint32, to uint32) []delta {
+	for i, d := range journal {
+		if d.from == serial {
+			if journal[len(journal)-1].to != to {
+				return nil
+			}
+			return journal[i:]
+		}
+	}
+	return nil
+}
+
+// sortedNames returns the names of set in order
+func sortedNames(set map[string][]string) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// zoneRecords returns every record served from rs, without the SOA
+func (res *Resolver) zoneRecords(rs *records.RecordGenerator) []dns.RR {
+	config := res.config()
+	var rrs []dns.RR
+
+	// with the TTLs of rs, which need not be the served records
+	add := func(rr dns.RR, name string) {
+		rr.Header().Ttl = res.ttl(rs, name)
+		rrs = append(rrs, rr)
+	}
+
+	for _, name := range sortedNames(rs.As) {
+		for _, host := range rs.As[name] {
+			rr, err := res.formatA(name, host)
+			if err != nil {
+				logging.Error.Println(err)
+				continue
+			}
+			add(rr, name)
+		}
+		rrs = append(rrs, res.locRecords(rs, name, name)...)
+	}
+
+	for _, name := range sortedNames(rs.SRVs) {
+		for _, host := range rs.SRVs[name] {
+			rr, err := res.formatSRV(name, host)
+			if err != nil {
+				logging.Error.Println(err)
+				continue
+			}
+			rr.Priority, rr.Weight = rs.SRVWeight(name, host)
+			add(rr, name)
+		}
+	}
+
+	for _, name := range sortedNames(rs.TXTs) {
+		for _, txt := range rs.TXTs[name] {
+			rr, err := res.formatTXT(name, txt)
+			if err != nil {
+				logging.Error.Println(err)
+				continue
+			}
+			add(rr, name)
+		}
+	}
+
+	for _, name := range sortedNames(rs.CNAMEs) {
+		for _, target := range rs.CNAMEs[name] {
+			add(res.formatCNAME(name, target), name)
+		}
+	}
+
+	for _, name := range sortedNames(rs.TLSAs) {
+		for _, value := range rs.TLSAs[name] {
+			rr, err := res.formatTLSA(name, value)
+			if err != nil {
+				logging.Error.Println(err)
+				continue
+			}
+			add(rr, name)
+		}
+	}
+
+	for _, name := range sortedNames(rs.SSHFPs) {
+		for _, value := range rs.SSHFPs[name] {
+			rr, err := res.formatSSHFP(name, value)
+			if err != nil {
+				logging.Error.Println(err)
+				continue
+			}
+			add(rr, name)
+		}
+	}
+
+	for _, name := range sortedNames(rs.URIs) {
+		for _, target := range rs.URIs[name] {
+			add(res.formatURI(name, target), name)
+		}
+	}
+
+	dnames := make([]string, 0, len(config.DNAMEs))
+	for name := range config.DNAMEs {
+		dnames = append(dnames, name)
+	}
+	sort.Strings(dnames)
+	for _, name := range dnames {
+		rrs = append(rrs, res.formatDNAME(name, config.DNAMEs[name]))
+	}
+
+	for _, name := range sortedNames(config.CAA) {
+		rrs = append(rrs, res.caaRecords(name, name)...)
+	}
+
+	return rrs
+}
+
+// diffRecords returns the records only in old and the ones only in cur
+func diffRecords(old []dns.RR, cur []dns.RR) (removed []dns.RR, added []dns.RR) {
+	in := func(rrs []dns.RR) map[string]bool {
+		set := make(map[string]bool, len(rrs))
+		for _, rr := range rrs {
+			set[rr.String()] = true
+		}
+		return set
+	}
+
+	oldSet, curSet := in(old), in(cur)
+	for _, rr := range old {
+		if !curSet[rr.String()] {
+			removed = append(removed, rr)
+		}
+	}
+	for _, rr := range cur {
+		if !oldSet[rr.String()] {
+			added = append(added, rr)
+		}
+	}
+
+	return removed, added
+}
+
+// transferAllowed reports whether the client that sent r over w may
+// transfer the zone - its address has to be in AXFRAllow (if set) and
+// the request has to carry a valid TSIG (if keys are configured)
+func (res *Resolver) transferAllowed(w dns.ResponseWriter, r *dns.Msg) bool {
+	config := res.config()
+	if len(config.AXFRAllow) == 0 && len(config.TSIGKeys) == 0 {
+		return false
+	}
+
+	if len(config.AXFRAllow) > 0 && !inNetworks(remoteIP(w), config.AXFRAllow) {
+		return false
+	}
+
+	if len(config.TSIGKeys) > 0 {
+		return r.IsTsig() != nil && w.TsigStatus() == nil
+	}
+
+	return true
+}
+
+// transfer answers AXFR and IXFR requests for the mesos domain
+// IXFR from a serial still in the journal gets the changes since, anything
+// else gets the full zone
+func (res *Resolver) transfer(w dns.ResponseWriter, r *dns.Msg) {
+	if !res.transferAllowed(w, r) {
+		logging.CurLog.TransfersRefused += 1
+		logging.Error.Println("refused zone transfer to " + w.RemoteAddr().String())
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		res.reply(w, r, m)
+		return
+	}
+
+	res.rsLock.RLock()
+	soa, _ := res.formatSOA(res.zone())
+	var rrs []dns.RR
+
+	var clientSerial uint32
+	ixfr := r.Question[0].Qtype == dns.TypeIXFR
+	if ixfr && len(r.Ns) > 0 {
+		if s, ok := r.Ns[0].(*dns.SOA); ok {
+			clientSerial = s.Serial
+		}
+	}
+
+	ds := journalSince(res.journal, clientSerial, soa.Serial)
+	switch {
+	case ixfr && clientSerial == soa.Serial:
+		// up to date - just the SOA
+		rrs = []dns.RR{soa}
+	case ixfr && len(ds) > 0:
+		// every change is the SOA it starts from, the removed records,
+		// the SOA it ends at and the added records
+		serial := func(n uint32) dns.RR {
+			rr := dns.Copy(soa).(*dns.SOA)
+			rr.Serial = n
+			return rr
+		}
+
+		rrs = append(rrs, soa)
+		for _, d := range ds {
+			rrs = append(rrs, serial(d.from))
+			rrs = append(rrs, d.removed...)
+			rrs = append(rrs, serial(d.to))
+			rrs = append(rrs, d.added...)
+		}
+		rrs = append(rrs, soa)
+	default:
+		rrs = append(rrs, soa)
+		rrs = append(rrs, res.nsRecords()...)
+		rrs = append(rrs, res.zoneRecords(&res.rs)...)
+		rrs = append(rrs, soa)
+	}
+	res.rsLock.RUnlock()
+
+	res.sendTransfer(w, r, rrs, soa)
+}
+
+// sendTransfer sends the transfer rrs, which start and end with soa, in
+// answer to r
+func (res *Resolver) sendTransfer(w dns.ResponseWriter, r *dns.Msg, rrs []dns.RR, soa *dns.SOA) {
+	_, udp := w.RemoteAddr().(*net.UDPAddr)
+
+	// AXFR is TCP only (RFC 5936, section 4.2)
+	if udp && r.Question[0].Qtype == dns.TypeAXFR {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNotImplemented)
+		res.reply(w, r, m)
+		return
+	}
+
+	logging.CurLog.Transfers += 1
+
+	// IXFR over UDP only gets an answer if it fits, otherwise the SOA
+	// tells the client to come back over TCP
+	if udp {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		m.Answer = rrs
+		if opt := r.IsEdns0(); opt != nil {
+			m.SetEdns0(dns.DefaultMsgSize, opt.Do())
+		}
+		if m.Len() > maxSize(w, r) {
+			m.Answer = []dns.RR{soa}
+		}
+
+		// the TSIG has to be the last record, the server signs it
+		if tsig := r.IsTsig(); tsig != nil {
+			m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+		}
+
+		if err := w.WriteMsg(m); err != nil {
+			logging.Error.Println(err)
+		}
+		return
+	}
+
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := tr.Out(w, r, ch); err != nil {
+			logging.Error.Println(err)
+			// drain so the sender doesn't block
+			for _ = range ch {
+			}
+		}
+	}()
+
+	// a few hundred records per message keeps each one well under 64k
+	for len(rrs) > 0 {
+		n := 200
+		if n > len(rrs) {
+			n = len(rrs)
+		}
+		ch <- &dns.Envelope{RR: rrs[:n]}
+		rrs = rrs[n:]
+	}
+	close(ch)
+	wg.Wait()
+}
@@ -0,0 +1,215 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// fakeXfrServer serves res over TCP on a random local port
+func fakeXfrServer(t *testing.T, res *Resolver) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &dns.Server{
+		Listener:   l,
+		Handler:    dns.HandlerFunc(res.HandleMesos),
+		TsigSecret: res.Config.TSIGKeys,
+	}
+	go server.ActivateAndServe()
+
+	return l.Addr().String(), func() { server.Shutdown() }
+}
+
+func transferIn(t *testing.T, m *dns.Msg, addr string, secrets map[string]string) ([]dns.RR, error) {
+	tr := &dns.Transfer{TsigSecret: secrets}
+	env, err := tr.In(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			return rrs, e.Error
+		}
+		rrs = append(rrs, e.RR...)
+	}
+	return rrs, nil
+}
+
+func TestAXFR(t *testing.T) {
+	res, err := fakeDNS(8056)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Config.AXFRAllow = []string{"127.0.0.0/8"}
+	res.bumpSerial()
+
+	addr, stop := fakeXfrServer(t, res)
+	defer stop()
+
+	m := new(dns.Msg)
+	m.SetAxfr("mesos.")
+	rrs, err := transferIn(t, m, addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rrs) < 3 {
+		t.Fatal("not transferring records")
+	}
+
+	if _, ok := rrs[0].(*dns.SOA); !ok {
+		t.Error("transfer should start with the SOA")
+	}
+	if _, ok := rrs[len(rrs)-1].(*dns.SOA); !ok {
+		t.Error("transfer should end with the SOA")
+	}
+
+	// not over UDP
+	w := &fakeWriter{}
+	res.HandleMesos(w, m)
+	if w.msg.Rcode != dns.RcodeNotImplemented || len(w.msg.Answer) != 0 {
+		t.Errorf("expected NOTIMP for AXFR over UDP, got %v", w.msg)
+	}
+
+	// not an allowed network
+	res.Config.AXFRAllow = []string{"10.0.0.0/8"}
+	if _, err := transferIn(t, m, addr, nil); err == nil {
+		t.Error("should refuse transfers from other networks")
+	}
+}
+
+func TestAXFRTsig(t *testing.T) {
+	res, err := fakeDNS(8057)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Config.TSIGKeys = map[string]string{"axfr.": "c2VjcmV0LXNlY3JldC1zZWNyZXQ="}
+	res.bumpSerial()
+
+	addr, stop := fakeXfrServer(t, res)
+	defer stop()
+
+	m := new(dns.Msg)
+	m.SetAxfr("mesos.")
+	if _, err := transferIn(t, m, addr, nil); err == nil {
+		t.Error("should refuse unsigned transfers")
+	}
+
+	m = new(dns.Msg)
+	m.SetAxfr("mesos.")
+	m.SetTsig("axfr.", dns.HmacSHA256, 300, 0)
+	rrs, err := transferIn(t, m, addr, res.Config.TSIGKeys)
+	if err != nil || len(rrs) < 3 {
+		t.Error("should transfer with a valid TSIG", err)
+	}
+}
+
+func TestIXFR(t *testing.T) {
+	res, err := fakeDNS(8058)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Config.AXFRAllow = []string{"127.0.0.0/8"}
+	res.bumpSerial()
+	from := res.serial
+	res.bumpSerial()
+
+	added, _ := res.formatTXT("new.mesos.", "hello")
+	res.journal = []delta{{from: from, to: res.serial, added: []dns.RR{added}}}
+	middle := res.serial
+	res.bumpSerial()
+
+	removed, _ := res.formatTXT("old.mesos.", "bye")
+	res.journal = append(res.journal, delta{from: middle, to: res.serial, removed: []dns.RR{removed}})
+
+	addr, stop := fakeXfrServer(t, res)
+	defer stop()
+
+	m := new(dns.Msg)
+	m.SetIxfr("mesos.", middle, "mesos-dns.mesos.", "root.mesos-dns.mesos.")
+	rrs, err := transferIn(t, m, addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// soa(new), soa(middle), removed, soa(new), soa(new)
+	if len(rrs) != 5 || rrs[2].String() != removed.String() {
+		t.Error("not sending the last change", rrs)
+	}
+
+	// every change since the client's serial
+	m.SetIxfr("mesos.", from, "mesos-dns.mesos.", "root.mesos-dns.mesos.")
+	rrs, err = transferIn(t, m, addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// soa(new), soa(old), soa(middle), added, soa(middle), removed,
+	// soa(new), soa(new)
+	if len(rrs) != 8 || rrs[3].String() != added.String() || rrs[5].String() != removed.String() {
+		t.Error("not sending the journal", rrs)
+	}
+	if rrs[2].(*dns.SOA).Serial != middle {
+		t.Error("changes should end at their serial", rrs[2])
+	}
+
+	// a serial the journal doesn't go back to gets the full zone
+	m.SetIxfr("mesos.", from-1, "mesos-dns.mesos.", "root.mesos-dns.mesos.")
+	rrs, err = transferIn(t, m, addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rr := range rrs {
+		if rr.String() == removed.String() {
+			t.Error("sending a change instead of the zone", rrs)
+		}
+	}
+	if len(rrs) < 3 {
+		t.Error("not sending the zone", rrs)
+	}
+}
+
+func TestAppendDelta(t *testing.T) {
+	var journal []delta
+	for i := uint32(1); i <= 5; i++ {
+		journal = appendDelta(journal, delta{from: i, to: i + 1}, 3)
+	}
+
+	if len(journal) != 3 || journal[0].from != 3 {
+		t.Error("should keep the last 3 changes", journal)
+	}
+	if ds := journalSince(journal, 4, 6); len(ds) != 2 {
+		t.Error("expected the changes from 4 to 6", ds)
+	}
+	if ds := journalSince(journal, 2, 6); ds != nil {
+		t.Error("2 is no longer in the journal", ds)
+	}
+	if ds := journalSince(journal, 4, 7); ds != nil {
+		t.Error("the journal doesn't reach 7", ds)
+	}
+	if journal = appendDelta(journal, delta{from: 6, to: 7}, 0); len(journal) != 0 {
+		t.Error("should keep no changes", journal)
+	}
+}
+
+func TestDiffRecords(t *testing.T) {
+	var res Resolver
+
+	a, _ := res.formatTXT("a.mesos.", "a")
+	b, _ := res.formatTXT("b.mesos.", "b")
+	c, _ := res.formatTXT("c.mesos.", "c")
+
+	removed, added := diffRecords([]dns.RR{a, b}, []dns.RR{b, c})
+	if len(removed) != 1 || removed[0] != a {
+		t.Error("wrong removed records", removed)
+	}
+	if len(added) != 1 || added[0] != c {
+		t.Error("wrong added records", added)
+	}
+}
@@ -0,0 +1,43 @@
+package resolver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// writeZone writes the records served for the mesos domain to w as an RFC
+// 1035 zone file, the records a zone transfer carries
+func (res *Resolver) writeZone(w io.Writer) error {
+	res.rsLock.RLock()
+	defer res.rsLock.RUnlock()
+
+	soa, _ := res.formatSOA(res.zone())
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; %s serial %d, exported by mesos-dns\n", res.zone(), soa.Serial)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", res.zone())
+	fmt.Fprintln(bw, soa.String())
+	for _, rr := range res.nsRecords() {
+		fmt.Fprintln(bw, rr.String())
+	}
+	for _, rr := range res.zoneRecords(&res.rs) {
+		fmt.Fprintln(bw, rr.String())
+	}
+	return bw.Flush()
+}
+
+// handleZone returns the records being served as a zone file
+func (res *Resolver) handleZone(w http.ResponseWriter, r *http.Request) {
+	if !only("GET", w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/dns")
+	if err := res.writeZone(w); err != nil {
+		logging.Error.Println(err)
+	}
+}
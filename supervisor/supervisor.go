@@ -0,0 +1,148 @@
+// package supervisor runs the long running parts of mesos-dns and
+// restarts them when they fail
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// Policy decides whether and when a component that stopped is started
+// again
+type Policy struct {
+	// Restart is always, on-failure or never
+	Restart string
+
+	// the wait before a restart starts at MinBackoff and doubles after
+	// every failure in a row up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// MaxFailures is how many failures in a row make the supervisor give
+	// up and shut everything down, 0 for no limit
+	MaxFailures int
+}
+
+// Component is a long running part of mesos-dns, Run returns when ctx
+// is done or it fails
+type Component struct {
+	Name   string
+	Run    func(ctx context.Context) error
+	Policy Policy
+}
+
+// Supervisor runs components, restarts them as their policies say and
+// shuts all of them down together
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// New returns a supervisor with no components
+func New() *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Supervisor{ctx: ctx, cancel: cancel}
+}
+
+// Go starts c
+func (s *Supervisor) Go(c Component) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervise(c)
+	}()
+}
+
+// Shutdown stops every component
+func (s *Supervisor) Shutdown() {
+	s.cancel()
+}
+
+// Wait returns once every component stopped after a shutdown, with the
+// failure that made the supervisor give up, if any
+func (s *Supervisor) Wait() error {
+	<-s.ctx.Done()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// fail shuts everything down because of err
+func (s *Supervisor) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+
+	s.cancel()
+}
+
+// supervise runs c until the shutdown or until its policy gives up
+func (s *Supervisor) supervise(c Component) {
+	backoff := c.Policy.MinBackoff
+	failures := 0
+
+	for {
+		start := time.Now()
+		err := run(s.ctx, c)
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		// a component that ran for a while has recovered
+		if time.Since(start) > c.Policy.MaxBackoff {
+			backoff, failures = c.Policy.MinBackoff, 0
+		}
+
+		if err == nil {
+			logging.Verbose.Println(c.Name + " stopped")
+			if c.Policy.Restart != "always" {
+				return
+			}
+		} else {
+			logging.CurLog.ComponentFailures += 1
+			logging.Error.Println(c.Name + " failed: " + err.Error())
+
+			failures++
+			if c.Policy.Restart == "never" || (c.Policy.MaxFailures > 0 && failures >= c.Policy.MaxFailures) {
+				s.fail(fmt.Errorf("%s failed %d times in a row: %s", c.Name, failures, err))
+				return
+			}
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		logging.CurLog.ComponentRestarts += 1
+		logging.Error.Println("restarting " + c.Name)
+
+		if backoff *= 2; backoff > c.Policy.MaxBackoff {
+			backoff = c.Policy.MaxBackoff
+		}
+	}
+}
+
+// run runs c once, turning a panic into its error
+func run(ctx context.Context, c Component) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = errors.New(fmt.Sprint("panic: ", rec))
+		}
+	}()
+	return c.Run(ctx)
+}
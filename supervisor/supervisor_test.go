@@ -0,0 +1,118 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+func init() {
+	logging.VerboseFlag = false
+	logging.SetupLogs()
+}
+
+var fast = Policy{Restart: "on-failure", MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+func TestRestart(t *testing.T) {
+	s := New()
+
+	var runs int32
+	started := make(chan struct{})
+	s.Go(Component{
+		Name: "flaky",
+		Run: func(ctx context.Context) error {
+			switch atomic.AddInt32(&runs, 1) {
+			case 1:
+				return errors.New("failed")
+			case 2:
+				panic("panicked")
+			}
+			close(started)
+			<-ctx.Done()
+			return nil
+		},
+		Policy: fast,
+	})
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("expected the component to be restarted after failing and panicking")
+	}
+
+	s.Shutdown()
+	if err := s.Wait(); err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+	if runs != 3 {
+		t.Errorf("expected 3 runs, got %d", runs)
+	}
+}
+
+func TestGiveUp(t *testing.T) {
+	s := New()
+
+	stopped := make(chan struct{})
+	s.Go(Component{
+		Name: "healthy",
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			close(stopped)
+			return nil
+		},
+		Policy: fast,
+	})
+
+	policy := fast
+	policy.MaxFailures = 3
+	var runs int32
+	s.Go(Component{
+		Name: "broken",
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return errors.New("can't bind")
+		},
+		Policy: policy,
+	})
+
+	if err := s.Wait(); err == nil || err.Error() != "broken failed 3 times in a row: can't bind" {
+		t.Errorf("expected to give up on broken, got %v", err)
+	}
+	if runs != 3 {
+		t.Errorf("expected 3 runs, got %d", runs)
+	}
+
+	select {
+	case <-stopped:
+	default:
+		t.Error("expected the other components to be shut down")
+	}
+}
+
+func TestStopped(t *testing.T) {
+	s := New()
+
+	var runs int32
+	done := make(chan struct{})
+	s.Go(Component{
+		Name: "once",
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			close(done)
+			return nil
+		},
+		Policy: Policy{Restart: "on-failure"},
+	})
+
+	<-done
+	time.Sleep(10 * time.Millisecond)
+	s.Shutdown()
+	s.Wait()
+	if runs != 1 {
+		t.Errorf("expected a component that stopped cleanly to stay stopped, got %d runs", runs)
+	}
+}
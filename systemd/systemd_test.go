@@ -0,0 +1,91 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Unsetenv("NOTIFY_SOCKET")
+	if Enabled() || Notify("READY=1") != nil {
+		t.Error("should do nothing outside of systemd")
+	}
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	if !Enabled() {
+		t.Error("should notify systemd")
+	}
+	if err := Notify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "READY=1" {
+		t.Errorf("expected READY=1, got %q", b[:n])
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	var tests = []struct {
+		usec, pid string
+		interval  time.Duration
+	}{
+		{"", "", 0},
+		{"30000000", "", 30 * time.Second},
+		{"30000000", strconv.Itoa(os.Getpid()), 30 * time.Second},
+		{"30000000", "1", 0},
+		{"-1", "", 0},
+	}
+
+	for _, tt := range tests {
+		os.Setenv("WATCHDOG_USEC", tt.usec)
+		os.Setenv("WATCHDOG_PID", tt.pid)
+		if interval := WatchdogInterval(); interval != tt.interval {
+			t.Errorf("%s for pid %q: expected %s, got %s", tt.usec, tt.pid, tt.interval, interval)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	// sockets for another process
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "2")
+	if files := Files(); files != nil {
+		t.Error("should ignore sockets passed to another process", files)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("should not pass the sockets on")
+	}
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	if files := Files(); files != nil {
+		t.Error("no sockets were passed", files)
+	}
+}
@@ -0,0 +1,259 @@
+// package tracing records spans of the work mesos-dns does and exports
+// them to a zipkin compatible collector, e.g. zipkin, jaeger or an
+// opentelemetry collector
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+// service is how mesos-dns shows up in traces
+const service = "mesos-dns"
+
+var (
+	lock     sync.RWMutex
+	exporter *collector
+	sample   float64
+)
+
+// Span is a timed piece of work, nil spans are not recorded so callers
+// don't have to check whether tracing is on
+type Span struct {
+	TraceID  string
+	ID       string
+	ParentID string
+	Name     string
+	Start    time.Time
+	Tags     map[string]string
+
+	exporter *collector
+}
+
+// Setup exports spans to the zipkin v2 api at endpoint, e.g.
+// http://zipkin:9411/api/v2/spans, and traces rate (0 to 1) of the
+// sampled work - tracing is off if endpoint is empty
+func Setup(endpoint string, rate float64) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if exporter != nil {
+		exporter.stop()
+		exporter = nil
+	}
+	sample = rate
+
+	if endpoint != "" {
+		exporter = newCollector(endpoint, time.Second)
+		go exporter.run()
+	}
+}
+
+func current() (*collector, float64) {
+	lock.RLock()
+	defer lock.RUnlock()
+	return exporter, sample
+}
+
+// StartTrace starts a new trace, unless tracing is off
+func StartTrace(name string) *Span {
+	c, _ := current()
+	if c == nil {
+		return nil
+	}
+	return newSpan(c, name, newID(16), "")
+}
+
+// StartSampledTrace starts a new trace for the sampled share of calls
+func StartSampledTrace(name string) *Span {
+	c, rate := current()
+	if c == nil || mrand.Float64() >= rate {
+		return nil
+	}
+	return newSpan(c, name, newID(16), "")
+}
+
+// StartSpan starts a child of parent, if parent is traced
+func StartSpan(name string, parent *Span) *Span {
+	if parent == nil {
+		return nil
+	}
+	return newSpan(parent.exporter, name, parent.TraceID, parent.ID)
+}
+
+// FromTraceparent continues the trace of a w3c traceparent header, or
+// starts a new one if there is no valid header
+func FromTraceparent(header string, name string) *Span {
+	c, _ := current()
+	if c == nil {
+		return nil
+	}
+
+	// version-traceid-parentid-flags
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || !isHex(parts[1]) || !isHex(parts[2]) {
+		return newSpan(c, name, newID(16), "")
+	}
+	return newSpan(c, name, parts[1], parts[2])
+}
+
+func newSpan(c *collector, name string, trace string, parent string) *Span {
+	return &Span{
+		TraceID:  trace,
+		ID:       newID(8),
+		ParentID: parent,
+		Name:     name,
+		Start:    time.Now(),
+		Tags:     make(map[string]string),
+		exporter: c,
+	}
+}
+
+// Traceparent returns the w3c traceparent header of s, to pass the
+// trace on
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.TraceID + "-" + s.ID + "-01"
+}
+
+// Tag annotates s
+func (s *Span) Tag(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.Tags[key] = value
+}
+
+// Finish ends s and queues it for export
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.exporter.add(zipkinSpan{
+		TraceID:   s.TraceID,
+		ID:        s.ID,
+		ParentID:  s.ParentID,
+		Name:      s.Name,
+		Timestamp: s.Start.UnixNano() / int64(time.Microsecond),
+		Duration:  int64(time.Since(s.Start) / time.Microsecond),
+		Local:     endpoint{ServiceName: service},
+		Tags:      s.Tags,
+	})
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		logging.Error.Println(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.Trim(s, "0") != ""
+}
+
+// zipkinSpan is a span in the zipkin v2 json format
+type zipkinSpan struct {
+	TraceID   string            `json:"traceId"`
+	ID        string            `json:"id"`
+	ParentID  string            `json:"parentId,omitempty"`
+	Name      string            `json:"name"`
+	Timestamp int64             `json:"timestamp"`
+	Duration  int64             `json:"duration"`
+	Local     endpoint          `json:"localEndpoint"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+type endpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// collector batches finished spans and posts them to endpoint
+type collector struct {
+	endpoint string
+	interval time.Duration
+	spans    chan zipkinSpan
+	done     chan struct{}
+}
+
+// maxQueued spans wait for export, we drop spans beyond that rather
+// than slow down answers
+const maxQueued = 1000
+
+func newCollector(endpoint string, interval time.Duration) *collector {
+	return &collector{
+		endpoint: endpoint,
+		interval: interval,
+		spans:    make(chan zipkinSpan, maxQueued),
+		done:     make(chan struct{}),
+	}
+}
+
+func (c *collector) add(s zipkinSpan) {
+	select {
+	case c.spans <- s:
+	default:
+		logging.VeryVerbose.Println("trace queue full, dropping span " + s.Name)
+	}
+}
+
+func (c *collector) stop() {
+	close(c.done)
+}
+
+func (c *collector) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	var batch []zipkinSpan
+	for {
+		select {
+		case s := <-c.spans:
+			batch = append(batch, s)
+			if len(batch) >= 100 {
+				c.post(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				c.post(batch)
+				batch = nil
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *collector) post(batch []zipkinSpan) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		logging.Error.Println(err)
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(c.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logging.Error.Println("exporting traces: " + err.Error())
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		logging.Error.Println("exporting traces: " + resp.Status)
+	}
+}
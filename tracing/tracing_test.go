@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/mesos-dns/logging"
+)
+
+func init() {
+	logging.VerboseFlag = false
+	logging.SetupLogs()
+}
+
+func TestOff(t *testing.T) {
+	Setup("", 1)
+
+	s := StartTrace("off")
+	if s != nil {
+		t.Error("should not trace without an endpoint")
+	}
+
+	// nil spans are fine to use
+	s.Tag("key", "value")
+	StartSpan("child", s).Finish()
+	s.Finish()
+}
+
+func TestExport(t *testing.T) {
+	spans := make(chan []zipkinSpan, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []zipkinSpan
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		spans <- batch
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	Setup(srv.URL, 0)
+	defer Setup("", 0)
+
+	if StartSampledTrace("unsampled") != nil {
+		t.Error("should not sample at rate 0")
+	}
+
+	root := StartTrace("reload")
+	child := StartSpan("fetch", root)
+	child.Tag("master", "10.0.0.1:5050")
+	child.Finish()
+	root.Finish()
+
+	var got []zipkinSpan
+	for len(got) < 2 {
+		select {
+		case batch := <-spans:
+			got = append(got, batch...)
+		case <-time.After(5 * time.Second):
+			t.Fatal("spans were not exported")
+		}
+	}
+
+	if got[0].Name != "fetch" || got[0].ParentID != root.ID || got[0].TraceID != root.TraceID {
+		t.Errorf("child span not linked to its parent: %+v", got[0])
+	}
+	if got[0].Tags["master"] != "10.0.0.1:5050" || got[0].Local.ServiceName != service {
+		t.Errorf("unexpected child span %+v", got[0])
+	}
+	if got[1].Name != "reload" || got[1].ParentID != "" {
+		t.Errorf("unexpected root span %+v", got[1])
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	Setup("http://127.0.0.1:1/api/v2/spans", 0)
+	defer Setup("", 0)
+
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	s := FromTraceparent(header, "http")
+	if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("should continue the trace, got %+v", s)
+	}
+	if p := s.Traceparent(); p != "00-4bf92f3577b34da6a3ce929d0e0e4736-"+s.ID+"-01" {
+		t.Errorf("unexpected traceparent %s", p)
+	}
+
+	for _, bad := range []string{"", "garbage", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"} {
+		if s := FromTraceparent(bad, "http"); s.ParentID != "" || len(s.TraceID) != 32 {
+			t.Errorf("%q: should start a new trace, got %+v", bad, s)
+		}
+	}
+}
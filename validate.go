@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mesosphere/mesos-dns/logging"
+	"github.com/mesosphere/mesos-dns/records"
+	"github.com/mesosphere/mesos-dns/resolver"
+)
+
+// validate runs the validate subcommand: it loads and checks the
+// configuration and, if asked to, fetches the state once and prints the
+// records it would serve, without binding any port
+func validate(args []string) {
+	cjson := ""
+	fetch := false
+
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mesos-dns validate [flags]")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cjson, "config", "config.json", "location of configuration file (json)")
+	fs.StringVar(&cjson, "j", "config.json", "shorthand for -config")
+	fs.BoolVar(&fetch, "fetch", false, "fetch the state from the masters and print the records that would be served")
+	fs.BoolVar(&logging.VerboseFlag, "v", false, "verbose logging")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	logging.SetupLogs()
+
+	// LoadConfig reports every problem it finds
+	config, err := records.LoadConfig(cjson)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if !fetch {
+		fmt.Fprintln(os.Stderr, "configuration is valid")
+		os.Exit(0)
+	}
+
+	if err := resolver.New(config).DryRun(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}